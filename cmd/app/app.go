@@ -0,0 +1,146 @@
+package main
+
+import (
+	"api/catshelter/internal/config"
+	"api/catshelter/internal/domain"
+	"api/catshelter/internal/mail"
+	"api/catshelter/internal/repository"
+	"api/catshelter/internal/service"
+	"log"
+	"log/slog"
+	"time"
+
+	"github.com/go-chi/jwtauth/v5"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// app holds the repositories and services shared by the server and the admin
+// commands, so both go through the same business rules.
+type app struct {
+	cfg *config.Config
+	db  *gorm.DB
+
+	tokenAuth *jwtauth.JWTAuth
+
+	roleRepository               repository.RoleRepository
+	permissionRepository         repository.PermissionRepository
+	userRepository               repository.UserRepository
+	refreshTokenRepository       repository.RefreshTokenRepository
+	catRepository                repository.CatRepository
+	securityEventRepository      repository.SecurityEventRepository
+	mfaRecoveryCodeRepository    repository.MfaRecoveryCodeRepository
+	passwordResetTokenRepository repository.PasswordResetTokenRepository
+	externalIdentityRepository   repository.ExternalIdentityRepository
+	apiKeyRepository             repository.ApiKeyRepository
+	auditLogRepository           repository.AuditLogRepository
+	avatarRepository             repository.AvatarRepository
+
+	contactService  service.ContactService
+	authService     service.AuthService
+	roleService     service.RoleService
+	tokenService    service.TokenService
+	userService     service.UserService
+	catService      service.CatService
+	passwordService service.PasswordService
+	mfaService      service.MfaService
+	apiKeyService   service.ApiKeyService
+	oidcService     service.OidcService
+	accountService  service.AccountService
+	profileService  service.ProfileService
+	auditService    service.AuditService
+}
+
+// openDatabase connects to Postgres, retrying with exponential backoff until
+// timeout, so the server can start before the database is up.
+func openDatabase(databaseUrl string, timeout time.Duration) *gorm.DB {
+	deadline := time.Now().Add(timeout)
+	delay := 500 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		// TranslateError turns unique violations into gorm.ErrDuplicatedKey,
+		// which repositories report as their own conflict errors.
+		db, err := gorm.Open(postgres.Open(databaseUrl), &gorm.Config{TranslateError: true})
+		if err == nil {
+			return db
+		}
+		if time.Now().Add(delay).After(deadline) {
+			log.Fatalf("Connection to DB failed after %d attempts: %v", attempt, err)
+		}
+
+		slog.Warn("connection to DB failed, retrying", "attempt", attempt, "retry_in", delay.String(), "error", err)
+		time.Sleep(delay)
+		delay = min(delay*2, 10*time.Second)
+	}
+}
+
+func newApp(cfg *config.Config) *app {
+	domain.SetPasswordHashCost(cfg.Auth.BcryptCost)
+	repository.SetPageSizes(cfg.Pagination.DefaultPageSize, cfg.Pagination.MaxPageSize)
+	db := openDatabase(cfg.Database.Url, cfg.Database.ConnectTimeout)
+
+	a := &app{cfg: cfg, db: db}
+	a.tokenAuth = jwtauth.New("HS256", []byte(cfg.Auth.Secret), nil)
+	mfaAuth := jwtauth.New("HS256", []byte(cfg.Auth.Secret+":mfa"), nil)
+	emailAuth := jwtauth.New("HS256", []byte(cfg.Auth.Secret+":email"), nil)
+	oidcAuth := jwtauth.New("HS256", []byte(cfg.Auth.Secret+":oidc"), nil)
+
+	a.roleRepository = repository.NewRoleRepositoryImpl(db)
+	a.permissionRepository = repository.NewPermissionRepositoryImpl(db)
+	a.userRepository = repository.NewUserReposioryImpl(db)
+	a.refreshTokenRepository = repository.NewRefreshTokenRepositoryImpl(db)
+	a.catRepository = repository.NewCatRepositoryImpl(db)
+	a.securityEventRepository = repository.NewSecurityEventRepositoryImpl(db)
+	loginAttemptRepository := newLoginAttemptRepository(cfg.Auth.LoginAttemptStore, db)
+	a.mfaRecoveryCodeRepository = repository.NewMfaRecoveryCodeRepositoryImpl(db)
+	a.passwordResetTokenRepository = repository.NewPasswordResetTokenRepositoryImpl(db)
+	a.externalIdentityRepository = repository.NewExternalIdentityRepositoryImpl(db)
+	a.apiKeyRepository = repository.NewApiKeyRepositoryImpl(db)
+	a.auditLogRepository = repository.NewAuditLogRepositoryImpl(db, []byte(cfg.Audit.Key))
+	a.avatarRepository = repository.NewAvatarRepositoryImpl(db)
+	transactor := repository.NewTransactor(db)
+
+	mailer, err := mail.NewMailer(mail.Config{
+		Driver:       cfg.Mail.Driver,
+		From:         cfg.Mail.From,
+		SmtpHost:     cfg.Mail.SmtpHost,
+		SmtpPort:     cfg.Mail.SmtpPort,
+		SmtpUsername: cfg.Mail.SmtpUsername,
+		SmtpPassword: cfg.Mail.SmtpPassword,
+		Dir:          cfg.Mail.Dir,
+	})
+	if err != nil {
+		log.Fatalf("Bad mail configuration: %v", err)
+	}
+
+	a.contactService = service.NewContactService(emailAuth, a.userRepository, mailer, cfg.Server.PublicUrl+"/api/user/verify-email")
+	a.authService = service.NewAuthService(a.userRepository, a.roleRepository, loginAttemptRepository, a.securityEventRepository, a.contactService)
+	a.roleService = service.NewRoleService(a.roleRepository, a.permissionRepository)
+	a.tokenService = service.NewTokenService(a.tokenAuth, a.refreshTokenRepository, a.userRepository, a.roleService, cfg.Auth.AccessTokenTTL, cfg.Auth.RefreshTokenTTL)
+	a.userService = service.NewUserService(a.userRepository, a.refreshTokenRepository, a.catRepository, a.roleRepository, transactor, a.auditLogRepository)
+	a.catService = service.NewCatService(a.catRepository, transactor, a.auditLogRepository)
+	a.passwordService = service.NewPasswordService(a.userRepository, a.refreshTokenRepository, a.apiKeyRepository, a.passwordResetTokenRepository, a.securityEventRepository, transactor, mailer, cfg.Server.PublicUrl+"/reset-password")
+	a.mfaService = service.NewMfaService(mfaAuth, a.userRepository, a.mfaRecoveryCodeRepository, a.refreshTokenRepository, a.apiKeyRepository, a.securityEventRepository, loginAttemptRepository)
+	a.apiKeyService = service.NewApiKeyService(a.apiKeyRepository, a.userRepository, a.roleRepository, a.securityEventRepository)
+	a.oidcService = service.NewOidcService(oidcAuth, a.userRepository, a.roleRepository, a.externalIdentityRepository, a.securityEventRepository, oidcProviders(cfg.Oidc.Providers), func(provider string) string {
+		return cfg.Server.PublicUrl + "/api/auth/oidc/" + provider + "/callback"
+	})
+	a.accountService = service.NewAccountService(a.userRepository, a.refreshTokenRepository, a.apiKeyRepository, a.externalIdentityRepository, a.mfaRecoveryCodeRepository, a.passwordResetTokenRepository, a.avatarRepository, a.securityEventRepository, a.auditLogRepository, transactor)
+	a.profileService = service.NewProfileService(a.userRepository, a.avatarRepository, a.contactService)
+	a.auditService = service.NewAuditService(a.auditLogRepository, []byte(cfg.Audit.Key))
+
+	return a
+}
+
+func oidcProviders(providers []config.OidcProvider) []service.OidcProviderConfig {
+	configs := make([]service.OidcProviderConfig, 0, len(providers))
+	for _, p := range providers {
+		configs = append(configs, service.OidcProviderConfig{
+			Name:         p.Name,
+			Issuer:       p.Issuer,
+			ClientId:     p.ClientId,
+			ClientSecret: p.ClientSecret,
+			Scopes:       p.Scopes,
+		})
+	}
+	return configs
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"api/catshelter/internal/domain"
+	"api/catshelter/internal/repository"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(args []string)
+}
+
+var commands map[string]command
+
+var commandList []command
+
+func init() {
+	commandList = []command{
+		{"serve", "[-addr :3000]", "run the HTTP server (default)", serve},
+		{"migrate", "up | down [steps] | status", "apply, revert or list schema migrations", runMigrate},
+		{"seed", "[-demo-cats n]", "create the default roles and permissions", seed},
+		{"create-admin", "-login l (-password p | -password-file f | -password-stdin)", "create a user with the admin role", createAdmin},
+		{"grant-role", "(-login l | -id id) -role r", "grant a role to a user", grantRole},
+		{"revoke-sessions", "(-login l | -id id) [-api-keys]", "sign a user out everywhere", revokeSessions},
+		{"config", "print [-format yaml|toml]", "show the effective configuration, secrets redacted", printConfig},
+		{"openapi", "print | check [-spec api/openapi.json]", "print the API document, or check it against the routes", runOpenapi},
+		{"help", "", "show this help", func([]string) { printUsage() }},
+	}
+	commands = make(map[string]command, len(commandList))
+	for _, c := range commandList {
+		commands[c.name] = c
+	}
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "usage: app <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "commands:")
+	for _, c := range commandList {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", c.name, c.summary)
+		if c.args != "" {
+			fmt.Fprintf(os.Stderr, "  %-16s   %s\n", "", c.args)
+		}
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Run 'app <command> -h' for the flags of a command. All commands take")
+	fmt.Fprintln(os.Stderr, "-config file and -set section.key=value and read the same configuration")
+	fmt.Fprintln(os.Stderr, "as the server.")
+}
+
+// seed creates the default roles and permissions, which the server also does
+// on startup, and optionally some adoptable cats for local development.
+func seed(args []string) {
+	flags := flag.NewFlagSet("seed", flag.ExitOnError)
+	demoCats := flags.Int("demo-cats", 0, "also add this many adoptable demo cats")
+	cfgFlags := addConfigFlags(flags)
+	flags.Parse(args)
+
+	a := newApp(cfgFlags.load())
+	ctx := context.Background()
+	if err := initRoles(ctx, a.roleRepository, a.permissionRepository); err != nil {
+		log.Fatalf("Bad init roles in DB: %v", err)
+	}
+
+	names := []string{"Barsik", "Murka", "Vaska", "Simba", "Luna", "Tom", "Pushok", "Ryzhik"}
+	for i := 0; i < *demoCats; i++ {
+		name := names[i%len(names)]
+		if i >= len(names) {
+			name = fmt.Sprintf("%s %d", name, i/len(names)+1)
+		}
+		if err := a.catService.AddCat(ctx, name, i%15+1); err != nil {
+			log.Fatalf("Adding demo cat failed: %v", err)
+		}
+	}
+	if *demoCats > 0 {
+		fmt.Printf("added %d demo cats\n", *demoCats)
+	}
+}
+
+// createAdmin bootstraps the first admin. With -if-not-exists an existing
+// user is kept as is and only granted the admin role, so the command can run
+// on every deploy.
+func createAdmin(args []string) {
+	flags := flag.NewFlagSet("create-admin", flag.ExitOnError)
+	login := flags.String("login", "", "login of the admin (required)")
+	name := flags.String("name", "", "display name")
+	email := flags.String("email", "", "email address")
+	phone := flags.String("phone", "", "phone number")
+	password := flags.String("password", "", "password; visible to other local users, prefer -password-file or -password-stdin")
+	passwordFile := flags.String("password-file", "", "read the password from this file")
+	passwordStdin := flags.Bool("password-stdin", false, "read the password from standard input")
+	ifNotExists := flags.Bool("if-not-exists", false, "succeed if the user already exists and make sure it is an admin")
+	cfgFlags := addConfigFlags(flags)
+	flags.Parse(args)
+
+	if *login == "" {
+		usageError(flags, "-login is required")
+	}
+	secret, err := readPassword(flags, *password, *passwordFile, *passwordStdin)
+	if err != nil {
+		log.Fatalf("Reading password failed: %v", err)
+	}
+
+	a := newApp(cfgFlags.load())
+	ctx := context.Background()
+	if err := initRoles(ctx, a.roleRepository, a.permissionRepository); err != nil {
+		log.Fatalf("Bad init roles in DB: %v", err)
+	}
+
+	user, err := a.userRepository.FindByLogin(ctx, *login)
+	switch {
+	case err == nil && !*ifNotExists:
+		log.Fatalf("User '%s' already exists", *login)
+	case err == nil:
+		fmt.Printf("user '%s' already exists\n", *login)
+	case errors.Is(err, repository.ErrUserNotFound):
+		user, err = a.authService.Register(ctx, *login, secret, *name, *email, *phone)
+		if err != nil {
+			log.Fatalf("Creating user failed: %v", err)
+		}
+		fmt.Printf("user '%s' created with id %s\n", user.Login, user.Id)
+	default:
+		log.Fatalf("DB error: %v", err)
+	}
+
+	grantRoleTo(ctx, a, user.Id, "admin")
+}
+
+func grantRole(args []string) {
+	flags := flag.NewFlagSet("grant-role", flag.ExitOnError)
+	login := flags.String("login", "", "login of the user")
+	id := flags.String("id", "", "id of the user")
+	role := flags.String("role", "", "name of the role (required)")
+	cfgFlags := addConfigFlags(flags)
+	flags.Parse(args)
+
+	if *role == "" {
+		usageError(flags, "-role is required")
+	}
+	requireOneUserFlag(flags, *login, *id)
+
+	a := newApp(cfgFlags.load())
+	ctx := context.Background()
+	user := findUserByFlags(ctx, a, *login, *id)
+	grantRoleTo(ctx, a, user.Id, *role)
+}
+
+// grantRoleTo grants roleName through UserService so the change is audited.
+// Granting a role the user already has is not an error.
+func grantRoleTo(ctx context.Context, a *app, userId, roleName string) {
+	user, err := a.userRepository.FindByIdWithRoles(ctx, userId)
+	if err != nil {
+		log.Fatalf("DB error: %v", err)
+	}
+	if slices.Contains(domain.RoleNames(user.Roles), roleName) {
+		fmt.Printf("user '%s' already has role '%s'\n", user.Login, roleName)
+		return
+	}
+
+	if err := a.userService.AddRole(ctx, userId, roleName); err != nil {
+		log.Fatalf("Granting role failed: %v", err)
+	}
+	fmt.Printf("role '%s' granted to user '%s'\n", roleName, user.Login)
+}
+
+// revokeSessions deletes every refresh token of a user. Access tokens already
+// issued stay valid until they expire, after auth.access_token_ttl at most.
+func revokeSessions(args []string) {
+	flags := flag.NewFlagSet("revoke-sessions", flag.ExitOnError)
+	login := flags.String("login", "", "login of the user")
+	id := flags.String("id", "", "id of the user")
+	apiKeys := flags.Bool("api-keys", false, "also revoke the user's API keys")
+	cfgFlags := addConfigFlags(flags)
+	flags.Parse(args)
+	requireOneUserFlag(flags, *login, *id)
+
+	a := newApp(cfgFlags.load())
+	ctx := context.Background()
+	user := findUserByFlags(ctx, a, *login, *id)
+
+	err := a.tokenService.DeleteAllRefreshTokens(ctx, user.Id)
+	if err != nil && !errors.Is(err, repository.ErrUserNotFound) {
+		log.Fatalf("Revoking sessions failed: %v", err)
+	}
+	fmt.Printf("sessions of user '%s' revoked\n", user.Login)
+
+	if *apiKeys {
+		if err := a.apiKeyRepository.RevokeByUserId(ctx, user.Id, time.Now()); err != nil {
+			log.Fatalf("Revoking API keys failed: %v", err)
+		}
+		fmt.Printf("API keys of user '%s' revoked\n", user.Login)
+	}
+}
+
+func requireOneUserFlag(flags *flag.FlagSet, login, id string) {
+	if (login == "") == (id == "") {
+		usageError(flags, "exactly one of -login and -id is required")
+	}
+}
+
+func findUserByFlags(ctx context.Context, a *app, login, id string) *domain.User {
+	var user *domain.User
+	var err error
+	if id != "" {
+		user, err = a.userRepository.FindById(ctx, id)
+	} else {
+		user, err = a.userRepository.FindByLogin(ctx, login)
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			log.Fatalf("User '%s%s' not found", login, id)
+		}
+		log.Fatalf("DB error: %v", err)
+	}
+	return user
+}
+
+// readPassword takes the password from exactly one of the password flags.
+func readPassword(flags *flag.FlagSet, password, file string, stdin bool) (string, error) {
+	given := 0
+	for _, set := range []bool{password != "", file != "", stdin} {
+		if set {
+			given++
+		}
+	}
+	if given != 1 {
+		usageError(flags, "exactly one of -password, -password-file and -password-stdin is required")
+	}
+
+	var content []byte
+	var err error
+	switch {
+	case password != "":
+		return password, nil
+	case file != "":
+		content, err = os.ReadFile(file)
+	default:
+		content, err = io.ReadAll(os.Stdin)
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+func usageError(flags *flag.FlagSet, message string) {
+	fmt.Fprintf(os.Stderr, "%s: %s\n", flags.Name(), message)
+	flags.Usage()
+	os.Exit(2)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"api/catshelter/internal/config"
+	"api/catshelter/internal/logging"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+
+	"github.com/joho/godotenv"
+)
+
+// configFlags are the flags every command has to choose its configuration.
+type configFlags struct {
+	file      string
+	overrides []string
+}
+
+func addConfigFlags(flags *flag.FlagSet) *configFlags {
+	f := &configFlags{}
+	flags.StringVar(&f.file, "config", "", "YAML or TOML config file, overrides CONFIG_FILE")
+	flags.Func("set", "override a setting as section.key=value, can be repeated", func(value string) error {
+		f.overrides = append(f.overrides, value)
+		return nil
+	})
+	return f
+}
+
+// load reads and validates the configuration and sets up logging with it.
+func (f *configFlags) load() *config.Config {
+	return f.loadWith((*config.Config).Validate)
+}
+
+// loadDatabase only requires the database settings, for commands that do not
+// run the application.
+func (f *configFlags) loadDatabase() *config.Config {
+	return f.loadWith(func(cfg *config.Config) error { return cfg.Database.Validate() })
+}
+
+func (f *configFlags) loadWith(validate func(*config.Config) error) *config.Config {
+	envErr := godotenv.Load()
+	cfg, err := config.Load(f.file, f.overrides)
+	if err == nil {
+		err = validate(cfg)
+	}
+	if err != nil {
+		log.Fatalf("Bad configuration:\n%v", err)
+	}
+
+	setupLogger(cfg.Log)
+	if envErr != nil {
+		slog.Info("no .env file, only environment variables are used")
+	}
+	return cfg
+}
+
+// printConfig implements `app config print`. Invalid settings are reported
+// after the configuration, which is printed anyway to help find them.
+func printConfig(args []string) {
+	if len(args) == 0 || args[0] != "print" {
+		fmt.Fprintln(os.Stderr, "usage: app config print [-format yaml|toml] [-config file] [-set key=value]")
+		os.Exit(2)
+	}
+	flags := flag.NewFlagSet("config print", flag.ExitOnError)
+	format := flags.String("format", "yaml", "output format, yaml or toml")
+	cfgFlags := addConfigFlags(flags)
+	flags.Parse(args[1:])
+
+	godotenv.Load()
+	cfg, err := config.Load(cfgFlags.file, cfgFlags.overrides)
+	if err != nil {
+		log.Fatalf("Bad configuration:\n%v", err)
+	}
+	if err := cfg.Write(os.Stdout, *format); err != nil {
+		usageError(flags, err.Error())
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Bad configuration:\n%v", err)
+	}
+}
+
+// setupLogger makes the configured slog logger the default, which also
+// receives the output of the log package.
+func setupLogger(cfg config.Log) {
+	logger, err := logging.New(os.Stderr, logging.Config{Level: cfg.Level, Format: cfg.Format})
+	if err != nil {
+		log.Fatalf("Bad logging configuration: %v", err)
+	}
+	slog.SetDefault(logger)
+	// What is still written through the log package are fatal errors.
+	slog.SetLogLoggerLevel(slog.LevelError)
+}
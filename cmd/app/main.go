@@ -1,165 +1,428 @@
 package main
 
 import (
+	"api/catshelter/internal/config"
 	"api/catshelter/internal/custom_middleware"
 	"api/catshelter/internal/domain"
 	"api/catshelter/internal/handler"
+	"api/catshelter/internal/handler/problem"
+	"api/catshelter/internal/metrics"
+	"api/catshelter/internal/openapi"
 	"api/catshelter/internal/repository"
 	"api/catshelter/internal/service"
+	"api/catshelter/internal/tracing"
 	"context"
 	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/httprate"
 	"github.com/go-chi/jwtauth/v5"
-	"github.com/joho/godotenv"
-	"gorm.io/driver/postgres"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"gorm.io/gorm"
 )
 
 func main() {
-	cfg := initEnv()
-	db, err := gorm.Open(postgres.Open(cfg.DatabaseUrl), &gorm.Config{})
-	if err != nil {
-		log.Fatalf("Connection to DB failed : %v", err)
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
 	}
 
-	tokenAuth := jwtauth.New("HS256", []byte(cfg.Secret), nil)
+	command, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command '%s'\n\n", name)
+		printUsage()
+		os.Exit(2)
+	}
+	command.run(args)
+}
 
-	migrateTables(db)
+func serve(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := flags.String("addr", "", "listen address, short for -set server.addr=")
+	cfgFlags := addConfigFlags(flags)
+	flags.Parse(args)
 
-	roleRepository := repository.NewRoleRepositoryImpl(db)
-	userRepository := repository.NewUserReposioryImpl(db)
-	refreshTokenRepository := repository.NewRefreshTokenRepositoryImpl(db)
-	catRepository := repository.NewCatRepositoryImpl(db)
+	if *addr != "" {
+		cfgFlags.overrides = append(cfgFlags.overrides, "server.addr="+*addr)
+	}
+	cfg := cfgFlags.load()
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{Exporter: cfg.Tracing.Exporter, ServiceName: cfg.Tracing.ServiceName})
+	if err != nil {
+		log.Fatalf("Bad tracing configuration: %v", err)
+	}
 
-	authService := service.NewAuthService(userRepository, roleRepository)
-	tokenService := service.NewTokenService(tokenAuth, refreshTokenRepository, userRepository)
-	userService := service.NewUserService(userRepository, catRepository, roleRepository)
-	catService := service.NewCatService(catRepository)
+	a := newApp(cfg)
 
-	authHandler := handler.NewAuthHandler(authService, tokenService)
-	userHandler := handler.NewUserHandler(userService)
-	catHandler := handler.NewCatHandler(&catService)
+	migrateDatabase(a.db)
+	if err := metrics.InstrumentDB(a.db); err != nil {
+		log.Fatalf("Instrumenting DB failed: %v", err)
+	}
+	if err := tracing.InstrumentDB(a.db); err != nil {
+		log.Fatalf("Instrumenting DB failed: %v", err)
+	}
 
-	err = initRoles(context.Background(), roleRepository)
+	err = initRoles(context.Background(), a.roleRepository, a.permissionRepository)
 	if err != nil {
 		log.Fatalf("Bad init roles in DB: %v", err)
 	}
 
+	problem.ExposeInternalErrors(cfg.Server.ExposeInternalErrors)
+
+	r := newRouter(a, cfg, handler.OpenAPI())
+	metricsServer := serveMetrics(r, cfg)
+
+	// Probes bypass the middleware so they are not logged, traced or
+	// counted on every poll.
+	sqlDB, err := a.db.DB()
+	if err != nil {
+		log.Fatalf("Connection to DB failed : %v", err)
+	}
+	healthHandler := handler.NewHealthHandler(sqlDB, newMigrator(a.db))
+	root := http.NewServeMux()
+	root.HandleFunc("GET /healthz", healthHandler.Live)
+	root.HandleFunc("GET /readyz", healthHandler.Ready)
+	root.Handle("/", otelhttp.NewHandler(r, "http.server", otelhttp.WithFilter(func(r *http.Request) bool {
+		return r.URL.Path != "/metrics"
+	})))
+
+	server := &http.Server{
+		Addr:              cfg.Server.Addr,
+		Handler:           root,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	serverErr := make(chan error, 1)
+	go func() {
+		slog.Info("the server starts", "addr", cfg.Server.Addr)
+		serverErr <- server.ListenAndServe()
+	}()
+	select {
+	case err := <-serverErr:
+		log.Fatalf("Server failed: %v", err)
+	case <-ctx.Done():
+	}
+	stop()
+
+	// Readiness fails first and new requests are still served until load
+	// balancers notice, then in-flight requests are drained and the exporters
+	// flushed before the database goes away.
+	slog.Info("shutting down", "delay", cfg.Server.ShutdownDelay.String(), "timeout", cfg.Server.ShutdownTimeout.String())
+	healthHandler.ShuttingDown()
+	time.Sleep(cfg.Server.ShutdownDelay)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("requests were still running at shutdown", "error", err)
+	}
+	if metricsServer != nil {
+		metricsServer.Shutdown(shutdownCtx)
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Error("flushing traces failed", "error", err)
+	}
+	sqlDB.Close()
+	slog.Info("the server stopped")
+}
+
+// newRouter routes the API and serves doc, which describes it. It only wires
+// handlers, so `app openapi check` can walk it without a database.
+func newRouter(a *app, cfg *config.Config, doc *openapi.Document) chi.Router {
+	authHandler := handler.NewAuthHandler(a.authService, a.tokenService, a.mfaService, []byte(cfg.Auth.Secret), handler.CookieOptions{
+		Secure:   cfg.Cookies.Secure,
+		SameSite: cfg.Cookies.SameSiteMode(),
+	})
+	mfaHandler := handler.NewMfaHandler(a.mfaService)
+	passwordHandler := handler.NewPasswordHandler(a.passwordService)
+	contactHandler := handler.NewContactHandler(a.contactService, a.profileService)
+	oidcHandler := handler.NewOidcHandler(a.oidcService, authHandler, cfg.Oidc.RedirectUrl)
+	apiKeyHandler := handler.NewApiKeyHandler(a.apiKeyService)
+	roleHandler := handler.NewRoleHandler(a.roleService)
+	auditHandler := handler.NewAuditHandler(a.auditService)
+	accountHandler := handler.NewAccountHandler(a.accountService, authHandler)
+	profileHandler := handler.NewProfileHandler(a.profileService, authHandler)
+	policy := service.NewPolicy(service.DefaultPolicyRules)
+	userHandler := handler.NewUserHandler(a.userService, a.catService, policy)
+	catHandler := handler.NewCatHandler(&a.catService, policy)
+
 	r := chi.NewRouter()
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		problem.NotFound(w, r, problem.CodeNotFound, "Not found")
+	})
+	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		problem.Write(w, r, problem.New(http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "Method not allowed"))
+	})
 
-	r.Use(middleware.Logger)
-	r.Use(middleware.Recoverer)
+	r.Use(custom_middleware.RequestID())
+	r.Use(custom_middleware.RequestLogger(slog.Default()))
+	r.Use(custom_middleware.Metrics())
+	r.Use(custom_middleware.TraceRoute())
+	r.Use(custom_middleware.Recoverer())
+	if cfg.Server.OpenapiValidation {
+		r.Use(custom_middleware.OpenAPIConformance(doc))
+	}
+	r.Use(custom_middleware.CSRFProtect([]byte(cfg.Auth.Secret), cfg.Server.TrustedOrigins))
+
+	specHandler, err := doc.Handler()
+	if err != nil {
+		log.Fatalf("Encoding the OpenAPI document failed: %v", err)
+	}
+	r.Method(http.MethodGet, "/openapi.json", specHandler)
+	r.Method(http.MethodGet, "/docs", doc.DocsHandler("/openapi.json", "/docs/assets"))
+	r.Method(http.MethodGet, "/docs/assets/{name}", openapi.DocsAssetsHandler())
 
 	r.Group(func(r chi.Router) {
-		r.Use(jwtauth.Verifier(tokenAuth))
+		r.Use(jwtauth.Verifier(a.tokenAuth))
+		r.Use(custom_middleware.ApiKeyAuthenticator(a.tokenAuth, a.apiKeyService, a.roleService))
+		r.Use(custom_middleware.LogUser())
 
 		r.Get("/api/user/info", userHandler.AboutMe)
+		r.Get("/api/auth/csrf", authHandler.CSRFToken)
+		r.Get("/api/user/verify-email", contactHandler.VerifyEmail)
+
+		r.Get("/api/auth/oidc/providers", oidcHandler.Providers)
+		r.Get("/api/auth/oidc/{provider}/login", oidcHandler.Login)
+		r.Get("/api/auth/oidc/{provider}/callback", oidcHandler.Callback)
 
 		r.Post("/api/auth/login", authHandler.Login)
 		r.Post("/api/auth/register", authHandler.Register)
-		r.With(httprate.LimitByIP(5, 1*time.Minute)).Post("/api/update-session", authHandler.UpdateSession)
+		r.With(limitByIP(cfg.RateLimits.MfaVerify)).Post("/api/auth/mfa/verify", authHandler.VerifyMfa)
+		r.With(limitByIP(cfg.RateLimits.PasswordForgot)).Post("/api/auth/password/forgot", passwordHandler.ForgotPassword)
+		r.With(limitByIP(cfg.RateLimits.PasswordReset)).Post("/api/auth/password/reset", passwordHandler.ResetPassword)
+		r.With(limitByIP(cfg.RateLimits.SessionRefresh)).Post("/api/update-session", authHandler.UpdateSession)
 
 		r.Get("/api/cats", catHandler.LonelyCats)
+		r.Get("/api/cats/{id}", catHandler.GetCat)
 	})
 
 	r.Group(func(r chi.Router) {
-		r.Use(jwtauth.Verifier(tokenAuth))
-		r.Use(jwtauth.Authenticator(tokenAuth))
+		r.Use(jwtauth.Verifier(a.tokenAuth))
+		r.Use(custom_middleware.ApiKeyAuthenticator(a.tokenAuth, a.apiKeyService, a.roleService))
+		r.Use(custom_middleware.LogUser())
+		r.Use(custom_middleware.Authenticator(a.tokenAuth))
+		r.Use(custom_middleware.AuditContext())
 
 		r.Post("/api/auth/logout", authHandler.Logout)
 		r.Post("/api/user/adopt-cat", userHandler.AdoptCat)
+		r.With(custom_middleware.SessionRequired()).Post("/api/auth/password/change", passwordHandler.ChangePassword)
+		r.With(custom_middleware.PermissionRequired(domain.PermissionProfileWrite)).Put("/api/user/me/contact", contactHandler.UpdateContacts)
+		r.With(limitByIP(cfg.RateLimits.VerificationResend)).Post("/api/user/verify-email/resend", contactHandler.ResendVerification)
+		r.Get("/api/user/{id}/avatar", profileHandler.Avatar)
+		r.Get("/api/user/info/{id}", userHandler.AboutUser)
+
+		r.Group(func(r chi.Router) {
+			r.Use(custom_middleware.SessionRequired())
+
+			r.Post("/api/auth/mfa/enroll", mfaHandler.Enroll)
+			r.Post("/api/auth/mfa/activate", mfaHandler.Activate)
+			r.Post("/api/auth/mfa/disable", mfaHandler.Disable)
+			r.Post("/api/auth/mfa/recovery-codes", mfaHandler.RegenerateRecoveryCodes)
+
+			r.Post("/api/user/api-keys", apiKeyHandler.CreateMine)
+			r.Get("/api/user/api-keys", apiKeyHandler.ListMine)
+			r.Delete("/api/user/api-keys/{keyId}", apiKeyHandler.RevokeMine)
+			r.Delete("/api/user/me", accountHandler.DeleteMe)
+			r.Get("/api/user/me/export", accountHandler.ExportMe)
+
+			r.Group(func(r chi.Router) {
+				r.Use(custom_middleware.PermissionRequired(domain.PermissionProfileWrite))
+
+				r.Patch("/api/user/me", profileHandler.UpdateMe)
+				r.Put("/api/user/me/avatar", profileHandler.UploadAvatar)
+				r.Delete("/api/user/me/avatar", profileHandler.DeleteAvatar)
+			})
+		})
 	})
 
 	r.Group(func(r chi.Router) {
-		r.Use(jwtauth.Verifier(tokenAuth))
-		r.Use(jwtauth.Authenticator(tokenAuth))
-		r.Use(custom_middleware.RoleRequired("admin"))
+		r.Use(jwtauth.Verifier(a.tokenAuth))
+		r.Use(custom_middleware.ApiKeyAuthenticator(a.tokenAuth, a.apiKeyService, a.roleService))
+		r.Use(custom_middleware.LogUser())
+		r.Use(custom_middleware.Authenticator(a.tokenAuth))
+		r.Use(custom_middleware.AuditContext())
+		r.Use(custom_middleware.MfaRequired(service.MfaMandatoryRoles...))
 
-		r.Post("/api/cats", catHandler.AddCat)
-		r.Get("/api/user/info/{id}", userHandler.AboutUser)
-		r.Post("/api/user/{id}/remove-role", userHandler.RemoveRole)
-		r.Post("/api/user/{id}/add-role", userHandler.AddRole)
+		r.With(custom_middleware.PermissionRequired(domain.PermissionCatsWrite)).Post("/api/cats", catHandler.AddCat)
+		r.With(custom_middleware.PermissionRequired(domain.PermissionUsersRead)).Get("/api/users", userHandler.List)
+		r.With(custom_middleware.PermissionRequired(domain.PermissionUsersRolesManage)).Post("/api/users/bulk/roles", userHandler.BulkAssignRole)
+		r.With(custom_middleware.PermissionRequired(domain.PermissionUsersManage)).Post("/api/users/bulk/suspend", userHandler.BulkSuspend)
+		r.With(custom_middleware.PermissionRequired(domain.PermissionUsersRolesManage)).Post("/api/user/{id}/remove-role", userHandler.RemoveRole)
+		r.With(custom_middleware.PermissionRequired(domain.PermissionUsersRolesManage)).Post("/api/user/{id}/add-role", userHandler.AddRole)
+		r.Group(func(r chi.Router) {
+			r.Use(custom_middleware.PermissionRequired(domain.PermissionUsersManage))
+
+			r.Post("/api/user/{id}/unlock", authHandler.UnlockUser)
+			r.Post("/api/user/{id}/mfa/reset", mfaHandler.Reset)
+			r.Post("/api/user/{id}/suspend", accountHandler.Suspend)
+			r.Post("/api/user/{id}/ban", accountHandler.Ban)
+			r.Post("/api/user/{id}/reactivate", accountHandler.Reactivate)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(custom_middleware.SessionRequired())
+			r.Use(custom_middleware.PermissionRequired(domain.PermissionUsersManage))
+
+			r.Post("/api/service-accounts", apiKeyHandler.CreateServiceAccount)
+			r.Post("/api/service-accounts/{id}/api-keys", apiKeyHandler.CreateForServiceAccount)
+			r.Get("/api/service-accounts/{id}/api-keys", apiKeyHandler.ListForServiceAccount)
+			r.Delete("/api/service-accounts/{id}/api-keys/{keyId}", apiKeyHandler.RevokeForServiceAccount)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(custom_middleware.PermissionRequired(domain.PermissionRolesManage))
+
+			r.Get("/api/roles", roleHandler.List)
+			r.Post("/api/roles", roleHandler.Create)
+			r.Patch("/api/roles/{name}", roleHandler.Update)
+			r.Delete("/api/roles/{name}", roleHandler.Delete)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(custom_middleware.PermissionRequired(domain.PermissionAuditRead))
+
+			r.Get("/api/audit", auditHandler.List)
+			r.Get("/api/audit/verify", auditHandler.Verify)
+		})
 	})
 
-	log.Printf("The server starts on port %s\n", cfg.HTTPport)
-	http.ListenAndServe(cfg.HTTPport, r)
+	return r
 }
-func initEnv() *Config {
-	err := godotenv.Load()
-	if err != nil {
-		log.Println("Failed to load .env file, system variables are used")
-	}
 
-	databaseUrl := os.Getenv("DATABASE_URL")
-	if databaseUrl == "" {
-		log.Fatal("The DATABASE_URL environment variable is not set")
-	}
-
-	httpPort := os.Getenv("HTTP_PORT")
-	if httpPort == "" {
-		log.Println("The HTTP_PORT environment variable is not set, the default port 3000 is used")
-		httpPort = ":3000"
-	}
+// limitByIP allows limit.Requests requests per limit.Window from one IP
+// address and answers the rest with a rate_limited problem.
+func limitByIP(limit config.RateLimit) func(http.Handler) http.Handler {
+	return httprate.Limit(limit.Requests, limit.Window,
+		httprate.WithKeyFuncs(httprate.KeyByIP),
+		httprate.WithLimitHandler(func(w http.ResponseWriter, r *http.Request) {
+			problem.Write(w, r, problem.New(http.StatusTooManyRequests, problem.CodeRateLimited, "Too many requests, try again later"))
+		}),
+	)
+}
 
-	secret := os.Getenv("SECRET")
-	if secret == "" {
-		log.Fatal("The SECRET environment variable is not set")
+// serveMetrics exposes /metrics on its own listener when metrics.addr is set,
+// otherwise on the API behind metrics.token. Without either it stays off, as
+// metrics reveal traffic and business volumes.
+// The separate listener, if any, is returned so it can be shut down.
+func serveMetrics(r chi.Router, cfg *config.Config) *http.Server {
+	switch {
+	case cfg.Metrics.Addr != "":
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler(cfg.Metrics.Token))
+		server := &http.Server{
+			Addr:              cfg.Metrics.Addr,
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+			WriteTimeout:      cfg.Server.WriteTimeout,
+			IdleTimeout:       cfg.Server.IdleTimeout,
+		}
+		go func() {
+			slog.Info("the metrics server starts", "addr", cfg.Metrics.Addr)
+			if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatalf("Metrics server failed: %v", err)
+			}
+		}()
+		return server
+	case cfg.Metrics.Token != "":
+		r.Handle("/metrics", metrics.Handler(cfg.Metrics.Token))
+	default:
+		slog.Warn("metrics are disabled, set METRICS_ADDR or METRICS_TOKEN to enable them")
 	}
+	return nil
+}
 
-	return &Config{
-		DatabaseUrl: databaseUrl,
-		HTTPport:    httpPort,
-		Secret:      secret,
+func newLoginAttemptRepository(store string, db *gorm.DB) repository.LoginAttemptRepository {
+	if store == "memory" {
+		return repository.NewInMemoryLoginAttemptRepository()
 	}
+	return repository.NewLoginAttemptRepositoryImpl(db)
 }
+func initRoles(ctx context.Context, r repository.RoleRepository, p repository.PermissionRepository) error {
+	roles := make(map[string]*domain.Role)
+	createdRoles := make(map[string]bool)
+	for _, def := range domain.DefaultRoles {
+		role, created, err := isExistsElseCreateRole(def.Name, r, ctx)
+		if err != nil {
+			return err
+		}
+		roles[def.Name] = role
+		createdRoles[def.Name] = created
 
-func migrateTables(db *gorm.DB) {
-	db.AutoMigrate(&domain.Role{})
-	db.AutoMigrate(&domain.Cat{})
-	db.AutoMigrate(&domain.User{})
-	db.AutoMigrate(&repository.RefreshToken{})
-}
-func initRoles(ctx context.Context, r repository.RoleRepository) error {
-	err := isExistsElseCreateRole("admin", r, ctx)
-	if err != nil {
-		return err
-	}
-	err = isExistsElseCreateRole("user", r, ctx)
-	if err != nil {
-		return err
+		// Like default permissions, the default parent is only set when one
+		// of the two roles is new, so an admin's changes survive restarts.
+		parent, ok := roles[def.InheritsFrom]
+		if !ok || role.InheritsFromId != nil || !(created || createdRoles[def.InheritsFrom]) {
+			continue
+		}
+		role.InheritsFromId = &parent.Id
+		if err := r.Save(ctx, role); err != nil {
+			return err
+		}
 	}
-	return nil
+
+	return initPermissions(ctx, r, p, roles, createdRoles)
 }
 
-func isExistsElseCreateRole(checkRole string, r repository.RoleRepository, ctx context.Context) error {
+func isExistsElseCreateRole(checkRole string, r repository.RoleRepository, ctx context.Context) (*domain.Role, bool, error) {
 	role, err := r.FindByName(ctx, checkRole)
 	if err != nil {
 		if !errors.Is(err, repository.ErrRoleNotFound) {
-			return err
+			return nil, false, err
 		}
 		role, _ = domain.NewRole(checkRole)
 		err = r.Save(ctx, role)
 		if err != nil {
-			return err
+			return nil, false, err
 		}
-		log.Printf("role '%s' created\n", checkRole)
-		return nil
-	}
-	if role != nil {
-		log.Printf("role '%s' already exists\n", checkRole)
+		slog.Info("role created", "role", checkRole)
+		return role, true, nil
 	}
-	return nil
+	slog.Debug("role already exists", "role", checkRole)
+	return role, false, nil
 }
 
-type Config struct {
-	DatabaseUrl string
-	HTTPport    string
-	Secret      string
+// initPermissions seeds domain.DefaultPermissions. Defaults are only granted
+// to a role when the permission or the role is new, so permissions revoked by
+// an admin stay revoked across restarts.
+func initPermissions(ctx context.Context, r repository.RoleRepository, p repository.PermissionRepository, roles map[string]*domain.Role, createdRoles map[string]bool) error {
+	for _, def := range domain.DefaultPermissions {
+		permission, err := p.FindByName(ctx, def.Name)
+		created := false
+		if err != nil {
+			if !errors.Is(err, repository.ErrPermissionNotFound) {
+				return err
+			}
+			permission, _ = domain.NewPermission(def.Name, def.Description)
+			if err := p.Save(ctx, permission); err != nil {
+				return err
+			}
+			created = true
+			slog.Info("permission created", "permission", def.Name)
+		}
+
+		for _, roleName := range def.Roles {
+			role, ok := roles[roleName]
+			if !ok || !(created || createdRoles[roleName]) {
+				continue
+			}
+			if err := r.AddPermission(ctx, role, permission); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
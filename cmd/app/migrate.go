@@ -0,0 +1,108 @@
+package main
+
+import (
+	"api/catshelter/internal/migration"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"strconv"
+
+	"gorm.io/gorm"
+)
+
+const migrateUsage = "usage: app migrate [-config file] [-set key=value] up | down [steps] | status"
+
+// runMigrate implements `app migrate`. It only needs the database settings.
+func runMigrate(args []string) {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	cfgFlags := addConfigFlags(flags)
+	flags.Parse(args)
+	args = flags.Args()
+	if len(args) == 0 {
+		log.Fatal(migrateUsage)
+	}
+
+	cfg := cfgFlags.loadDatabase()
+	db := openDatabase(cfg.Database.Url, cfg.Database.ConnectTimeout)
+	migrator := newMigrator(db)
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			fmt.Printf("applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("no pending migrations")
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			var err error
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				log.Fatal(migrateUsage)
+			}
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		for _, m := range reverted {
+			fmt.Printf("reverted %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		if len(reverted) == 0 {
+			fmt.Println("no applied migrations")
+		}
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			log.Fatalf("Reading migration status failed: %v", err)
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.AppliedAt != nil {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			if s.Modified {
+				state += " (modified since applied)"
+			}
+			if s.Unknown {
+				state += " (unknown to this build)"
+			}
+			fmt.Printf("%04d_%s\t%s\t%s\n", s.Version, s.Name, s.Checksum[:12], state)
+		}
+	default:
+		log.Fatal(migrateUsage)
+	}
+}
+
+// migrateDatabase applies pending migrations at startup. Instances started
+// together wait for each other on the migration lock.
+func migrateDatabase(db *gorm.DB) {
+	applied, err := newMigrator(db).Up(context.Background())
+	for _, m := range applied {
+		slog.Info("migration applied", "version", m.Version, "name", m.Name)
+	}
+	if err != nil {
+		log.Fatalf("Migration failed: %v", err)
+	}
+}
+
+func newMigrator(db *gorm.DB) *migration.Migrator {
+	sqlDB, err := db.DB()
+	if err != nil {
+		log.Fatalf("Connection to DB failed : %v", err)
+	}
+	migrator, err := migration.NewMigrator(sqlDB)
+	if err != nil {
+		log.Fatalf("Bad embedded migrations: %v", err)
+	}
+	return migrator
+}
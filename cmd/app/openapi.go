@@ -0,0 +1,101 @@
+package main
+
+import (
+	"api/catshelter/internal/config"
+	"api/catshelter/internal/handler"
+	"api/catshelter/internal/openapi"
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/jwtauth/v5"
+)
+
+// undocumentedRoutes are served next to the API but are not part of it.
+var undocumentedRoutes = []string{"GET /openapi.json", "GET /docs", "GET /docs/assets/{name}", "GET /metrics"}
+
+// probeRoutes are served by the root mux in front of the router.
+var probeRoutes = []string{"GET /healthz", "GET /readyz"}
+
+// runOpenapi implements `app openapi print` and `app openapi check`. The
+// check fails when a route is missing from the document or the committed
+// document differs from the generated one, e.g. after a dto changed, so CI
+// can run it.
+func runOpenapi(args []string) {
+	if len(args) == 0 || (args[0] != "print" && args[0] != "check") {
+		fmt.Fprintln(os.Stderr, "usage: app openapi print | check [-spec api/openapi.json]")
+		os.Exit(2)
+	}
+	flags := flag.NewFlagSet("openapi "+args[0], flag.ExitOnError)
+	spec := flags.String("spec", "api/openapi.json", "committed document to compare with")
+	flags.Parse(args[1:])
+
+	doc := handler.OpenAPI()
+	content, err := doc.JSON()
+	if err != nil {
+		log.Fatalf("Encoding the OpenAPI document failed: %v", err)
+	}
+	if args[0] == "print" {
+		os.Stdout.Write(content)
+		return
+	}
+
+	mismatches, routes, err := routeMismatches(doc)
+	if err != nil {
+		log.Fatalf("Walking the routes failed: %v", err)
+	}
+	for _, mismatch := range mismatches {
+		fmt.Println(mismatch)
+	}
+	failed := len(mismatches) > 0
+
+	committed, err := os.ReadFile(*spec)
+	if err != nil {
+		log.Fatalf("Reading the committed document failed: %v", err)
+	}
+	if !bytes.Equal(committed, content) {
+		fmt.Printf("%s is out of date, run 'app openapi print > %s' and review the changes\n", *spec, *spec)
+		failed = true
+	}
+	if failed {
+		os.Exit(1)
+	}
+	fmt.Printf("%d routes documented, %s is up to date\n", routes, *spec)
+}
+
+// routeMismatches lists the routes the router serves but doc does not
+// describe, and the other way round, along with how many routes are served.
+func routeMismatches(doc *openapi.Document) ([]string, int, error) {
+	// The router only needs a token verifier to be built; no request is
+	// served, so the services can stay unset.
+	a := &app{tokenAuth: jwtauth.New("HS256", []byte("openapi check"), nil)}
+	routes := slices.Clone(probeRoutes)
+	err := chi.Walk(newRouter(a, config.Default(), doc), func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		if !slices.Contains(undocumentedRoutes, method+" "+route) {
+			routes = append(routes, method+" "+route)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var mismatches []string
+	documented := doc.Routes()
+	for _, route := range routes {
+		if !slices.Contains(documented, route) {
+			mismatches = append(mismatches, route+" is routed but not documented")
+		}
+	}
+	for _, route := range documented {
+		if !slices.Contains(routes, route) {
+			mismatches = append(mismatches, route+" is documented but not routed")
+		}
+	}
+	return mismatches, len(routes), nil
+}
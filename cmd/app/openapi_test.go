@@ -0,0 +1,309 @@
+package main
+
+import (
+	"api/catshelter/internal/config"
+	"api/catshelter/internal/domain"
+	"api/catshelter/internal/handler"
+	"api/catshelter/internal/handler/dto"
+	"api/catshelter/internal/repository"
+	"api/catshelter/internal/service"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/jwtauth/v5"
+)
+
+func TestOpenapiDocumentIsUpToDate(t *testing.T) {
+	content, err := handler.OpenAPI().JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	committed, err := os.ReadFile("../../api/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(committed, content) {
+		t.Error("api/openapi.json is out of date, run 'go run ./cmd/app openapi print > api/openapi.json'")
+	}
+}
+
+func TestOpenapiDocumentsEveryRoute(t *testing.T) {
+	mismatches, _, err := routeMismatches(handler.OpenAPI())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mismatch := range mismatches {
+		t.Error(mismatch)
+	}
+}
+
+// TestHandlersMatchOpenapiDocument serves requests through the router and
+// checks each request and response against the document, as
+// OPENAPI_VALIDATION does at runtime. Services the requests reach are faked.
+func TestHandlersMatchOpenapiDocument(t *testing.T) {
+	owner := "00000000-0000-0000-0000-000000000001"
+	cats := &fakeCatService{cats: map[string]*domain.Cat{
+		"00000000-0000-0000-0000-00000000000a": {BaseModel: domain.BaseModel{Id: "00000000-0000-0000-0000-00000000000a"}, Name: "Murka", Age: 3},
+		"00000000-0000-0000-0000-00000000000b": {BaseModel: domain.BaseModel{Id: "00000000-0000-0000-0000-00000000000b"}, Name: "Barsik", Age: 5, UserId: &owner},
+	}}
+	stranger := "00000000-0000-0000-0000-000000000002"
+	users := &fakeUserService{users: map[string]*domain.User{
+		owner:    {BaseModel: domain.BaseModel{Id: owner}, Login: "owner", Name: "Owner", Status: domain.UserStatusActive, Version: 1},
+		stranger: {BaseModel: domain.BaseModel{Id: stranger}, Login: "stranger", Name: "Stranger", Status: domain.UserStatusActive, Version: 1},
+	}}
+	cfg := config.Default()
+	cfg.Auth.Secret = "openapi test secret"
+	a := &app{tokenAuth: jwtauth.New("HS256", []byte(cfg.Auth.Secret), nil), catService: cats, userService: users}
+	doc := handler.OpenAPI()
+	router := newRouter(a, cfg, doc)
+
+	user := accessToken(t, a, owner, false)
+	staff := accessToken(t, a, owner, true, domain.PermissionCatsWrite, domain.PermissionUsersRead)
+	staffWithoutMfa := roleToken(t, a, owner, "staff", false, domain.PermissionCatsWrite, domain.PermissionUsersRead)
+	adminWithoutMfa := roleToken(t, a, owner, "admin", false, domain.PermissionCatsWrite, domain.PermissionUsersRead)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   string
+		status int
+		// invalid requests break the document on purpose, to check the
+		// problem the handler answers with.
+		invalid bool
+	}{
+		{name: "anonymous user info", method: http.MethodGet, path: "/api/user/info", status: http.StatusOK},
+		{name: "user info", method: http.MethodGet, path: "/api/user/info", token: user, status: http.StatusOK},
+		{name: "csrf token", method: http.MethodGet, path: "/api/auth/csrf", status: http.StatusOK},
+		{name: "lonely cats", method: http.MethodGet, path: "/api/cats?page=1&page_size=10", status: http.StatusOK},
+		{name: "available cat", method: http.MethodGet, path: "/api/cats/00000000-0000-0000-0000-00000000000a", status: http.StatusOK},
+		{name: "adopted cat of someone else", method: http.MethodGet, path: "/api/cats/00000000-0000-0000-0000-00000000000b", status: http.StatusNotFound},
+		{name: "adopted cat of the owner", method: http.MethodGet, path: "/api/cats/00000000-0000-0000-0000-00000000000b", token: user, status: http.StatusOK},
+		{name: "missing cat", method: http.MethodGet, path: "/api/cats/00000000-0000-0000-0000-00000000000c", status: http.StatusNotFound},
+		{name: "login without credentials", method: http.MethodPost, path: "/api/auth/login", body: `{}`, status: http.StatusBadRequest, invalid: true},
+		{name: "login with malformed json", method: http.MethodPost, path: "/api/auth/login", body: `{"login":`, status: http.StatusBadRequest, invalid: true},
+		{name: "login while logged in", method: http.MethodPost, path: "/api/auth/login", token: user, body: `{"login":"owner","password":"password1"}`, status: http.StatusBadRequest},
+		{name: "register with a short password", method: http.MethodPost, path: "/api/auth/register", body: `{"login":"newcomer","password":"1","name":"Newcomer"}`, status: http.StatusBadRequest, invalid: true},
+		{name: "add cat", method: http.MethodPost, path: "/api/cats", token: staff, body: `{"name":"Pushok","age":2}`, status: http.StatusCreated},
+		{name: "add cat without a name", method: http.MethodPost, path: "/api/cats", token: staff, body: `{"age":2}`, status: http.StatusBadRequest, invalid: true},
+		{name: "add cat anonymously", method: http.MethodPost, path: "/api/cats", body: `{"name":"Pushok","age":2}`, status: http.StatusUnauthorized},
+		{name: "add cat without permission", method: http.MethodPost, path: "/api/cats", token: accessToken(t, a, owner, true), body: `{"name":"Pushok","age":2}`, status: http.StatusForbidden},
+		{name: "add cat as staff without mfa", method: http.MethodPost, path: "/api/cats", token: staffWithoutMfa, body: `{"name":"Pushok","age":2}`, status: http.StatusCreated},
+		{name: "add cat as admin without mfa", method: http.MethodPost, path: "/api/cats", token: adminWithoutMfa, body: `{"name":"Pushok","age":2}`, status: http.StatusForbidden},
+		{name: "list users as staff without mfa", method: http.MethodGet, path: "/api/users", token: staffWithoutMfa, status: http.StatusOK},
+		{name: "list users as admin without mfa", method: http.MethodGet, path: "/api/users", token: adminWithoutMfa, status: http.StatusForbidden},
+		{name: "list users without permission", method: http.MethodGet, path: "/api/users", token: accessToken(t, a, owner, true), status: http.StatusForbidden},
+		{name: "contacts without a version", method: http.MethodPut, path: "/api/user/me/contact", token: accessToken(t, a, owner, false, domain.PermissionProfileWrite), body: `{"email":"owner@example.com","phone":""}`, status: http.StatusPreconditionRequired},
+		{name: "own profile without mfa", method: http.MethodGet, path: "/api/user/info/" + owner, token: user, status: http.StatusOK},
+		{name: "profile of someone else", method: http.MethodGet, path: "/api/user/info/" + stranger, token: user, status: http.StatusNotFound},
+		{name: "avatar anonymously", method: http.MethodGet, path: "/api/user/" + owner + "/avatar", status: http.StatusUnauthorized},
+		{name: "logout with an expired token", method: http.MethodPost, path: "/api/auth/logout", token: expiredToken(t, a, owner), status: http.StatusUnauthorized},
+		{name: "enroll mfa with an api key", method: http.MethodPost, path: "/api/auth/mfa/enroll", token: apiKeyToken(t, a, owner), status: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.body != "" {
+				r.Header.Set("Content-Type", "application/json")
+			}
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rctx := chi.NewRouteContext()
+			if !router.Match(rctx, tt.method, r.URL.Path) {
+				t.Fatalf("%s %s is not routed", tt.method, r.URL.Path)
+			}
+			route := rctx.RoutePattern()
+
+			err := doc.CheckRequest(tt.method, route, r, []byte(tt.body))
+			if tt.invalid && err == nil {
+				t.Errorf("request matches the document, want it not to")
+			}
+			if !tt.invalid && err != nil {
+				t.Errorf("request does not match the document: %v", err)
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			body, _ := io.ReadAll(w.Result().Body)
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.status, body)
+			}
+			if err := doc.CheckResponse(tt.method, route, w.Code, w.Header(), body); err != nil {
+				t.Errorf("response does not match the document: %v\n%s", err, body)
+			}
+		})
+	}
+}
+
+func TestDocsAssetsAreServed(t *testing.T) {
+	a := &app{tokenAuth: jwtauth.New("HS256", []byte("openapi test secret"), nil)}
+	router := newRouter(a, config.Default(), handler.OpenAPI())
+
+	for path, status := range map[string]int{
+		"/openapi.json":                     http.StatusOK,
+		"/docs":                             http.StatusOK,
+		"/docs/assets/swagger-ui.css":       http.StatusOK,
+		"/docs/assets/swagger-ui-bundle.js": http.StatusOK,
+		"/docs/assets/index.html":           http.StatusNotFound,
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != status {
+			t.Errorf("GET %s: status %d, want %d", path, w.Code, status)
+		}
+	}
+}
+
+func TestAuditExportEscapesFormulas(t *testing.T) {
+	actor := "00000000-0000-0000-0000-000000000001"
+	audit := &fakeAuditService{entries: []*repository.AuditEntry{{
+		Seq: 1, ActorId: &actor, Action: "user.updated", TargetType: "user", TargetId: actor,
+		Before: `{"name":"Murka"}`, After: `{"name":"=HYPERLINK(\"http://evil\")"}`, RequestId: "@SUM(A1)",
+	}}}
+	a := &app{tokenAuth: jwtauth.New("HS256", []byte("openapi test secret"), nil), auditService: audit}
+	router := newRouter(a, config.Default(), handler.OpenAPI())
+
+	r := httptest.NewRequest(http.MethodGet, "/api/audit?format=csv", nil)
+	r.Header.Set("Authorization", "Bearer "+accessToken(t, a, actor, true, domain.PermissionAuditRead))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("%d records, want a header and one entry", len(records))
+	}
+	for column, want := range map[int]string{
+		6: `{"name":"Murka"}`,
+		7: `{"name":"=HYPERLINK(\"http://evil\")"}`,
+		9: "'@SUM(A1)",
+	} {
+		if got := records[1][column]; got != want {
+			t.Errorf("%s = %q, want %q", records[0][column], got, want)
+		}
+	}
+}
+
+// accessToken signs an access token of a regular user the way the token
+// service does.
+func accessToken(t *testing.T, a *app, userId string, mfa bool, permissions ...string) string {
+	t.Helper()
+	return roleToken(t, a, userId, "user", mfa, permissions...)
+}
+
+func roleToken(t *testing.T, a *app, userId, role string, mfa bool, permissions ...string) string {
+	t.Helper()
+	return signToken(t, a, map[string]interface{}{
+		"user_id":     userId,
+		"roles":       []string{role},
+		"permissions": append([]string{}, permissions...),
+		"mfa":         mfa,
+		"exp":         time.Now().Add(time.Minute).Unix(),
+	})
+}
+
+// apiKeyToken signs the token ApiKeyAuthenticator puts in place of an API key.
+func apiKeyToken(t *testing.T, a *app, userId string) string {
+	t.Helper()
+	return signToken(t, a, map[string]interface{}{
+		"user_id":     userId,
+		"api_key_id":  "00000000-0000-0000-0000-0000000000ff",
+		"permissions": []string{},
+		"mfa":         true,
+		"exp":         time.Now().Add(time.Minute).Unix(),
+	})
+}
+
+func expiredToken(t *testing.T, a *app, userId string) string {
+	t.Helper()
+	return signToken(t, a, map[string]interface{}{
+		"user_id": userId,
+		"exp":     time.Now().Add(-time.Minute).Unix(),
+	})
+}
+
+func signToken(t *testing.T, a *app, claims map[string]interface{}) string {
+	t.Helper()
+	_, token, err := a.tokenAuth.Encode(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+type fakeCatService struct {
+	service.CatService
+	cats map[string]*domain.Cat
+}
+
+func (s *fakeCatService) FindLonelyCats(_ context.Context, page, pageSize int) ([]*domain.Cat, *dto.PaginationResult, error) {
+	var lonely []*domain.Cat
+	for _, cat := range s.cats {
+		if cat.UserId == nil {
+			lonely = append(lonely, cat)
+		}
+	}
+	return lonely, &dto.PaginationResult{Page: page, PageSize: pageSize, TotalCount: int64(len(lonely)), TotalPages: 1}, nil
+}
+
+func (s *fakeCatService) AddCat(_ context.Context, name string, age int) error {
+	_, err := domain.NewCat(name, age)
+	return err
+}
+
+func (s *fakeCatService) FindById(_ context.Context, id string) (*domain.Cat, error) {
+	cat, ok := s.cats[id]
+	if !ok {
+		return nil, repository.ErrCatNotFound
+	}
+	return cat, nil
+}
+
+type fakeAuditService struct {
+	service.AuditService
+	entries []*repository.AuditEntry
+}
+
+func (s *fakeAuditService) FindAll(_ context.Context, _ *repository.AuditFilter) ([]*repository.AuditEntry, error) {
+	return s.entries, nil
+}
+
+type fakeUserService struct {
+	service.UserService
+	users map[string]*domain.User
+}
+
+func (s *fakeUserService) Search(_ context.Context, _ *repository.UserSearch, page, pageSize int) ([]*domain.User, *dto.PaginationResult, error) {
+	var users []*domain.User
+	for _, user := range s.users {
+		users = append(users, user)
+	}
+	return users, &dto.PaginationResult{Page: page, PageSize: pageSize, TotalCount: int64(len(users)), TotalPages: 1}, nil
+}
+
+func (s *fakeUserService) FindByIdWithAll(ctx context.Context, id string) (*domain.User, error) {
+	return s.FindByIdWithCats(ctx, id)
+}
+
+func (s *fakeUserService) FindByIdWithCats(_ context.Context, id string) (*domain.User, error) {
+	user, ok := s.users[id]
+	if !ok {
+		return nil, repository.ErrUserNotFound
+	}
+	return user, nil
+}
@@ -0,0 +1,246 @@
+// Package config holds the settings of the server and the admin commands.
+//
+// Values are layered, each source overriding the previous one: the defaults
+// below, a YAML or TOML file, environment variables and finally command line
+// flags. Every setting has a key in the file (section.key) and most have an
+// environment variable, given by the env tag.
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	Server     Server     `yaml:"server" toml:"server"`
+	Database   Database   `yaml:"database" toml:"database"`
+	Auth       Auth       `yaml:"auth" toml:"auth"`
+	Audit      Audit      `yaml:"audit" toml:"audit"`
+	Cookies    Cookies    `yaml:"cookies" toml:"cookies"`
+	RateLimits RateLimits `yaml:"rate_limits" toml:"rate_limits"`
+	Pagination Pagination `yaml:"pagination" toml:"pagination"`
+	Mail       Mail       `yaml:"mail" toml:"mail"`
+	Oidc       Oidc       `yaml:"oidc" toml:"oidc"`
+	Log        Log        `yaml:"log" toml:"log"`
+	Metrics    Metrics    `yaml:"metrics" toml:"metrics"`
+	Tracing    Tracing    `yaml:"tracing" toml:"tracing"`
+}
+
+type Server struct {
+	Addr string `yaml:"addr" toml:"addr" env:"HTTP_PORT"`
+	// PublicUrl is where clients reach the API, used in links sent by mail
+	// and OIDC callbacks. Defaults to http://localhost<addr>.
+	PublicUrl      string   `yaml:"public_url" toml:"public_url" env:"PUBLIC_URL"`
+	TrustedOrigins []string `yaml:"trusted_origins" toml:"trusted_origins" env:"TRUSTED_ORIGINS"`
+
+	ReadTimeout     time.Duration `yaml:"read_timeout" toml:"read_timeout" env:"HTTP_READ_TIMEOUT"`
+	WriteTimeout    time.Duration `yaml:"write_timeout" toml:"write_timeout" env:"HTTP_WRITE_TIMEOUT"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout" toml:"idle_timeout" env:"HTTP_IDLE_TIMEOUT"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+	// ShutdownDelay keeps serving after readiness fails on shutdown, so load
+	// balancers notice and stop sending requests before connections close.
+	ShutdownDelay time.Duration `yaml:"shutdown_delay" toml:"shutdown_delay" env:"SHUTDOWN_DELAY"`
+
+	// ExposeInternalErrors sends the cause of 500 responses to clients. For
+	// local development only.
+	ExposeInternalErrors bool `yaml:"expose_internal_errors" toml:"expose_internal_errors" env:"EXPOSE_INTERNAL_ERRORS"`
+	// OpenapiValidation logs requests and responses that do not match the
+	// OpenAPI document. For development and end-to-end environments.
+	OpenapiValidation bool `yaml:"openapi_validation" toml:"openapi_validation" env:"OPENAPI_VALIDATION"`
+}
+
+type Database struct {
+	Url            string        `yaml:"url" toml:"url" env:"DATABASE_URL" secret:"true"`
+	ConnectTimeout time.Duration `yaml:"connect_timeout" toml:"connect_timeout" env:"DB_CONNECT_TIMEOUT"`
+}
+
+type Auth struct {
+	// Secret signs access tokens, CSRF tokens and the short-lived tokens of
+	// the MFA, email verification and OIDC flows.
+	Secret          string        `yaml:"secret" toml:"secret" env:"SECRET" secret:"true"`
+	AccessTokenTTL  time.Duration `yaml:"access_token_ttl" toml:"access_token_ttl" env:"ACCESS_TOKEN_TTL"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl" toml:"refresh_token_ttl" env:"REFRESH_TOKEN_TTL"`
+	BcryptCost      int           `yaml:"bcrypt_cost" toml:"bcrypt_cost" env:"BCRYPT_COST"`
+	// LoginAttemptStore is db, shared by all instances, or memory.
+	LoginAttemptStore string `yaml:"login_attempt_store" toml:"login_attempt_store" env:"LOGIN_ATTEMPT_STORE"`
+}
+
+type Audit struct {
+	// Key signs the hash chain of the audit log. It must not be stored in
+	// the database, or whoever can write the table can rewrite the chain.
+	Key string `yaml:"key" toml:"key" env:"AUDIT_KEY" secret:"true"`
+}
+
+// Cookies sets the attributes of the session and CSRF cookies. Secure may
+// only be turned off for local development over plain HTTP.
+type Cookies struct {
+	Secure bool `yaml:"secure" toml:"secure" env:"COOKIE_SECURE"`
+	// SameSite is lax, strict or none.
+	SameSite string `yaml:"same_site" toml:"same_site" env:"COOKIE_SAME_SITE"`
+}
+
+func (c Cookies) SameSiteMode() http.SameSite {
+	switch c.SameSite {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteLaxMode
+	}
+}
+
+// RateLimits are per client IP address.
+type RateLimits struct {
+	PasswordForgot     RateLimit `yaml:"password_forgot" toml:"password_forgot" env:"RATE_LIMIT_PASSWORD_FORGOT"`
+	PasswordReset      RateLimit `yaml:"password_reset" toml:"password_reset" env:"RATE_LIMIT_PASSWORD_RESET"`
+	SessionRefresh     RateLimit `yaml:"session_refresh" toml:"session_refresh" env:"RATE_LIMIT_SESSION_REFRESH"`
+	MfaVerify          RateLimit `yaml:"mfa_verify" toml:"mfa_verify" env:"RATE_LIMIT_MFA_VERIFY"`
+	VerificationResend RateLimit `yaml:"verification_resend" toml:"verification_resend" env:"RATE_LIMIT_VERIFICATION_RESEND"`
+}
+
+// RateLimit allows Requests requests per Window. It is written as
+// "<requests>/<window>", for example "5/1m".
+type RateLimit struct {
+	Requests int
+	Window   time.Duration
+}
+
+func (l RateLimit) MarshalText() ([]byte, error) {
+	return []byte(strconv.Itoa(l.Requests) + "/" + shortDuration(l.Window)), nil
+}
+
+func (l *RateLimit) UnmarshalText(text []byte) error {
+	requests, window, ok := strings.Cut(string(text), "/")
+	if !ok {
+		return fmt.Errorf("must look like 5/1m")
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(requests))
+	if err != nil {
+		return fmt.Errorf("must look like 5/1m")
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(window))
+	if err != nil {
+		return fmt.Errorf("must look like 5/1m")
+	}
+	l.Requests, l.Window = n, d
+	return nil
+}
+
+type Pagination struct {
+	DefaultPageSize int `yaml:"default_page_size" toml:"default_page_size" env:"DEFAULT_PAGE_SIZE"`
+	MaxPageSize     int `yaml:"max_page_size" toml:"max_page_size" env:"MAX_PAGE_SIZE"`
+}
+
+type Mail struct {
+	// Driver is smtp, file or log.
+	Driver       string `yaml:"driver" toml:"driver" env:"MAIL_DRIVER"`
+	From         string `yaml:"from" toml:"from" env:"MAIL_FROM"`
+	SmtpHost     string `yaml:"smtp_host" toml:"smtp_host" env:"SMTP_HOST"`
+	SmtpPort     string `yaml:"smtp_port" toml:"smtp_port" env:"SMTP_PORT"`
+	SmtpUsername string `yaml:"smtp_username" toml:"smtp_username" env:"SMTP_USERNAME"`
+	SmtpPassword string `yaml:"smtp_password" toml:"smtp_password" env:"SMTP_PASSWORD" secret:"true"`
+	Dir          string `yaml:"dir" toml:"dir" env:"MAIL_DIR"`
+}
+
+type Oidc struct {
+	// RedirectUrl is where browsers land after signing in with a provider.
+	RedirectUrl string `yaml:"redirect_url" toml:"redirect_url" env:"OIDC_REDIRECT_URL"`
+	// Providers come from OIDC_PROVIDERS and OIDC_<NAME>_* in the
+	// environment, which replace the providers of the file.
+	Providers []OidcProvider `yaml:"providers" toml:"providers"`
+}
+
+type OidcProvider struct {
+	Name         string   `yaml:"name" toml:"name"`
+	Issuer       string   `yaml:"issuer" toml:"issuer"`
+	ClientId     string   `yaml:"client_id" toml:"client_id"`
+	ClientSecret string   `yaml:"client_secret" toml:"client_secret" secret:"true"`
+	Scopes       []string `yaml:"scopes" toml:"scopes"`
+}
+
+type Log struct {
+	// Level is debug, info, warn or error.
+	Level string `yaml:"level" toml:"level" env:"LOG_LEVEL"`
+	// Format is json or text.
+	Format string `yaml:"format" toml:"format" env:"LOG_FORMAT"`
+}
+
+type Metrics struct {
+	// Addr is the address of a separate listener for /metrics, which should
+	// not be reachable from the internet.
+	Addr  string `yaml:"addr" toml:"addr" env:"METRICS_ADDR"`
+	Token string `yaml:"token" toml:"token" env:"METRICS_TOKEN" secret:"true"`
+}
+
+type Tracing struct {
+	// Exporter is none, otlp or stdout.
+	Exporter    string `yaml:"exporter" toml:"exporter" env:"OTEL_TRACES_EXPORTER"`
+	ServiceName string `yaml:"service_name" toml:"service_name" env:"OTEL_SERVICE_NAME"`
+}
+
+// Default returns the settings used when no source sets them.
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			Addr:            ":3000",
+			ReadTimeout:     30 * time.Second,
+			WriteTimeout:    60 * time.Second,
+			IdleTimeout:     120 * time.Second,
+			ShutdownTimeout: 30 * time.Second,
+			ShutdownDelay:   5 * time.Second,
+		},
+		Database: Database{
+			ConnectTimeout: 60 * time.Second,
+		},
+		Auth: Auth{
+			AccessTokenTTL:    15 * time.Minute,
+			RefreshTokenTTL:   30 * 24 * time.Hour,
+			BcryptCost:        10,
+			LoginAttemptStore: "db",
+		},
+		Cookies: Cookies{
+			Secure:   true,
+			SameSite: "lax",
+		},
+		RateLimits: RateLimits{
+			PasswordForgot:     RateLimit{Requests: 5, Window: time.Minute},
+			PasswordReset:      RateLimit{Requests: 5, Window: time.Minute},
+			SessionRefresh:     RateLimit{Requests: 5, Window: time.Minute},
+			MfaVerify:          RateLimit{Requests: 5, Window: time.Minute},
+			VerificationResend: RateLimit{Requests: 3, Window: 10 * time.Minute},
+		},
+		Pagination: Pagination{
+			DefaultPageSize: 10,
+			MaxPageSize:     100,
+		},
+		Mail: Mail{
+			Driver: "log",
+			From:   "no-reply@catshelter.local",
+		},
+		Log: Log{
+			Level:  "info",
+			Format: "json",
+		},
+		Tracing: Tracing{
+			Exporter:    "none",
+			ServiceName: "catshelter",
+		},
+	}
+}
+
+// shortDuration formats d without the zero units time.Duration.String adds,
+// so one minute is "1m" rather than "1m0s".
+func shortDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
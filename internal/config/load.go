@@ -0,0 +1,237 @@
+package config
+
+import (
+	"bytes"
+	"encoding"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Load builds the configuration from the defaults, the file (CONFIG_FILE when
+// file is empty), the environment and overrides of the form section.key=value,
+// in that order. It does not validate the result.
+func Load(file string, overrides []string) (*Config, error) {
+	cfg := Default()
+
+	if file == "" {
+		file = os.Getenv("CONFIG_FILE")
+	}
+	if file != "" {
+		if err := cfg.readFile(file); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.readEnv(); err != nil {
+		return nil, err
+	}
+	for _, override := range overrides {
+		key, value, ok := strings.Cut(override, "=")
+		if !ok {
+			return nil, fmt.Errorf("'%s' must look like section.key=value", override)
+		}
+		if err := cfg.Set(key, value); err != nil {
+			return nil, err
+		}
+	}
+
+	cfg.Server.PublicUrl = strings.TrimSuffix(cfg.Server.PublicUrl, "/")
+	if cfg.Server.PublicUrl == "" {
+		cfg.Server.PublicUrl = "http://localhost" + cfg.Server.Addr
+	}
+	return cfg, nil
+}
+
+// readFile decodes a YAML (.yaml, .yml) or TOML (.toml) file. Unknown keys
+// are errors, so a misspelt setting does not silently keep its default.
+func (c *Config) readFile(file string) error {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(content))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+	case ".toml":
+		meta, err := toml.Decode(string(content), c)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("%s: unknown key '%s'", file, undecoded[0])
+		}
+	default:
+		return fmt.Errorf("config file %s must end in .yaml, .yml or .toml", file)
+	}
+	return nil
+}
+
+// readEnv applies every variable named by an env tag. Secrets can also be
+// read from the file named by <VARIABLE>_FILE, as mounted by Docker and
+// Kubernetes secrets.
+func (c *Config) readEnv() error {
+	var errs []error
+	walk(reflect.ValueOf(c).Elem(), "", func(key string, field reflect.StructField, v reflect.Value) {
+		name := field.Tag.Get("env")
+		if name == "" {
+			return
+		}
+		value, ok, err := lookupEnv(name, field.Tag.Get("secret") == "true")
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		if !ok {
+			return
+		}
+		if err := setValue(v, value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	})
+	if err := c.readOidcEnv(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func lookupEnv(name string, secret bool) (string, bool, error) {
+	value, ok := os.LookupEnv(name)
+	if !secret {
+		return value, ok, nil
+	}
+	file := os.Getenv(name + "_FILE")
+	if file == "" {
+		return value, ok, nil
+	}
+	if ok {
+		return "", false, fmt.Errorf("only one of %s and %s_FILE may be set", name, name)
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return "", false, fmt.Errorf("%s_FILE: %w", name, err)
+	}
+	return strings.TrimRight(string(content), "\r\n"), true, nil
+}
+
+// readOidcEnv reads the providers listed in OIDC_PROVIDERS from
+// OIDC_<NAME>_ISSUER, _CLIENT_ID, _CLIENT_SECRET and _SCOPES.
+func (c *Config) readOidcEnv() error {
+	names, ok := os.LookupEnv("OIDC_PROVIDERS")
+	if !ok {
+		return nil
+	}
+
+	var providers []OidcProvider
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		clientSecret, _, err := lookupEnv(prefix+"CLIENT_SECRET", true)
+		if err != nil {
+			return err
+		}
+		providers = append(providers, OidcProvider{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientId:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: clientSecret,
+			Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+		})
+	}
+	c.Oidc.Providers = providers
+	return nil
+}
+
+// Set changes the setting named by its file key, for example
+// "auth.access_token_ttl", from its text form.
+func (c *Config) Set(key, value string) error {
+	found := false
+	var err error
+	walk(reflect.ValueOf(c).Elem(), "", func(fieldKey string, _ reflect.StructField, v reflect.Value) {
+		if fieldKey != key {
+			return
+		}
+		found = true
+		if setErr := setValue(v, value); setErr != nil {
+			err = fmt.Errorf("%s: %w", key, setErr)
+		}
+	})
+	if !found {
+		return fmt.Errorf("unknown setting '%s'", key)
+	}
+	return err
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// walk calls fn for every setting below v with its dotted file key. Lists
+// of sections, such as the OIDC providers, are not walked into.
+func walk(v reflect.Value, prefix string, fn func(key string, field reflect.StructField, v reflect.Value)) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		key := prefix + field.Tag.Get("yaml")
+		if field.Type.Kind() == reflect.Struct && field.Type != reflect.TypeOf(RateLimit{}) {
+			walk(v.Field(i), key+".", fn)
+			continue
+		}
+		fn(key, field, v.Field(i))
+	}
+}
+
+// setValue parses text into v, which is a setting of one of the kinds used
+// by Config. Lists are comma separated.
+func setValue(v reflect.Value, text string) error {
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(text))
+	}
+
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(text)
+		if err != nil {
+			return fmt.Errorf("must be a duration like 30s")
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(text)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return fmt.Errorf("must be true or false")
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Int:
+		n, err := strconv.Atoi(text)
+		if err != nil {
+			return fmt.Errorf("must be a whole number")
+		}
+		v.SetInt(int64(n))
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		var items []string
+		for _, item := range strings.Split(text, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("cannot be set from text, use the config file")
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"reflect"
+	"slices"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Redacted replaces the value of secret settings.
+const Redacted = "[REDACTED]"
+
+// Redacted returns a copy of c with secrets hidden. Of a URL with a password,
+// such as the database URL, only the password is hidden so the host and
+// database stay visible.
+func (c *Config) Redacted() *Config {
+	copied := *c
+	copied.Oidc.Providers = slices.Clone(c.Oidc.Providers)
+	redact(reflect.ValueOf(&copied).Elem())
+	return &copied
+}
+
+func redact(v reflect.Value) {
+	for i := 0; i < v.NumField(); i++ {
+		field, value := v.Type().Field(i), v.Field(i)
+		switch {
+		case field.Type.Kind() == reflect.Struct:
+			redact(value)
+		case field.Type.Kind() == reflect.Slice && field.Type.Elem().Kind() == reflect.Struct:
+			for j := 0; j < value.Len(); j++ {
+				redact(value.Index(j))
+			}
+		case field.Tag.Get("secret") == "true" && value.String() != "":
+			value.SetString(redactSecret(value.String()))
+		}
+	}
+}
+
+func redactSecret(secret string) string {
+	u, err := url.Parse(secret)
+	if err != nil || u.Scheme == "" || u.User == nil {
+		return Redacted
+	}
+	if _, hasPassword := u.User.Password(); !hasPassword {
+		return Redacted
+	}
+	return u.Redacted()
+}
+
+// Write encodes c with secrets redacted as yaml or toml, in the form Load
+// reads.
+func (c *Config) Write(w io.Writer, format string) error {
+	redacted := c.Redacted()
+	switch format {
+	case "yaml":
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(redacted); err != nil {
+			return err
+		}
+		return encoder.Close()
+	case "toml":
+		return toml.NewEncoder(w).Encode(redacted)
+	default:
+		return fmt.Errorf("unknown format '%s', use yaml or toml", format)
+	}
+}
@@ -0,0 +1,160 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// problems collects validation errors as "section.key: message".
+type problems []error
+
+func (p *problems) add(key, format string, args ...any) {
+	*p = append(*p, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+}
+
+func (p *problems) oneOf(key, value string, allowed ...string) {
+	if !slices.Contains(allowed, value) {
+		p.add(key, "must be one of %v, not '%s'", allowed, value)
+	}
+}
+
+func (p *problems) positive(key string, d time.Duration) {
+	if d <= 0 {
+		p.add(key, "must be a positive duration")
+	}
+}
+
+// Validate reports every invalid setting at once.
+func (c *Config) Validate() error {
+	var p problems
+	c.Database.validate(&p)
+
+	if c.Server.Addr == "" {
+		p.add("server.addr", "is required")
+	}
+	if u, err := url.Parse(c.Server.PublicUrl); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		p.add("server.public_url", "must be an absolute http or https URL")
+	}
+	for _, timeout := range []struct {
+		key string
+		d   time.Duration
+	}{
+		{"server.read_timeout", c.Server.ReadTimeout},
+		{"server.write_timeout", c.Server.WriteTimeout},
+		{"server.idle_timeout", c.Server.IdleTimeout},
+	} {
+		if timeout.d < 0 {
+			p.add(timeout.key, "must not be negative, 0 means no timeout")
+		}
+	}
+	p.positive("server.shutdown_timeout", c.Server.ShutdownTimeout)
+	if c.Server.ShutdownDelay < 0 {
+		p.add("server.shutdown_delay", "must not be negative, 0 means no delay")
+	}
+
+	if c.Auth.Secret == "" {
+		p.add("auth.secret", "is required")
+	}
+	p.positive("auth.access_token_ttl", c.Auth.AccessTokenTTL)
+	p.positive("auth.refresh_token_ttl", c.Auth.RefreshTokenTTL)
+	if c.Auth.RefreshTokenTTL < c.Auth.AccessTokenTTL {
+		p.add("auth.refresh_token_ttl", "must not be shorter than auth.access_token_ttl")
+	}
+	if c.Auth.BcryptCost < bcrypt.MinCost || c.Auth.BcryptCost > bcrypt.MaxCost {
+		p.add("auth.bcrypt_cost", "must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	p.oneOf("auth.login_attempt_store", c.Auth.LoginAttemptStore, "db", "memory")
+
+	if c.Audit.Key == "" {
+		p.add("audit.key", "is required")
+	} else if c.Audit.Key == c.Auth.Secret {
+		p.add("audit.key", "must differ from auth.secret")
+	}
+
+	p.oneOf("cookies.same_site", c.Cookies.SameSite, "lax", "strict", "none")
+	if c.Cookies.SameSite == "none" && !c.Cookies.Secure {
+		p.add("cookies.same_site", "none requires cookies.secure, browsers reject it otherwise")
+	}
+
+	for _, limit := range []struct {
+		key string
+		RateLimit
+	}{
+		{"rate_limits.password_forgot", c.RateLimits.PasswordForgot},
+		{"rate_limits.password_reset", c.RateLimits.PasswordReset},
+		{"rate_limits.session_refresh", c.RateLimits.SessionRefresh},
+		{"rate_limits.mfa_verify", c.RateLimits.MfaVerify},
+		{"rate_limits.verification_resend", c.RateLimits.VerificationResend},
+	} {
+		if limit.Requests <= 0 || limit.Window <= 0 {
+			p.add(limit.key, "must allow at least one request in a positive window")
+		}
+	}
+
+	if c.Pagination.DefaultPageSize <= 0 {
+		p.add("pagination.default_page_size", "must be positive")
+	}
+	if c.Pagination.MaxPageSize < c.Pagination.DefaultPageSize {
+		p.add("pagination.max_page_size", "must not be smaller than pagination.default_page_size")
+	}
+
+	p.oneOf("mail.driver", c.Mail.Driver, "smtp", "file", "log")
+	if c.Mail.Driver == "smtp" && c.Mail.SmtpHost == "" {
+		p.add("mail.smtp_host", "is required by the smtp driver")
+	}
+	if c.Mail.Driver == "file" && c.Mail.Dir == "" {
+		p.add("mail.dir", "is required by the file driver")
+	}
+
+	names := make(map[string]bool)
+	for i, provider := range c.Oidc.Providers {
+		key := fmt.Sprintf("oidc.providers[%d]", i)
+		switch {
+		case provider.Name == "":
+			p.add(key+".name", "is required")
+		case names[provider.Name]:
+			p.add(key+".name", "'%s' is configured twice", provider.Name)
+		}
+		names[provider.Name] = true
+		if provider.Issuer == "" {
+			p.add(key+".issuer", "is required")
+		}
+		if provider.ClientId == "" {
+			p.add(key+".client_id", "is required")
+		}
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		p.add("log.level", "must be debug, info, warn or error, not '%s'", c.Log.Level)
+	}
+	p.oneOf("log.format", c.Log.Format, "json", "text")
+
+	p.oneOf("tracing.exporter", c.Tracing.Exporter, "none", "otlp", "stdout", "console")
+	if c.Tracing.ServiceName == "" {
+		p.add("tracing.service_name", "is required")
+	}
+
+	return errors.Join(p...)
+}
+
+// Validate checks the settings needed to reach the database, which is all
+// `app migrate` uses.
+func (d Database) Validate() error {
+	var p problems
+	d.validate(&p)
+	return errors.Join(p...)
+}
+
+func (d Database) validate(p *problems) {
+	if d.Url == "" {
+		p.add("database.url", "is required")
+	}
+	p.positive("database.connect_timeout", d.ConnectTimeout)
+}
@@ -0,0 +1,33 @@
+package custom_middleware
+
+import (
+	"api/catshelter/internal/custom_middleware/heplers"
+	"api/catshelter/internal/service"
+	"net"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// AuditContext records who makes the request for audit log entries written
+// while handling it. It must run after authentication and middleware.RequestID.
+func AuditContext() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				userId, _ := heplers.UserIdFromContext(r.Context())
+				ip, _, err := net.SplitHostPort(r.RemoteAddr)
+				if err != nil {
+					ip = r.RemoteAddr
+				}
+
+				ctx := service.ContextWithAuditActor(r.Context(), service.AuditActor{
+					UserId:    userId,
+					Ip:        ip,
+					RequestId: middleware.GetReqID(r.Context()),
+				})
+				next.ServeHTTP(w, r.WithContext(ctx))
+			},
+		)
+	}
+}
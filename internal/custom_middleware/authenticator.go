@@ -0,0 +1,28 @@
+package custom_middleware
+
+import (
+	"api/catshelter/internal/handler/problem"
+	"net/http"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+// Authenticator rejects requests without a valid token found by
+// jwtauth.Verifier, like jwtauth.Authenticator but answering with a problem
+// document.
+func Authenticator(tokenAuth *jwtauth.JWTAuth) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				token, _, err := jwtauth.FromContext(r.Context())
+				if err != nil || token == nil || jwt.Validate(token, tokenAuth.ValidateOptions()...) != nil {
+					problem.Write(w, r, problem.New(http.StatusUnauthorized, problem.CodeUnauthenticated, "Authentication required"))
+					return
+				}
+
+				next.ServeHTTP(w, r)
+			},
+		)
+	}
+}
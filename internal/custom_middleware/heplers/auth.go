@@ -19,24 +19,52 @@ func UserIdFromContext(ctx context.Context) (string, bool) {
 }
 
 func UserRolesFromContext(ctx context.Context) ([]string, bool) {
-	roles, ok := loadValueFromClaims(ctx, "roles")
+	return stringsFromClaims(ctx, "roles")
+}
+
+func MfaVerifiedFromContext(ctx context.Context) bool {
+	mfa, ok := loadValueFromClaims(ctx, "mfa")
+	if !ok {
+		return false
+	}
+	verified, ok := mfa.(bool)
+	return ok && verified
+}
+
+// PermissionsFromContext returns the permissions granted to the request: the
+// permissions of the user's roles, narrowed to the key's scopes for API keys.
+func PermissionsFromContext(ctx context.Context) ([]string, bool) {
+	return stringsFromClaims(ctx, "permissions")
+}
+
+func ApiKeyIdFromContext(ctx context.Context) (string, bool) {
+	keyId, ok := loadValueFromClaims(ctx, "api_key_id")
+	if !ok {
+		return "", false
+	}
+	keyIdString, ok := keyId.(string)
+	return keyIdString, ok
+}
+
+func stringsFromClaims(ctx context.Context, claim string) ([]string, bool) {
+	values, ok := loadValueFromClaims(ctx, claim)
 	if !ok {
 		return nil, false
 	}
-	rolesSlice, ok := roles.([]interface{})
+	valuesSlice, ok := values.([]interface{})
 	if !ok {
 		return nil, false
 	}
-	stringRoles := make([]string, 0, len(rolesSlice))
-	for _, role := range rolesSlice {
-		roleStr, ok := role.(string)
+	strs := make([]string, 0, len(valuesSlice))
+	for _, value := range valuesSlice {
+		str, ok := value.(string)
 		if !ok {
 			return nil, false
 		}
-		stringRoles = append(stringRoles, roleStr)
+		strs = append(strs, str)
 	}
 
-	return stringRoles, true
+	return strs, true
 }
 
 func loadValueFromClaims(ctx context.Context, value string) (interface{}, bool) {
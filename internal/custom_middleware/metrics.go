@@ -0,0 +1,49 @@
+package custom_middleware
+
+import (
+	"api/catshelter/internal/metrics"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+var knownMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true,
+	http.MethodPatch: true, http.MethodDelete: true, http.MethodOptions: true,
+}
+
+// Metrics counts and times requests by chi route pattern. Requests matching
+// no route share one label value, so scanners cannot blow up the number of
+// series.
+func Metrics() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				start := time.Now()
+				metrics.HTTPRequestsInFlight.Inc()
+				defer metrics.HTTPRequestsInFlight.Dec()
+				ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+				next.ServeHTTP(ww, r)
+
+				route := "unmatched"
+				if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+					route = rctx.RoutePattern()
+				}
+				status := ww.Status()
+				if status == 0 {
+					status = http.StatusOK
+				}
+				method := r.Method
+				if !knownMethods[method] {
+					method = "other"
+				}
+				metrics.HTTPRequests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+				metrics.HTTPRequestDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+			},
+		)
+	}
+}
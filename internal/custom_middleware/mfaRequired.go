@@ -0,0 +1,38 @@
+package custom_middleware
+
+import (
+	"api/catshelter/internal/custom_middleware/heplers"
+	"api/catshelter/internal/handler/problem"
+	"net/http"
+	"strings"
+)
+
+// MfaRequired only lets callers with one of the given roles through when
+// their session passed two-factor authentication at login. Callers without
+// those roles are not asked for a second factor.
+func MfaRequired(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				if hasAnyRole(r, roles) && !heplers.MfaVerifiedFromContext(r.Context()) {
+					problem.Forbidden(w, r, problem.CodeMfaRequired, "Two-factor authentication required")
+					return
+				}
+
+				next.ServeHTTP(w, r)
+			},
+		)
+	}
+}
+
+func hasAnyRole(r *http.Request, roles []string) bool {
+	userRoles, _ := heplers.UserRolesFromContext(r.Context())
+	for _, userRole := range userRoles {
+		for _, role := range roles {
+			if strings.EqualFold(userRole, role) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package custom_middleware
+
+import (
+	"api/catshelter/internal/openapi"
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// maxCheckedBody caps how much of a body OpenAPIConformance keeps to check.
+// Larger bodies, like avatars, are passed through unchecked.
+const maxCheckedBody = 1 << 20
+
+// OpenAPIConformance checks every request and response of a documented route
+// against doc and logs a warning for each mismatch. It never changes what
+// the client gets, so it can run in development and end-to-end environments
+// to catch handlers and documentation drifting apart.
+func OpenAPIConformance(doc *openapi.Document) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				var requestBody []byte
+				checkBody := r.ContentLength >= 0 && r.ContentLength <= maxCheckedBody &&
+					!strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/")
+				if checkBody && r.Body != nil {
+					var err error
+					requestBody, err = io.ReadAll(io.LimitReader(r.Body, maxCheckedBody+1))
+					if err != nil || len(requestBody) > maxCheckedBody {
+						checkBody = false
+					}
+					r.Body = struct {
+						io.Reader
+						io.Closer
+					}{io.MultiReader(bytes.NewReader(requestBody), r.Body), r.Body}
+				}
+
+				var responseBody bytes.Buffer
+				ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+				ww.Tee(&limitedWriter{w: &responseBody, n: maxCheckedBody})
+
+				next.ServeHTTP(ww, r)
+
+				// Undocumented routes, like the document itself, are left to
+				// `app openapi check`.
+				rctx := chi.RouteContext(r.Context())
+				if rctx == nil {
+					return
+				}
+				route := rctx.RoutePattern()
+				if _, ok := doc.Operation(r.Method, route); !ok {
+					return
+				}
+				if checkBody {
+					if err := doc.CheckRequest(r.Method, route, r, requestBody); err != nil {
+						slog.WarnContext(r.Context(), "request does not match the API document", "route", r.Method+" "+route, "error", err)
+					}
+				}
+				status := ww.Status()
+				if status == 0 {
+					status = http.StatusOK
+				}
+				if responseBody.Len() >= maxCheckedBody {
+					return
+				}
+				if err := doc.CheckResponse(r.Method, route, status, ww.Header(), responseBody.Bytes()); err != nil {
+					slog.WarnContext(r.Context(), "response does not match the API document", "route", r.Method+" "+route, "status", status, "error", err)
+				}
+			},
+		)
+	}
+}
+
+// limitedWriter keeps the first n bytes written to it and drops the rest.
+type limitedWriter struct {
+	w io.Writer
+	n int
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if l.n > 0 {
+		keep := p[:min(len(p), l.n)]
+		l.w.Write(keep)
+		l.n -= len(keep)
+	}
+	return len(p), nil
+}
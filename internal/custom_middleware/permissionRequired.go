@@ -0,0 +1,51 @@
+package custom_middleware
+
+import (
+	"api/catshelter/internal/custom_middleware/heplers"
+	"api/catshelter/internal/handler/problem"
+	"net/http"
+	"slices"
+)
+
+// PermissionRequired lets a request through only if it holds all of the
+// given permissions.
+func PermissionRequired(permissions ...string) func(http.Handler) http.Handler {
+	return permissionMiddleware(func(granted []string) bool {
+		for _, p := range permissions {
+			if !slices.Contains(granted, p) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// AnyPermissionRequired lets a request through if it holds at least one of
+// the given permissions.
+func AnyPermissionRequired(permissions ...string) func(http.Handler) http.Handler {
+	return permissionMiddleware(func(granted []string) bool {
+		for _, p := range permissions {
+			if slices.Contains(granted, p) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func permissionMiddleware(allowed func(granted []string) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				granted, _ := heplers.PermissionsFromContext(r.Context())
+
+				if !allowed(granted) {
+					problem.Forbidden(w, r, problem.CodeForbidden, "Forbidden")
+					return
+				}
+
+				next.ServeHTTP(w, r)
+			},
+		)
+	}
+}
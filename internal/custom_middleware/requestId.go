@@ -0,0 +1,35 @@
+package custom_middleware
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
+)
+
+const RequestIdHeader = "X-Request-ID"
+
+// validRequestId keeps ids from clients and proxies safe to log and echo.
+var validRequestId = regexp.MustCompile(`^[A-Za-z0-9._:/+=-]{1,128}$`)
+
+// RequestID takes the request id from the X-Request-ID header, or generates
+// one, and returns it in the response. It is stored where
+// middleware.GetReqID finds it.
+func RequestID() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				requestId := r.Header.Get(RequestIdHeader)
+				if !validRequestId.MatchString(requestId) {
+					requestId = uuid.NewString()
+				}
+
+				w.Header().Set(RequestIdHeader, requestId)
+				ctx := context.WithValue(r.Context(), middleware.RequestIDKey, requestId)
+				next.ServeHTTP(w, r.WithContext(ctx))
+			},
+		)
+	}
+}
@@ -0,0 +1,100 @@
+package custom_middleware
+
+import (
+	"api/catshelter/internal/custom_middleware/heplers"
+	"api/catshelter/internal/handler/problem"
+	"api/catshelter/internal/logging"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// RequestLogger writes one access log line per request and prepares the
+// context so that every record logged while handling the request carries its
+// fields. It must run after RequestID.
+func RequestLogger(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				start := time.Now()
+				ctx := logging.ContextWithRequest(r.Context())
+				ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+				next.ServeHTTP(ww, r.WithContext(ctx))
+
+				status := ww.Status()
+				if status == 0 {
+					status = http.StatusOK
+				}
+				level := slog.LevelInfo
+				if status >= http.StatusInternalServerError {
+					level = slog.LevelError
+				}
+				ip, _, err := net.SplitHostPort(r.RemoteAddr)
+				if err != nil {
+					ip = r.RemoteAddr
+				}
+
+				logger.LogAttrs(ctx, level, "request",
+					slog.String("method", r.Method),
+					slog.String("path", r.URL.Path),
+					slog.String("query", logging.RedactQuery(r.URL.Query())),
+					slog.Int("status", status),
+					slog.Int("bytes", ww.BytesWritten()),
+					slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+					slog.String("ip", ip),
+					slog.String("user_agent", r.UserAgent()),
+				)
+			},
+		)
+	}
+}
+
+// LogUser attaches the authenticated user to the log records of the request.
+// It must run after authentication.
+func LogUser() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				if userId, ok := heplers.UserIdFromContext(r.Context()); ok {
+					logging.SetUserId(r.Context(), userId)
+				}
+				next.ServeHTTP(w, r)
+			},
+		)
+	}
+}
+
+// Recoverer turns a panic into a logged 500 problem.
+func Recoverer() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				defer func() {
+					recovered := recover()
+					if recovered == nil {
+						return
+					}
+					if recovered == http.ErrAbortHandler {
+						panic(recovered)
+					}
+
+					slog.ErrorContext(r.Context(), "panic while handling request",
+						slog.String("panic", fmt.Sprint(recovered)),
+						slog.String("stack", string(debug.Stack())),
+					)
+					if r.Header.Get("Connection") != "Upgrade" {
+						problem.Write(w, r, problem.New(http.StatusInternalServerError, problem.CodeInternal, "Internal server error"))
+					}
+				}()
+
+				next.ServeHTTP(w, r)
+			},
+		)
+	}
+}
@@ -2,10 +2,13 @@ package custom_middleware
 
 import (
 	"api/catshelter/internal/custom_middleware/heplers"
+	"api/catshelter/internal/handler/problem"
 	"net/http"
 	"strings"
 )
 
+// RoleRequired checks the roles claim, which already includes inherited
+// roles, so RoleRequired("staff") also lets admins through.
 func RoleRequired(requiredRole string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(
@@ -21,7 +24,7 @@ func RoleRequired(requiredRole string) func(http.Handler) http.Handler {
 				}
 
 				if !hasRole {
-					http.Error(w, "Forbidden", http.StatusForbidden)
+					problem.Forbidden(w, r, problem.CodeForbidden, "Forbidden")
 					return
 				}
 
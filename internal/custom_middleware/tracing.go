@@ -0,0 +1,30 @@
+package custom_middleware
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TraceRoute names the server span started by otelhttp after the chi route
+// pattern, e.g. "GET /api/cats/{id}", which is only known once the request
+// has been routed.
+func TraceRoute() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				next.ServeHTTP(w, r)
+
+				rctx := chi.RouteContext(r.Context())
+				if rctx == nil || rctx.RoutePattern() == "" {
+					return
+				}
+				span := trace.SpanFromContext(r.Context())
+				span.SetName(r.Method + " " + rctx.RoutePattern())
+				span.SetAttributes(semconv.HTTPRoute(rctx.RoutePattern()))
+			},
+		)
+	}
+}
@@ -1,7 +1,6 @@
 package domain
 
 import (
-	"errors"
 	"fmt"
 
 	"github.com/google/uuid"
@@ -14,14 +13,12 @@ type Cat struct {
 	UserId *string `gorm:"type:uuid"`
 }
 
-var ErrValidation = errors.New("validation error")
-
 func NewCat(name string, age int) (*Cat, error) {
 	if len(name) == 0 {
-		return nil, fmt.Errorf("%w: cat must have a name", ErrValidation)
+		return nil, NewFieldError("name", "cat must have a name")
 	}
 	if age <= 0 {
-		return nil, fmt.Errorf("%w: cat age must be positive", ErrValidation)
+		return nil, NewFieldError("age", "cat age must be positive")
 	}
 
 	return &Cat{
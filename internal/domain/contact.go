@@ -0,0 +1,48 @@
+package domain
+
+import (
+	"net/mail"
+	"strings"
+)
+
+var (
+	ErrInvalidEmail = NewFieldError("email", "invalid email address")
+	ErrInvalidPhone = NewFieldError("phone", "phone must be in international format, e.g. +14155552671")
+)
+
+// NormalizeEmail trims and lowercases an address and rejects display names
+// and anything net/mail does not accept.
+func NormalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email || !strings.Contains(email[strings.LastIndex(email, "@"):], ".") {
+		return "", ErrInvalidEmail
+	}
+	return email, nil
+}
+
+// NormalizePhone converts a phone number to E.164, dropping the spaces, dots,
+// dashes and parentheses people like to type. Only ASCII digits are accepted:
+// E.164 has no others, and two spellings of one number must not both pass the
+// unique index.
+func NormalizePhone(phone string) (string, error) {
+	var b strings.Builder
+	for i, r := range strings.TrimSpace(phone) {
+		switch {
+		case r == '+' && i == 0:
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')':
+		default:
+			return "", ErrInvalidPhone
+		}
+	}
+
+	normalized := b.String()
+	digits := len(strings.TrimPrefix(normalized, "+"))
+	if !strings.HasPrefix(normalized, "+") || digits < 8 || digits > 15 || normalized[1] == '0' {
+		return "", ErrInvalidPhone
+	}
+	return normalized, nil
+}
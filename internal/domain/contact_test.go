@@ -0,0 +1,38 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizePhone(t *testing.T) {
+	tests := []struct {
+		phone string
+		want  string
+	}{
+		{"+14155552671", "+14155552671"},
+		{" +1 (415) 555-26.71 ", "+14155552671"},
+		{"14155552671", ""},
+		{"+04155552671", ""},
+		{"+1415", ""},
+		{"+1 415 555 2671 ext 1", ""},
+		// Arabic-Indic, fullwidth and Devanagari digits are digits to
+		// unicode.IsDigit but not to E.164.
+		{"+442079460٠٠٠", ""},
+		{"+١٤١٥٥٥٥٢٦٧١", ""},
+		{"+4420794６０", ""},
+		{"+44207946०", ""},
+	}
+	for _, tt := range tests {
+		got, err := NormalizePhone(tt.phone)
+		if tt.want == "" {
+			if !errors.Is(err, ErrInvalidPhone) {
+				t.Errorf("NormalizePhone(%q) = %q, %v, want ErrInvalidPhone", tt.phone, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("NormalizePhone(%q) = %q, %v, want %q", tt.phone, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package domain
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+const (
+	PermissionCatsRead         = "cats:read"
+	PermissionCatsWrite        = "cats:write"
+	PermissionUsersRead        = "users:read"
+	PermissionUsersManage      = "users:manage"
+	PermissionUsersRolesManage = "users:roles:manage"
+	PermissionRolesManage      = "roles:manage"
+	PermissionAuditRead        = "audit:read"
+	PermissionMedicalWrite     = "medical:write"
+	PermissionAdoptionsWrite   = "adoptions:write"
+	PermissionProfileWrite     = "profile:write"
+)
+
+// DefaultPermissions are created at startup, each attached to the roles
+// listed for it the first time it appears.
+var DefaultPermissions = []struct {
+	Name        string
+	Description string
+	Roles       []string
+}{
+	{PermissionCatsRead, "View cats", []string{"admin", "user"}},
+	{PermissionCatsWrite, "Add and edit cats", []string{"admin", "staff"}},
+	{PermissionUsersRead, "View other users", []string{"admin", "staff"}},
+	{PermissionUsersManage, "Unlock users, reset their two-factor authentication and manage service accounts", []string{"admin"}},
+	{PermissionUsersRolesManage, "Grant and revoke user roles", []string{"admin"}},
+	{PermissionRolesManage, "Create, edit and delete roles", []string{"admin"}},
+	{PermissionAuditRead, "Read and export the audit log", []string{"admin"}},
+	{PermissionMedicalWrite, "Record medical information about cats", []string{"admin", "volunteer"}},
+	{PermissionAdoptionsWrite, "Adopt cats", []string{"admin", "user"}},
+	{PermissionProfileWrite, "Edit own profile", []string{"admin", "user"}},
+}
+
+type Permission struct {
+	BaseModel
+	Name        string `gorm:"unique"`
+	Description string
+}
+
+func NewPermission(name, description string) (*Permission, error) {
+	if name == "" {
+		return nil, errors.New("permission name must not be empty")
+	}
+
+	return &Permission{
+		BaseModel: BaseModel{
+			Id: uuid.NewString(),
+		},
+		Name:        name,
+		Description: description,
+	}, nil
+}
+
+func IsKnownPermission(name string) bool {
+	for _, p := range DefaultPermissions {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -2,13 +2,45 @@ package domain
 
 import (
 	"errors"
+	"fmt"
+	"regexp"
+	"strings"
 
 	"github.com/google/uuid"
 )
 
+// BuiltinRoles are relied on by the application itself and can be neither
+// renamed nor deleted.
+var BuiltinRoles = []string{"admin", "user"}
+
+// DefaultRoles are created at startup, parents before the roles inheriting
+// from them.
+var DefaultRoles = []struct {
+	Name         string
+	InheritsFrom string
+}{
+	{"user", ""},
+	{"volunteer", "user"},
+	{"staff", "volunteer"},
+	{"admin", "staff"},
+}
+
+var (
+	ErrBuiltinRole         = fmt.Errorf("%w: built-in roles cannot be renamed or deleted", ErrValidation)
+	ErrRoleInheritanceLoop = fmt.Errorf("%w: role inheritance must not form a cycle", ErrValidation)
+	ErrInvalidRoleName     = NewFieldError("name", "role name must be 2-32 lowercase letters, digits, '-' or '_'")
+
+	roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{1,31}$`)
+)
+
+// Role groups permissions. A role that inherits from another one also has
+// all of its permissions, e.g. admin ⊇ staff ⊇ volunteer ⊇ user.
 type Role struct {
 	BaseModel
-	Name string `gorm:"unique"`
+	Name           string `gorm:"unique"`
+	Description    string
+	InheritsFromId *string       `gorm:"type:uuid"`
+	Permissions    []*Permission `gorm:"many2many:role_permissions;"`
 }
 
 func NewRole(name string) (*Role, error) {
@@ -23,3 +55,113 @@ func NewRole(name string) (*Role, error) {
 		Name: name,
 	}, nil
 }
+
+func ValidateRoleName(name string) error {
+	if !roleNamePattern.MatchString(name) {
+		return ErrInvalidRoleName
+	}
+	return nil
+}
+
+func (r *Role) IsBuiltin() bool {
+	for _, name := range BuiltinRoles {
+		if strings.EqualFold(r.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Role) Rename(name string) error {
+	if strings.EqualFold(r.Name, name) {
+		return nil
+	}
+	if r.IsBuiltin() {
+		return ErrBuiltinRole
+	}
+	if err := ValidateRoleName(name); err != nil {
+		return err
+	}
+	r.Name = name
+	return nil
+}
+
+// InheritFrom makes r include parent. all must contain every role so the
+// chain above parent can be checked for cycles; a nil parent clears it.
+func (r *Role) InheritFrom(parent *Role, all []*Role) error {
+	if parent == nil {
+		r.InheritsFromId = nil
+		return nil
+	}
+
+	byId := rolesById(all)
+	for current := parent; current != nil; current = byId[deref(current.InheritsFromId)] {
+		if current.Id == r.Id {
+			return ErrRoleInheritanceLoop
+		}
+	}
+	r.InheritsFromId = &parent.Id
+	return nil
+}
+
+func (r *Role) HasPermission(name string) bool {
+	for _, p := range r.Permissions {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// EffectiveRoles expands roles with every role they inherit from. all must
+// contain every role, with permissions loaded if they are needed later.
+func EffectiveRoles(roles []*Role, all []*Role) []*Role {
+	byId := rolesById(all)
+	seen := make(map[string]bool)
+	effective := make([]*Role, 0, len(roles))
+	for _, role := range roles {
+		for current := byId[role.Id]; current != nil && !seen[current.Id]; current = byId[deref(current.InheritsFromId)] {
+			seen[current.Id] = true
+			effective = append(effective, current)
+		}
+	}
+	return effective
+}
+
+func RoleNames(roles []*Role) []string {
+	names := make([]string, 0, len(roles))
+	for _, role := range roles {
+		names = append(names, role.Name)
+	}
+	return names
+}
+
+// PermissionNames returns the distinct permission names granted by roles.
+func PermissionNames(roles []*Role) []string {
+	seen := make(map[string]bool)
+	permissions := make([]string, 0)
+	for _, r := range roles {
+		for _, p := range r.Permissions {
+			if !seen[p.Name] {
+				seen[p.Name] = true
+				permissions = append(permissions, p.Name)
+			}
+		}
+	}
+	return permissions
+}
+
+func rolesById(roles []*Role) map[string]*Role {
+	byId := make(map[string]*Role, len(roles))
+	for _, role := range roles {
+		byId[role.Id] = role
+	}
+	return byId
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -2,6 +2,9 @@ package domain
 
 import (
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
@@ -9,24 +12,75 @@ import (
 
 type User struct {
 	BaseModel
-	Login    string `gorm:"unique"`
-	Password string
-	Name     string
-	Roles    []*Role `gorm:"many2many:user_roles;"`
-	Cats     []*Cat
+	Login           string `gorm:"unique"`
+	Password        string
+	Name            string
+	Email           *string `gorm:"uniqueIndex"`
+	EmailVerifiedAt *time.Time
+	Phone           *string `gorm:"uniqueIndex"`
+	TotpSecret      string
+	TotpEnabled     bool
+	TotpLastStep    int64
+	ServiceAccount  bool
+	Status          string `gorm:"index;default:active"`
+	SuspendedReason string
+	SuspendedUntil  *time.Time
+	DeletedAt       *time.Time
+	CreatedAt       time.Time `gorm:"index;default:now()"`
+	Version         int64     `gorm:"not null;default:1"`
+	Roles           []*Role   `gorm:"many2many:user_roles;"`
+	Cats            []*Cat
 }
 
-var ErrCannotRemoveLastRole = errors.New("user must have at least one role")
+const (
+	UserStatusActive    = "active"
+	UserStatusSuspended = "suspended"
+	UserStatusBanned    = "banned"
+	UserStatusDeleted   = "deleted"
+)
+
+var (
+	ErrCannotRemoveLastRole = errors.New("user must have at least one role")
+	ErrTotpAlreadyEnabled   = errors.New("two-factor authentication is already enabled")
+	ErrTotpNotEnrolled      = errors.New("two-factor authentication is not enrolled")
+	ErrEmailNotVerified     = errors.New("email address is not verified")
+	ErrEmailChanged         = errors.New("email address has changed since verification was requested")
+	ErrAccountDisabled      = errors.New("account is disabled")
+	ErrAccountDeleted       = fmt.Errorf("%w: account is deleted", ErrAccountDisabled)
+	ErrAccountBanned        = fmt.Errorf("%w: a banned account must be reactivated before it can be suspended", ErrValidation)
+)
+
+// AccountDisabledError explains why a suspended or banned user may not sign
+// in.
+type AccountDisabledError struct {
+	Status string
+	Reason string
+	Until  *time.Time
+}
+
+func (e *AccountDisabledError) Error() string {
+	if e.Until != nil {
+		return fmt.Sprintf("account is %s until %s: %s", e.Status, e.Until.UTC().Format(time.RFC3339), e.Reason)
+	}
+	return fmt.Sprintf("account is %s: %s", e.Status, e.Reason)
+}
+
+func (e *AccountDisabledError) Unwrap() error {
+	return ErrAccountDisabled
+}
 
 func NewUser(login, password, name string) (*User, error) {
-	if len(password) < 8 {
-		return nil, errors.New("password is too short")
+	if err := validatePassword(password); err != nil {
+		return nil, err
 	}
-	if len(login) < 6 {
-		return nil, errors.New("login is too short")
+	if err := ValidateLogin(login); err != nil {
+		return nil, err
+	}
+	if err := validateName(name); err != nil {
+		return nil, err
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := hashPassword(password)
 	if err != nil {
 		return nil, err
 	}
@@ -36,11 +90,97 @@ func NewUser(login, password, name string) (*User, error) {
 			Id: uuid.NewString(),
 		},
 		Login:    login,
-		Password: string(hashedPassword),
+		Password: hashedPassword,
 		Name:     name,
+		Status:   UserStatusActive,
+		Version:  1,
+	}, nil
+}
+
+const (
+	minLoginLength = 6
+	maxLoginLength = 64
+	maxNameLength  = 100
+)
+
+func ValidateLogin(login string) error {
+	if len(login) < minLoginLength {
+		return NewFieldError("login", "login is too short")
+	}
+	if len(login) > maxLoginLength {
+		return NewFieldError("login", "login is too long")
+	}
+	if strings.TrimSpace(login) != login || strings.ContainsAny(login, " \t\r\n") {
+		return NewFieldError("login", "login must not contain whitespace")
+	}
+	return nil
+}
+
+func validateName(name string) error {
+	if len([]rune(name)) > maxNameLength {
+		return NewFieldError("name", "name is too long")
+	}
+	return nil
+}
+
+func (u *User) ChangeLogin(login string) error {
+	if err := ValidateLogin(login); err != nil {
+		return err
+	}
+	u.Login = login
+	return nil
+}
+
+func (u *User) Rename(name string) error {
+	name = strings.TrimSpace(name)
+	if err := validateName(name); err != nil {
+		return err
+	}
+	u.Name = name
+	return nil
+}
+
+// NewUserWithoutPassword creates a user who signs in with an identity
+// provider. Without a password hash no password matches, until the user
+// sets one through a password reset.
+func NewUserWithoutPassword(login, name string) (*User, error) {
+	if err := ValidateLogin(login); err != nil {
+		return nil, err
+	}
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+	return &User{
+		BaseModel: BaseModel{
+			Id: uuid.NewString(),
+		},
+		Login:   login,
+		Name:    name,
+		Status:  UserStatusActive,
+		Version: 1,
 	}, nil
 }
 
+// HasPassword tells whether the user has a password to confirm actions with.
+func (u *User) HasPassword() bool {
+	return u.Password != ""
+}
+
+// NewServiceAccount creates a user for automation. Its password is random and
+// never revealed, so it can only authenticate with API keys.
+func NewServiceAccount(login, name string) (*User, error) {
+	password, err := randomKeyPart(32)
+	if err != nil {
+		return nil, err
+	}
+	user, err := NewUser(login, password, name)
+	if err != nil {
+		return nil, err
+	}
+	user.ServiceAccount = true
+	return user, nil
+}
+
 func (u *User) AddRole(role *Role) error {
 	_, ok := u.IsHaveRole(role)
 	if ok {
@@ -72,3 +212,248 @@ func (u *User) IsHaveRole(role *Role) (int, bool) {
 	}
 	return -1, false
 }
+
+// SetEmail normalizes and stores the address. A changed address has to be
+// verified again; an empty one removes it.
+func (u *User) SetEmail(email string) error {
+	if strings.TrimSpace(email) == "" {
+		u.Email = nil
+		u.EmailVerifiedAt = nil
+		return nil
+	}
+	normalized, err := NormalizeEmail(email)
+	if err != nil {
+		return err
+	}
+	if u.Email != nil && *u.Email == normalized {
+		return nil
+	}
+	u.Email = &normalized
+	u.EmailVerifiedAt = nil
+	return nil
+}
+
+func (u *User) SetPhone(phone string) error {
+	if strings.TrimSpace(phone) == "" {
+		u.Phone = nil
+		return nil
+	}
+	normalized, err := NormalizePhone(phone)
+	if err != nil {
+		return err
+	}
+	u.Phone = &normalized
+	return nil
+}
+
+// VerifyEmail confirms email only if it is still the user's current address,
+// so links sent to a previous address cannot verify the new one.
+func (u *User) VerifyEmail(email string) error {
+	if u.Email == nil || *u.Email != email {
+		return ErrEmailChanged
+	}
+	if u.EmailVerifiedAt == nil {
+		now := time.Now()
+		u.EmailVerifiedAt = &now
+	}
+	return nil
+}
+
+func (u *User) IsEmailVerified() bool {
+	return u.Email != nil && u.EmailVerifiedAt != nil
+}
+
+func (u *User) ChangePassword(password string) error {
+	hash, err := NewPasswordHash(password)
+	if err != nil {
+		return err
+	}
+	u.SetPassword(hash)
+	return nil
+}
+
+// PasswordHash is a hash of a password that passed validation.
+type PasswordHash string
+
+// NewPasswordHash validates and hashes password, so a caller can get the
+// fallible part done before it commits to the change, e.g. before using up a
+// reset token.
+func NewPasswordHash(password string) (PasswordHash, error) {
+	if err := validatePassword(password); err != nil {
+		return "", err
+	}
+	hashedPassword, err := hashPassword(password)
+	if err != nil {
+		return "", err
+	}
+	return PasswordHash(hashedPassword), nil
+}
+
+func (u *User) SetPassword(hash PasswordHash) {
+	u.Password = string(hash)
+}
+
+// maxPasswordBytes is the most bcrypt hashes; it rejects longer input.
+const maxPasswordBytes = 72
+
+func validatePassword(password string) error {
+	if len(password) < 8 {
+		return NewFieldError("password", "password is too short")
+	}
+	if len(password) > maxPasswordBytes {
+		return NewFieldError("password", fmt.Sprintf("password is too long, at most %d bytes", maxPasswordBytes))
+	}
+	return nil
+}
+
+var passwordHashCost = bcrypt.DefaultCost
+
+// SetPasswordHashCost sets the bcrypt cost of new password hashes. Existing
+// hashes keep their cost until the password changes. It is meant to be called
+// at startup.
+func SetPasswordHashCost(cost int) {
+	passwordHashCost = cost
+}
+
+func hashPassword(password string) (string, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), passwordHashCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashedPassword), nil
+}
+
+func (u *User) CheckPassword(password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password)) == nil
+}
+
+// Suspend disables the account until the given time, or indefinitely when
+// until is nil. A ban is not turned into a suspension, which could run out.
+func (u *User) Suspend(reason string, until *time.Time) error {
+	switch u.Status {
+	case UserStatusDeleted:
+		return ErrAccountDeleted
+	case UserStatusBanned:
+		return ErrAccountBanned
+	}
+	if strings.TrimSpace(reason) == "" {
+		return NewFieldError("reason", "a suspension needs a reason")
+	}
+	if until != nil && !until.After(time.Now()) {
+		return NewFieldError("until", "suspension must end in the future")
+	}
+	u.Status = UserStatusSuspended
+	u.SuspendedReason = reason
+	u.SuspendedUntil = until
+	return nil
+}
+
+// Ban disables the account permanently; only Reactivate lifts it.
+func (u *User) Ban(reason string) error {
+	if u.Status == UserStatusDeleted {
+		return ErrAccountDeleted
+	}
+	if strings.TrimSpace(reason) == "" {
+		return NewFieldError("reason", "a ban needs a reason")
+	}
+	u.Status = UserStatusBanned
+	u.SuspendedReason = reason
+	u.SuspendedUntil = nil
+	return nil
+}
+
+func (u *User) Reactivate() error {
+	if u.Status == UserStatusDeleted {
+		return ErrAccountDeleted
+	}
+	u.Status = UserStatusActive
+	u.SuspendedReason = ""
+	u.SuspendedUntil = nil
+	return nil
+}
+
+// CheckActive reports why the user may not sign in, if they may not. A
+// suspension whose end has passed is lifted.
+func (u *User) CheckActive() error {
+	switch u.Status {
+	case UserStatusSuspended:
+		if u.SuspendedUntil != nil && !u.SuspendedUntil.After(time.Now()) {
+			return u.Reactivate()
+		}
+		return &AccountDisabledError{Status: u.Status, Reason: u.SuspendedReason, Until: u.SuspendedUntil}
+	case UserStatusBanned:
+		return &AccountDisabledError{Status: u.Status, Reason: u.SuspendedReason}
+	case UserStatusDeleted:
+		return ErrAccountDeleted
+	}
+	return nil
+}
+
+// Anonymize erases personal data for an account deletion. The row itself is
+// kept so adoption records still point at it, but nothing identifies the
+// person any more and the account can never sign in again.
+func (u *User) Anonymize() error {
+	password, err := randomKeyPart(32)
+	if err != nil {
+		return err
+	}
+	hashedPassword, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	u.Login = "deleted-" + u.Id
+	u.Password = hashedPassword
+	u.Name = ""
+	u.Email = nil
+	u.EmailVerifiedAt = nil
+	u.Phone = nil
+	u.TotpSecret = ""
+	u.TotpEnabled = false
+	u.TotpLastStep = 0
+	u.Status = UserStatusDeleted
+	u.SuspendedReason = ""
+	u.SuspendedUntil = nil
+	u.DeletedAt = &now
+	u.Version++
+	return nil
+}
+
+func (u *User) HasRoleName(name string) bool {
+	for _, r := range u.Roles {
+		if strings.EqualFold(r.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// EnrollTotp stores a secret that only becomes active after EnableTotp, so a
+// half-finished enrollment never locks the user out.
+func (u *User) EnrollTotp(secret string) error {
+	if u.TotpEnabled {
+		return ErrTotpAlreadyEnabled
+	}
+	u.TotpSecret = secret
+	u.TotpLastStep = 0
+	return nil
+}
+
+func (u *User) EnableTotp(step int64) error {
+	if u.TotpEnabled {
+		return ErrTotpAlreadyEnabled
+	}
+	if u.TotpSecret == "" {
+		return ErrTotpNotEnrolled
+	}
+	u.TotpEnabled = true
+	u.TotpLastStep = step
+	return nil
+}
+
+func (u *User) DisableTotp() {
+	u.TotpSecret = ""
+	u.TotpEnabled = false
+	u.TotpLastStep = 0
+}
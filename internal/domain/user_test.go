@@ -0,0 +1,49 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSuspendKeepsBans(t *testing.T) {
+	user, err := NewUser("murka_cat", "password", "Murka")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := user.Ban("spam"); err != nil {
+		t.Fatal(err)
+	}
+
+	until := time.Now().Add(time.Hour)
+	if err := user.Suspend("cooling off", &until); !errors.Is(err, ErrValidation) {
+		t.Errorf("Suspend of a banned user = %v, want a validation error", err)
+	}
+	if user.Status != UserStatusBanned || user.SuspendedReason != "spam" || user.SuspendedUntil != nil {
+		t.Errorf("user is %s for %q until %v, want banned for spam", user.Status, user.SuspendedReason, user.SuspendedUntil)
+	}
+	if err := user.CheckActive(); !errors.Is(err, ErrAccountDisabled) {
+		t.Errorf("CheckActive = %v, want the ban to hold", err)
+	}
+}
+
+func TestBanEndsSuspension(t *testing.T) {
+	user, err := NewUser("murka_cat", "password", "Murka")
+	if err != nil {
+		t.Fatal(err)
+	}
+	until := time.Now().Add(time.Hour)
+	if err := user.Suspend("cooling off", &until); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := user.Ban("spam"); err != nil {
+		t.Fatal(err)
+	}
+	if user.Status != UserStatusBanned || user.SuspendedUntil != nil {
+		t.Errorf("user is %s until %v, want banned for good", user.Status, user.SuspendedUntil)
+	}
+	if err := user.Ban(" "); !errors.Is(err, ErrValidation) {
+		t.Errorf("Ban without a reason = %v, want a validation error", err)
+	}
+}
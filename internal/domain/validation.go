@@ -0,0 +1,26 @@
+package domain
+
+import (
+	"errors"
+)
+
+var ErrValidation = errors.New("validation error")
+
+// FieldError is a validation error caused by a single input field, so clients
+// can show it next to that field. It matches ErrValidation.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func NewFieldError(field, message string) *FieldError {
+	return &FieldError{Field: field, Message: message}
+}
+
+func (e *FieldError) Error() string {
+	return ErrValidation.Error() + ": " + e.Message
+}
+
+func (e *FieldError) Unwrap() error {
+	return ErrValidation
+}
@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"api/catshelter/internal/custom_middleware/heplers"
+	"api/catshelter/internal/handler/dto"
+	"api/catshelter/internal/handler/problem"
+	"api/catshelter/internal/service"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type AccountHandler struct {
+	accountService service.AccountService
+	authHandler    *AuthHandler
+}
+
+func (h *AccountHandler) Suspend(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		problem.BadRequest(w, r, "User id is missing in URL")
+		return
+	}
+
+	var req dto.SuspendUserRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	actorId, _ := heplers.UserIdFromContext(r.Context())
+	if err := h.accountService.Suspend(r.Context(), actorId, id, req.Reason, req.Until); err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	w.Write([]byte("User successfully suspended"))
+}
+
+func (h *AccountHandler) Ban(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		problem.BadRequest(w, r, "User id is missing in URL")
+		return
+	}
+
+	var req dto.BanUserRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	actorId, _ := heplers.UserIdFromContext(r.Context())
+	if err := h.accountService.Ban(r.Context(), actorId, id, req.Reason); err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	w.Write([]byte("User successfully banned"))
+}
+
+func (h *AccountHandler) Reactivate(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		problem.BadRequest(w, r, "User id is missing in URL")
+		return
+	}
+
+	if err := h.accountService.Reactivate(r.Context(), id); err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	w.Write([]byte("User successfully reactivated"))
+}
+
+// DeleteMe deletes the caller's account after checking their password, if they
+// have one, and signs them out.
+func (h *AccountHandler) DeleteMe(w http.ResponseWriter, r *http.Request) {
+	userId, ok := heplers.UserIdFromContext(r.Context())
+	if !ok {
+		problem.MissingUser(w, r)
+		return
+	}
+
+	var req dto.DeleteAccountRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	if err := h.accountService.Delete(r.Context(), userId, req.Password); err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	h.authHandler.clearAuthCookies(w)
+	w.Write([]byte("Account successfully deleted"))
+}
+
+func (h *AccountHandler) ExportMe(w http.ResponseWriter, r *http.Request) {
+	userId, ok := heplers.UserIdFromContext(r.Context())
+	if !ok {
+		problem.MissingUser(w, r)
+		return
+	}
+
+	data, err := h.accountService.Export(r.Context(), userId)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="account-export.json"`)
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(mapAccountDataToAccountExportResponse(data))
+}
+
+func NewAccountHandler(accountService service.AccountService, authHandler *AuthHandler) *AccountHandler {
+	return &AccountHandler{accountService: accountService, authHandler: authHandler}
+}
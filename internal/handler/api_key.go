@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"api/catshelter/internal/custom_middleware/heplers"
+	"api/catshelter/internal/domain"
+	"api/catshelter/internal/handler/dto"
+	"api/catshelter/internal/handler/problem"
+	"api/catshelter/internal/service"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type ApiKeyHandler struct {
+	apiKeyService service.ApiKeyService
+}
+
+func (h *ApiKeyHandler) CreateMine(w http.ResponseWriter, r *http.Request) {
+	userId, ok := heplers.UserIdFromContext(r.Context())
+	if !ok {
+		problem.MissingUser(w, r)
+		return
+	}
+	h.create(w, r, userId)
+}
+
+func (h *ApiKeyHandler) ListMine(w http.ResponseWriter, r *http.Request) {
+	userId, ok := heplers.UserIdFromContext(r.Context())
+	if !ok {
+		problem.MissingUser(w, r)
+		return
+	}
+
+	h.list(w, r, userId)
+}
+
+func (h *ApiKeyHandler) RevokeMine(w http.ResponseWriter, r *http.Request) {
+	userId, ok := heplers.UserIdFromContext(r.Context())
+	if !ok {
+		problem.MissingUser(w, r)
+		return
+	}
+
+	h.revoke(w, r, userId)
+}
+
+func (h *ApiKeyHandler) CreateServiceAccount(w http.ResponseWriter, r *http.Request) {
+	var req dto.CreateServiceAccountRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	user, err := h.apiKeyService.CreateServiceAccount(r.Context(), req.Login, req.Name)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(&dto.ServiceAccountResponse{Id: user.Id, Login: user.Login, Name: user.Name})
+}
+
+func (h *ApiKeyHandler) CreateForServiceAccount(w http.ResponseWriter, r *http.Request) {
+	account, ok := h.serviceAccountFromUrl(w, r)
+	if !ok {
+		return
+	}
+
+	h.create(w, r, account.Id)
+}
+
+func (h *ApiKeyHandler) ListForServiceAccount(w http.ResponseWriter, r *http.Request) {
+	account, ok := h.serviceAccountFromUrl(w, r)
+	if !ok {
+		return
+	}
+
+	h.list(w, r, account.Id)
+}
+
+func (h *ApiKeyHandler) RevokeForServiceAccount(w http.ResponseWriter, r *http.Request) {
+	account, ok := h.serviceAccountFromUrl(w, r)
+	if !ok {
+		return
+	}
+
+	h.revoke(w, r, account.Id)
+}
+
+func (h *ApiKeyHandler) serviceAccountFromUrl(w http.ResponseWriter, r *http.Request) (*domain.User, bool) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		problem.BadRequest(w, r, "Service account id is missing in URL")
+		return nil, false
+	}
+
+	account, err := h.apiKeyService.FindServiceAccount(r.Context(), id)
+	if err != nil {
+		problem.Error(w, r, err)
+		return nil, false
+	}
+	return account, true
+}
+
+func (h *ApiKeyHandler) create(w http.ResponseWriter, r *http.Request, userId string) {
+	var req dto.CreateApiKeyRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	mfaVerified := heplers.MfaVerifiedFromContext(r.Context())
+	key, plain, err := h.apiKeyService.Create(r.Context(), userId, req.Name, req.Scopes, req.ExpiresAt, mfaVerified)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(&dto.CreatedApiKeyResponse{ApiKeyResponse: mapApiKeyToApiKeyResponse(key), Key: plain})
+}
+
+func (h *ApiKeyHandler) list(w http.ResponseWriter, r *http.Request, userId string) {
+	keys, err := h.apiKeyService.List(r.Context(), userId)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(mapApiKeysToApiKeyResponses(keys))
+}
+
+func (h *ApiKeyHandler) revoke(w http.ResponseWriter, r *http.Request, userId string) {
+	keyId := chi.URLParam(r, "keyId")
+	if keyId == "" {
+		problem.BadRequest(w, r, "API key id is missing in URL")
+		return
+	}
+
+	if err := h.apiKeyService.Revoke(r.Context(), userId, keyId); err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	w.Write([]byte("API key successfully revoked"))
+}
+
+func NewApiKeyHandler(apiKeyService service.ApiKeyService) *ApiKeyHandler {
+	return &ApiKeyHandler{apiKeyService: apiKeyService}
+}
@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"api/catshelter/internal/handler/dto"
+	"api/catshelter/internal/handler/problem"
+	"api/catshelter/internal/repository"
+	"api/catshelter/internal/service"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type AuditHandler struct {
+	auditService service.AuditService
+}
+
+// List returns audit entries, newest first. Filters: actor_id, action,
+// target_type, target_id, from and to (RFC 3339). With '?format=csv' or
+// 'Accept: text/csv' every matching entry is exported as CSV instead.
+func (h *AuditHandler) List(w http.ResponseWriter, r *http.Request) {
+	filter, err := auditFilterFromRequest(r)
+	if err != nil {
+		problem.BadRequest(w, r, err.Error())
+		return
+	}
+
+	if r.URL.Query().Get("format") == "csv" || strings.Contains(r.Header.Get("Accept"), "text/csv") {
+		h.exportCsv(w, r, filter)
+		return
+	}
+
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page <= 0 {
+		page = 1
+	}
+	pageSize, err := strconv.Atoi(r.URL.Query().Get("page_size"))
+	if err != nil || pageSize <= 0 {
+		pageSize = repository.DefaultPageSize()
+	}
+
+	entries, paginationInfo, err := h.auditService.Find(r.Context(), filter, page, pageSize)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	response := &dto.AuditPaginatedResponse{
+		Data:       mapAuditEntriesToAuditEntryResponses(entries),
+		Pagination: *paginationInfo,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *AuditHandler) Verify(w http.ResponseWriter, r *http.Request) {
+	verification, err := h.auditService.Verify(r.Context())
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&dto.AuditVerificationResponse{
+		Entries:     verification.Entries,
+		Valid:       verification.Valid,
+		BrokenAtSeq: verification.BrokenAtSeq,
+	})
+}
+
+func (h *AuditHandler) exportCsv(w http.ResponseWriter, r *http.Request, filter *repository.AuditFilter) {
+	entries, err := h.auditService.FindAll(r.Context(), filter)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="audit-log.csv"`)
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"seq", "created_at", "actor_id", "action", "target_type", "target_id", "before", "after", "ip", "request_id", "prev_hash", "hash"})
+	for _, entry := range entries {
+		actorId := ""
+		if entry.ActorId != nil {
+			actorId = *entry.ActorId
+		}
+		writer.Write([]string{
+			strconv.FormatInt(entry.Seq, 10),
+			entry.CreatedAt.UTC().Format(time.RFC3339Nano),
+			csvCell(actorId),
+			csvCell(entry.Action),
+			csvCell(entry.TargetType),
+			csvCell(entry.TargetId),
+			csvCell(entry.Before),
+			csvCell(entry.After),
+			csvCell(entry.Ip),
+			csvCell(entry.RequestId),
+			entry.PrevHash,
+			entry.Hash,
+		})
+	}
+	writer.Flush()
+}
+
+// csvCell keeps spreadsheets from running a value as a formula by prefixing
+// the characters that start one with a quote.
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func auditFilterFromRequest(r *http.Request) (*repository.AuditFilter, error) {
+	query := r.URL.Query()
+	filter := &repository.AuditFilter{
+		ActorId:    query.Get("actor_id"),
+		Action:     query.Get("action"),
+		TargetType: query.Get("target_type"),
+		TargetId:   query.Get("target_id"),
+	}
+	for name, target := range map[string]**time.Time{"from": &filter.From, "to": &filter.To} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid '%s' time, expected RFC 3339", name)
+		}
+		*target = &t
+	}
+	return filter, nil
+}
+
+func NewAuditHandler(auditService service.AuditService) *AuditHandler {
+	return &AuditHandler{auditService: auditService}
+}
@@ -2,95 +2,163 @@ package handler
 
 import (
 	"api/catshelter/internal/custom_middleware/heplers"
+	"api/catshelter/internal/domain"
 	"api/catshelter/internal/handler/dto"
+	"api/catshelter/internal/handler/problem"
 	"api/catshelter/internal/repository"
 	"api/catshelter/internal/service"
 	"encoding/json"
 	"errors"
-	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"strings"
 	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	authTransportHeader = "X-Auth-Transport"
+	authTransportToken  = "token"
 )
 
+// AuthHandler issues and revokes sessions.
+//
+// Tokens are delivered in one of two transports:
+//   - cookie (default): the access and refresh tokens are set as HttpOnly
+//     cookies. Browsers should use this transport.
+//   - token: requests carrying "X-Auth-Transport: token" receive the tokens in
+//     a JSON body and are expected to send the access token back in an
+//     "Authorization: Bearer" header and the refresh token in the request
+//     body of /api/update-session and /api/auth/logout. Mobile apps and
+//     scripts should use this transport.
 type AuthHandler struct {
 	tokenService service.TokenService
 	authService  service.AuthService
+	mfaService   service.MfaService
+	csrfSecret   []byte
+	cookies      CookieOptions
+}
+
+// CookieOptions are the attributes of the session and CSRF cookies.
+type CookieOptions struct {
+	Secure   bool
+	SameSite http.SameSite
 }
 
 func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	_, ok := heplers.UserIdFromContext(r.Context())
 	if ok {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("You are already logged in"))
+		problem.Write(w, r, problem.New(http.StatusBadRequest, problem.CodeAlreadyLoggedIn, "You are already logged in"))
 		return
 	}
 
 	var req dto.RegisterUserRequest
-	err := json.NewDecoder(r.Body).Decode(&req)
-	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if !decodeRequest(w, r, &req) {
 		return
 	}
 
-	user, err := h.authService.Register(r.Context(), req.Login, req.Password, req.Name)
+	user, err := h.authService.Register(r.Context(), req.Login, req.Password, req.Name, req.Email, req.Phone)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Error(w, r, err)
 		return
 	}
 
-	tokens, err := h.tokenService.CreateSession(r.Context(), user)
+	tokens, err := h.tokenService.CreateSession(r.Context(), user, false)
 	if err != nil {
-		http.Error(w, "Could not create session", http.StatusInternalServerError)
+		problem.Error(w, r, err)
 		return
 	}
 
-	h.setAuthCookies(w, tokens)
-	w.Write([]byte("Registration successful"))
+	h.writeSession(w, r, tokens, "Registration successful")
 }
 
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	_, ok := heplers.UserIdFromContext(r.Context())
 	if ok {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("You are already logged in"))
+		problem.Write(w, r, problem.New(http.StatusBadRequest, problem.CodeAlreadyLoggedIn, "You are already logged in"))
 		return
 	}
 	var req dto.LoginUserRequest
-	err := json.NewDecoder(r.Body).Decode(&req)
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	user, err := h.authService.Login(r.Context(), req.Login, req.Password, clientIp(r))
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	h.startSession(w, r, user, "Login successful")
+}
+
+// startSession answers a successful first factor: users with two-factor
+// authentication get an mfa challenge, everyone else a session.
+func (h *AuthHandler) startSession(w http.ResponseWriter, r *http.Request, user *domain.User, message string) {
+	if err := user.CheckActive(); err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+	if user.TotpEnabled {
+		pending, err := h.mfaService.IssuePendingToken(r.Context(), user)
+		if err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(&dto.MfaChallengeResponse{
+			MfaRequired: true,
+			MfaToken:    pending.Token,
+			ExpiresIn:   int64(time.Until(pending.ExpiresAt).Seconds()),
+		})
+		return
+	}
+
+	tokens, err := h.tokenService.CreateSession(r.Context(), user, false)
 	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		problem.Error(w, r, err)
+		return
+	}
+
+	h.writeSession(w, r, tokens, message)
+}
+
+// VerifyMfa completes a login started by Login for users with two-factor
+// authentication enabled.
+func (h *AuthHandler) VerifyMfa(w http.ResponseWriter, r *http.Request) {
+	var req dto.MfaVerifyRequest
+	if !decodeRequest(w, r, &req) {
 		return
 	}
 
-	user, err := h.authService.Login(r.Context(), req.Login, req.Password)
+	user, err := h.mfaService.VerifyPending(r.Context(), req.MfaToken, req.Code, req.RecoveryCode)
 	if err != nil {
-		http.Error(w, "Incorrect login or password", http.StatusBadRequest)
+		problem.Error(w, r, err)
 		return
 	}
 
-	tokens, err := h.tokenService.CreateSession(r.Context(), user)
+	tokens, err := h.tokenService.CreateSession(r.Context(), user, true)
 	if err != nil {
-		http.Error(w, "Could not create session", http.StatusInternalServerError)
+		problem.Error(w, r, err)
 		return
 	}
 
-	h.setAuthCookies(w, tokens)
-	w.Write([]byte("Login successful"))
+	h.writeSession(w, r, tokens, "Login successful")
 }
 
 func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("refresh_token")
-	if err != nil {
+	refreshToken, ok := refreshTokenFromRequest(r)
+	if !ok {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
-	err = h.tokenService.DeleteRefreshToken(r.Context(), cookie.Value)
+	err := h.tokenService.DeleteRefreshToken(r.Context(), refreshToken)
 	if err != nil {
-		if errors.Is(err, repository.ErrRefreshTokenNotFound) {
-			http.Error(w, err.Error(), http.StatusNotFound)
-			return
-		}
-		http.Error(w, fmt.Sprintf("DB error: %s", err.Error()), http.StatusInternalServerError)
+		problem.Error(w, r, err)
 		return
 	}
 	h.clearAuthCookies(w)
@@ -100,13 +168,13 @@ func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 func (h *AuthHandler) LogoutEverywhere(w http.ResponseWriter, r *http.Request) {
 	userId, ok := heplers.UserIdFromContext(r.Context())
 	if !ok {
-		http.Error(w, "User id not found", http.StatusBadRequest)
+		problem.MissingUser(w, r)
 		return
 	}
 
 	err := h.tokenService.DeleteAllRefreshTokens(r.Context(), userId)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err != nil && !errors.Is(err, repository.ErrUserNotFound) {
+		problem.Error(w, r, err)
 		return
 	}
 
@@ -115,20 +183,108 @@ func (h *AuthHandler) LogoutEverywhere(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *AuthHandler) UpdateSession(w http.ResponseWriter, r *http.Request) {
-	refreshToken, err := r.Cookie("refresh_token")
+	refreshToken, ok := refreshTokenFromRequest(r)
+	if !ok {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, problem.CodeInvalidRefreshToken, "Refresh token not found in 'refresh_token' cookie or request body"))
+		return
+	}
+
+	sessionTokens, err := h.tokenService.UpdateSession(r.Context(), refreshToken)
+	if err != nil {
+		if errors.Is(err, domain.ErrAccountDisabled) {
+			h.clearAuthCookies(w)
+		}
+		problem.Error(w, r, err)
+		return
+	}
+
+	h.writeSession(w, r, sessionTokens, "Session successfully updated")
+}
+
+func (h *AuthHandler) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		problem.BadRequest(w, r, "User id is missing in URL")
+		return
+	}
+
+	err := h.authService.UnlockUser(r.Context(), id)
 	if err != nil {
-		http.Error(w, "'refresh_token' cookie not found", http.StatusBadRequest)
+		problem.Error(w, r, err)
 		return
 	}
 
-	sessionTokens, err := h.tokenService.UpdateSession(r.Context(), refreshToken.Value)
+	w.Write([]byte("User successfully unlocked"))
+}
+
+func (h *AuthHandler) CSRFToken(w http.ResponseWriter, r *http.Request) {
+	token, err := heplers.GenerateCSRFToken(h.csrfSecret)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Error(w, r, err)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     heplers.CSRFCookieName,
+		Value:    token,
+		Expires:  time.Now().Add(24 * time.Hour * 30),
+		Secure:   h.cookies.Secure,
+		SameSite: h.cookies.SameSite,
+		Path:     "/",
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(&dto.CSRFTokenResponse{Token: token, HeaderName: heplers.CSRFHeaderName})
+}
+
+func (h *AuthHandler) writeSession(w http.ResponseWriter, r *http.Request, tokens *service.SessionTokens, message string) {
+	if !wantsTokenTransport(r) {
+		h.setAuthCookies(w, tokens)
+		w.Write([]byte(message))
 		return
 	}
 
-	h.setAuthCookies(w, sessionTokens)
-	w.Write([]byte("Session successfully updated"))
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(tokenResponse(tokens))
+}
+
+func tokenResponse(tokens *service.SessionTokens) *dto.TokenResponse {
+	return &dto.TokenResponse{
+		AccessToken:  tokens.AccessToken.Token,
+		RefreshToken: tokens.RefreshToken.Token,
+		ExpiresIn:    int64(time.Until(tokens.AccessToken.ExpiresAt).Seconds()),
+		TokenType:    "Bearer",
+	}
+}
+
+func clientIp(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// wantsTokenTransport reports whether the client asked for tokens in the
+// response body instead of cookies.
+func wantsTokenTransport(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get(authTransportHeader), authTransportToken)
+}
+
+// refreshTokenFromRequest looks for the refresh token in the 'refresh_token'
+// cookie first and falls back to a JSON body for token transport clients.
+func refreshTokenFromRequest(r *http.Request) (string, bool) {
+	if cookie, err := r.Cookie("refresh_token"); err == nil && cookie.Value != "" {
+		return cookie.Value, true
+	}
+
+	var req dto.RefreshSessionRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxBodySize)).Decode(&req); err != nil || req.RefreshToken == "" {
+		return "", false
+	}
+	return req.RefreshToken, true
 }
 
 func (h *AuthHandler) clearAuthCookies(w http.ResponseWriter) {
@@ -155,8 +311,8 @@ func (h *AuthHandler) setAuthCookies(w http.ResponseWriter, tokens *service.Sess
 		Value:    tokens.AccessToken.Token,
 		Expires:  tokens.AccessToken.ExpiresAt,
 		HttpOnly: true,
-		Secure:   true,
-		SameSite: http.SameSiteLaxMode,
+		Secure:   h.cookies.Secure,
+		SameSite: h.cookies.SameSite,
 		Path:     "/",
 	})
 
@@ -165,12 +321,12 @@ func (h *AuthHandler) setAuthCookies(w http.ResponseWriter, tokens *service.Sess
 		Value:    tokens.RefreshToken.Token,
 		Expires:  tokens.RefreshToken.ExpiresAt,
 		HttpOnly: true,
-		Secure:   true,
-		SameSite: http.SameSiteLaxMode,
+		Secure:   h.cookies.Secure,
+		SameSite: h.cookies.SameSite,
 		Path:     "/",
 	})
 }
 
-func NewAuthHandler(authService service.AuthService, tokenService service.TokenService) *AuthHandler {
-	return &AuthHandler{authService: authService, tokenService: tokenService}
+func NewAuthHandler(authService service.AuthService, tokenService service.TokenService, mfaService service.MfaService, csrfSecret []byte, cookies CookieOptions) *AuthHandler {
+	return &AuthHandler{authService: authService, tokenService: tokenService, mfaService: mfaService, csrfSecret: csrfSecret, cookies: cookies}
 }
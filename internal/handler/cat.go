@@ -1,18 +1,22 @@
 package handler
 
 import (
-	"api/catshelter/internal/domain"
 	"api/catshelter/internal/handler/dto"
+	"api/catshelter/internal/handler/problem"
+	"api/catshelter/internal/repository"
 	"api/catshelter/internal/service"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+
+	"github.com/go-chi/chi/v5"
 )
 
 type CatHandler struct {
 	catService service.CatService
+	policy     service.Policy
 }
 
 func (c *CatHandler) LonelyCats(w http.ResponseWriter, r *http.Request) {
@@ -26,12 +30,12 @@ func (c *CatHandler) LonelyCats(w http.ResponseWriter, r *http.Request) {
 
 	pageSize, err := strconv.Atoi(pageSizeStr)
 	if err != nil || pageSize <= 0 {
-		pageSize = 10
+		pageSize = repository.DefaultPageSize()
 	}
 
 	cats, paginationInfo, err := c.catService.FindLonelyCats(r.Context(), page, pageSize)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("DB error: %s", err.Error()), http.StatusInternalServerError)
+		problem.Error(w, r, err)
 		return
 	}
 
@@ -45,27 +49,51 @@ func (c *CatHandler) LonelyCats(w http.ResponseWriter, r *http.Request) {
 
 func (c *CatHandler) AddCat(w http.ResponseWriter, r *http.Request) {
 	var newCatRequest dto.CatRequest
-	err := json.NewDecoder(r.Body).Decode(&newCatRequest)
+	if !decodeRequest(w, r, &newCatRequest) {
+		return
+	}
+	err := c.catService.AddCat(r.Context(), newCatRequest.Name, int(newCatRequest.Age))
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to decode JSON: %s", err.Error()), http.StatusBadRequest)
+		problem.Error(w, r, err)
 		return
 	}
-	err = c.catService.AddCat(r.Context(), newCatRequest.Name, int(newCatRequest.Age))
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte("New cat successfully created"))
+}
+
+// GetCat shows a cat. Adopted cats are only visible to their owner and to
+// staff; everyone else gets the same 404 as for a cat that does not exist.
+func (c *CatHandler) GetCat(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		problem.BadRequest(w, r, "Cat id is missing in URL")
+		return
+	}
+
+	notFound := problem.New(http.StatusNotFound, problem.CodeCatNotFound, fmt.Sprintf("Cat with id '%s' not found", id))
+	cat, err := c.catService.FindById(r.Context(), id)
 	if err != nil {
-		if errors.Is(err, domain.ErrValidation) {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+		if errors.Is(err, repository.ErrCatNotFound) {
+			problem.Write(w, r, notFound)
 			return
 		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Error(w, r, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusCreated)
-	w.Write([]byte("New cat successfully created"))
+	if err := c.policy.Authorize(subjectFromRequest(r), service.ActionRead, cat); err != nil {
+		writePolicyError(w, r, err, notFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(mapCatToCatResponse(cat))
 }
 
-func NewCatHandler(catService *service.CatService) *CatHandler {
+func NewCatHandler(catService *service.CatService, policy service.Policy) *CatHandler {
 	return &CatHandler{
 		catService: *catService,
+		policy:     policy,
 	}
 }
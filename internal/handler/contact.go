@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"api/catshelter/internal/custom_middleware/heplers"
+	"api/catshelter/internal/handler/dto"
+	"api/catshelter/internal/handler/problem"
+	"api/catshelter/internal/service"
+	"encoding/json"
+	"net/http"
+)
+
+type ContactHandler struct {
+	contactService service.ContactService
+	profileService service.ProfileService
+}
+
+// UpdateContacts replaces both contact fields. It is a profile edit, so it
+// needs the profile version like PATCH /api/user/me.
+func (h *ContactHandler) UpdateContacts(w http.ResponseWriter, r *http.Request) {
+	userId, ok := heplers.UserIdFromContext(r.Context())
+	if !ok {
+		problem.MissingUser(w, r)
+		return
+	}
+
+	var req dto.UpdateContactsRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	version, ok := profileVersion(r, req.Version)
+	if !ok {
+		problem.Write(w, r, problem.New(http.StatusPreconditionRequired, problem.CodeVersionRequired, "Profile version is required in 'If-Match' header or 'version' field"))
+		return
+	}
+
+	user, _, err := h.profileService.Update(r.Context(), userId, version, &service.ProfileUpdate{
+		Email: &req.Email,
+		Phone: &req.Phone,
+	})
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	roles, _ := heplers.UserRolesFromContext(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", profileETag(user.Version))
+	json.NewEncoder(w).Encode(mapUserToUserInfoResponse(user, roles))
+}
+
+func (h *ContactHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	userId, ok := heplers.UserIdFromContext(r.Context())
+	if !ok {
+		problem.MissingUser(w, r)
+		return
+	}
+
+	if err := h.contactService.SendVerification(r.Context(), userId); err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte("Verification email sent"))
+}
+
+func (h *ContactHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		problem.BadRequest(w, r, "Verification token is missing")
+		return
+	}
+
+	if err := h.contactService.VerifyEmail(r.Context(), token); err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	w.Write([]byte("Email address successfully verified"))
+}
+
+func NewContactHandler(contactService service.ContactService, profileService service.ProfileService) *ContactHandler {
+	return &ContactHandler{contactService: contactService, profileService: profileService}
+}
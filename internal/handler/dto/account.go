@@ -0,0 +1,70 @@
+package dto
+
+import "time"
+
+type SuspendUserRequest struct {
+	Reason string     `json:"reason" validate:"required,max=500"`
+	Until  *time.Time `json:"until"`
+}
+
+type BanUserRequest struct {
+	Reason string `json:"reason" validate:"required,max=500"`
+}
+
+type DeleteAccountRequest struct {
+	Password string `json:"password" validate:"max=256"`
+}
+
+// AccountExportResponse is the machine-readable export of all data held
+// about a user.
+type AccountExportResponse struct {
+	ExportedAt         time.Time                `json:"exported_at"`
+	Profile            AccountProfileExport     `json:"profile"`
+	Avatar             *AvatarExport            `json:"avatar"`
+	AdoptedCats        []CatResponse            `json:"adopted_cats"`
+	ExternalIdentities []ExternalIdentityExport `json:"external_identities"`
+	ApiKeys            []ApiKeyResponse         `json:"api_keys"`
+	Sessions           []SessionExport          `json:"sessions"`
+	SecurityEvents     []SecurityEventExport    `json:"security_events"`
+	AuditEntries       []AuditEntryResponse     `json:"audit_entries"`
+}
+
+type AccountProfileExport struct {
+	Id              string     `json:"id"`
+	Login           string     `json:"login"`
+	Name            string     `json:"name"`
+	Email           *string    `json:"email"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	Phone           *string    `json:"phone"`
+	Status          string     `json:"status"`
+	TotpEnabled     bool       `json:"totp_enabled"`
+	ServiceAccount  bool       `json:"service_account"`
+	Roles           []string   `json:"roles"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// AvatarExport holds the image; Data is base64 encoded in JSON.
+type AvatarExport struct {
+	ContentType string    `json:"content_type"`
+	Data        []byte    `json:"data"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type ExternalIdentityExport struct {
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type SessionExport struct {
+	ExpiresAt   time.Time `json:"expires_at"`
+	MfaVerified bool      `json:"mfa_verified"`
+}
+
+type SecurityEventExport struct {
+	Type      string    `json:"type"`
+	Ip        string    `json:"ip"`
+	Details   string    `json:"details"`
+	CreatedAt time.Time `json:"created_at"`
+}
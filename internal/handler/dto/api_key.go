@@ -0,0 +1,36 @@
+package dto
+
+import "time"
+
+type CreateApiKeyRequest struct {
+	Name      string     `json:"name" validate:"required,max=64"`
+	Scopes    []string   `json:"scopes" validate:"required,max=50"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type ApiKeyResponse struct {
+	Id         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type CreatedApiKeyResponse struct {
+	ApiKeyResponse
+	Key string `json:"key"`
+}
+
+type CreateServiceAccountRequest struct {
+	Login string `json:"login" validate:"required,min=6,max=64"`
+	Name  string `json:"name" validate:"max=100"`
+}
+
+type ServiceAccountResponse struct {
+	Id    string `json:"id"`
+	Login string `json:"login"`
+	Name  string `json:"name"`
+}
@@ -0,0 +1,32 @@
+package dto
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type AuditEntryResponse struct {
+	Seq        int64           `json:"seq"`
+	ActorId    *string         `json:"actor_id"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetId   string          `json:"target_id"`
+	Before     json.RawMessage `json:"before"`
+	After      json.RawMessage `json:"after"`
+	Ip         string          `json:"ip"`
+	RequestId  string          `json:"request_id"`
+	CreatedAt  time.Time       `json:"created_at"`
+	PrevHash   string          `json:"prev_hash"`
+	Hash       string          `json:"hash"`
+}
+
+type AuditPaginatedResponse struct {
+	Data       []AuditEntryResponse `json:"data"`
+	Pagination PaginationResult     `json:"pagination"`
+}
+
+type AuditVerificationResponse struct {
+	Entries     int   `json:"entries"`
+	Valid       bool  `json:"valid"`
+	BrokenAtSeq int64 `json:"broken_at_seq,omitempty"`
+}
@@ -1,12 +1,89 @@
 package dto
 
+import "api/catshelter/internal/domain"
+
 type LoginUserRequest struct {
-	Login    string `json:"login"`
-	Password string `json:"password"`
+	Login    string `json:"login" validate:"required,max=64"`
+	Password string `json:"password" validate:"required,max=256"`
 }
 
 type RegisterUserRequest struct {
-	Name     string `json:"name"`
-	Login    string `json:"login"`
-	Password string `json:"password"`
+	Name     string `json:"name" validate:"max=100"`
+	Login    string `json:"login" validate:"required,min=6,max=64"`
+	Password string `json:"password" validate:"required,min=8,max=72"`
+	Email    string `json:"email" validate:"max=254"`
+	Phone    string `json:"phone" validate:"max=32"`
+}
+
+type RefreshSessionRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	TokenType    string `json:"token_type"`
+}
+
+type CSRFTokenResponse struct {
+	Token      string `json:"csrf_token"`
+	HeaderName string `json:"header_name"`
+}
+
+type MfaChallengeResponse struct {
+	MfaRequired bool   `json:"mfa_required"`
+	MfaToken    string `json:"mfa_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+type MfaVerifyRequest struct {
+	MfaToken     string `json:"mfa_token" validate:"required"`
+	Code         string `json:"code" validate:"max=16"`
+	RecoveryCode string `json:"recovery_code" validate:"max=32"`
+}
+
+func (r *MfaVerifyRequest) Validate() []*domain.FieldError {
+	if r.Code == "" && r.RecoveryCode == "" {
+		return []*domain.FieldError{domain.NewFieldError("code", "code or recovery_code is required")}
+	}
+	return nil
+}
+
+type MfaEnrollResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningUri string `json:"provisioning_uri"`
+	QrCode          string `json:"qr_code"`
+}
+
+type MfaCodeRequest struct {
+	Code string `json:"code" validate:"required,max=16"`
+}
+
+type MfaDisableRequest struct {
+	Password string `json:"password" validate:"max=256"`
+	Code     string `json:"code" validate:"max=16"`
+}
+
+type MfaRecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"max=256"`
+	NewPassword     string `json:"new_password" validate:"required,min=8,max=72"`
+	RefreshToken    string `json:"refresh_token"`
+}
+
+type ForgotPasswordRequest struct {
+	Login string `json:"login" validate:"required,max=254"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token" validate:"required,max=256"`
+	NewPassword string `json:"new_password" validate:"required,min=8,max=72"`
+}
+
+type OidcProvidersResponse struct {
+	Providers []string `json:"providers"`
 }
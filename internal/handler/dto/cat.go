@@ -7,8 +7,8 @@ type CatResponse struct {
 }
 
 type CatRequest struct {
-	Name string `json:"name"`
-	Age  int16  `json:"age"`
+	Name string `json:"name" validate:"required,max=100"`
+	Age  int16  `json:"age" validate:"required,min=1,max=40"`
 }
 
 type CatsPaginatedResponse struct {
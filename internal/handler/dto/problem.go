@@ -0,0 +1,19 @@
+package dto
+
+// ProblemResponse is an RFC 7807 problem details document. Code is a stable
+// machine-readable error code; Title and Detail are for humans and may change.
+type ProblemResponse struct {
+	Type      string               `json:"type"`
+	Title     string               `json:"title"`
+	Status    int                  `json:"status"`
+	Detail    string               `json:"detail,omitempty"`
+	Instance  string               `json:"instance,omitempty"`
+	Code      string               `json:"code"`
+	RequestId string               `json:"request_id,omitempty"`
+	Errors    []FieldErrorResponse `json:"errors,omitempty"`
+}
+
+type FieldErrorResponse struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
@@ -3,3 +3,28 @@ package dto
 type RoleResponse struct {
 	Name string `json:"name"`
 }
+
+type RoleDetailsResponse struct {
+	Name         string   `json:"name"`
+	Description  string   `json:"description"`
+	InheritsFrom string   `json:"inherits_from,omitempty"`
+	Permissions  []string `json:"permissions"`
+	Builtin      bool     `json:"builtin"`
+	UserCount    int64    `json:"user_count"`
+}
+
+type CreateRoleRequest struct {
+	Name         string   `json:"name" validate:"required,max=32"`
+	Description  string   `json:"description" validate:"max=500"`
+	InheritsFrom string   `json:"inherits_from" validate:"max=32"`
+	Permissions  []string `json:"permissions" validate:"max=100"`
+}
+
+// UpdateRoleRequest only changes the fields that are present. An empty
+// inherits_from removes the parent role.
+type UpdateRoleRequest struct {
+	Name         *string   `json:"name" validate:"max=32"`
+	Description  *string   `json:"description" validate:"max=500"`
+	InheritsFrom *string   `json:"inherits_from" validate:"max=32"`
+	Permissions  *[]string `json:"permissions" validate:"max=100"`
+}
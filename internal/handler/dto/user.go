@@ -1,17 +1,80 @@
 package dto
 
+import "time"
+
 type UserInfoResponse struct {
-	Id    string         `json:"id"`
-	Name  string         `json:"name"`
-	Login string         `json:"login"`
-	Roles []RoleResponse `json:"roles"`
-	Cats  []CatResponse  `json:"cats"`
+	Id            string         `json:"id"`
+	Name          string         `json:"name"`
+	Login         string         `json:"login"`
+	Email         *string        `json:"email"`
+	EmailVerified bool           `json:"email_verified"`
+	Phone         *string        `json:"phone"`
+	Roles         []RoleResponse `json:"roles"`
+	Cats          []CatResponse  `json:"cats"`
+	Status        string         `json:"status"`
+	Version       int64          `json:"version"`
+}
+
+// UpdateProfileRequest only changes the fields that are present. Version is
+// the profile version the client last saw; an 'If-Match' header may carry it
+// instead.
+type UpdateProfileRequest struct {
+	Name    *string `json:"name" validate:"max=100"`
+	Login   *string `json:"login" validate:"min=6,max=64"`
+	Email   *string `json:"email" validate:"max=254"`
+	Phone   *string `json:"phone" validate:"max=32"`
+	Version *int64  `json:"version" validate:"min=1"`
+}
+
+// UpdateProfileResponse carries new tokens for token transport clients when
+// a login change re-issued the session.
+type UpdateProfileResponse struct {
+	*UserInfoResponse
+	Session *TokenResponse `json:"session,omitempty"`
 }
 
 type AdoptCatRequest struct {
-	Id string `json:"id"`
+	Id string `json:"id" validate:"required,max=64"`
 }
 
 type AddRoleRequest struct {
-	Name string `json:"name"`
+	Name string `json:"name" validate:"required,max=32"`
+}
+
+// UpdateContactsRequest replaces both contact fields; an empty one is
+// removed. Version works as in UpdateProfileRequest.
+type UpdateContactsRequest struct {
+	Email   string `json:"email" validate:"max=254"`
+	Phone   string `json:"phone" validate:"max=32"`
+	Version *int64 `json:"version" validate:"min=1"`
+}
+
+type UserSummaryResponse struct {
+	Id        string    `json:"id"`
+	Login     string    `json:"login"`
+	Name      string    `json:"name"`
+	Email     *string   `json:"email"`
+	Status    string    `json:"status"`
+	Roles     []string  `json:"roles"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type UsersPaginatedResponse struct {
+	Data       []UserSummaryResponse `json:"data"`
+	Pagination PaginationResult      `json:"pagination"`
+}
+
+type BulkAssignRoleRequest struct {
+	UserIds []string `json:"user_ids" validate:"required,max=500"`
+	Role    string   `json:"role" validate:"required,max=32"`
+}
+
+type BulkAssignRoleResponse struct {
+	Assigned int `json:"assigned"`
+}
+
+type BulkSuspendRequest struct {
+	UserIds []string   `json:"user_ids" validate:"required,max=500"`
+	Reason  string     `json:"reason" validate:"required,max=500"`
+	Until   *time.Time `json:"until"`
 }
@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"api/catshelter/internal/handler/dto"
+	"api/catshelter/internal/migration"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const readinessTimeout = 2 * time.Second
+
+type HealthHandler struct {
+	db           *sql.DB
+	migrator     *migration.Migrator
+	shuttingDown atomic.Bool
+}
+
+func NewHealthHandler(db *sql.DB, migrator *migration.Migrator) *HealthHandler {
+	return &HealthHandler{db: db, migrator: migrator}
+}
+
+// ShuttingDown makes the instance report not ready, so load balancers stop
+// sending it requests while it drains.
+func (h *HealthHandler) ShuttingDown() {
+	h.shuttingDown.Store(true)
+}
+
+// Live reports that the process is up. It checks nothing else, so a database
+// outage does not get healthy instances restarted.
+func (h *HealthHandler) Live(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, &dto.HealthResponse{Status: "ok"})
+}
+
+// Ready reports whether the instance can serve requests: the database answers
+// and its schema is up to date.
+func (h *HealthHandler) Ready(w http.ResponseWriter, r *http.Request) {
+	if h.shuttingDown.Load() {
+		writeHealth(w, http.StatusServiceUnavailable, &dto.HealthResponse{Status: "shutting down"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	response := &dto.HealthResponse{Status: "ok", Checks: map[string]string{}}
+	if err := h.db.PingContext(ctx); err != nil {
+		slog.WarnContext(ctx, "readiness check failed", "check", "database", "error", err)
+		response.Checks["database"] = "unavailable"
+		response.Checks["migrations"] = "unknown"
+	} else {
+		response.Checks["database"] = "ok"
+		pending, err := h.migrator.Pending(ctx)
+		switch {
+		case err != nil:
+			slog.WarnContext(ctx, "readiness check failed", "check", "migrations", "error", err)
+			response.Checks["migrations"] = "unknown"
+		case len(pending) > 0:
+			response.Checks["migrations"] = fmt.Sprintf("%d pending", len(pending))
+		default:
+			response.Checks["migrations"] = "ok"
+		}
+	}
+
+	status := http.StatusOK
+	for _, result := range response.Checks {
+		if result != "ok" {
+			response.Status = "unavailable"
+			status = http.StatusServiceUnavailable
+		}
+	}
+	writeHealth(w, status, response)
+}
+
+func writeHealth(w http.ResponseWriter, status int, response *dto.HealthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
@@ -3,6 +3,10 @@ package handler
 import (
 	"api/catshelter/internal/domain"
 	"api/catshelter/internal/handler/dto"
+	"api/catshelter/internal/repository"
+	"api/catshelter/internal/service"
+	"encoding/json"
+	"time"
 )
 
 func mapRolesToRolesResponse(roles []string) []dto.RoleResponse {
@@ -13,24 +17,162 @@ func mapRolesToRolesResponse(roles []string) []dto.RoleResponse {
 	return roleResponses
 }
 
+func mapCatToCatResponse(cat *domain.Cat) dto.CatResponse {
+	return dto.CatResponse{
+		Id:   cat.Id,
+		Name: cat.Name,
+		Age:  cat.Age,
+	}
+}
+
 func mapCatsToCatResponses(cats []*domain.Cat) []dto.CatResponse {
 	catResponses := make([]dto.CatResponse, len(cats))
 	for i, cat := range cats {
-		catResponses[i] = dto.CatResponse{
-			Id:   cat.Id,
-			Name: cat.Name,
-			Age:  cat.Age,
-		}
+		catResponses[i] = mapCatToCatResponse(cat)
 	}
 	return catResponses
 }
 
 func mapUserToUserInfoResponse(user *domain.User, roles []string) *dto.UserInfoResponse {
 	return &dto.UserInfoResponse{
-		Id:    user.Id,
-		Name:  user.Name,
-		Login: user.Login,
-		Roles: mapRolesToRolesResponse(roles),
-		Cats:  mapCatsToCatResponses(user.Cats),
+		Id:            user.Id,
+		Name:          user.Name,
+		Login:         user.Login,
+		Email:         user.Email,
+		EmailVerified: user.IsEmailVerified(),
+		Phone:         user.Phone,
+		Roles:         mapRolesToRolesResponse(roles),
+		Cats:          mapCatsToCatResponses(user.Cats),
+		Status:        user.Status,
+		Version:       user.Version,
+	}
+}
+
+func mapApiKeyToApiKeyResponse(key *domain.ApiKey) dto.ApiKeyResponse {
+	return dto.ApiKeyResponse{
+		Id:         key.Id,
+		Name:       key.Name,
+		Prefix:     domain.ApiKeyPrefix + key.Prefix,
+		Scopes:     key.ScopeList(),
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+		RevokedAt:  key.RevokedAt,
+		CreatedAt:  key.CreatedAt,
+	}
+}
+
+func mapApiKeysToApiKeyResponses(keys []*domain.ApiKey) []dto.ApiKeyResponse {
+	responses := make([]dto.ApiKeyResponse, len(keys))
+	for i, key := range keys {
+		responses[i] = mapApiKeyToApiKeyResponse(key)
+	}
+	return responses
+}
+
+func mapRoleSummaryToRoleDetailsResponse(summary *service.RoleSummary) dto.RoleDetailsResponse {
+	return dto.RoleDetailsResponse{
+		Name:         summary.Role.Name,
+		Description:  summary.Role.Description,
+		InheritsFrom: summary.InheritsFrom,
+		Permissions:  domain.PermissionNames([]*domain.Role{summary.Role}),
+		Builtin:      summary.Role.IsBuiltin(),
+		UserCount:    summary.UserCount,
+	}
+}
+
+func mapAuditEntriesToAuditEntryResponses(entries []*repository.AuditEntry) []dto.AuditEntryResponse {
+	responses := make([]dto.AuditEntryResponse, len(entries))
+	for i, entry := range entries {
+		responses[i] = dto.AuditEntryResponse{
+			Seq:        entry.Seq,
+			ActorId:    entry.ActorId,
+			Action:     entry.Action,
+			TargetType: entry.TargetType,
+			TargetId:   entry.TargetId,
+			Before:     rawJsonOrNull(entry.Before),
+			After:      rawJsonOrNull(entry.After),
+			Ip:         entry.Ip,
+			RequestId:  entry.RequestId,
+			CreatedAt:  entry.CreatedAt,
+			PrevHash:   entry.PrevHash,
+			Hash:       entry.Hash,
+		}
+	}
+	return responses
+}
+
+func rawJsonOrNull(s string) json.RawMessage {
+	if s == "" {
+		return json.RawMessage("null")
+	}
+	return json.RawMessage(s)
+}
+
+func mapUsersToUserSummaryResponses(users []*domain.User) []dto.UserSummaryResponse {
+	responses := make([]dto.UserSummaryResponse, len(users))
+	for i, user := range users {
+		responses[i] = dto.UserSummaryResponse{
+			Id:        user.Id,
+			Login:     user.Login,
+			Name:      user.Name,
+			Email:     user.Email,
+			Status:    user.Status,
+			Roles:     domain.RoleNames(user.Roles),
+			CreatedAt: user.CreatedAt,
+		}
+	}
+	return responses
+}
+
+func mapAccountDataToAccountExportResponse(data *service.AccountData) *dto.AccountExportResponse {
+	user := data.User
+	response := &dto.AccountExportResponse{
+		ExportedAt: time.Now().UTC(),
+		Profile: dto.AccountProfileExport{
+			Id:              user.Id,
+			Login:           user.Login,
+			Name:            user.Name,
+			Email:           user.Email,
+			EmailVerifiedAt: user.EmailVerifiedAt,
+			Phone:           user.Phone,
+			Status:          user.Status,
+			TotpEnabled:     user.TotpEnabled,
+			ServiceAccount:  user.ServiceAccount,
+			Roles:           domain.RoleNames(user.Roles),
+			CreatedAt:       user.CreatedAt,
+		},
+		AdoptedCats:        mapCatsToCatResponses(user.Cats),
+		ExternalIdentities: make([]dto.ExternalIdentityExport, len(data.ExternalIdentities)),
+		ApiKeys:            mapApiKeysToApiKeyResponses(data.ApiKeys),
+		Sessions:           make([]dto.SessionExport, len(data.Sessions)),
+		SecurityEvents:     make([]dto.SecurityEventExport, len(data.SecurityEvents)),
+		AuditEntries:       mapAuditEntriesToAuditEntryResponses(data.AuditEntries),
+	}
+	if data.Avatar != nil {
+		response.Avatar = &dto.AvatarExport{
+			ContentType: data.Avatar.ContentType,
+			Data:        data.Avatar.Data,
+			UpdatedAt:   data.Avatar.UpdatedAt,
+		}
+	}
+	for i, identity := range data.ExternalIdentities {
+		response.ExternalIdentities[i] = dto.ExternalIdentityExport{
+			Provider:  identity.Provider,
+			Subject:   identity.Subject,
+			Email:     identity.Email,
+			CreatedAt: identity.CreatedAt,
+		}
+	}
+	for i, session := range data.Sessions {
+		response.Sessions[i] = dto.SessionExport{ExpiresAt: session.ExpiresAt, MfaVerified: session.MfaVerified}
+	}
+	for i, event := range data.SecurityEvents {
+		response.SecurityEvents[i] = dto.SecurityEventExport{
+			Type:      event.Type,
+			Ip:        event.Ip,
+			Details:   event.Details,
+			CreatedAt: event.CreatedAt,
+		}
 	}
+	return response
 }
@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"api/catshelter/internal/custom_middleware/heplers"
+	"api/catshelter/internal/handler/dto"
+	"api/catshelter/internal/handler/problem"
+	"api/catshelter/internal/service"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type MfaHandler struct {
+	mfaService service.MfaService
+}
+
+func (h *MfaHandler) Enroll(w http.ResponseWriter, r *http.Request) {
+	userId, ok := heplers.UserIdFromContext(r.Context())
+	if !ok {
+		problem.MissingUser(w, r)
+		return
+	}
+
+	enrollment, err := h.mfaService.Enroll(r.Context(), userId)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	response := &dto.MfaEnrollResponse{
+		Secret:          enrollment.Secret,
+		ProvisioningUri: enrollment.ProvisioningUri,
+		QrCode:          "data:image/png;base64," + base64.StdEncoding.EncodeToString(enrollment.QrCodePng),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *MfaHandler) Activate(w http.ResponseWriter, r *http.Request) {
+	userId, ok := heplers.UserIdFromContext(r.Context())
+	if !ok {
+		problem.MissingUser(w, r)
+		return
+	}
+
+	var req dto.MfaCodeRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	codes, err := h.mfaService.Activate(r.Context(), userId, req.Code)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	writeRecoveryCodes(w, codes)
+}
+
+func (h *MfaHandler) Disable(w http.ResponseWriter, r *http.Request) {
+	userId, ok := heplers.UserIdFromContext(r.Context())
+	if !ok {
+		problem.MissingUser(w, r)
+		return
+	}
+
+	var req dto.MfaDisableRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	if err := h.mfaService.Disable(r.Context(), userId, req.Password, req.Code); err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	w.Write([]byte("Two-factor authentication disabled"))
+}
+
+func (h *MfaHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	userId, ok := heplers.UserIdFromContext(r.Context())
+	if !ok {
+		problem.MissingUser(w, r)
+		return
+	}
+
+	var req dto.MfaCodeRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	codes, err := h.mfaService.RegenerateRecoveryCodes(r.Context(), userId, req.Code)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	writeRecoveryCodes(w, codes)
+}
+
+func (h *MfaHandler) Reset(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		problem.BadRequest(w, r, "User id is missing in URL")
+		return
+	}
+
+	if err := h.mfaService.Reset(r.Context(), id); err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	w.Write([]byte("Two-factor authentication reset"))
+}
+
+func writeRecoveryCodes(w http.ResponseWriter, codes []string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(&dto.MfaRecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+func NewMfaHandler(mfaService service.MfaService) *MfaHandler {
+	return &MfaHandler{mfaService: mfaService}
+}
@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"api/catshelter/internal/handler/dto"
+	"api/catshelter/internal/handler/problem"
+	"api/catshelter/internal/service"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const oidcFlowCookieName = "oidc_flow"
+
+type OidcHandler struct {
+	oidcService service.OidcService
+	authHandler *AuthHandler
+	redirectUrl string
+}
+
+func (h *OidcHandler) Providers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&dto.OidcProvidersResponse{Providers: h.oidcService.Providers()})
+}
+
+func (h *OidcHandler) Login(w http.ResponseWriter, r *http.Request) {
+	provider := chi.URLParam(r, "provider")
+
+	authUrl, flowToken, err := h.oidcService.Begin(r.Context(), provider)
+	if err != nil {
+		writeOidcError(w, r, err)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcFlowCookieName,
+		Value:    flowToken,
+		MaxAge:   int((10 * time.Minute).Seconds()),
+		HttpOnly: true,
+		Secure:   h.authHandler.cookies.Secure,
+		// The provider redirects back with a cross-site navigation, which
+		// strict cookies would not survive, so this one is always lax.
+		SameSite: http.SameSiteLaxMode,
+		Path:     "/api/auth/oidc/",
+	})
+	http.Redirect(w, r, authUrl, http.StatusFound)
+}
+
+func (h *OidcHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	provider := chi.URLParam(r, "provider")
+	query := r.URL.Query()
+
+	if providerErr := query.Get("error"); providerErr != "" {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, problem.CodeIdentityProviderError, "Sign-in was rejected by the identity provider: "+providerErr))
+		return
+	}
+
+	flowCookie, err := r.Cookie(oidcFlowCookieName)
+	if err != nil {
+		writeOidcError(w, r, service.ErrInvalidOidcFlow)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcFlowCookieName,
+		Value:    "",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Path:     "/api/auth/oidc/",
+	})
+
+	user, err := h.oidcService.Complete(r.Context(), provider, flowCookie.Value, query.Get("state"), query.Get("code"))
+	if err != nil {
+		writeOidcError(w, r, err)
+		return
+	}
+
+	if h.redirectUrl == "" || user.TotpEnabled {
+		h.authHandler.startSession(w, r, user, "Login successful")
+		return
+	}
+
+	tokens, err := h.authHandler.tokenService.CreateSession(r.Context(), user, false)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+	h.authHandler.setAuthCookies(w, tokens)
+	http.Redirect(w, r, h.redirectUrl, http.StatusFound)
+}
+
+// writeOidcError logs why a sign-in failed; the client only learns that it
+// did.
+func writeOidcError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, service.ErrOidcAuthFailed) {
+		slog.WarnContext(r.Context(), "oidc sign-in failed", "error", err)
+	}
+	problem.Error(w, r, err)
+}
+
+func NewOidcHandler(oidcService service.OidcService, authHandler *AuthHandler, redirectUrl string) *OidcHandler {
+	return &OidcHandler{oidcService: oidcService, authHandler: authHandler, redirectUrl: redirectUrl}
+}
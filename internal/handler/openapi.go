@@ -0,0 +1,716 @@
+package handler
+
+import (
+	"api/catshelter/internal/custom_middleware/heplers"
+	"api/catshelter/internal/domain"
+	"api/catshelter/internal/handler/dto"
+	"api/catshelter/internal/handler/problem"
+	"api/catshelter/internal/openapi"
+	"api/catshelter/internal/repository"
+	"api/catshelter/internal/service"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// access is what an endpoint requires of the caller.
+type access int
+
+const (
+	// accessNone reads no credentials at all.
+	accessNone access = iota
+	// accessOptional reads credentials when they are sent.
+	accessOptional
+	// accessUser requires a session or an API key.
+	accessUser
+	// accessSession requires a session; API keys are refused.
+	accessSession
+)
+
+// endpoint describes one route for the OpenAPI document. Error responses
+// follow from the other fields: a body can be rejected with 400 and 413,
+// path parameters with 404, credentials with 401 and 403, rate limits with
+// 429.
+type endpoint struct {
+	method      string
+	path        string
+	id          string
+	tag         string
+	summary     string
+	description string
+
+	access      access
+	mfa         bool
+	permission  string
+	rateLimited bool
+
+	params []*openapi.Parameter
+	// body is the request DTO. requestContent replaces it for bodies that
+	// are not JSON.
+	body           any
+	optionalBody   bool
+	requestContent map[string]openapi.MediaType
+
+	responses map[int]*openapi.Response
+}
+
+var pathParam = regexp.MustCompile(`\{(\w+)\}`)
+
+// OpenAPI describes every endpoint of the API. `app openapi check` keeps it in
+// step with the router and with the committed api/openapi.json.
+func OpenAPI() *openapi.Document {
+	d := openapi.New(openapi.Info{
+		Title:   "Cat Shelter API",
+		Version: "1.0.0",
+		Description: "Browsers authenticate with the `jwt` cookie and must send the token from " +
+			"`GET /api/auth/csrf` in the `" + heplers.CSRFHeaderName + "` header on unsafe requests. " +
+			"Other clients send `" + authTransportHeader + ": " + authTransportToken + "` when signing in " +
+			"and then an `Authorization: Bearer` access token or an API key.\n\n" +
+			"Errors are RFC 7807 problem documents with a stable `code`.",
+	})
+	d.Components.SecuritySchemes = map[string]*openapi.SecurityScheme{
+		"bearer": {Type: "http", Scheme: "bearer", Description: "An access token of the token transport, or an API key."},
+		"apiKey": {Type: "apiKey", In: "header", Name: "X-API-Key"},
+		"cookie": {Type: "apiKey", In: "cookie", Name: "jwt", Description: "The access token cookie set on sign-in."},
+	}
+	d.Components.Responses["Problem"] = &openapi.Response{
+		Description: "Problem details",
+		Content:     map[string]openapi.MediaType{problem.ContentType: {Schema: d.Schema(dto.ProblemResponse{})}},
+	}
+
+	for _, e := range endpoints(d) {
+		d.Add(e.method, e.path, e.operation(d))
+	}
+	d.Tags = []openapi.Tag{
+		{Name: "Authentication", Description: "Sessions, passwords and CSRF tokens"},
+		{Name: "Two-factor authentication"},
+		{Name: "Identity providers", Description: "Sign in with OpenID Connect"},
+		{Name: "Account", Description: "The caller's profile, contact details, API keys and data"},
+		{Name: "Cats"},
+		{Name: "Users", Description: "User administration"},
+		{Name: "Service accounts"},
+		{Name: "Roles"},
+		{Name: "Audit log"},
+		{Name: "Health"},
+	}
+	return d
+}
+
+func (e *endpoint) operation(d *openapi.Document) *openapi.Operation {
+	op := &openapi.Operation{
+		Tags:        []string{e.tag},
+		Summary:     e.summary,
+		Description: e.description,
+		OperationId: e.id,
+		Responses:   make(map[string]*openapi.Response),
+	}
+
+	for _, match := range pathParam.FindAllStringSubmatch(e.path, -1) {
+		op.Parameters = append(op.Parameters, &openapi.Parameter{Name: match[1], In: "path", Required: true, Schema: &openapi.Schema{Type: "string"}})
+	}
+	op.Parameters = append(op.Parameters, e.params...)
+
+	switch {
+	case e.requestContent != nil:
+		op.RequestBody = &openapi.RequestBody{Required: true, Content: e.requestContent}
+	case e.body != nil:
+		op.RequestBody = &openapi.RequestBody{
+			Required: !e.optionalBody,
+			Content:  map[string]openapi.MediaType{"application/json": {Schema: d.Schema(e.body)}},
+		}
+	}
+
+	switch e.access {
+	case accessOptional:
+		op.Security = []openapi.SecurityRequirement{{"bearer": {}}, {"apiKey": {}}, {"cookie": {}}, {}}
+	case accessUser:
+		op.Security = []openapi.SecurityRequirement{{"bearer": {}}, {"apiKey": {}}, {"cookie": {}}}
+	case accessSession:
+		op.Security = []openapi.SecurityRequirement{{"bearer": {}}, {"cookie": {}}}
+	}
+	var requirements []string
+	if e.access == accessSession {
+		requirements = append(requirements, "a session, API keys are refused")
+	}
+	if e.mfa {
+		requirements = append(requirements, "two-factor authentication when the caller's role demands it")
+	}
+	if e.permission != "" {
+		requirements = append(requirements, "the `"+e.permission+"` permission")
+	}
+	for i, requirement := range requirements {
+		if i == 0 {
+			op.Description += "\n\nRequires "
+		} else {
+			op.Description += " and "
+		}
+		op.Description += requirement
+	}
+	if len(requirements) > 0 {
+		op.Description += "."
+	}
+
+	for status, response := range e.responses {
+		op.Responses[strconv.Itoa(status)] = response
+	}
+	problemResponse := func(status int, description string) {
+		if _, ok := op.Responses[strconv.Itoa(status)]; !ok {
+			op.Responses[strconv.Itoa(status)] = &openapi.Response{Ref: "#/components/responses/Problem", Description: description}
+		}
+	}
+	if op.RequestBody != nil {
+		problemResponse(http.StatusBadRequest, "Invalid request")
+		problemResponse(http.StatusRequestEntityTooLarge, "Request body too large")
+	}
+	if len(op.Parameters) > 0 && pathParam.MatchString(e.path) {
+		problemResponse(http.StatusNotFound, "Not found")
+	}
+	if e.access >= accessUser {
+		problemResponse(http.StatusUnauthorized, "Not authenticated")
+	}
+	if e.access == accessSession || e.mfa || e.permission != "" {
+		problemResponse(http.StatusForbidden, "Not allowed")
+	}
+	if e.rateLimited {
+		problemResponse(http.StatusTooManyRequests, "Too many requests")
+	}
+	op.Responses["default"] = &openapi.Response{Ref: "#/components/responses/Problem", Description: "Error"}
+	return op
+}
+
+func jsonResponse(d *openapi.Document, description string, v any) *openapi.Response {
+	return &openapi.Response{
+		Description: description,
+		Content:     map[string]openapi.MediaType{"application/json": {Schema: d.Schema(v)}},
+	}
+}
+
+// textResponse is a confirmation message for humans.
+func textResponse(description string) *openapi.Response {
+	return &openapi.Response{
+		Description: description,
+		Content:     map[string]openapi.MediaType{"text/plain": {Schema: &openapi.Schema{Type: "string"}}},
+	}
+}
+
+// sessionResponse is a started session: cookies and a message, or the tokens
+// for the token transport.
+func sessionResponse(d *openapi.Document, description string, alternatives ...any) *openapi.Response {
+	schema := d.Schema(dto.TokenResponse{})
+	if len(alternatives) > 0 {
+		schema = &openapi.Schema{AnyOf: []*openapi.Schema{schema}}
+		for _, alternative := range alternatives {
+			schema.AnyOf = append(schema.AnyOf, d.Schema(alternative))
+		}
+	}
+	return &openapi.Response{
+		Description: description + ". Cookie transport clients get the `jwt` and `refresh_token` cookies and a message.",
+		Content: map[string]openapi.MediaType{
+			"text/plain":       {Schema: &openapi.Schema{Type: "string"}},
+			"application/json": {Schema: schema},
+		},
+	}
+}
+
+func redirectResponse(description string) *openapi.Response {
+	return &openapi.Response{
+		Description: description,
+		Headers:     map[string]*openapi.Header{"Location": {Schema: &openapi.Schema{Type: "string", Format: "uri"}}},
+	}
+}
+
+func queryParam(name, description string, schema *openapi.Schema) *openapi.Parameter {
+	return &openapi.Parameter{Name: name, In: "query", Description: description, Schema: schema}
+}
+
+var (
+	stringSchema   = &openapi.Schema{Type: "string"}
+	dateTimeSchema = &openapi.Schema{Type: "string", Format: "date-time"}
+	transportParam = &openapi.Parameter{
+		Name:        authTransportHeader,
+		In:          "header",
+		Description: "`" + authTransportToken + "` to receive the tokens in the body instead of cookies.",
+		Schema:      &openapi.Schema{Type: "string", Enum: []any{authTransportToken}},
+	}
+)
+
+func pageParams() []*openapi.Parameter {
+	return []*openapi.Parameter{
+		queryParam("page", "Page number, from 1", &openapi.Schema{Type: "integer"}),
+		queryParam("page_size", "Items per page, capped by the server", &openapi.Schema{Type: "integer"}),
+	}
+}
+
+func endpoints(d *openapi.Document) []endpoint {
+	userInfo := jsonResponse(d, "The user", dto.UserInfoResponse{})
+	apiKeys := jsonResponse(d, "API keys, including revoked ones", []dto.ApiKeyResponse{})
+	createdApiKey := jsonResponse(d, "The key; the secret `key` is only shown in this response", dto.CreatedApiKeyResponse{})
+	recoveryCodes := jsonResponse(d, "New single-use recovery codes", dto.MfaRecoveryCodesResponse{})
+	roleDetails := jsonResponse(d, "The role", dto.RoleDetailsResponse{})
+	health := jsonResponse(d, "Healthy", dto.HealthResponse{})
+	unhealthy := jsonResponse(d, "Unhealthy", dto.HealthResponse{})
+
+	aboutMe := jsonResponse(d, "The caller, or a greeting for anonymous callers", dto.UserInfoResponse{})
+	aboutMe.Content["text/plain"] = openapi.MediaType{Schema: stringSchema}
+	aboutMe.Headers = map[string]*openapi.Header{"ETag": {Description: "Profile version, for `If-Match`", Schema: stringSchema}}
+
+	auditList := jsonResponse(d, "Entries, newest first", dto.AuditPaginatedResponse{})
+	auditList.Content["text/csv"] = openapi.MediaType{Schema: stringSchema}
+
+	avatar := &openapi.Response{
+		Description: "The avatar image",
+		Content:     map[string]openapi.MediaType{"image/*": {}},
+	}
+	avatarUpload := map[string]openapi.MediaType{
+		"image/png":  {},
+		"image/jpeg": {},
+		"image/gif":  {},
+		"multipart/form-data": {Schema: &openapi.Schema{
+			Type:       "object",
+			Properties: map[string]*openapi.Schema{"avatar": {Type: "string", ContentMediaType: "application/octet-stream"}},
+			Required:   []string{"avatar"},
+		}},
+	}
+
+	return []endpoint{
+		{
+			method: "GET", path: "/healthz", id: "live", tag: "Health", access: accessNone,
+			summary:   "Liveness probe",
+			responses: map[int]*openapi.Response{200: health},
+		},
+		{
+			method: "GET", path: "/readyz", id: "ready", tag: "Health", access: accessNone,
+			summary:     "Readiness probe",
+			description: "Ready when the database answers and no migration is pending.",
+			responses:   map[int]*openapi.Response{200: health, 503: unhealthy},
+		},
+
+		{
+			method: "POST", path: "/api/auth/register", id: "register", tag: "Authentication", access: accessOptional,
+			summary: "Create an account and sign in",
+			params:  []*openapi.Parameter{transportParam},
+			body:    dto.RegisterUserRequest{},
+			responses: map[int]*openapi.Response{
+				200: sessionResponse(d, "Registered and signed in"),
+				409: {Ref: "#/components/responses/Problem", Description: "Login, email or phone taken"},
+			},
+		},
+		{
+			method: "POST", path: "/api/auth/login", id: "login", tag: "Authentication", access: accessOptional,
+			summary:     "Sign in with login and password",
+			description: "Users with two-factor authentication get an MFA challenge to complete with `POST /api/auth/mfa/verify`.",
+			params:      []*openapi.Parameter{transportParam},
+			body:        dto.LoginUserRequest{},
+			responses: map[int]*openapi.Response{
+				200: sessionResponse(d, "Signed in, or an MFA challenge", dto.MfaChallengeResponse{}),
+				401: {Ref: "#/components/responses/Problem", Description: "Wrong login or password"},
+				429: {Ref: "#/components/responses/Problem", Description: "Too many failed attempts, see `Retry-After`"},
+			},
+		},
+		{
+			method: "POST", path: "/api/auth/mfa/verify", id: "verifyMfa", tag: "Authentication", access: accessOptional,
+			summary:     "Complete a sign-in with a TOTP or recovery code",
+			description: "A pending token stops working after 5 wrong codes. Repeated wrong codes also lock the account's second factor for a while.",
+			rateLimited: true,
+			params:      []*openapi.Parameter{transportParam},
+			body:        dto.MfaVerifyRequest{},
+			responses: map[int]*openapi.Response{
+				200: sessionResponse(d, "Signed in"),
+				429: {Ref: "#/components/responses/Problem", Description: "Too many requests or wrong codes, see `Retry-After`"},
+			},
+		},
+		{
+			method: "POST", path: "/api/update-session", id: "refreshSession", tag: "Authentication", access: accessOptional,
+			summary:     "Exchange a refresh token for new tokens",
+			description: "The refresh token is read from the `refresh_token` cookie or the body, and rotated.",
+			rateLimited: true,
+			params:      []*openapi.Parameter{transportParam},
+			body:        dto.RefreshSessionRequest{}, optionalBody: true,
+			responses: map[int]*openapi.Response{
+				200: sessionResponse(d, "New tokens"),
+			},
+		},
+		{
+			method: "POST", path: "/api/auth/logout", id: "logout", tag: "Authentication", access: accessUser,
+			summary: "Sign out",
+			body:    dto.RefreshSessionRequest{}, optionalBody: true,
+			responses: map[int]*openapi.Response{
+				200: textResponse("Signed out"),
+			},
+		},
+		{
+			method: "GET", path: "/api/auth/csrf", id: "csrfToken", tag: "Authentication", access: accessOptional,
+			summary:     "Get a CSRF token",
+			description: "Also sets the `" + heplers.CSRFCookieName + "` cookie the token is checked against.",
+			responses: map[int]*openapi.Response{
+				200: jsonResponse(d, "The token and the header to send it in", dto.CSRFTokenResponse{}),
+			},
+		},
+		{
+			method: "POST", path: "/api/auth/password/forgot", id: "forgotPassword", tag: "Authentication", access: accessOptional,
+			summary:     "Request a password reset link",
+			description: "Answers the same whether or not the account exists.",
+			rateLimited: true,
+			body:        dto.ForgotPasswordRequest{},
+			responses:   map[int]*openapi.Response{202: textResponse("Accepted")},
+		},
+		{
+			method: "POST", path: "/api/auth/password/reset", id: "resetPassword", tag: "Authentication", access: accessOptional,
+			summary:     "Set a new password with a reset token",
+			rateLimited: true,
+			body:        dto.ResetPasswordRequest{},
+			responses:   map[int]*openapi.Response{200: textResponse("Password changed")},
+		},
+		{
+			method: "POST", path: "/api/auth/password/change", id: "changePassword", tag: "Authentication", access: accessSession,
+			summary:     "Change the caller's password",
+			description: "Signs out every other session.",
+			body:        dto.ChangePasswordRequest{},
+			responses:   map[int]*openapi.Response{200: textResponse("Password changed")},
+		},
+
+		{
+			method: "POST", path: "/api/auth/mfa/enroll", id: "enrollMfa", tag: "Two-factor authentication", access: accessSession,
+			summary:   "Start enrolling a TOTP authenticator",
+			responses: map[int]*openapi.Response{200: jsonResponse(d, "The secret to add to the authenticator", dto.MfaEnrollResponse{})},
+		},
+		{
+			method: "POST", path: "/api/auth/mfa/activate", id: "activateMfa", tag: "Two-factor authentication", access: accessSession,
+			summary:   "Finish enrolling with a code from the authenticator",
+			body:      dto.MfaCodeRequest{},
+			responses: map[int]*openapi.Response{200: recoveryCodes},
+		},
+		{
+			method: "POST", path: "/api/auth/mfa/disable", id: "disableMfa", tag: "Two-factor authentication", access: accessSession,
+			summary:   "Turn two-factor authentication off",
+			body:      dto.MfaDisableRequest{},
+			responses: map[int]*openapi.Response{200: textResponse("Disabled")},
+		},
+		{
+			method: "POST", path: "/api/auth/mfa/recovery-codes", id: "regenerateRecoveryCodes", tag: "Two-factor authentication", access: accessSession,
+			summary:   "Replace the recovery codes",
+			body:      dto.MfaCodeRequest{},
+			responses: map[int]*openapi.Response{200: recoveryCodes},
+		},
+		{
+			method: "POST", path: "/api/user/{id}/mfa/reset", id: "resetMfa", tag: "Two-factor authentication", access: accessUser,
+			mfa: true, permission: domain.PermissionUsersManage,
+			summary:   "Turn off two-factor authentication of a user who lost their device",
+			responses: map[int]*openapi.Response{200: textResponse("Reset")},
+		},
+
+		{
+			method: "GET", path: "/api/auth/oidc/providers", id: "listIdentityProviders", tag: "Identity providers", access: accessOptional,
+			summary:   "List the configured identity providers",
+			responses: map[int]*openapi.Response{200: jsonResponse(d, "Provider names", dto.OidcProvidersResponse{})},
+		},
+		{
+			method: "GET", path: "/api/auth/oidc/{provider}/login", id: "startIdentityProviderSignIn", tag: "Identity providers", access: accessOptional,
+			summary:   "Start signing in with an identity provider",
+			responses: map[int]*openapi.Response{302: redirectResponse("Redirect to the identity provider")},
+		},
+		{
+			method: "GET", path: "/api/auth/oidc/{provider}/callback", id: "completeIdentityProviderSignIn", tag: "Identity providers", access: accessOptional,
+			summary:     "Complete signing in with an identity provider",
+			description: "The identity provider redirects the browser here. On success the session cookies are set.",
+			params: []*openapi.Parameter{
+				queryParam("state", "", stringSchema),
+				queryParam("code", "", stringSchema),
+				queryParam("error", "Set by the provider when sign-in was rejected", stringSchema),
+			},
+			responses: map[int]*openapi.Response{302: redirectResponse("Signed in, redirect to the configured page")},
+		},
+
+		{
+			method: "GET", path: "/api/user/info", id: "getMe", tag: "Account", access: accessOptional,
+			summary:   "Get the caller's profile",
+			responses: map[int]*openapi.Response{200: aboutMe},
+		},
+		{
+			method: "PATCH", path: "/api/user/me", id: "updateMe", tag: "Account", access: accessSession, permission: domain.PermissionProfileWrite,
+			summary: "Edit the caller's profile",
+			description: "Only the fields present change. The profile version must be sent in `version` or " +
+				"`If-Match`. Changing the login signs out every other session and re-issues the caller's.",
+			params: []*openapi.Parameter{
+				{Name: "If-Match", In: "header", Description: "The ETag of `GET /api/user/info`", Schema: stringSchema},
+				transportParam,
+			},
+			body: dto.UpdateProfileRequest{},
+			responses: map[int]*openapi.Response{
+				200: jsonResponse(d, "The updated profile", dto.UpdateProfileResponse{}),
+				409: {Ref: "#/components/responses/Problem", Description: "Login, email or phone taken"},
+				412: {Ref: "#/components/responses/Problem", Description: "The profile changed since the given version"},
+				428: {Ref: "#/components/responses/Problem", Description: "No profile version was given"},
+			},
+		},
+		{
+			method: "DELETE", path: "/api/user/me", id: "deleteMe", tag: "Account", access: accessSession,
+			summary:     "Delete the caller's account",
+			description: "Users with a password must confirm it.",
+			body:        dto.DeleteAccountRequest{}, optionalBody: true,
+			responses: map[int]*openapi.Response{200: textResponse("Deleted")},
+		},
+		{
+			method: "GET", path: "/api/user/me/export", id: "exportMe", tag: "Account", access: accessSession,
+			summary:   "Export all data held about the caller",
+			responses: map[int]*openapi.Response{200: jsonResponse(d, "The export", dto.AccountExportResponse{})},
+		},
+		{
+			method: "PUT", path: "/api/user/me/contact", id: "updateContacts", tag: "Account", access: accessUser, permission: domain.PermissionProfileWrite,
+			summary: "Set the caller's email and phone",
+			description: "A changed email must be verified again. The profile version must be sent in `version` or " +
+				"`If-Match`, as for `PATCH /api/user/me`.",
+			params: []*openapi.Parameter{
+				{Name: "If-Match", In: "header", Description: "The ETag of `GET /api/user/info`", Schema: stringSchema},
+			},
+			body: dto.UpdateContactsRequest{},
+			responses: map[int]*openapi.Response{
+				200: userInfo,
+				409: {Ref: "#/components/responses/Problem", Description: "Email or phone taken"},
+				412: {Ref: "#/components/responses/Problem", Description: "The profile changed since the given version"},
+				428: {Ref: "#/components/responses/Problem", Description: "No profile version was given"},
+			},
+		},
+		{
+			method: "GET", path: "/api/user/verify-email", id: "verifyEmail", tag: "Account", access: accessOptional,
+			summary: "Verify an email address with the link sent by mail",
+			params:  []*openapi.Parameter{{Name: "token", In: "query", Required: true, Schema: stringSchema}},
+			responses: map[int]*openapi.Response{
+				200: textResponse("Verified"),
+				412: {Ref: "#/components/responses/Problem", Description: "The profile changed while verifying; open the link again"},
+			},
+		},
+		{
+			method: "POST", path: "/api/user/verify-email/resend", id: "resendVerification", tag: "Account", access: accessUser,
+			summary:     "Send a new verification link",
+			rateLimited: true,
+			responses:   map[int]*openapi.Response{202: textResponse("Sent")},
+		},
+		{
+			method: "PUT", path: "/api/user/me/avatar", id: "uploadAvatar", tag: "Account", access: accessSession, permission: domain.PermissionProfileWrite,
+			summary:        "Upload the caller's avatar",
+			description:    fmt.Sprintf("A PNG, JPEG or GIF image of at most %d KiB, as the body or the `avatar` field of a form.", service.MaxAvatarSize>>10),
+			requestContent: avatarUpload,
+			responses: map[int]*openapi.Response{
+				200: textResponse("Updated"),
+				400: {Ref: "#/components/responses/Problem", Description: "Not a supported image"},
+				413: {Ref: "#/components/responses/Problem", Description: "Image too large"},
+			},
+		},
+		{
+			method: "DELETE", path: "/api/user/me/avatar", id: "deleteAvatar", tag: "Account", access: accessSession, permission: domain.PermissionProfileWrite,
+			summary:   "Remove the caller's avatar",
+			responses: map[int]*openapi.Response{200: textResponse("Deleted")},
+		},
+		{
+			method: "GET", path: "/api/user/{id}/avatar", id: "getAvatar", tag: "Account", access: accessUser,
+			summary:   "Get a user's avatar",
+			responses: map[int]*openapi.Response{200: avatar},
+		},
+		{
+			method: "POST", path: "/api/user/api-keys", id: "createMyApiKey", tag: "Account", access: accessSession,
+			summary:     "Create an API key",
+			description: "Scopes are permissions the caller has; the key never grants more than its owner.",
+			body:        dto.CreateApiKeyRequest{},
+			responses:   map[int]*openapi.Response{201: createdApiKey},
+		},
+		{
+			method: "GET", path: "/api/user/api-keys", id: "listMyApiKeys", tag: "Account", access: accessSession,
+			summary:   "List the caller's API keys",
+			responses: map[int]*openapi.Response{200: apiKeys},
+		},
+		{
+			method: "DELETE", path: "/api/user/api-keys/{keyId}", id: "revokeMyApiKey", tag: "Account", access: accessSession,
+			summary:   "Revoke one of the caller's API keys",
+			responses: map[int]*openapi.Response{200: textResponse("Revoked")},
+		},
+		{
+			method: "POST", path: "/api/user/adopt-cat", id: "adoptCat", tag: "Cats", access: accessUser,
+			summary:     "Adopt a cat",
+			description: "Requires a verified email address.",
+			body:        dto.AdoptCatRequest{},
+			responses:   map[int]*openapi.Response{200: textResponse("Adopted")},
+		},
+
+		{
+			method: "GET", path: "/api/cats", id: "listCats", tag: "Cats", access: accessOptional,
+			summary:   "List cats waiting for adoption",
+			params:    pageParams(),
+			responses: map[int]*openapi.Response{200: jsonResponse(d, "A page of cats", dto.CatsPaginatedResponse{})},
+		},
+		{
+			method: "POST", path: "/api/cats", id: "addCat", tag: "Cats", access: accessUser, mfa: true, permission: domain.PermissionCatsWrite,
+			summary:   "Add a cat",
+			body:      dto.CatRequest{},
+			responses: map[int]*openapi.Response{201: textResponse("Added")},
+		},
+		{
+			method: "GET", path: "/api/cats/{id}", id: "getCat", tag: "Cats", access: accessOptional,
+			summary:   "Get a cat",
+			responses: map[int]*openapi.Response{200: jsonResponse(d, "The cat", dto.CatResponse{})},
+		},
+
+		{
+			method: "GET", path: "/api/user/info/{id}", id: "getUser", tag: "Users", access: accessUser,
+			summary:     "Get a user's profile",
+			description: "Allowed by the resource policies, e.g. for admins and the user themselves.",
+			responses:   map[int]*openapi.Response{200: userInfo},
+		},
+		{
+			method: "GET", path: "/api/users", id: "listUsers", tag: "Users", access: accessUser, mfa: true, permission: domain.PermissionUsersRead,
+			summary: "Search users",
+			params: append([]*openapi.Parameter{
+				queryParam("q", "Part of the login, name or email", stringSchema),
+				queryParam("role", "Role name", stringSchema),
+				queryParam("status", "Account status", stringSchema),
+				queryParam("registered_from", "", dateTimeSchema),
+				queryParam("registered_to", "", dateTimeSchema),
+				queryParam("sort", "A column, prefixed with `-` for descending order", &openapi.Schema{
+					Type: "string",
+					Enum: sortValues(),
+				}),
+			}, pageParams()...),
+			responses: map[int]*openapi.Response{200: jsonResponse(d, "A page of users", dto.UsersPaginatedResponse{})},
+		},
+		{
+			method: "POST", path: "/api/users/bulk/roles", id: "bulkAssignRole", tag: "Users", access: accessUser, mfa: true, permission: domain.PermissionUsersRolesManage,
+			summary:   "Grant a role to many users",
+			body:      dto.BulkAssignRoleRequest{},
+			responses: map[int]*openapi.Response{200: jsonResponse(d, "How many users got the role", dto.BulkAssignRoleResponse{})},
+		},
+		{
+			method: "POST", path: "/api/users/bulk/suspend", id: "bulkSuspend", tag: "Users", access: accessUser, mfa: true, permission: domain.PermissionUsersManage,
+			summary:   "Suspend many users",
+			body:      dto.BulkSuspendRequest{},
+			responses: map[int]*openapi.Response{200: textResponse("Suspended")},
+		},
+		{
+			method: "POST", path: "/api/user/{id}/add-role", id: "addRole", tag: "Users", access: accessUser, mfa: true, permission: domain.PermissionUsersRolesManage,
+			summary:   "Grant a role to a user",
+			body:      dto.AddRoleRequest{},
+			responses: map[int]*openapi.Response{200: textResponse("Granted")},
+		},
+		{
+			method: "POST", path: "/api/user/{id}/remove-role", id: "removeRole", tag: "Users", access: accessUser, mfa: true, permission: domain.PermissionUsersRolesManage,
+			summary:   "Revoke a role from a user",
+			body:      dto.AddRoleRequest{},
+			responses: map[int]*openapi.Response{200: textResponse("Revoked")},
+		},
+		{
+			method: "POST", path: "/api/user/{id}/unlock", id: "unlockUser", tag: "Users", access: accessUser, mfa: true, permission: domain.PermissionUsersManage,
+			summary:   "Lift a login lockout",
+			responses: map[int]*openapi.Response{200: textResponse("Unlocked")},
+		},
+		{
+			method: "POST", path: "/api/user/{id}/suspend", id: "suspendUser", tag: "Users", access: accessUser, mfa: true, permission: domain.PermissionUsersManage,
+			summary:   "Suspend a user, indefinitely or until a time",
+			body:      dto.SuspendUserRequest{},
+			responses: map[int]*openapi.Response{200: textResponse("Suspended")},
+		},
+		{
+			method: "POST", path: "/api/user/{id}/ban", id: "banUser", tag: "Users", access: accessUser, mfa: true, permission: domain.PermissionUsersManage,
+			summary:   "Ban a user",
+			body:      dto.BanUserRequest{},
+			responses: map[int]*openapi.Response{200: textResponse("Banned")},
+		},
+		{
+			method: "POST", path: "/api/user/{id}/reactivate", id: "reactivateUser", tag: "Users", access: accessUser, mfa: true, permission: domain.PermissionUsersManage,
+			summary:   "Lift a suspension or ban",
+			responses: map[int]*openapi.Response{200: textResponse("Reactivated")},
+		},
+
+		{
+			method: "POST", path: "/api/service-accounts", id: "createServiceAccount", tag: "Service accounts", access: accessSession, mfa: true, permission: domain.PermissionUsersManage,
+			summary: "Create a service account",
+			body:    dto.CreateServiceAccountRequest{},
+			responses: map[int]*openapi.Response{
+				201: jsonResponse(d, "The service account", dto.ServiceAccountResponse{}),
+				409: {Ref: "#/components/responses/Problem", Description: "Login taken"},
+			},
+		},
+		{
+			method: "POST", path: "/api/service-accounts/{id}/api-keys", id: "createServiceAccountApiKey", tag: "Service accounts", access: accessSession, mfa: true, permission: domain.PermissionUsersManage,
+			summary:   "Create an API key for a service account",
+			body:      dto.CreateApiKeyRequest{},
+			responses: map[int]*openapi.Response{201: createdApiKey},
+		},
+		{
+			method: "GET", path: "/api/service-accounts/{id}/api-keys", id: "listServiceAccountApiKeys", tag: "Service accounts", access: accessSession, mfa: true, permission: domain.PermissionUsersManage,
+			summary:   "List the API keys of a service account",
+			responses: map[int]*openapi.Response{200: apiKeys},
+		},
+		{
+			method: "DELETE", path: "/api/service-accounts/{id}/api-keys/{keyId}", id: "revokeServiceAccountApiKey", tag: "Service accounts", access: accessSession, mfa: true, permission: domain.PermissionUsersManage,
+			summary:   "Revoke an API key of a service account",
+			responses: map[int]*openapi.Response{200: textResponse("Revoked")},
+		},
+
+		{
+			method: "GET", path: "/api/roles", id: "listRoles", tag: "Roles", access: accessUser, mfa: true, permission: domain.PermissionRolesManage,
+			summary:   "List roles with their permissions",
+			responses: map[int]*openapi.Response{200: jsonResponse(d, "The roles", []dto.RoleDetailsResponse{})},
+		},
+		{
+			method: "POST", path: "/api/roles", id: "createRole", tag: "Roles", access: accessUser, mfa: true, permission: domain.PermissionRolesManage,
+			summary: "Create a role",
+			body:    dto.CreateRoleRequest{},
+			responses: map[int]*openapi.Response{
+				201: roleDetails,
+				409: {Ref: "#/components/responses/Problem", Description: "Role exists"},
+			},
+		},
+		{
+			method: "PATCH", path: "/api/roles/{name}", id: "updateRole", tag: "Roles", access: accessUser, mfa: true, permission: domain.PermissionRolesManage,
+			summary:     "Edit a role",
+			description: "Only the fields present change.",
+			body:        dto.UpdateRoleRequest{},
+			responses:   map[int]*openapi.Response{200: roleDetails},
+		},
+		{
+			method: "DELETE", path: "/api/roles/{name}", id: "deleteRole", tag: "Roles", access: accessUser, mfa: true, permission: domain.PermissionRolesManage,
+			summary:     "Delete a role",
+			description: "A role still assigned to users can only be deleted when they are moved to `reassign_to`.",
+			params:      []*openapi.Parameter{queryParam("reassign_to", "Role the users of the deleted role get instead", stringSchema)},
+			responses: map[int]*openapi.Response{
+				200: textResponse("Deleted"),
+				409: {Ref: "#/components/responses/Problem", Description: "Role is built in or still in use"},
+			},
+		},
+
+		{
+			method: "GET", path: "/api/audit", id: "listAuditEntries", tag: "Audit log", access: accessUser, mfa: true, permission: domain.PermissionAuditRead,
+			summary:     "Search the audit log",
+			description: "With `format=csv` or `Accept: text/csv` every matching entry is exported as CSV, unpaginated.",
+			params: append([]*openapi.Parameter{
+				queryParam("actor_id", "", stringSchema),
+				queryParam("action", "", stringSchema),
+				queryParam("target_type", "", stringSchema),
+				queryParam("target_id", "", stringSchema),
+				queryParam("from", "", dateTimeSchema),
+				queryParam("to", "", dateTimeSchema),
+				queryParam("format", "", &openapi.Schema{Type: "string", Enum: []any{"csv"}}),
+			}, pageParams()...),
+			responses: map[int]*openapi.Response{200: auditList},
+		},
+		{
+			method: "GET", path: "/api/audit/verify", id: "verifyAuditLog", tag: "Audit log", access: accessUser, mfa: true, permission: domain.PermissionAuditRead,
+			summary:   "Check the hash chain of the audit log",
+			responses: map[int]*openapi.Response{200: jsonResponse(d, "The result", dto.AuditVerificationResponse{})},
+		},
+	}
+}
+
+func sortValues() []any {
+	var columns []string
+	for column := range repository.UserSortColumns {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	values := make([]any, 0, 2*len(columns))
+	for _, column := range columns {
+		values = append(values, column, "-"+column)
+	}
+	return values
+}
@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"api/catshelter/internal/custom_middleware/heplers"
+	"api/catshelter/internal/handler/dto"
+	"api/catshelter/internal/handler/problem"
+	"api/catshelter/internal/service"
+	"log/slog"
+	"net/http"
+)
+
+type PasswordHandler struct {
+	passwordService service.PasswordService
+}
+
+func (h *PasswordHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	userId, ok := heplers.UserIdFromContext(r.Context())
+	if !ok {
+		problem.MissingUser(w, r)
+		return
+	}
+
+	var req dto.ChangePasswordRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	currentRefreshToken := req.RefreshToken
+	if cookie, err := r.Cookie("refresh_token"); err == nil {
+		currentRefreshToken = cookie.Value
+	}
+
+	err := h.passwordService.ChangePassword(r.Context(), userId, req.CurrentPassword, req.NewPassword, currentRefreshToken)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	w.Write([]byte("Password successfully changed"))
+}
+
+func (h *PasswordHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req dto.ForgotPasswordRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	if err := h.passwordService.RequestReset(r.Context(), req.Login); err != nil {
+		slog.ErrorContext(r.Context(), "password reset request failed", "error", err)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte("If the account exists, a password reset link has been sent"))
+}
+
+func (h *PasswordHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req dto.ResetPasswordRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	err := h.passwordService.ResetPassword(r.Context(), req.Token, req.NewPassword)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	w.Write([]byte("Password successfully reset"))
+}
+
+func NewPasswordHandler(passwordService service.PasswordService) *PasswordHandler {
+	return &PasswordHandler{passwordService: passwordService}
+}
@@ -0,0 +1,29 @@
+package handler
+
+import (
+	"api/catshelter/internal/custom_middleware/heplers"
+	"api/catshelter/internal/handler/problem"
+	"api/catshelter/internal/service"
+	"errors"
+	"net/http"
+)
+
+// subjectFromRequest describes the caller for policy checks. Anonymous
+// requests get an empty subject.
+func subjectFromRequest(r *http.Request) *service.Subject {
+	subject := &service.Subject{}
+	subject.UserId, _ = heplers.UserIdFromContext(r.Context())
+	subject.Roles, _ = heplers.UserRolesFromContext(r.Context())
+	subject.Permissions, _ = heplers.PermissionsFromContext(r.Context())
+	return subject
+}
+
+// writePolicyError answers a denied policy check. notFound is sent for hidden
+// resources and must be the same problem a missing resource gets.
+func writePolicyError(w http.ResponseWriter, r *http.Request, err error, notFound *problem.Problem) {
+	if errors.Is(err, service.ErrResourceHidden) {
+		problem.Write(w, r, notFound)
+		return
+	}
+	problem.Error(w, r, err)
+}
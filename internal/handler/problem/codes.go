@@ -0,0 +1,144 @@
+package problem
+
+import (
+	"api/catshelter/internal/domain"
+	"api/catshelter/internal/repository"
+	"api/catshelter/internal/service"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Error codes are part of the API: clients may branch on them, so existing
+// codes must never change meaning or be renamed.
+const (
+	CodeInternal         = "internal_error"
+	CodeInvalidRequest   = "invalid_request"
+	CodeInvalidBody      = "invalid_body"
+	CodeValidation       = "validation_failed"
+	CodeUnauthenticated  = "unauthenticated"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeTooLarge         = "payload_too_large"
+	CodeRateLimited      = "rate_limited"
+
+	CodeInvalidCredentials  = "invalid_credentials"
+	CodeLoginLocked         = "login_locked"
+	CodeAccountDisabled     = "account_disabled"
+	CodeAccountDeleted      = "account_deleted"
+	CodeIncorrectPassword   = "incorrect_password"
+	CodeAlreadyLoggedIn     = "already_logged_in"
+	CodeInvalidRefreshToken = "invalid_refresh_token"
+	CodeInvalidApiKey       = "invalid_api_key"
+	CodeApiKeyNotAllowed    = "api_key_not_allowed"
+	CodeCsrfFailed          = "csrf_failed"
+
+	CodeMfaRequired      = "mfa_required"
+	CodeMfaMandatory     = "mfa_mandatory"
+	CodeInvalidMfaCode   = "invalid_mfa_code"
+	CodeInvalidMfaToken  = "invalid_mfa_token"
+	CodeMfaAlreadyActive = "mfa_already_enabled"
+	CodeMfaNotEnrolled   = "mfa_not_enrolled"
+
+	CodeUserNotFound       = "user_not_found"
+	CodeCatNotFound        = "cat_not_found"
+	CodeRoleNotFound       = "role_not_found"
+	CodePermissionNotFound = "permission_not_found"
+	CodeApiKeyNotFound     = "api_key_not_found"
+	CodeAvatarNotFound     = "avatar_not_found"
+	CodeNotServiceAccount  = "not_service_account"
+
+	CodeLoginTaken            = "login_taken"
+	CodeEmailTaken            = "email_taken"
+	CodePhoneTaken            = "phone_taken"
+	CodeRoleExists            = "role_exists"
+	CodeRoleInUse             = "role_in_use"
+	CodeLastRole              = "last_role"
+	CodeVersionConflict       = "version_conflict"
+	CodeVersionRequired       = "version_required"
+	CodeEmailNotVerified      = "email_not_verified"
+	CodeNoEmail               = "no_email"
+	CodeInvalidVerifyLink     = "invalid_verification_link"
+	CodeInvalidResetToken     = "invalid_reset_token"
+	CodeUnknownOidcProvider   = "unknown_identity_provider"
+	CodeInvalidOidcFlow       = "invalid_sign_in_attempt"
+	CodeOidcFailed            = "identity_provider_failed"
+	CodeIdentityProviderError = "identity_provider_rejected"
+)
+
+type mapping struct {
+	err    error
+	status int
+	code   string
+	// detail replaces the error message for errors whose message may carry
+	// internal or sensitive data.
+	detail string
+	header func(err error) http.Header
+}
+
+func (m mapping) matches(err error) bool {
+	return errors.Is(err, m.err)
+}
+
+// mappings translates sentinel errors of the domain, repository and service
+// layers. More specific errors must come before the errors they wrap.
+var mappings = []mapping{
+	{err: repository.ErrUserNotFound, status: http.StatusNotFound, code: CodeUserNotFound},
+	{err: repository.ErrCatNotFound, status: http.StatusNotFound, code: CodeCatNotFound},
+	{err: repository.ErrRoleNotFound, status: http.StatusNotFound, code: CodeRoleNotFound},
+	{err: repository.ErrApiKeyNotFound, status: http.StatusNotFound, code: CodeApiKeyNotFound},
+	{err: repository.ErrAvatarNotFound, status: http.StatusNotFound, code: CodeAvatarNotFound},
+	{err: service.ErrNotServiceAccount, status: http.StatusNotFound, code: CodeNotServiceAccount},
+	{err: service.ErrUnknownOidcProvider, status: http.StatusNotFound, code: CodeUnknownOidcProvider},
+	{err: service.ErrResourceHidden, status: http.StatusNotFound, code: CodeNotFound},
+	{err: repository.ErrPermissionNotFound, status: http.StatusBadRequest, code: CodePermissionNotFound},
+
+	{err: service.ErrInvalidCredentials, status: http.StatusUnauthorized, code: CodeInvalidCredentials},
+	{err: service.ErrTooManyLoginAttempts, status: http.StatusTooManyRequests, code: CodeLoginLocked,
+		detail: "Too many login attempts, try again later", header: retryAfter},
+	{err: repository.ErrRefreshTokenNotFound, status: http.StatusUnauthorized, code: CodeInvalidRefreshToken,
+		detail: "Refresh token is invalid or expired"},
+	{err: service.ErrRefreshTokenExpired, status: http.StatusUnauthorized, code: CodeInvalidRefreshToken,
+		detail: "Refresh token is invalid or expired"},
+	{err: service.ErrInvalidMfaCode, status: http.StatusUnauthorized, code: CodeInvalidMfaCode},
+	{err: service.ErrInvalidMfaToken, status: http.StatusUnauthorized, code: CodeInvalidMfaToken},
+	{err: service.ErrIncorrectPassword, status: http.StatusUnauthorized, code: CodeIncorrectPassword},
+	{err: service.ErrOidcAuthFailed, status: http.StatusUnauthorized, code: CodeOidcFailed,
+		detail: service.ErrOidcAuthFailed.Error()},
+
+	{err: domain.ErrAccountDeleted, status: http.StatusForbidden, code: CodeAccountDeleted},
+	{err: domain.ErrAccountDisabled, status: http.StatusForbidden, code: CodeAccountDisabled},
+	{err: service.ErrMfaMandatory, status: http.StatusForbidden, code: CodeMfaMandatory},
+	{err: domain.ErrEmailNotVerified, status: http.StatusForbidden, code: CodeEmailNotVerified,
+		detail: "Verify your email address first"},
+	{err: service.ErrForbidden, status: http.StatusForbidden, code: CodeForbidden, detail: "Forbidden"},
+
+	{err: service.ErrLoginAlreadyUsed, status: http.StatusConflict, code: CodeLoginTaken},
+	{err: service.ErrEmailAlreadyUsed, status: http.StatusConflict, code: CodeEmailTaken},
+	{err: service.ErrPhoneAlreadyUsed, status: http.StatusConflict, code: CodePhoneTaken},
+	{err: service.ErrRoleAlreadyExists, status: http.StatusConflict, code: CodeRoleExists},
+	{err: service.ErrRoleInUse, status: http.StatusConflict, code: CodeRoleInUse},
+	{err: domain.ErrTotpAlreadyEnabled, status: http.StatusConflict, code: CodeMfaAlreadyActive},
+	{err: domain.ErrTotpNotEnrolled, status: http.StatusConflict, code: CodeMfaNotEnrolled},
+	{err: repository.ErrVersionConflict, status: http.StatusPreconditionFailed, code: CodeVersionConflict,
+		detail: "The resource was changed elsewhere, reload it and try again"},
+
+	{err: domain.ErrCannotRemoveLastRole, status: http.StatusBadRequest, code: CodeLastRole},
+	{err: service.ErrMfaCodeNotSpecified, status: http.StatusBadRequest, code: CodeValidation},
+	{err: service.ErrNoEmail, status: http.StatusBadRequest, code: CodeNoEmail},
+	{err: service.ErrInvalidEmailVerificationLink, status: http.StatusBadRequest, code: CodeInvalidVerifyLink},
+	{err: service.ErrInvalidPasswordResetToken, status: http.StatusBadRequest, code: CodeInvalidResetToken},
+	{err: service.ErrInvalidOidcFlow, status: http.StatusBadRequest, code: CodeInvalidOidcFlow},
+	{err: domain.ErrValidation, status: http.StatusBadRequest, code: CodeValidation},
+}
+
+func retryAfter(err error) http.Header {
+	var lockedErr *service.LoginLockedError
+	if !errors.As(err, &lockedErr) {
+		return nil
+	}
+	seconds := int(time.Until(lockedErr.Until).Seconds()) + 1
+	return http.Header{"Retry-After": []string{strconv.Itoa(seconds)}}
+}
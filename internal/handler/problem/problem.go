@@ -0,0 +1,201 @@
+// Package problem writes errors as RFC 7807 problem details
+// (application/problem+json) with stable error codes.
+package problem
+
+import (
+	"api/catshelter/internal/domain"
+	"api/catshelter/internal/handler/dto"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+const ContentType = "application/problem+json"
+
+// TypePrefix is prepended to the code to form the problem type URI.
+const TypePrefix = "urn:catshelter:problem:"
+
+var exposeInternalErrors atomic.Bool
+
+// ExposeInternalErrors controls whether the detail of unexpected errors is
+// sent to clients. It must stay off in production, where such errors are only
+// logged.
+func ExposeInternalErrors(expose bool) {
+	exposeInternalErrors.Store(expose)
+}
+
+// Problem is an error with the HTTP status and code it should be answered
+// with. Detail is shown to the client.
+type Problem struct {
+	Status int
+	Code   string
+	Detail string
+	Errors []*domain.FieldError
+	Header http.Header
+}
+
+func New(status int, code, detail string) *Problem {
+	return &Problem{Status: status, Code: code, Detail: detail}
+}
+
+func (p *Problem) Error() string {
+	return p.Detail
+}
+
+// Write sends p to the client.
+func Write(w http.ResponseWriter, r *http.Request, p *Problem) {
+	response := &dto.ProblemResponse{
+		Type:      TypePrefix + p.Code,
+		Title:     http.StatusText(p.Status),
+		Status:    p.Status,
+		Detail:    p.Detail,
+		Instance:  r.URL.Path,
+		Code:      p.Code,
+		RequestId: middleware.GetReqID(r.Context()),
+	}
+	for _, fieldErr := range p.Errors {
+		response.Errors = append(response.Errors, dto.FieldErrorResponse{Field: fieldErr.Field, Message: fieldErr.Message})
+	}
+
+	for name, values := range p.Header {
+		for _, value := range values {
+			w.Header().Add(name, value)
+		}
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// Error answers err. Known errors are mapped by From; anything else is logged
+// and answered with a 500 that does not reveal the cause.
+func Error(w http.ResponseWriter, r *http.Request, err error) {
+	p := From(err)
+	if p.Code == CodeInternal {
+		slog.ErrorContext(r.Context(), "internal error", "method", r.Method, "path", r.URL.Path, "error", err)
+		if exposeInternalErrors.Load() {
+			p.Detail = err.Error()
+		}
+	}
+	Write(w, r, p)
+}
+
+// From maps err to a problem using the first matching entry of mappings.
+func From(err error) *Problem {
+	var p *Problem
+	if errors.As(err, &p) {
+		return p
+	}
+
+	for _, m := range mappings {
+		if !m.matches(err) {
+			continue
+		}
+		p := New(m.status, m.code, err.Error())
+		if m.detail != "" {
+			p.Detail = m.detail
+		}
+		if m.status == http.StatusBadRequest {
+			p.Errors = fieldErrors(err)
+			if len(p.Errors) > 1 {
+				p.Detail = "Request has invalid fields"
+			}
+		}
+		if m.header != nil {
+			p.Header = m.header(err)
+		}
+		return p
+	}
+	return New(http.StatusInternalServerError, CodeInternal, "Internal server error")
+}
+
+// fieldErrors collects the field errors in err's tree, including those
+// joined with errors.Join.
+func fieldErrors(err error) []*domain.FieldError {
+	if fieldErr, ok := err.(*domain.FieldError); ok {
+		return []*domain.FieldError{fieldErr}
+	}
+	switch e := err.(type) {
+	case interface{ Unwrap() []error }:
+		var all []*domain.FieldError
+		for _, inner := range e.Unwrap() {
+			all = append(all, fieldErrors(inner)...)
+		}
+		return all
+	case interface{ Unwrap() error }:
+		return fieldErrors(e.Unwrap())
+	}
+	return nil
+}
+
+func BadRequest(w http.ResponseWriter, r *http.Request, detail string) {
+	Write(w, r, New(http.StatusBadRequest, CodeInvalidRequest, detail))
+}
+
+func Forbidden(w http.ResponseWriter, r *http.Request, code, detail string) {
+	Write(w, r, New(http.StatusForbidden, code, detail))
+}
+
+func NotFound(w http.ResponseWriter, r *http.Request, code, detail string) {
+	Write(w, r, New(http.StatusNotFound, code, detail))
+}
+
+// MissingUser answers handlers behind the authenticator that find no user id
+// in the context, which means the route is wired wrong.
+func MissingUser(w http.ResponseWriter, r *http.Request) {
+	Write(w, r, New(http.StatusUnauthorized, CodeUnauthenticated, "Authentication required"))
+}
+
+// InvalidBody answers a request body that could not be decoded as JSON.
+// Type mismatches and unknown fields are reported against the offending field.
+func InvalidBody(w http.ResponseWriter, r *http.Request, err error) {
+	p := New(http.StatusBadRequest, CodeInvalidBody, "Request body is not valid JSON")
+
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		p = New(http.StatusRequestEntityTooLarge, CodeTooLarge,
+			"Request body must not be larger than "+strconv.FormatInt(maxBytesErr.Limit, 10)+" bytes")
+	case errors.Is(err, io.EOF):
+		p.Detail = "Request body is empty"
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		p.Detail = "Request body has a field of the wrong type"
+		p.Errors = []*domain.FieldError{domain.NewFieldError(typeErr.Field, typeErr.Field+" must be "+jsonTypeName(typeErr.Type.Kind()))}
+	case errors.As(err, &syntaxErr):
+		p.Detail = "Request body is not valid JSON: " + syntaxErr.Error()
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no error type for unknown fields.
+		field, _ := strconv.Unquote(strings.TrimPrefix(err.Error(), "json: unknown field "))
+		p.Detail = "Request body has an unknown field"
+		p.Errors = []*domain.FieldError{domain.NewFieldError(field, field+" is not a known field")}
+	case !errors.Is(err, io.ErrUnexpectedEOF):
+		p.Detail = "Request body is not valid: " + err.Error()
+	}
+	Write(w, r, p)
+}
+
+func jsonTypeName(kind reflect.Kind) string {
+	switch kind {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	default:
+		return "a number"
+	}
+}
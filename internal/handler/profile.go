@@ -0,0 +1,172 @@
+package handler
+
+import (
+	"api/catshelter/internal/custom_middleware/heplers"
+	"api/catshelter/internal/handler/dto"
+	"api/catshelter/internal/handler/problem"
+	"api/catshelter/internal/repository"
+	"api/catshelter/internal/service"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type ProfileHandler struct {
+	profileService service.ProfileService
+	authHandler    *AuthHandler
+}
+
+// UpdateMe edits the caller's profile. The profile version must be sent in
+// the body or as 'If-Match: "<version>"' (see the ETag of /api/user/info); a
+// stale version answers 412. Changing the login signs out every other session
+// and re-issues the caller's.
+func (h *ProfileHandler) UpdateMe(w http.ResponseWriter, r *http.Request) {
+	userId, ok := heplers.UserIdFromContext(r.Context())
+	if !ok {
+		problem.MissingUser(w, r)
+		return
+	}
+
+	var req dto.UpdateProfileRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	version, ok := profileVersion(r, req.Version)
+	if !ok {
+		problem.Write(w, r, problem.New(http.StatusPreconditionRequired, problem.CodeVersionRequired, "Profile version is required in 'If-Match' header or 'version' field"))
+		return
+	}
+
+	user, loginChanged, err := h.profileService.Update(r.Context(), userId, version, &service.ProfileUpdate{
+		Name:  req.Name,
+		Login: req.Login,
+		Email: req.Email,
+		Phone: req.Phone,
+	})
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	userRoles, _ := heplers.UserRolesFromContext(r.Context())
+	response := &dto.UpdateProfileResponse{UserInfoResponse: mapUserToUserInfoResponse(user, userRoles)}
+
+	if loginChanged {
+		if err := h.authHandler.tokenService.DeleteAllRefreshTokens(r.Context(), userId); err != nil && !errors.Is(err, repository.ErrUserNotFound) {
+			problem.Error(w, r, err)
+			return
+		}
+		tokens, err := h.authHandler.tokenService.CreateSession(r.Context(), user, heplers.MfaVerifiedFromContext(r.Context()))
+		if err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		if wantsTokenTransport(r) {
+			response.Session = tokenResponse(tokens)
+		} else {
+			h.authHandler.setAuthCookies(w, tokens)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("ETag", profileETag(user.Version))
+	json.NewEncoder(w).Encode(response)
+}
+
+// UploadAvatar takes the image in the 'avatar' field of a multipart form or
+// as the raw request body.
+func (h *ProfileHandler) UploadAvatar(w http.ResponseWriter, r *http.Request) {
+	userId, ok := heplers.UserIdFromContext(r.Context())
+	if !ok {
+		problem.MissingUser(w, r)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, service.MaxAvatarSize+1<<10)
+	var body io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("avatar")
+		if err != nil {
+			problem.BadRequest(w, r, "Avatar file is missing in 'avatar' field or too large")
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+
+	data, err := io.ReadAll(io.LimitReader(body, service.MaxAvatarSize+1))
+	if err != nil {
+		problem.Write(w, r, problem.New(http.StatusRequestEntityTooLarge, problem.CodeTooLarge, "Avatar is too large"))
+		return
+	}
+
+	if err := h.profileService.SetAvatar(r.Context(), userId, data); err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	w.Write([]byte("Avatar successfully updated"))
+}
+
+func (h *ProfileHandler) DeleteAvatar(w http.ResponseWriter, r *http.Request) {
+	userId, ok := heplers.UserIdFromContext(r.Context())
+	if !ok {
+		problem.MissingUser(w, r)
+		return
+	}
+
+	if err := h.profileService.DeleteAvatar(r.Context(), userId); err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	w.Write([]byte("Avatar successfully deleted"))
+}
+
+func (h *ProfileHandler) Avatar(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		problem.BadRequest(w, r, "User id is missing in URL")
+		return
+	}
+
+	avatar, err := h.profileService.Avatar(r.Context(), id)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", avatar.ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	w.Header().Set("Last-Modified", avatar.UpdatedAt.UTC().Format(http.TimeFormat))
+	w.Write(avatar.Data)
+}
+
+func profileETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// profileVersion reads the expected version from 'If-Match' or, failing
+// that, from the request body.
+func profileVersion(r *http.Request, bodyVersion *int64) (int64, bool) {
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		version, err := strconv.ParseInt(strings.Trim(strings.TrimPrefix(ifMatch, "W/"), `"`), 10, 64)
+		return version, err == nil
+	}
+	if bodyVersion != nil {
+		return *bodyVersion, true
+	}
+	return 0, false
+}
+
+func NewProfileHandler(profileService service.ProfileService, authHandler *AuthHandler) *ProfileHandler {
+	return &ProfileHandler{profileService: profileService, authHandler: authHandler}
+}
@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"api/catshelter/internal/handler/problem"
+	"api/catshelter/internal/handler/validate"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// maxBodySize bounds JSON request bodies. Avatar uploads have their own limit.
+const maxBodySize = 64 << 10
+
+var errTrailingData = errors.New("more than one JSON value")
+
+// decodeRequest reads the JSON body of r into req and checks it with
+// validate.Struct. Unknown fields, trailing data and bodies over maxBodySize
+// are rejected. On failure the problem is written and false is returned.
+func decodeRequest[T any](w http.ResponseWriter, r *http.Request, req *T) bool {
+	if err := decodeJSON(w, r, req); err != nil {
+		problem.InvalidBody(w, r, err)
+		return false
+	}
+	if err := validate.Struct(req); err != nil {
+		problem.Error(w, r, err)
+		return false
+	}
+	return true
+}
+
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return errTrailingData
+	}
+	return nil
+}
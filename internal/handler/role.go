@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"api/catshelter/internal/handler/dto"
+	"api/catshelter/internal/handler/problem"
+	"api/catshelter/internal/service"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type RoleHandler struct {
+	roleService service.RoleService
+}
+
+func (h *RoleHandler) List(w http.ResponseWriter, r *http.Request) {
+	summaries, err := h.roleService.List(r.Context())
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	response := make([]dto.RoleDetailsResponse, 0, len(summaries))
+	for _, summary := range summaries {
+		response = append(response, mapRoleSummaryToRoleDetailsResponse(summary))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *RoleHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req dto.CreateRoleRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	summary, err := h.roleService.Create(r.Context(), req.Name, req.Description, req.InheritsFrom, req.Permissions)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(mapRoleSummaryToRoleDetailsResponse(summary))
+}
+
+func (h *RoleHandler) Update(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	if name == "" {
+		problem.BadRequest(w, r, "Role name is missing in URL")
+		return
+	}
+
+	var req dto.UpdateRoleRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	summary, err := h.roleService.Update(r.Context(), name, &service.RoleUpdate{
+		Name:         req.Name,
+		Description:  req.Description,
+		InheritsFrom: req.InheritsFrom,
+		Permissions:  req.Permissions,
+	})
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(mapRoleSummaryToRoleDetailsResponse(summary))
+}
+
+// Delete removes a role. Roles still assigned to users need a
+// '?reassign_to=<role>' query parameter naming the role they move to.
+func (h *RoleHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	if name == "" {
+		problem.BadRequest(w, r, "Role name is missing in URL")
+		return
+	}
+
+	if err := h.roleService.Delete(r.Context(), name, r.URL.Query().Get("reassign_to")); err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	w.Write([]byte("Role successfully deleted"))
+}
+
+func NewRoleHandler(roleService service.RoleService) *RoleHandler {
+	return &RoleHandler{roleService: roleService}
+}
@@ -4,18 +4,24 @@ import (
 	"api/catshelter/internal/custom_middleware/heplers"
 	"api/catshelter/internal/domain"
 	"api/catshelter/internal/handler/dto"
+	"api/catshelter/internal/handler/problem"
 	"api/catshelter/internal/repository"
 	"api/catshelter/internal/service"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 )
 
 type UserHandler struct {
 	userService service.UserService
+	catService  service.CatService
+	policy      service.Policy
 }
 
 func (h *UserHandler) AboutMe(w http.ResponseWriter, r *http.Request) {
@@ -26,11 +32,7 @@ func (h *UserHandler) AboutMe(w http.ResponseWriter, r *http.Request) {
 	}
 	userWithCats, err := h.userService.FindByIdWithCats(r.Context(), userId)
 	if err != nil {
-		if errors.Is(err, repository.ErrUserNotFound) {
-			http.Error(w, fmt.Sprintf("User with id '%s' not found", userId), http.StatusNotFound)
-			return
-		}
-		http.Error(w, fmt.Sprintf("Internal server error: %s", err.Error()), http.StatusInternalServerError)
+		problem.Error(w, r, err)
 		return
 	}
 	userRoles, _ := heplers.UserRolesFromContext(r.Context())
@@ -38,34 +40,44 @@ func (h *UserHandler) AboutMe(w http.ResponseWriter, r *http.Request) {
 	response := mapUserToUserInfoResponse(userWithCats, userRoles)
 
 	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(response)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Error encoding response: %s", err.Error()), http.StatusInternalServerError)
-		return
-	}
+	w.Header().Set("ETag", profileETag(userWithCats.Version))
+	json.NewEncoder(w).Encode(response)
 }
 
 func (h *UserHandler) AdoptCat(w http.ResponseWriter, r *http.Request) {
 	var cat dto.AdoptCatRequest
-	err := json.NewDecoder(r.Body).Decode(&cat)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to decode JSON: %s", err.Error()), http.StatusBadRequest)
+	if !decodeRequest(w, r, &cat) {
 		return
 	}
 
 	userId, ok := heplers.UserIdFromContext(r.Context())
 	if !ok {
-		http.Error(w, "User id not found", http.StatusBadRequest)
+		problem.MissingUser(w, r)
+		return
+	}
+
+	notFound := problem.New(http.StatusNotFound, problem.CodeCatNotFound, fmt.Sprintf("Cat with id '%s' not found", cat.Id))
+	found, err := h.catService.FindById(r.Context(), cat.Id)
+	if err != nil {
+		if errors.Is(err, repository.ErrCatNotFound) {
+			problem.Write(w, r, notFound)
+			return
+		}
+		problem.Error(w, r, err)
+		return
+	}
+	if err := h.policy.Authorize(subjectFromRequest(r), service.ActionAdopt, found); err != nil {
+		writePolicyError(w, r, err, notFound)
 		return
 	}
 
 	err = h.userService.AdoptCat(r.Context(), cat.Id, userId)
 	if err != nil {
-		if errors.Is(err, repository.ErrCatNotFound) || errors.Is(err, repository.ErrUserNotFound) {
-			http.Error(w, err.Error(), http.StatusNotFound)
+		if errors.Is(err, domain.ErrEmailNotVerified) {
+			problem.Write(w, r, problem.New(http.StatusForbidden, problem.CodeEmailNotVerified, "Verify your email address before adopting a cat"))
 			return
 		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Error(w, r, err)
 		return
 	}
 
@@ -75,17 +87,22 @@ func (h *UserHandler) AdoptCat(w http.ResponseWriter, r *http.Request) {
 func (h *UserHandler) AboutUser(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	if id == "" {
-		http.Error(w, "User id is missing in URL", http.StatusBadRequest)
+		problem.BadRequest(w, r, "User id is missing in URL")
 		return
 	}
 
+	notFound := problem.New(http.StatusNotFound, problem.CodeUserNotFound, fmt.Sprintf("User with id '%s' not found", id))
 	user, err := h.userService.FindByIdWithAll(r.Context(), id)
 	if err != nil {
 		if errors.Is(err, repository.ErrUserNotFound) {
-			http.Error(w, fmt.Sprintf("User with id '%s' not found", id), http.StatusNotFound)
+			problem.Write(w, r, notFound)
 			return
 		}
-		http.Error(w, fmt.Sprintf("DB error: %s", err.Error()), http.StatusInternalServerError)
+		problem.Error(w, r, err)
+		return
+	}
+	if err := h.policy.Authorize(subjectFromRequest(r), service.ActionRead, user); err != nil {
+		writePolicyError(w, r, err, notFound)
 		return
 	}
 
@@ -97,41 +114,24 @@ func (h *UserHandler) AboutUser(w http.ResponseWriter, r *http.Request) {
 	response := mapUserToUserInfoResponse(user, userRolesStrings)
 
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(response); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to encode JSON: %s", err.Error()), http.StatusInternalServerError)
-		return
-	}
+	json.NewEncoder(w).Encode(response)
 }
 
 func (h *UserHandler) AddRole(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	if id == "" {
-		http.Error(w, "User id is missing in URL", http.StatusBadRequest)
+		problem.BadRequest(w, r, "User id is missing in URL")
 		return
 	}
 
 	var roleName dto.AddRoleRequest
-	if err := json.NewDecoder(r.Body).Decode(&roleName); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to decode JSON: %s", err.Error()), http.StatusInternalServerError)
+	if !decodeRequest(w, r, &roleName) {
 		return
 	}
 
 	err := h.userService.AddRole(r.Context(), id, roleName.Name)
 	if err != nil {
-		if errors.Is(err, repository.ErrUserNotFound) {
-			http.Error(w, fmt.Sprintf("User with id '%s' not found", id), http.StatusNotFound)
-			return
-		}
-		if errors.Is(err, repository.ErrRoleNotFound) {
-			http.Error(w, fmt.Sprintf("Role with name '%s' not found", roleName.Name), http.StatusNotFound)
-			return
-		}
-		if errors.Is(err, domain.ErrValidation) {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Error(w, r, err)
 		return
 	}
 
@@ -141,42 +141,108 @@ func (h *UserHandler) AddRole(w http.ResponseWriter, r *http.Request) {
 func (h *UserHandler) RemoveRole(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	if id == "" {
-		http.Error(w, "User id is missing in URL", http.StatusBadRequest)
+		problem.BadRequest(w, r, "User id is missing in URL")
 		return
 	}
 
 	var roleName dto.AddRoleRequest
-	if err := json.NewDecoder(r.Body).Decode(&roleName); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to decode JSON: %s", err.Error()), http.StatusInternalServerError)
+	if !decodeRequest(w, r, &roleName) {
 		return
 	}
 
 	err := h.userService.RemoveRole(r.Context(), id, roleName.Name)
 	if err != nil {
-		if errors.Is(err, repository.ErrUserNotFound) {
-			http.Error(w, fmt.Sprintf("User with id '%s' not found", id), http.StatusNotFound)
-			return
-		}
-		if errors.Is(err, repository.ErrRoleNotFound) {
-			http.Error(w, fmt.Sprintf("Role with name '%s' not found", roleName.Name), http.StatusNotFound)
-			return
-		}
-		if errors.Is(err, domain.ErrValidation) {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
+		problem.Error(w, r, err)
+		return
+	}
+
+	w.Write([]byte("Role successfully removed"))
+}
+
+// List is the admin user directory. Query parameters: q (login, name or
+// email), role, status, registered_from and registered_to (RFC 3339), sort
+// (login, name, email, created_at; prefix with '-' for descending), page and
+// page_size.
+func (h *UserHandler) List(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	search := &repository.UserSearch{
+		Query:  query.Get("q"),
+		Role:   query.Get("role"),
+		Status: query.Get("status"),
+	}
+
+	sort := query.Get("sort")
+	search.Sort, search.Desc = strings.TrimPrefix(sort, "-"), strings.HasPrefix(sort, "-")
+	if _, ok := repository.UserSortColumns[search.Sort]; search.Sort != "" && !ok {
+		problem.BadRequest(w, r, fmt.Sprintf("Unknown sort '%s'", search.Sort))
+		return
+	}
+	for name, target := range map[string]**time.Time{"registered_from": &search.RegisteredFrom, "registered_to": &search.RegisteredTo} {
+		value := query.Get(name)
+		if value == "" {
+			continue
 		}
-		if errors.Is(err, domain.ErrCannotRemoveLastRole) {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			problem.BadRequest(w, r, fmt.Sprintf("Invalid '%s' time, expected RFC 3339", name))
 			return
 		}
+		*target = &t
+	}
 
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	page, err := strconv.Atoi(query.Get("page"))
+	if err != nil || page <= 0 {
+		page = 1
+	}
+	pageSize, err := strconv.Atoi(query.Get("page_size"))
+	if err != nil || pageSize <= 0 {
+		pageSize = repository.DefaultPageSize()
+	}
+
+	users, paginationInfo, err := h.userService.Search(r.Context(), search, page, pageSize)
+	if err != nil {
+		problem.Error(w, r, err)
 		return
 	}
 
-	w.Write([]byte("Role successfully removed"))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&dto.UsersPaginatedResponse{
+		Data:       mapUsersToUserSummaryResponses(users),
+		Pagination: *paginationInfo,
+	})
+}
+
+func (h *UserHandler) BulkAssignRole(w http.ResponseWriter, r *http.Request) {
+	var req dto.BulkAssignRoleRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	assigned, err := h.userService.BulkAssignRole(r.Context(), req.UserIds, req.Role)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&dto.BulkAssignRoleResponse{Assigned: assigned})
+}
+
+func (h *UserHandler) BulkSuspend(w http.ResponseWriter, r *http.Request) {
+	var req dto.BulkSuspendRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	userId, _ := heplers.UserIdFromContext(r.Context())
+	if err := h.userService.BulkSuspend(r.Context(), userId, req.UserIds, req.Reason, req.Until); err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	w.Write([]byte("Users successfully suspended"))
 }
 
-func NewUserHandler(userService service.UserService) *UserHandler {
-	return &UserHandler{userService: userService}
+func NewUserHandler(userService service.UserService, catService service.CatService, policy service.Policy) *UserHandler {
+	return &UserHandler{userService: userService, catService: catService, policy: policy}
 }
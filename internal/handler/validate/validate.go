@@ -0,0 +1,232 @@
+// Package validate checks request DTOs against rules declared in their
+// `validate` struct tags, so malformed input is rejected with per-field errors
+// before it reaches a service.
+//
+// Rules are separated by commas:
+//
+//	required     the value must not be empty; nil pointers and empty strings
+//	             or slices fail
+//	min=n, max=n length of strings (in characters) and slices, or the value
+//	             of numbers
+//	email        a string that looks like an email address
+//	oneof=a b    a string that is one of the space separated values
+//
+// Rules other than required are skipped for empty values. Nested structs,
+// pointers to structs and slices of structs are checked as well, with fields
+// reported by their JSON path, e.g. "items[2].name". A DTO may implement
+// Validator for rules that involve several fields; it is only called when the
+// tags are satisfied.
+package validate
+
+import (
+	"api/catshelter/internal/domain"
+	"errors"
+	"fmt"
+	"net/mail"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Validator is implemented by DTOs with rules the tags cannot express.
+type Validator interface {
+	Validate() []*domain.FieldError
+}
+
+// Struct checks v, a pointer to a struct, and returns every failed rule as a
+// *domain.FieldError joined with errors.Join, or nil.
+func Struct(v any) error {
+	var fieldErrs []*domain.FieldError
+	check(reflect.ValueOf(v), "", &fieldErrs)
+	if len(fieldErrs) == 0 {
+		return nil
+	}
+
+	errs := make([]error, len(fieldErrs))
+	for i, fieldErr := range fieldErrs {
+		errs[i] = fieldErr
+	}
+	return errors.Join(errs...)
+}
+
+func check(value reflect.Value, path string, fieldErrs *[]*domain.FieldError) {
+	for value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return
+		}
+		value = value.Elem()
+	}
+
+	switch value.Kind() {
+	case reflect.Struct:
+		checkStruct(value, path, fieldErrs)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			check(value.Index(i), fmt.Sprintf("%s[%d]", path, i), fieldErrs)
+		}
+	}
+}
+
+func checkStruct(value reflect.Value, path string, fieldErrs *[]*domain.FieldError) {
+	before := len(*fieldErrs)
+	structType := value.Type()
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		fieldValue := value.Field(i)
+
+		name, ok := jsonName(field)
+		if !ok {
+			continue
+		}
+		fieldPath := path
+		if name != "" {
+			fieldPath = joinPath(path, name)
+		}
+
+		if tag := field.Tag.Get("validate"); tag != "" {
+			if fieldErr := checkRules(fieldValue, fieldPath, tag); fieldErr != nil {
+				*fieldErrs = append(*fieldErrs, fieldErr)
+				continue
+			}
+		}
+		if isNested(field.Type) {
+			check(fieldValue, fieldPath, fieldErrs)
+		}
+	}
+
+	if len(*fieldErrs) > before || !value.CanAddr() {
+		return
+	}
+	if validator, ok := value.Addr().Interface().(Validator); ok {
+		for _, fieldErr := range validator.Validate() {
+			fieldErr.Field = joinPath(path, fieldErr.Field)
+			*fieldErrs = append(*fieldErrs, fieldErr)
+		}
+	}
+}
+
+// jsonName returns the name a field has in JSON, or "" for embedded structs
+// whose fields are promoted. Fields hidden from JSON are not checked.
+func jsonName(field reflect.StructField) (string, bool) {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	switch {
+	case name == "-":
+		return "", false
+	case name != "":
+		return name, true
+	case field.Anonymous:
+		return "", true
+	default:
+		return field.Name, true
+	}
+}
+
+func joinPath(path, name string) string {
+	if path == "" || name == "" {
+		return path + name
+	}
+	return path + "." + name
+}
+
+func isNested(fieldType reflect.Type) bool {
+	for fieldType.Kind() == reflect.Pointer || fieldType.Kind() == reflect.Slice || fieldType.Kind() == reflect.Array {
+		fieldType = fieldType.Elem()
+	}
+	return fieldType.Kind() == reflect.Struct && fieldType.PkgPath() != "time"
+}
+
+// checkRules returns the first rule of tag that value breaks.
+func checkRules(value reflect.Value, path, tag string) *domain.FieldError {
+	for value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			break
+		}
+		value = value.Elem()
+	}
+	empty := value.IsZero() || (value.Kind() == reflect.Slice && value.Len() == 0)
+
+	for _, rule := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		if name == "required" {
+			if empty {
+				return domain.NewFieldError(path, path+" is required")
+			}
+			continue
+		}
+		if empty {
+			continue
+		}
+
+		var message string
+		switch name {
+		case "min":
+			message = checkBound(value, param, true)
+		case "max":
+			message = checkBound(value, param, false)
+		case "email":
+			if !isEmail(value.String()) {
+				message = "must be a valid email address"
+			}
+		case "oneof":
+			if !slices.Contains(strings.Fields(param), value.String()) {
+				message = "must be one of " + strings.Join(strings.Fields(param), ", ")
+			}
+		default:
+			panic(fmt.Sprintf("validate: unknown rule '%s' on %s", name, path))
+		}
+		if message != "" {
+			return domain.NewFieldError(path, path+" "+message)
+		}
+	}
+	return nil
+}
+
+func checkBound(value reflect.Value, param string, isMin bool) string {
+	bound, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		panic(fmt.Sprintf("validate: bad bound '%s'", param))
+	}
+
+	var actual float64
+	var unit string
+	switch value.Kind() {
+	case reflect.String:
+		actual = float64(utf8.RuneCountInString(value.String()))
+		unit = " characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		actual = float64(value.Len())
+		unit = " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		actual = float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		actual = float64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		actual = value.Float()
+	default:
+		panic(fmt.Sprintf("validate: min and max do not apply to %s", value.Kind()))
+	}
+
+	switch {
+	case isMin && actual < bound:
+		if unit == "" {
+			return "must be at least " + param
+		}
+		return "must have at least " + param + unit
+	case !isMin && actual > bound:
+		if unit == "" {
+			return "must be at most " + param
+		}
+		return "must have at most " + param + unit
+	}
+	return ""
+}
+
+func isEmail(s string) bool {
+	address, err := mail.ParseAddress(s)
+	return err == nil && address.Address == s
+}
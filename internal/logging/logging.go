@@ -0,0 +1,157 @@
+// Package logging builds the slog logger of the application. Every record
+// logged with a request context carries the request id, the route pattern,
+// the authenticated user and the trace, and sensitive attributes are redacted.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Redacted replaces the value of sensitive attributes.
+const Redacted = "[REDACTED]"
+
+type Config struct {
+	// Level is debug, info, warn or error; empty means info.
+	Level string
+	// Format is json or text; empty means json.
+	Format string
+}
+
+// New returns a logger writing to w as configured.
+func New(w io.Writer, cfg Config) (*slog.Logger, error) {
+	var level slog.Level
+	if cfg.Level != "" {
+		if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+			return nil, fmt.Errorf("bad log level '%s'", cfg.Level)
+		}
+	}
+
+	options := &slog.HandlerOptions{Level: level, ReplaceAttr: redact}
+	var handler slog.Handler
+	switch cfg.Format {
+	case "", "json":
+		handler = slog.NewJSONHandler(w, options)
+	case "text":
+		handler = slog.NewTextHandler(w, options)
+	default:
+		return nil, fmt.Errorf("bad log format '%s', use json or text", cfg.Format)
+	}
+	return slog.New(&contextHandler{Handler: handler}), nil
+}
+
+// IsSensitive reports whether values named key must not be logged.
+func IsSensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, part := range []string{"password", "token", "secret", "cookie", "authorization", "api_key", "apikey", "body"} {
+		if strings.Contains(key, part) {
+			return true
+		}
+	}
+	switch key {
+	case "code", "recovery_code", "key", "state":
+		return true
+	}
+	return false
+}
+
+func redact(groups []string, attr slog.Attr) slog.Attr {
+	if IsSensitive(attr.Key) && attr.Value.Kind() != slog.KindGroup {
+		return slog.String(attr.Key, Redacted)
+	}
+	return attr
+}
+
+// RedactQuery returns the encoded query with sensitive parameters redacted.
+func RedactQuery(query url.Values) string {
+	if len(query) == 0 {
+		return ""
+	}
+	redacted := make(url.Values, len(query))
+	for name, values := range query {
+		if IsSensitive(name) {
+			values = []string{Redacted}
+		}
+		redacted[name] = values
+	}
+	return redacted.Encode()
+}
+
+type requestFieldsKey struct{}
+
+// requestFields is shared by everything handling one request, so the user
+// found by authentication deep in the middleware chain also shows up on the
+// access log line written by the outermost middleware.
+type requestFields struct {
+	mu     sync.Mutex
+	userId string
+}
+
+// ContextWithRequest prepares ctx to carry the fields of a request.
+func ContextWithRequest(ctx context.Context) context.Context {
+	return context.WithValue(ctx, requestFieldsKey{}, &requestFields{})
+}
+
+// SetUserId attaches the authenticated user to the request of ctx.
+func SetUserId(ctx context.Context, userId string) {
+	if fields, ok := ctx.Value(requestFieldsKey{}).(*requestFields); ok {
+		fields.mu.Lock()
+		fields.userId = userId
+		fields.mu.Unlock()
+	}
+}
+
+func userIdFromContext(ctx context.Context) string {
+	fields, ok := ctx.Value(requestFieldsKey{}).(*requestFields)
+	if !ok {
+		return ""
+	}
+	fields.mu.Lock()
+	defer fields.mu.Unlock()
+	return fields.userId
+}
+
+// contextHandler adds the request fields of the context to each record.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if ctx != nil {
+		if requestId := middleware.GetReqID(ctx); requestId != "" {
+			record.AddAttrs(slog.String("request_id", requestId))
+		}
+		if rctx := chi.RouteContext(ctx); rctx != nil {
+			if route := rctx.RoutePattern(); route != "" {
+				record.AddAttrs(slog.String("route", route))
+			}
+		}
+		if userId := userIdFromContext(ctx); userId != "" {
+			record.AddAttrs(slog.String("user_id", userId))
+		}
+		if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+			record.AddAttrs(
+				slog.String("trace_id", spanContext.TraceID().String()),
+				slog.String("span_id", spanContext.SpanID().String()),
+			)
+		}
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,65 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/url"
+	"testing"
+)
+
+func TestRedaction(t *testing.T) {
+	tests := []struct {
+		key       string
+		sensitive bool
+	}{
+		{"password", true},
+		{"new_password", true},
+		{"mfa_token", true},
+		{"client_secret", true},
+		{"Cookie", true},
+		{"Authorization", true},
+		{"api_key", true},
+		{"code", true},
+		{"recovery_code", true},
+		{"state", true},
+		{"body", true},
+		{"request_body", true},
+		{"login", false},
+		{"subject", false},
+		{"to", false},
+		{"status", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := IsSensitive(tt.key); got != tt.sensitive {
+				t.Errorf("IsSensitive(%q) = %v, want %v", tt.key, got, tt.sensitive)
+			}
+
+			var buf bytes.Buffer
+			logger, err := New(&buf, Config{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			logger.Info("message", slog.String(tt.key, "value"))
+			var record map[string]any
+			if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+				t.Fatal(err)
+			}
+			want := "value"
+			if tt.sensitive {
+				want = Redacted
+			}
+			if record[tt.key] != want {
+				t.Errorf("logged %s=%v, want %v", tt.key, record[tt.key], want)
+			}
+		})
+	}
+}
+
+func TestRedactQuery(t *testing.T) {
+	query := url.Values{"token": {"abc"}, "page": {"2"}}
+	if got, want := RedactQuery(query), "page=2&token=%5BREDACTED%5D"; got != want {
+		t.Errorf("RedactQuery = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,47 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type logMailer struct {
+	from string
+}
+
+// Send logs that a message went out but not its body, which carries reset
+// and verification links that must not end up in logs.
+func (l *logMailer) Send(ctx context.Context, message *Message) error {
+	slog.InfoContext(ctx, "mail sent to log", "to", message.To, "from", l.from, "subject", message.Subject)
+	return nil
+}
+
+func NewLogMailer(from string) Mailer {
+	return &logMailer{from: from}
+}
+
+type fileMailer struct {
+	dir  string
+	from string
+}
+
+func (f *fileMailer) Send(ctx context.Context, message *Message) error {
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102T150405"), uuid.NewString())
+	return os.WriteFile(filepath.Join(f.dir, name), formatMessage(f.from, message), 0o600)
+}
+
+func NewFileMailer(dir, from string) (Mailer, error) {
+	if dir == "" {
+		dir = "mail"
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("creating mail directory: %w", err)
+	}
+	return &fileMailer{dir: dir, from: from}, nil
+}
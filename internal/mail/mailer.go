@@ -0,0 +1,62 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers plain text messages. Implementations must be safe for
+// concurrent use.
+type Mailer interface {
+	Send(ctx context.Context, message *Message) error
+}
+
+type Config struct {
+	Driver       string
+	From         string
+	SmtpHost     string
+	SmtpPort     string
+	SmtpUsername string
+	SmtpPassword string
+	Dir          string
+}
+
+// NewMailer picks a driver by name: "smtp" for real delivery, "file" to drop
+// .eml files into Dir and "log" to only note sent messages, without their
+// bodies, for local testing.
+func NewMailer(cfg Config) (Mailer, error) {
+	switch cfg.Driver {
+	case "smtp":
+		if cfg.SmtpHost == "" {
+			return nil, fmt.Errorf("smtp mailer requires a host")
+		}
+		return NewSmtpMailer(cfg.SmtpHost, cfg.SmtpPort, cfg.SmtpUsername, cfg.SmtpPassword, cfg.From), nil
+	case "file":
+		return NewFileMailer(cfg.Dir, cfg.From)
+	case "", "log":
+		return NewLogMailer(cfg.From), nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver '%s'", cfg.Driver)
+	}
+}
+
+func formatMessage(from string, message *Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", message.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", message.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(message.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
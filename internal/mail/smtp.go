@@ -0,0 +1,33 @@
+package mail
+
+import (
+	"context"
+	"net"
+	"net/smtp"
+)
+
+type smtpMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+// Send uses smtp.SendMail, which upgrades the connection with STARTTLS
+// whenever the server offers it.
+func (s *smtpMailer) Send(ctx context.Context, message *Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return smtp.SendMail(s.addr, s.auth, s.from, []string{message.To}, formatMessage(s.from, message))
+}
+
+func NewSmtpMailer(host, port, username, password, from string) Mailer {
+	if port == "" {
+		port = "587"
+	}
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &smtpMailer{addr: net.JoinHostPort(host, port), auth: auth, from: from}
+}
@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"gorm.io/gorm"
+)
+
+const startedAtKey = "metrics:started_at"
+
+// registerer is implemented by the callback positions of GORM processors,
+// whose type is not exported.
+type registerer interface {
+	Register(name string, fn func(*gorm.DB)) error
+}
+
+// InstrumentDB times every GORM statement through callbacks and exports the
+// connection pool statistics of db.
+func InstrumentDB(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	if err := registerPoolStats(sqlDB); err != nil {
+		return err
+	}
+
+	callbacks := db.Callback()
+	processors := []struct {
+		operation     string
+		before, after registerer
+	}{
+		{"create", callbacks.Create().Before("*"), callbacks.Create().After("*")},
+		{"query", callbacks.Query().Before("*"), callbacks.Query().After("*")},
+		{"update", callbacks.Update().Before("*"), callbacks.Update().After("*")},
+		{"delete", callbacks.Delete().Before("*"), callbacks.Delete().After("*")},
+		{"row", callbacks.Row().Before("*"), callbacks.Row().After("*")},
+		{"raw", callbacks.Raw().Before("*"), callbacks.Raw().After("*")},
+	}
+	for _, p := range processors {
+		operation := p.operation
+		if err := p.before.Register("metrics:before_"+operation, before); err != nil {
+			return err
+		}
+		err := p.after.Register("metrics:after_"+operation, func(tx *gorm.DB) {
+			after(tx, operation)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var poolStatsRegistered bool
+
+// registerPoolStats registers the pool collector once; the admin commands
+// and the server each open a single database.
+func registerPoolStats(sqlDB *sql.DB) error {
+	if poolStatsRegistered {
+		return nil
+	}
+	poolStatsRegistered = true
+	return Registry.Register(collectors.NewDBStatsCollector(sqlDB, namespace))
+}
+
+func before(tx *gorm.DB) {
+	tx.InstanceSet(startedAtKey, time.Now())
+}
+
+func after(tx *gorm.DB, operation string) {
+	value, ok := tx.InstanceGet(startedAtKey)
+	if !ok {
+		return
+	}
+	startedAt, ok := value.(time.Time)
+	if !ok {
+		return
+	}
+
+	table := tx.Statement.Table
+	if table == "" {
+		table = "unknown"
+	}
+	DBQueryDuration.WithLabelValues(operation, table).Observe(time.Since(startedAt).Seconds())
+	if tx.Error != nil && !errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		DBQueryErrors.WithLabelValues(operation, table).Inc()
+	}
+}
@@ -0,0 +1,138 @@
+// Package metrics defines the Prometheus metrics of the application and
+// serves them from a dedicated registry.
+package metrics
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "catshelter"
+
+// Registry holds every metric of the application. The default registry of
+// the client library is not used, so dependencies cannot add metrics behind
+// our back.
+var Registry = prometheus.NewRegistry()
+
+var (
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, chi route pattern and status code.",
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method and chi route pattern.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	HTTPRequestsInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "http_requests_in_flight",
+		Help:      "HTTP requests being handled.",
+	})
+
+	DBQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Duration of GORM statements by operation and table.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"operation", "table"})
+
+	DBQueryErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "db_query_errors_total",
+		Help:      "GORM statements that failed, not counting record not found.",
+	}, []string{"operation", "table"})
+)
+
+// Business events.
+var (
+	Registrations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "registrations_total",
+		Help:      "New accounts by method: password or oidc.",
+	}, []string{"method"})
+
+	Logins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logins_total",
+		Help:      "Password login attempts by result: succeeded, failed, throttled or inactive.",
+	}, []string{"result"})
+
+	Adoptions = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "adoptions_total",
+		Help:      "Cats adopted.",
+	})
+
+	CatsAdded = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cats_added_total",
+		Help:      "Cats added to the shelter.",
+	})
+
+	TokenRefreshes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "token_refreshes_total",
+		Help:      "Session refreshes by result: succeeded, invalid (unknown token), reused (already rotated token) or expired.",
+	}, []string{"result"})
+)
+
+const (
+	RegistrationPassword = "password"
+	RegistrationOidc     = "oidc"
+
+	LoginSucceeded = "succeeded"
+	LoginFailed    = "failed"
+	LoginThrottled = "throttled"
+	LoginInactive  = "inactive"
+
+	RefreshSucceeded = "succeeded"
+	RefreshInvalid   = "invalid"
+	RefreshReused    = "reused"
+	RefreshExpired   = "expired"
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests, HTTPRequestDuration, HTTPRequestsInFlight,
+		DBQueryDuration, DBQueryErrors,
+		Registrations, Logins, Adoptions, CatsAdded, TokenRefreshes,
+	)
+	for _, method := range []string{RegistrationPassword, RegistrationOidc} {
+		Registrations.WithLabelValues(method)
+	}
+	for _, result := range []string{LoginSucceeded, LoginFailed, LoginThrottled, LoginInactive} {
+		Logins.WithLabelValues(result)
+	}
+	for _, result := range []string{RefreshSucceeded, RefreshInvalid, RefreshReused, RefreshExpired} {
+		TokenRefreshes.WithLabelValues(result)
+	}
+}
+
+// Handler serves the metrics in the Prometheus text format. With a non-empty
+// token, requests must send it as a bearer token.
+func Handler(token string) http.Handler {
+	handler := promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+	if token == "" {
+		return handler
+	}
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
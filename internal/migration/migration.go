@@ -0,0 +1,360 @@
+package migration
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed sql/*.sql
+var embedded embed.FS
+
+// lockKey identifies the session advisory lock held while migrating, so only
+// one instance changes the schema at a time.
+const lockKey = 7310438
+
+var (
+	ErrChecksumMismatch = errors.New("applied migration was changed")
+	ErrUnknownMigration = errors.New("applied migration is unknown to this build")
+	ErrNoDownMigration  = errors.New("migration has no down script")
+)
+
+// Migration is one versioned schema change, read from a pair of files named
+// <version>_<name>.up.sql and <version>_<name>.down.sql.
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// MigrationStatus reports whether a known migration has been applied.
+// Checksum is the one recorded when the migration was applied.
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+	Checksum  string
+	Modified  bool
+	Unknown   bool
+}
+
+type appliedMigration struct {
+	version   int64
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []*Migration
+}
+
+// NewMigrator returns a Migrator for the migrations embedded in the binary.
+func NewMigrator(db *sql.DB) (*Migrator, error) {
+	migrations, err := Load(embedded)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Load reads migrations from the sql directory of fsys, ordered by version.
+func Load(fsys fs.FS) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, "sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		fileName := entry.Name()
+		base, direction, ok := splitFileName(fileName)
+		if !ok {
+			return nil, fmt.Errorf("bad migration file name '%s'", fileName)
+		}
+		versionPart, name, _ := strings.Cut(base, "_")
+		version, err := strconv.ParseInt(versionPart, 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("bad migration version in '%s'", fileName)
+		}
+
+		content, err := fs.ReadFile(fsys, path.Join("sql", fileName))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		} else if migration.Name != name {
+			return nil, fmt.Errorf("migration %d has two names: '%s' and '%s'", version, migration.Name, name)
+		}
+		if direction == "up" {
+			migration.Up = string(content)
+			sum := sha256.Sum256(content)
+			migration.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %d has no up script", migration.Version)
+		}
+		migrations = append(migrations, migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+func splitFileName(fileName string) (string, string, bool) {
+	for _, direction := range []string{"up", "down"} {
+		if base, ok := strings.CutSuffix(fileName, "."+direction+".sql"); ok {
+			return base, direction, true
+		}
+	}
+	return "", "", false
+}
+
+// Up applies every pending migration, each in its own transaction, and
+// returns the ones it applied. It refuses to run if an applied migration was
+// edited or is missing from this build.
+func (m *Migrator) Up(ctx context.Context) ([]*Migration, error) {
+	var applied []*Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		done, err := m.verify(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := done[migration.Version]; ok {
+				continue
+			}
+			err := inTransaction(ctx, conn, func(tx *sql.Tx) error {
+				if _, err := tx.ExecContext(ctx, migration.Up); err != nil {
+					return err
+				}
+				_, err := tx.ExecContext(ctx,
+					"INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES ($1, $2, $3, $4)",
+					migration.Version, migration.Name, migration.Checksum, time.Now())
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("applying migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down reverts the last steps applied migrations, newest first, and returns
+// the ones it reverted.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]*Migration, error) {
+	var reverted []*Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		done, err := m.verify(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := done[migration.Version]; !ok {
+				continue
+			}
+			if migration.Down == "" {
+				return fmt.Errorf("%w: %d_%s", ErrNoDownMigration, migration.Version, migration.Name)
+			}
+			err := inTransaction(ctx, conn, func(tx *sql.Tx) error {
+				if _, err := tx.ExecContext(ctx, migration.Down); err != nil {
+					return err
+				}
+				_, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = $1", migration.Version)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("reverting migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			reverted = append(reverted, migration)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status lists known migrations in order followed by applied migrations this
+// build does not know about.
+func (m *Migrator) Status(ctx context.Context) ([]*MigrationStatus, error) {
+	var statuses []*MigrationStatus
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		done, err := findApplied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			status := &MigrationStatus{Version: migration.Version, Name: migration.Name, Checksum: migration.Checksum}
+			if applied, ok := done[migration.Version]; ok {
+				status.AppliedAt = &applied.appliedAt
+				status.Checksum = applied.checksum
+				status.Modified = applied.checksum != migration.Checksum
+				delete(done, migration.Version)
+			}
+			statuses = append(statuses, status)
+		}
+		for _, applied := range sortedApplied(done) {
+			statuses = append(statuses, &MigrationStatus{
+				Version:   applied.version,
+				Name:      applied.name,
+				AppliedAt: &applied.appliedAt,
+				Checksum:  applied.checksum,
+				Unknown:   true,
+			})
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+// Pending returns the migrations not applied yet. Unlike the other methods it
+// does not take the migration lock, so it is cheap enough for readiness
+// probes; a database without schema_migrations has everything pending.
+func (m *Migrator) Pending(ctx context.Context) ([]*Migration, error) {
+	var exists bool
+	err := m.db.QueryRowContext(ctx, "SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return m.migrations, nil
+	}
+
+	done, err := findApplied(ctx, m.db)
+	if err != nil {
+		return nil, err
+	}
+	var pending []*Migration
+	for _, migration := range m.migrations {
+		if _, ok := done[migration.Version]; !ok {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+// withLock runs fn on a dedicated connection holding the migration lock and
+// makes sure the schema_migrations table exists.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockKey); err != nil {
+		return fmt.Errorf("taking migration lock: %w", err)
+	}
+	defer conn.ExecContext(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock($1)", lockKey)
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    bigint PRIMARY KEY,
+		name       text NOT NULL,
+		checksum   text NOT NULL,
+		applied_at timestamptz NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("creating schema_migrations: %w", err)
+	}
+
+	return fn(conn)
+}
+
+// verify compares the applied migrations with the embedded ones.
+func (m *Migrator) verify(ctx context.Context, conn *sql.Conn) (map[int64]*appliedMigration, error) {
+	done, err := findApplied(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[int64]*Migration, len(m.migrations))
+	for _, migration := range m.migrations {
+		known[migration.Version] = migration
+	}
+	for _, applied := range sortedApplied(done) {
+		migration, ok := known[applied.version]
+		if !ok {
+			return nil, fmt.Errorf("%w: %d_%s", ErrUnknownMigration, applied.version, applied.name)
+		}
+		if migration.Checksum != applied.checksum {
+			return nil, fmt.Errorf("%w: %d_%s", ErrChecksumMismatch, applied.version, applied.name)
+		}
+	}
+	return done, nil
+}
+
+// querier is implemented by *sql.DB and *sql.Conn.
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+func findApplied(ctx context.Context, conn querier) (map[int64]*appliedMigration, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, name, checksum, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	done := make(map[int64]*appliedMigration)
+	for rows.Next() {
+		applied := &appliedMigration{}
+		if err := rows.Scan(&applied.version, &applied.name, &applied.checksum, &applied.appliedAt); err != nil {
+			return nil, err
+		}
+		done[applied.version] = applied
+	}
+	return done, rows.Err()
+}
+
+func sortedApplied(done map[int64]*appliedMigration) []*appliedMigration {
+	applied := make([]*appliedMigration, 0, len(done))
+	for _, migration := range done {
+		applied = append(applied, migration)
+	}
+	sort.Slice(applied, func(i, j int) bool {
+		return applied[i].version < applied[j].version
+	})
+	return applied
+}
+
+func inTransaction(ctx context.Context, conn *sql.Conn, fn func(tx *sql.Tx) error) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,215 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// baselineSchema is what AutoMigrate created before this series, with a user
+// and a session that must survive the upgrade.
+const baselineSchema = `
+CREATE TABLE roles (id uuid PRIMARY KEY, name text CONSTRAINT uni_roles_name UNIQUE);
+CREATE TABLE users (id uuid PRIMARY KEY, login text CONSTRAINT uni_users_login UNIQUE, password text, name text);
+CREATE TABLE user_roles (
+    user_id uuid, role_id uuid, PRIMARY KEY (user_id, role_id),
+    CONSTRAINT fk_user_roles_user FOREIGN KEY (user_id) REFERENCES users (id),
+    CONSTRAINT fk_user_roles_role FOREIGN KEY (role_id) REFERENCES roles (id)
+);
+CREATE TABLE cats (
+    id uuid PRIMARY KEY, name text, age smallint, user_id uuid,
+    CONSTRAINT fk_users_cats FOREIGN KEY (user_id) REFERENCES users (id)
+);
+CREATE TABLE refresh_tokens (id uuid PRIMARY KEY, token text, user_id text, expires_at timestamptz);
+
+INSERT INTO roles VALUES ('00000000-0000-0000-0000-000000000001', 'user');
+INSERT INTO users VALUES ('00000000-0000-0000-0000-000000000002', 'barsik', 'hash', 'Barsik');
+INSERT INTO user_roles VALUES ('00000000-0000-0000-0000-000000000002', '00000000-0000-0000-0000-000000000001');
+INSERT INTO refresh_tokens VALUES ('00000000-0000-0000-0000-000000000003', 'token', '00000000-0000-0000-0000-000000000002', now());
+`
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := Load(embedded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, migration := range migrations {
+		if migration.Version != int64(i+1) {
+			t.Errorf("migration %d_%s: want version %d", migration.Version, migration.Name, i+1)
+		}
+		if migration.Down == "" {
+			t.Errorf("migration %d_%s has no down script", migration.Version, migration.Name)
+		}
+	}
+
+	var tables []string
+	for _, match := range regexp.MustCompile(`CREATE TABLE IF NOT EXISTS (\w+)`).FindAllStringSubmatch(migrations[0].Up, -1) {
+		tables = append(tables, match[1])
+	}
+	slices.Sort(tables)
+	if want := []string{"cats", "refresh_tokens", "roles", "user_roles", "users"}; !slices.Equal(tables, want) {
+		t.Errorf("baseline creates %v, want %v", tables, want)
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("from the AutoMigrate baseline", func(t *testing.T) {
+		db := testDatabase(t)
+		if _, err := db.ExecContext(ctx, baselineSchema); err != nil {
+			t.Fatal(err)
+		}
+		upgrade(t, db)
+
+		var status string
+		var version int64
+		var totpEnabled, serviceAccount bool
+		err := db.QueryRowContext(ctx, "SELECT status, version, totp_enabled, service_account FROM users WHERE login = 'barsik'").
+			Scan(&status, &version, &totpEnabled, &serviceAccount)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status != "active" || version != 1 || totpEnabled || serviceAccount {
+			t.Errorf("existing user got status %q, version %d, totp_enabled %v, service_account %v", status, version, totpEnabled, serviceAccount)
+		}
+		var mfaVerified bool
+		if err := db.QueryRowContext(ctx, "SELECT mfa_verified FROM refresh_tokens").Scan(&mfaVerified); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("from a complete AutoMigrate schema", func(t *testing.T) {
+		db := testDatabase(t)
+		upgrade(t, db)
+		// What AutoMigrate built just before migrations: every table, but
+		// nothing recorded.
+		if _, err := db.ExecContext(ctx, "DROP TABLE schema_migrations"); err != nil {
+			t.Fatal(err)
+		}
+		upgrade(t, db)
+	})
+
+	t.Run("audit log is append-only", func(t *testing.T) {
+		db := testDatabase(t)
+		upgrade(t, db)
+		_, err := db.ExecContext(ctx, `INSERT INTO audit_entries (id, seq, action, created_at, prev_hash, hash)
+			VALUES ('00000000-0000-0000-0000-000000000004', 1, 'cat_created', now(), '', 'hash')`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, statement := range []string{
+			"UPDATE audit_entries SET hash = 'forged'",
+			"DELETE FROM audit_entries",
+			"TRUNCATE audit_entries",
+		} {
+			if _, err := db.ExecContext(ctx, statement); err == nil {
+				t.Errorf("%s succeeded", statement)
+			}
+		}
+	})
+
+	t.Run("down and up again", func(t *testing.T) {
+		db := testDatabase(t)
+		migrator := upgrade(t, db)
+		reverted, err := migrator.Down(ctx, len(migrator.migrations))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(reverted) != len(migrator.migrations) {
+			t.Errorf("reverted %d migrations, want %d", len(reverted), len(migrator.migrations))
+		}
+		var tables int
+		if err := db.QueryRowContext(ctx, "SELECT count(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name <> 'schema_migrations'").Scan(&tables); err != nil {
+			t.Fatal(err)
+		}
+		if tables != 0 {
+			t.Errorf("%d tables left after reverting everything", tables)
+		}
+		upgrade(t, db)
+	})
+}
+
+// upgrade applies every migration and checks the result has the columns the
+// application maps.
+func upgrade(t *testing.T, db *sql.DB) *Migrator {
+	t.Helper()
+	ctx := context.Background()
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	pending, err := migrator.Pending(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) > 0 {
+		t.Fatalf("%d migrations still pending", len(pending))
+	}
+
+	for table, columns := range map[string][]string{
+		"users": {"email", "email_verified_at", "phone", "totp_secret", "totp_enabled", "totp_last_step", "service_account",
+			"status", "suspended_reason", "suspended_until", "deleted_at", "created_at", "version"},
+		"roles":                  {"description", "inherits_from_id"},
+		"refresh_tokens":         {"mfa_verified"},
+		"avatars":                {"user_id", "content_type", "data", "updated_at"},
+		"rotated_refresh_tokens": {"token_hash", "session_id", "expires_at"},
+	} {
+		for _, column := range columns {
+			var exists bool
+			err := db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM information_schema.columns
+				WHERE table_schema = current_schema() AND table_name = $1 AND column_name = $2)`, table, column).Scan(&exists)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !exists {
+				t.Errorf("%s.%s is missing", table, column)
+			}
+		}
+	}
+	return migrator
+}
+
+// testDatabase connects to TEST_DATABASE_URL with a schema of its own, which
+// is dropped when the test ends.
+func testDatabase(t *testing.T) *sql.DB {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	ctx := context.Background()
+	schema := fmt.Sprintf("migration_test_%d", time.Now().UnixNano())
+
+	admin, err := sql.Open("pgx", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := admin.ExecContext(ctx, "CREATE SCHEMA "+schema); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := pgx.ParseConfig(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.RuntimeParams["search_path"] = schema
+	db := stdlib.OpenDB(*config)
+	t.Cleanup(func() {
+		db.Close()
+		admin.ExecContext(ctx, "DROP SCHEMA "+schema+" CASCADE")
+		admin.Close()
+	})
+	return db
+}
@@ -0,0 +1,39 @@
+-- Baseline: the roles, cats, users, user_roles and refresh_tokens tables as
+-- AutoMigrate created them before versioned migrations. Everything is
+-- IF NOT EXISTS so databases created by AutoMigrate adopt it without changes;
+-- the following migrations bring them up to date.
+
+CREATE TABLE IF NOT EXISTS roles (
+    id   uuid PRIMARY KEY,
+    name text CONSTRAINT uni_roles_name UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS users (
+    id       uuid PRIMARY KEY,
+    login    text CONSTRAINT uni_users_login UNIQUE,
+    password text,
+    name     text
+);
+
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id uuid,
+    role_id uuid,
+    PRIMARY KEY (user_id, role_id),
+    CONSTRAINT fk_user_roles_user FOREIGN KEY (user_id) REFERENCES users (id),
+    CONSTRAINT fk_user_roles_role FOREIGN KEY (role_id) REFERENCES roles (id)
+);
+
+CREATE TABLE IF NOT EXISTS cats (
+    id      uuid PRIMARY KEY,
+    name    text,
+    age     smallint,
+    user_id uuid,
+    CONSTRAINT fk_users_cats FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id         uuid PRIMARY KEY,
+    token      text,
+    user_id    text,
+    expires_at timestamptz
+);
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS login_attempts (
+    key             text PRIMARY KEY,
+    failures        bigint,
+    last_failure_at timestamptz,
+    locked_until    timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS security_events (
+    id         uuid PRIMARY KEY,
+    type       text,
+    user_id    uuid,
+    login      text,
+    ip         text,
+    details    text,
+    created_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_security_events_type ON security_events (type);
+CREATE INDEX IF NOT EXISTS idx_security_events_user_id ON security_events (user_id);
@@ -0,0 +1,14 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_secret text;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_enabled boolean DEFAULT false;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_last_step bigint DEFAULT 0;
+
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS mfa_verified boolean DEFAULT false;
+
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+    id        uuid PRIMARY KEY,
+    user_id   uuid,
+    code_hash text,
+    used_at   timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_user_id ON mfa_recovery_codes (user_id);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS password_reset_tokens (
+    id         uuid PRIMARY KEY,
+    user_id    uuid,
+    token_hash text CONSTRAINT uni_password_reset_tokens_token_hash UNIQUE,
+    expires_at timestamptz,
+    used_at    timestamptz,
+    created_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_password_reset_tokens_user_id ON password_reset_tokens (user_id);
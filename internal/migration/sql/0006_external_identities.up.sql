@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS external_identities (
+    id         uuid PRIMARY KEY,
+    user_id    uuid,
+    provider   text,
+    subject    text,
+    email      text,
+    created_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_external_identities_user_id ON external_identities (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_external_identity_subject ON external_identities (provider, subject);
@@ -0,0 +1,15 @@
+ALTER TABLE roles ADD COLUMN IF NOT EXISTS description text;
+
+CREATE TABLE IF NOT EXISTS permissions (
+    id          uuid PRIMARY KEY,
+    name        text CONSTRAINT uni_permissions_name UNIQUE,
+    description text
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role_id       uuid,
+    permission_id uuid,
+    PRIMARY KEY (role_id, permission_id),
+    CONSTRAINT fk_role_permissions_role FOREIGN KEY (role_id) REFERENCES roles (id),
+    CONSTRAINT fk_role_permissions_permission FOREIGN KEY (permission_id) REFERENCES permissions (id)
+);
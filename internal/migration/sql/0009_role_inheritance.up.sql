@@ -0,0 +1 @@
+ALTER TABLE roles ADD COLUMN IF NOT EXISTS inherits_from_id uuid;
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS audit_entries (
+    id          uuid PRIMARY KEY,
+    seq         bigint,
+    actor_id    uuid,
+    action      text,
+    target_type text,
+    target_id   text,
+    before      text,
+    after       text,
+    ip          text,
+    request_id  text,
+    created_at  timestamptz,
+    prev_hash   text,
+    hash        text
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_audit_entries_seq ON audit_entries (seq);
+CREATE INDEX IF NOT EXISTS idx_audit_entries_actor_id ON audit_entries (actor_id);
+CREATE INDEX IF NOT EXISTS idx_audit_entries_action ON audit_entries (action);
+CREATE INDEX IF NOT EXISTS idx_audit_target ON audit_entries (target_type, target_id);
+CREATE INDEX IF NOT EXISTS idx_audit_entries_created_at ON audit_entries (created_at);
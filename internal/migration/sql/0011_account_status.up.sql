@@ -0,0 +1,10 @@
+-- Existing users become active and are dated to the migration, as their real
+-- registration time is unknown.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS status text DEFAULT 'active';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS suspended_reason text;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS suspended_until timestamptz;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at timestamptz;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS created_at timestamptz DEFAULT now();
+
+CREATE INDEX IF NOT EXISTS idx_users_status ON users (status);
+CREATE INDEX IF NOT EXISTS idx_users_created_at ON users (created_at);
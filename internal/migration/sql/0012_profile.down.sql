@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS avatars;
+ALTER TABLE users DROP COLUMN IF EXISTS version;
@@ -0,0 +1,8 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 1;
+
+CREATE TABLE IF NOT EXISTS avatars (
+    user_id      uuid PRIMARY KEY,
+    content_type text,
+    data         bytea,
+    updated_at   timestamptz
+);
@@ -0,0 +1,9 @@
+-- Refresh tokens replaced by rotation, kept until they would have expired so a
+-- replay can be told apart from an unknown token.
+CREATE TABLE IF NOT EXISTS rotated_refresh_tokens (
+    token_hash text PRIMARY KEY,
+    session_id uuid NOT NULL,
+    expires_at timestamptz NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_rotated_refresh_tokens_expires_at ON rotated_refresh_tokens (expires_at);
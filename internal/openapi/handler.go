@@ -0,0 +1,68 @@
+package openapi
+
+import (
+	"html/template"
+	"net/http"
+	"path"
+	"slices"
+
+	swaggerFiles "github.com/swaggo/files/v2"
+)
+
+// Handler serves the document as JSON.
+func (d *Document) Handler() (http.Handler, error) {
+	content, err := d.JSON()
+	if err != nil {
+		return nil, err
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(content)
+	}), nil
+}
+
+// The UI is served from the binary at the version pinned in go.mod, so the
+// page works offline and runs no script a third party can change.
+var docsPage = template.Must(template.New("docs").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <meta name="viewport" content="width=device-width, initial-scale=1">
+  <title>{{.Title}}</title>
+  <link rel="stylesheet" href="{{.AssetsUrl}}/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="{{.AssetsUrl}}/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({url: {{.SpecUrl}}, dom_id: "#swagger-ui"});
+  </script>
+</body>
+</html>
+`))
+
+// docsAssets are the Swagger UI files the docs page loads.
+var docsAssets = []string{"swagger-ui.css", "swagger-ui-bundle.js"}
+
+// DocsHandler serves an HTML page that renders the document at specUrl with
+// the Swagger UI files served by DocsAssetsHandler at assetsUrl.
+func (d *Document) DocsHandler(specUrl, assetsUrl string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		docsPage.Execute(w, struct{ Title, SpecUrl, AssetsUrl string }{d.Info.Title, specUrl, assetsUrl})
+	})
+}
+
+// DocsAssetsHandler serves the Swagger UI files named by the last segment of
+// the request path.
+func DocsAssetsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := path.Base(r.URL.Path)
+		if !slices.Contains(docsAssets, name) {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+		http.ServeFileFS(w, r, swaggerFiles.FS, name)
+	})
+}
@@ -0,0 +1,182 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// Schema describes the JSON encoding of v. Named structs are added to the
+// components once and referenced from then on.
+//
+// Structs whose name ends in Request are read as request bodies: their
+// `validate` tags give the required properties and bounds, and unknown
+// properties are rejected like the handlers do. Properties of other structs
+// are required unless tagged omitempty, as they are always encoded.
+func (d *Document) Schema(v any) *Schema {
+	return d.schemaOf(reflect.TypeOf(v))
+}
+
+func (d *Document) schemaOf(t reflect.Type) *Schema {
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case rawMessageType:
+		return &Schema{Description: "Any JSON value"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return nullable(d.schemaOf(t.Elem()))
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", ContentEncoding: "base64"}
+		}
+		return &Schema{Type: "array", Items: d.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: d.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return d.structSchema(t)
+		}
+		ref := &Schema{Ref: "#/components/schemas/" + t.Name()}
+		if _, ok := d.Components.Schemas[t.Name()]; !ok {
+			// Registered before it is built so recursive types terminate.
+			d.Components.Schemas[t.Name()] = &Schema{}
+			*d.Components.Schemas[t.Name()] = *d.structSchema(t)
+		}
+		return ref
+	default:
+		return &Schema{}
+	}
+}
+
+func (d *Document) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	request := strings.HasSuffix(t.Name(), "Request")
+	if request {
+		schema.AdditionalProperties = false
+	}
+	d.addProperties(schema, t, request)
+	return schema
+}
+
+func (d *Document) addProperties(schema *Schema, t reflect.Type, request bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		name, options, _ := strings.Cut(tag, ",")
+		if tag == "-" {
+			continue
+		}
+
+		// Embedded structs without a name are flattened, as encoding/json does.
+		embedded := field.Type
+		if embedded.Kind() == reflect.Pointer {
+			embedded = embedded.Elem()
+		}
+		if field.Anonymous && name == "" && embedded.Kind() == reflect.Struct {
+			d.addProperties(schema, embedded, request)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property := d.schemaOf(field.Type)
+		required := !strings.Contains(options, "omitempty")
+		if request {
+			required = applyRules(property, field.Tag.Get("validate"))
+		}
+		schema.Properties[name] = property
+		if required {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+}
+
+// applyRules adds the bounds of a `validate` tag to property and reports
+// whether the tag makes it required.
+func applyRules(property *Schema, tag string) bool {
+	required := false
+	target := property
+	if len(property.AnyOf) > 0 {
+		target = property.AnyOf[0]
+	}
+	for _, rule := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(rule, "=")
+		n, _ := strconv.Atoi(param)
+		switch name {
+		case "required":
+			required = true
+		case "email":
+			target.Format = "email"
+		case "oneof":
+			for _, value := range strings.Fields(param) {
+				target.Enum = append(target.Enum, value)
+			}
+		case "min", "max":
+			setBound(target, name == "min", n)
+		}
+	}
+	return required
+}
+
+func setBound(s *Schema, isMin bool, n int) {
+	kind := s.Type
+	if types, ok := kind.([]string); ok {
+		kind = types[0]
+	}
+	switch kind {
+	case "string":
+		if isMin {
+			s.MinLength = &n
+		} else {
+			s.MaxLength = &n
+		}
+	case "array":
+		if isMin {
+			s.MinItems = &n
+		} else {
+			s.MaxItems = &n
+		}
+	case "integer", "number":
+		if isMin {
+			s.Minimum = &n
+		} else {
+			s.Maximum = &n
+		}
+	}
+}
+
+// nullable allows null in addition to the values of s.
+func nullable(s *Schema) *Schema {
+	switch kind := s.Type.(type) {
+	case string:
+		s.Type = []string{kind, "null"}
+		return s
+	case []string:
+		return s
+	}
+	return &Schema{AnyOf: []*Schema{s, {Type: "null"}}}
+}
@@ -0,0 +1,236 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// CheckRequest reports how a request to the operation at method and route,
+// a path in chi syntax, differs from the document: missing required query
+// parameters, an undocumented content type or a body that does not match
+// its schema.
+func (d *Document) CheckRequest(method, route string, r *http.Request, body []byte) error {
+	op, ok := d.Operation(method, route)
+	if !ok {
+		return fmt.Errorf("%s %s is not documented", method, route)
+	}
+
+	var errs []error
+	for _, param := range op.Parameters {
+		if param.In == "query" && param.Required && !r.URL.Query().Has(param.Name) {
+			errs = append(errs, fmt.Errorf("query parameter '%s' is required", param.Name))
+		}
+	}
+
+	if op.RequestBody == nil || len(body) == 0 {
+		if op.RequestBody != nil && op.RequestBody.Required {
+			errs = append(errs, errors.New("request body is required"))
+		}
+		return errors.Join(errs...)
+	}
+	if err := d.checkContent(op.RequestBody.Content, r.Header.Get("Content-Type"), body); err != nil {
+		errs = append(errs, fmt.Errorf("request body: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// CheckResponse reports how a response of the operation at method and route
+// differs from the document: an undocumented status or content type, or a
+// body that does not match its schema.
+func (d *Document) CheckResponse(method, route string, status int, header http.Header, body []byte) error {
+	op, ok := d.Operation(method, route)
+	if !ok {
+		return fmt.Errorf("%s %s is not documented", method, route)
+	}
+	response, ok := op.response(status)
+	if !ok {
+		return fmt.Errorf("status %d is not documented", status)
+	}
+	if response.Ref != "" {
+		response = d.Components.Responses[strings.TrimPrefix(response.Ref, "#/components/responses/")]
+	}
+
+	if len(body) == 0 || len(response.Content) == 0 {
+		return nil
+	}
+	contentType := header.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(body)
+	}
+	if err := d.checkContent(response.Content, contentType, body); err != nil {
+		return fmt.Errorf("status %d: %w", status, err)
+	}
+	return nil
+}
+
+func (d *Document) checkContent(content map[string]MediaType, contentType string, body []byte) error {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("bad content type '%s'", contentType)
+	}
+	media, ok := content[mediaType]
+	if !ok {
+		media, ok = content[mediaType[:strings.Index(mediaType, "/")+1]+"*"]
+	}
+	if !ok {
+		return fmt.Errorf("content type '%s' is not documented", mediaType)
+	}
+	if media.Schema == nil || !isJSON(mediaType) {
+		return nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	var errs []error
+	d.validate(media.Schema, value, "", &errs)
+	return errors.Join(errs...)
+}
+
+func isJSON(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// validate checks a value decoded with json.Decoder.UseNumber against s and
+// appends every mismatch, prefixed with its JSON path.
+func (d *Document) validate(s *Schema, value any, path string, errs *[]error) {
+	fail := func(format string, args ...any) {
+		at := path
+		if at == "" {
+			at = "body"
+		}
+		*errs = append(*errs, fmt.Errorf("%s: %s", at, fmt.Sprintf(format, args...)))
+	}
+
+	if s.Ref != "" {
+		target, ok := d.Components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+		if !ok {
+			fail("unknown schema %s", s.Ref)
+			return
+		}
+		d.validate(target, value, path, errs)
+		return
+	}
+	if len(s.AnyOf) > 0 {
+		for _, option := range s.AnyOf {
+			var optionErrs []error
+			d.validate(option, value, path, &optionErrs)
+			if len(optionErrs) == 0 {
+				return
+			}
+		}
+		fail("matches none of the allowed schemas")
+		return
+	}
+
+	kind := jsonType(value)
+	if allowed := schemaTypes(s); len(allowed) > 0 && !slices.Contains(allowed, kind) &&
+		!(kind == "integer" && slices.Contains(allowed, "number")) {
+		fail("is %s, expected %s", kind, strings.Join(allowed, " or "))
+		return
+	}
+	if len(s.Enum) > 0 && !slices.ContainsFunc(s.Enum, func(e any) bool { return fmt.Sprint(e) == fmt.Sprint(value) }) {
+		fail("'%v' is not one of %v", value, s.Enum)
+	}
+
+	switch v := value.(type) {
+	case string:
+		length := utf8.RuneCountInString(v)
+		if s.MinLength != nil && length < *s.MinLength {
+			fail("is shorter than %d characters", *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			fail("is longer than %d characters", *s.MaxLength)
+		}
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, v); err != nil {
+				fail("is not an RFC 3339 date-time")
+			}
+		}
+	case json.Number:
+		n, _ := v.Float64()
+		if s.Minimum != nil && n < float64(*s.Minimum) {
+			fail("is less than %d", *s.Minimum)
+		}
+		if s.Maximum != nil && n > float64(*s.Maximum) {
+			fail("is greater than %d", *s.Maximum)
+		}
+	case []any:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			fail("has fewer than %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			fail("has more than %d items", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				d.validate(s.Items, item, fmt.Sprintf("%s[%d]", path, i), errs)
+			}
+		}
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				fail("property '%s' is required", name)
+			}
+		}
+		for name, property := range v {
+			propertyPath := name
+			if path != "" {
+				propertyPath = path + "." + name
+			}
+			if schema, ok := s.Properties[name]; ok {
+				d.validate(schema, property, propertyPath, errs)
+				continue
+			}
+			switch additional := s.AdditionalProperties.(type) {
+			case bool:
+				if !additional {
+					fail("property '%s' is not allowed", name)
+				}
+			case *Schema:
+				d.validate(additional, property, propertyPath, errs)
+			}
+		}
+	}
+}
+
+func schemaTypes(s *Schema) []string {
+	switch kind := s.Type.(type) {
+	case string:
+		return []string{kind}
+	case []string:
+		return kind
+	}
+	return nil
+}
+
+func jsonType(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if strings.ContainsAny(v.String(), ".eE") {
+			return "number"
+		}
+		return "integer"
+	case []any:
+		return "array"
+	default:
+		return "object"
+	}
+}
@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"api/catshelter/internal/domain"
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type ApiKeyRepository interface {
+	Save(ctx context.Context, key *domain.ApiKey) error
+	FindById(ctx context.Context, id string) (*domain.ApiKey, error)
+	FindByPrefix(ctx context.Context, prefix string) (*domain.ApiKey, error)
+	FindByUserId(ctx context.Context, userId string) ([]*domain.ApiKey, error)
+	RevokeByUserId(ctx context.Context, userId string, revokedAt time.Time) error
+	ClearMfaVerified(ctx context.Context, userId string) error
+	TouchLastUsed(ctx context.Context, id string, usedAt time.Time) error
+}
+
+var ErrApiKeyNotFound = errors.New("api key not found")
+
+type apiKeyRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func (a *apiKeyRepositoryImpl) Save(ctx context.Context, key *domain.ApiKey) error {
+	return conn(ctx, a.db).Save(key).Error
+}
+
+func (a *apiKeyRepositoryImpl) FindById(ctx context.Context, id string) (*domain.ApiKey, error) {
+	var key domain.ApiKey
+	result := conn(ctx, a.db).First(&key, "id = ?", id)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrApiKeyNotFound
+		}
+		return nil, result.Error
+	}
+	return &key, nil
+}
+
+func (a *apiKeyRepositoryImpl) FindByPrefix(ctx context.Context, prefix string) (*domain.ApiKey, error) {
+	var key domain.ApiKey
+	result := conn(ctx, a.db).First(&key, "prefix = ?", prefix)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrApiKeyNotFound
+		}
+		return nil, result.Error
+	}
+	return &key, nil
+}
+
+func (a *apiKeyRepositoryImpl) FindByUserId(ctx context.Context, userId string) ([]*domain.ApiKey, error) {
+	var keys []*domain.ApiKey
+	result := conn(ctx, a.db).Where("user_id = ?", userId).Order("created_at DESC").Find(&keys)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return keys, nil
+}
+
+// TouchLastUsed only writes when the stored value is older than a minute, so
+// busy keys do not turn every request into an UPDATE.
+func (a *apiKeyRepositoryImpl) TouchLastUsed(ctx context.Context, id string, usedAt time.Time) error {
+	return conn(ctx, a.db).Model(&domain.ApiKey{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", id, usedAt.Add(-time.Minute)).
+		Update("last_used_at", usedAt).Error
+}
+
+func (a *apiKeyRepositoryImpl) RevokeByUserId(ctx context.Context, userId string, revokedAt time.Time) error {
+	return conn(ctx, a.db).Model(&domain.ApiKey{}).Where("user_id = ? AND revoked_at IS NULL", userId).
+		Update("revoked_at", revokedAt).Error
+}
+
+// ClearMfaVerified stops the user's keys from counting as two-factor
+// authenticated, once the factors they were created with changed.
+func (a *apiKeyRepositoryImpl) ClearMfaVerified(ctx context.Context, userId string) error {
+	return conn(ctx, a.db).Model(&domain.ApiKey{}).Where("user_id = ? AND mfa_verified", userId).
+		Update("mfa_verified", false).Error
+}
+
+func NewApiKeyRepositoryImpl(db *gorm.DB) ApiKeyRepository {
+	return &apiKeyRepositoryImpl{db: db}
+}
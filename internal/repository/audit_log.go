@@ -0,0 +1,189 @@
+package repository
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// auditLogLockKey serializes appends so every entry chains onto the latest
+// one. It is an arbitrary constant used with pg_advisory_xact_lock.
+const auditLogLockKey = 7310437
+
+// keyedHashPrefix marks hashes computed with the audit key. Entries written
+// before the log was keyed hold a bare SHA-256.
+const keyedHashPrefix = "hmac-sha256:"
+
+// AuditEntry is one record of the append-only audit log. Each entry stores
+// the hash of the previous one, so editing or removing an entry breaks the
+// chain from that point on. Hashes are keyed with a secret kept outside the
+// database, so the chain cannot be recomputed from the table alone.
+type AuditEntry struct {
+	Id         string  `gorm:"type:uuid;primary_key;"`
+	Seq        int64   `gorm:"uniqueIndex"`
+	ActorId    *string `gorm:"type:uuid;index"`
+	Action     string  `gorm:"index"`
+	TargetType string  `gorm:"index:idx_audit_target"`
+	TargetId   string  `gorm:"index:idx_audit_target"`
+	Before     string
+	After      string
+	Ip         string
+	RequestId  string
+	CreatedAt  time.Time `gorm:"index"`
+	PrevHash   string
+	Hash       string
+}
+
+// ComputeHash hashes the entry's content together with the previous hash
+// using HMAC-SHA256 with key. A nil key gives the bare SHA-256 of entries
+// written before the log was keyed.
+func (a *AuditEntry) ComputeHash(key []byte) string {
+	actorId := ""
+	if a.ActorId != nil {
+		actorId = *a.ActorId
+	}
+	fields := []string{
+		a.PrevHash,
+		strconv.FormatInt(a.Seq, 10),
+		a.Id,
+		actorId,
+		a.Action,
+		a.TargetType,
+		a.TargetId,
+		a.Before,
+		a.After,
+		a.Ip,
+		a.RequestId,
+		a.CreatedAt.UTC().Format(time.RFC3339Nano),
+	}
+	content := []byte(strings.Join(fields, "\x1f"))
+	if key == nil {
+		sum := sha256.Sum256(content)
+		return hex.EncodeToString(sum[:])
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(content)
+	return keyedHashPrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Keyed reports whether the entry's hash was computed with the audit key.
+func (a *AuditEntry) Keyed() bool {
+	return strings.HasPrefix(a.Hash, keyedHashPrefix)
+}
+
+type AuditFilter struct {
+	ActorId    string
+	Action     string
+	TargetType string
+	TargetId   string
+	From       *time.Time
+	To         *time.Time
+}
+
+type AuditLogRepository interface {
+	Append(ctx context.Context, entry *AuditEntry) error
+	Find(ctx context.Context, filter *AuditFilter, page, pageSize int) ([]*AuditEntry, int64, error)
+	FindAll(ctx context.Context, filter *AuditFilter) ([]*AuditEntry, error)
+	// FindAfter returns up to limit entries following seq afterSeq, in
+	// chain order.
+	FindAfter(ctx context.Context, afterSeq int64, limit int) ([]*AuditEntry, error)
+}
+
+type auditLogRepositoryImpl struct {
+	db  *gorm.DB
+	key []byte
+}
+
+// Append chains entry onto the latest entry and stores it. Inside a
+// Transactor transaction the lock is held until that transaction ends, so the
+// entry is only visible together with the change it describes.
+func (a *auditLogRepositoryImpl) Append(ctx context.Context, entry *AuditEntry) error {
+	return conn(ctx, a.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", auditLogLockKey).Error; err != nil {
+			return err
+		}
+
+		var last AuditEntry
+		result := tx.Order("seq DESC").Limit(1).Find(&last)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if entry.Id == "" {
+			entry.Id = uuid.NewString()
+		}
+		// Postgres keeps microseconds, so truncate before hashing.
+		entry.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+		entry.Seq = last.Seq + 1
+		entry.PrevHash = last.Hash
+		entry.Hash = entry.ComputeHash(a.key)
+
+		return tx.Create(entry).Error
+	})
+}
+
+func (a *auditLogRepositoryImpl) Find(ctx context.Context, filter *AuditFilter, page, pageSize int) ([]*AuditEntry, int64, error) {
+	var entries []*AuditEntry
+	var count int64
+
+	baseQuery := applyAuditFilter(conn(ctx, a.db).Model(&AuditEntry{}), filter)
+	if err := baseQuery.Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if err := baseQuery.Order("seq DESC").Scopes(PaginationWithParams(page, pageSize)).Find(&entries).Error; err != nil {
+		return nil, 0, err
+	}
+	return entries, count, nil
+}
+
+func (a *auditLogRepositoryImpl) FindAll(ctx context.Context, filter *AuditFilter) ([]*AuditEntry, error) {
+	var entries []*AuditEntry
+	result := applyAuditFilter(conn(ctx, a.db), filter).Order("seq").Find(&entries)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return entries, nil
+}
+
+func (a *auditLogRepositoryImpl) FindAfter(ctx context.Context, afterSeq int64, limit int) ([]*AuditEntry, error) {
+	var entries []*AuditEntry
+	result := conn(ctx, a.db).Where("seq > ?", afterSeq).Order("seq").Limit(limit).Find(&entries)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return entries, nil
+}
+
+func applyAuditFilter(db *gorm.DB, filter *AuditFilter) *gorm.DB {
+	if filter.ActorId != "" {
+		db = db.Where("actor_id = ?", filter.ActorId)
+	}
+	if filter.Action != "" {
+		db = db.Where("action = ?", filter.Action)
+	}
+	if filter.TargetType != "" {
+		db = db.Where("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetId != "" {
+		db = db.Where("target_id = ?", filter.TargetId)
+	}
+	if filter.From != nil {
+		db = db.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		db = db.Where("created_at < ?", *filter.To)
+	}
+	return db
+}
+
+func NewAuditLogRepositoryImpl(db *gorm.DB, key []byte) AuditLogRepository {
+	return &auditLogRepositoryImpl{db: db, key: key}
+}
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Avatar is a user's profile picture, stored in the database so no file
+// storage has to be configured.
+type Avatar struct {
+	UserId      string `gorm:"type:uuid;primary_key;"`
+	ContentType string
+	Data        []byte
+	UpdatedAt   time.Time
+}
+
+type AvatarRepository interface {
+	Save(ctx context.Context, avatar *Avatar) error
+	FindByUserId(ctx context.Context, userId string) (*Avatar, error)
+	DeleteByUserId(ctx context.Context, userId string) error
+}
+
+var ErrAvatarNotFound = errors.New("avatar not found")
+
+type avatarRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func (a *avatarRepositoryImpl) Save(ctx context.Context, avatar *Avatar) error {
+	return conn(ctx, a.db).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"content_type", "data", "updated_at"}),
+	}).Create(avatar).Error
+}
+
+func (a *avatarRepositoryImpl) FindByUserId(ctx context.Context, userId string) (*Avatar, error) {
+	var avatar Avatar
+	result := conn(ctx, a.db).First(&avatar, "user_id = ?", userId)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrAvatarNotFound
+		}
+		return nil, result.Error
+	}
+	return &avatar, nil
+}
+
+func (a *avatarRepositoryImpl) DeleteByUserId(ctx context.Context, userId string) error {
+	return conn(ctx, a.db).Delete(&Avatar{}, "user_id = ?", userId).Error
+}
+
+func NewAvatarRepositoryImpl(db *gorm.DB) AvatarRepository {
+	return &avatarRepositoryImpl{db: db}
+}
@@ -25,7 +25,7 @@ func (c *catRepositoryImpl) FindWithoutUserId(ctx context.Context, page, pageSiz
 	var cats []*domain.Cat
 	var count int64
 
-	baseQuery := c.db.WithContext(ctx).Model(&domain.Cat{}).Where("user_id IS NULL")
+	baseQuery := conn(ctx, c.db).Model(&domain.Cat{}).Where("user_id IS NULL")
 
 	if err := baseQuery.Count(&count).Error; err != nil {
 		return nil, 0, err
@@ -40,7 +40,7 @@ func (c *catRepositoryImpl) FindWithoutUserId(ctx context.Context, page, pageSiz
 
 func (c *catRepositoryImpl) FindAll(ctx context.Context) ([]*domain.Cat, error) {
 	var cats []*domain.Cat
-	result := c.db.WithContext(ctx).Find(&cats)
+	result := conn(ctx, c.db).Find(&cats)
 	if result.Error != nil {
 		return nil, result.Error
 	}
@@ -49,7 +49,7 @@ func (c *catRepositoryImpl) FindAll(ctx context.Context) ([]*domain.Cat, error)
 
 func (c *catRepositoryImpl) FindById(ctx context.Context, id string) (*domain.Cat, error) {
 	var cat domain.Cat
-	result := c.db.WithContext(ctx).First(&cat, "id = ?", id)
+	result := conn(ctx, c.db).First(&cat, "id = ?", id)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			return nil, ErrCatNotFound
@@ -60,7 +60,7 @@ func (c *catRepositoryImpl) FindById(ctx context.Context, id string) (*domain.Ca
 }
 
 func (c *catRepositoryImpl) Save(ctx context.Context, cat *domain.Cat) error {
-	return c.db.WithContext(ctx).Save(cat).Error
+	return conn(ctx, c.db).Save(cat).Error
 }
 
 func NewCatRepositoryImpl(db *gorm.DB) CatRepository {
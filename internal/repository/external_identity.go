@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ExternalIdentity links a user to an account at an OpenID Connect provider.
+type ExternalIdentity struct {
+	Id        string `gorm:"type:uuid;primary_key;"`
+	UserId    string `gorm:"type:uuid;index"`
+	Provider  string `gorm:"uniqueIndex:idx_external_identity_subject"`
+	Subject   string `gorm:"uniqueIndex:idx_external_identity_subject"`
+	Email     string
+	CreatedAt time.Time
+}
+
+type ExternalIdentityRepository interface {
+	Save(ctx context.Context, identity *ExternalIdentity) error
+	FindByProviderSubject(ctx context.Context, provider, subject string) (*ExternalIdentity, error)
+	FindByUserId(ctx context.Context, userId string) ([]*ExternalIdentity, error)
+	DeleteByUserId(ctx context.Context, userId string) error
+}
+
+func (e *ExternalIdentity) BeforeCreate(tx *gorm.DB) (err error) {
+	if e.Id == "" {
+		e.Id = uuid.NewString()
+	}
+	return
+}
+
+var ErrExternalIdentityNotFound = errors.New("external identity not found")
+
+type externalIdentityRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func (e *externalIdentityRepositoryImpl) Save(ctx context.Context, identity *ExternalIdentity) error {
+	return conn(ctx, e.db).Save(identity).Error
+}
+
+func (e *externalIdentityRepositoryImpl) FindByProviderSubject(ctx context.Context, provider, subject string) (*ExternalIdentity, error) {
+	var identity ExternalIdentity
+	result := conn(ctx, e.db).First(&identity, "provider = ? AND subject = ?", provider, subject)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrExternalIdentityNotFound
+		}
+		return nil, result.Error
+	}
+	return &identity, nil
+}
+
+func (e *externalIdentityRepositoryImpl) FindByUserId(ctx context.Context, userId string) ([]*ExternalIdentity, error) {
+	var identities []*ExternalIdentity
+	result := conn(ctx, e.db).Order("created_at").Find(&identities, "user_id = ?", userId)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return identities, nil
+}
+
+func (e *externalIdentityRepositoryImpl) DeleteByUserId(ctx context.Context, userId string) error {
+	return conn(ctx, e.db).Delete(&ExternalIdentity{}, "user_id = ?", userId).Error
+}
+
+func NewExternalIdentityRepositoryImpl(db *gorm.DB) ExternalIdentityRepository {
+	return &externalIdentityRepositoryImpl{db: db}
+}
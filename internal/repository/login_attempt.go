@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type LoginAttempt struct {
+	Key           string `gorm:"primary_key"`
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   *time.Time
+}
+
+// LoginAttemptRepository keeps failed login counters. The database
+// implementation lets several API instances share the counters, the in-memory
+// one is meant for single instance deployments and local development.
+type LoginAttemptRepository interface {
+	FindByKey(ctx context.Context, key string) (*LoginAttempt, error)
+	RegisterFailure(ctx context.Context, key string, window time.Duration) (*LoginAttempt, error)
+	LockUntil(ctx context.Context, key string, until time.Time) error
+	DeleteByKey(ctx context.Context, key string) error
+}
+
+var ErrLoginAttemptNotFound = errors.New("login attempt not found")
+
+type loginAttemptRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func (l *loginAttemptRepositoryImpl) FindByKey(ctx context.Context, key string) (*LoginAttempt, error) {
+	var attempt LoginAttempt
+	result := conn(ctx, l.db).First(&attempt, "key = ?", key)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrLoginAttemptNotFound
+		}
+		return nil, result.Error
+	}
+	return &attempt, nil
+}
+
+// RegisterFailure increments the counter in a single upsert so concurrent
+// instances never lose an update. Counters older than window start over.
+func (l *loginAttemptRepositoryImpl) RegisterFailure(ctx context.Context, key string, window time.Duration) (*LoginAttempt, error) {
+	now := time.Now()
+	attempt := LoginAttempt{Key: key, Failures: 1, LastFailureAt: now}
+	result := conn(ctx, l.db).
+		Clauses(
+			clause.OnConflict{
+				Columns: []clause.Column{{Name: "key"}},
+				DoUpdates: clause.Assignments(map[string]interface{}{
+					"failures":        gorm.Expr("CASE WHEN login_attempts.last_failure_at < ? THEN 1 ELSE login_attempts.failures + 1 END", now.Add(-window)),
+					"last_failure_at": now,
+				}),
+			},
+			clause.Returning{},
+		).
+		Create(&attempt)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &attempt, nil
+}
+
+func (l *loginAttemptRepositoryImpl) LockUntil(ctx context.Context, key string, until time.Time) error {
+	return conn(ctx, l.db).Model(&LoginAttempt{}).Where("key = ?", key).Update("locked_until", until).Error
+}
+
+func (l *loginAttemptRepositoryImpl) DeleteByKey(ctx context.Context, key string) error {
+	return conn(ctx, l.db).Delete(&LoginAttempt{}, "key = ?", key).Error
+}
+
+func NewLoginAttemptRepositoryImpl(db *gorm.DB) LoginAttemptRepository {
+	return &loginAttemptRepositoryImpl{db: db}
+}
+
+type inMemoryLoginAttemptRepository struct {
+	mu       sync.Mutex
+	attempts map[string]LoginAttempt
+}
+
+func (m *inMemoryLoginAttemptRepository) FindByKey(ctx context.Context, key string) (*LoginAttempt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	attempt, ok := m.attempts[key]
+	if !ok {
+		return nil, ErrLoginAttemptNotFound
+	}
+	return &attempt, nil
+}
+
+func (m *inMemoryLoginAttemptRepository) RegisterFailure(ctx context.Context, key string, window time.Duration) (*LoginAttempt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	attempt, ok := m.attempts[key]
+	if !ok || attempt.LastFailureAt.Before(now.Add(-window)) {
+		attempt = LoginAttempt{Key: key, LockedUntil: attempt.LockedUntil}
+	}
+	attempt.Failures++
+	attempt.LastFailureAt = now
+	m.attempts[key] = attempt
+	return &attempt, nil
+}
+
+func (m *inMemoryLoginAttemptRepository) LockUntil(ctx context.Context, key string, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	attempt, ok := m.attempts[key]
+	if !ok {
+		return ErrLoginAttemptNotFound
+	}
+	attempt.LockedUntil = &until
+	m.attempts[key] = attempt
+	return nil
+}
+
+func (m *inMemoryLoginAttemptRepository) DeleteByKey(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.attempts, key)
+	return nil
+}
+
+func NewInMemoryLoginAttemptRepository() LoginAttemptRepository {
+	return &inMemoryLoginAttemptRepository{attempts: make(map[string]LoginAttempt)}
+}
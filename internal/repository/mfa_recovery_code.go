@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type MfaRecoveryCode struct {
+	Id       string `gorm:"type:uuid;primary_key;"`
+	UserId   string `gorm:"type:uuid;index"`
+	CodeHash string
+	UsedAt   *time.Time
+}
+
+type MfaRecoveryCodeRepository interface {
+	ReplaceForUser(ctx context.Context, userId string, codes []*MfaRecoveryCode) error
+	Use(ctx context.Context, userId, codeHash string) error
+	DeleteByUserId(ctx context.Context, userId string) error
+}
+
+func (m *MfaRecoveryCode) BeforeCreate(tx *gorm.DB) (err error) {
+	if m.Id == "" {
+		m.Id = uuid.NewString()
+	}
+	return
+}
+
+var ErrRecoveryCodeNotFound = errors.New("recovery code not found")
+
+type mfaRecoveryCodeRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func (m *mfaRecoveryCodeRepositoryImpl) ReplaceForUser(ctx context.Context, userId string, codes []*MfaRecoveryCode) error {
+	return conn(ctx, m.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&MfaRecoveryCode{}, "user_id = ?", userId).Error; err != nil {
+			return err
+		}
+		if len(codes) == 0 {
+			return nil
+		}
+		return tx.Create(codes).Error
+	})
+}
+
+// Use marks an unused code as used in one statement so the same code cannot be
+// redeemed twice by concurrent requests.
+func (m *mfaRecoveryCodeRepositoryImpl) Use(ctx context.Context, userId, codeHash string) error {
+	result := conn(ctx, m.db).Model(&MfaRecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userId, codeHash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrRecoveryCodeNotFound
+	}
+	return nil
+}
+
+func (m *mfaRecoveryCodeRepositoryImpl) DeleteByUserId(ctx context.Context, userId string) error {
+	return conn(ctx, m.db).Delete(&MfaRecoveryCode{}, "user_id = ?", userId).Error
+}
+
+func NewMfaRecoveryCodeRepositoryImpl(db *gorm.DB) MfaRecoveryCodeRepository {
+	return &mfaRecoveryCodeRepositoryImpl{db: db}
+}
@@ -6,31 +6,31 @@ import (
 	"gorm.io/gorm"
 )
 
-func PaginationWithParams(page, pageSize int) func(db *gorm.DB) *gorm.DB {
-	return func(db *gorm.DB) *gorm.DB {
-		if page <= 0 {
-			page = 1
-		}
+var (
+	defaultPageSize = 10
+	maxPageSize     = 100
+)
+
+// SetPageSizes sets the page size used when a request asks for none and the
+// largest page a request may ask for. It is meant to be called at startup.
+func SetPageSizes(defaultSize, maxSize int) {
+	defaultPageSize, maxPageSize = defaultSize, maxSize
+}
 
-		switch {
-		case pageSize > 100:
-			pageSize = 100
-		case pageSize <= 0:
-			pageSize = 10
-		}
+func DefaultPageSize() int {
+	return defaultPageSize
+}
 
+func PaginationWithParams(page, pageSize int) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		page, pageSize := normalizePage(page, pageSize)
 		offset := (page - 1) * pageSize
 		return db.Offset(offset).Limit(pageSize)
 	}
 }
 
 func CalculatePaginationResult(page, pageSize int, totalCount int64) dto.PaginationResult {
-	if page <= 0 {
-		page = 1
-	}
-	if pageSize <= 0 {
-		pageSize = 10
-	}
+	page, pageSize = normalizePage(page, pageSize)
 
 	totalPages := int((totalCount + int64(pageSize) - 1) / int64(pageSize))
 
@@ -43,3 +43,17 @@ func CalculatePaginationResult(page, pageSize int, totalCount int64) dto.Paginat
 		HasPrev:    page > 1,
 	}
 }
+
+func normalizePage(page, pageSize int) (int, int) {
+	if page <= 0 {
+		page = 1
+	}
+
+	switch {
+	case pageSize > maxPageSize:
+		pageSize = maxPageSize
+	case pageSize <= 0:
+		pageSize = defaultPageSize
+	}
+	return page, pageSize
+}
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type PasswordResetToken struct {
+	Id        string `gorm:"type:uuid;primary_key;"`
+	UserId    string `gorm:"type:uuid;index"`
+	TokenHash string `gorm:"unique"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+type PasswordResetTokenRepository interface {
+	Save(ctx context.Context, token *PasswordResetToken) error
+	Consume(ctx context.Context, tokenHash string) (*PasswordResetToken, error)
+	DeleteByUserId(ctx context.Context, userId string) error
+}
+
+func (p *PasswordResetToken) BeforeCreate(tx *gorm.DB) (err error) {
+	if p.Id == "" {
+		p.Id = uuid.NewString()
+	}
+	return
+}
+
+var ErrPasswordResetTokenNotFound = errors.New("password reset token not found")
+
+type passwordResetTokenRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func (p *passwordResetTokenRepositoryImpl) Save(ctx context.Context, token *PasswordResetToken) error {
+	return conn(ctx, p.db).Save(token).Error
+}
+
+// Consume marks a valid token as used and returns it. Unknown, expired and
+// already used tokens are all reported as ErrPasswordResetTokenNotFound.
+func (p *passwordResetTokenRepositoryImpl) Consume(ctx context.Context, tokenHash string) (*PasswordResetToken, error) {
+	var tokens []*PasswordResetToken
+	result := conn(ctx, p.db).Model(&tokens).
+		Clauses(clause.Returning{}).
+		Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", tokenHash, time.Now()).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 || len(tokens) == 0 {
+		return nil, ErrPasswordResetTokenNotFound
+	}
+	return tokens[0], nil
+}
+
+func (p *passwordResetTokenRepositoryImpl) DeleteByUserId(ctx context.Context, userId string) error {
+	return conn(ctx, p.db).Delete(&PasswordResetToken{}, "user_id = ?", userId).Error
+}
+
+func NewPasswordResetTokenRepositoryImpl(db *gorm.DB) PasswordResetTokenRepository {
+	return &passwordResetTokenRepositoryImpl{db: db}
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"api/catshelter/internal/domain"
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+type PermissionRepository interface {
+	Save(ctx context.Context, permission *domain.Permission) error
+	FindByName(ctx context.Context, name string) (*domain.Permission, error)
+	FindAll(ctx context.Context) ([]*domain.Permission, error)
+}
+
+var ErrPermissionNotFound = errors.New("permission not found")
+
+type permissionRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func (p *permissionRepositoryImpl) Save(ctx context.Context, permission *domain.Permission) error {
+	return conn(ctx, p.db).Save(permission).Error
+}
+
+func (p *permissionRepositoryImpl) FindByName(ctx context.Context, name string) (*domain.Permission, error) {
+	var permission domain.Permission
+	result := conn(ctx, p.db).First(&permission, "name = ?", name)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrPermissionNotFound
+		}
+		return nil, result.Error
+	}
+	return &permission, nil
+}
+
+func (p *permissionRepositoryImpl) FindAll(ctx context.Context) ([]*domain.Permission, error) {
+	var permissions []*domain.Permission
+	result := conn(ctx, p.db).Order("name").Find(&permissions)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return permissions, nil
+}
+
+func NewPermissionRepositoryImpl(db *gorm.DB) PermissionRepository {
+	return &permissionRepositoryImpl{db: db}
+}
@@ -2,6 +2,8 @@ package repository
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"time"
 
@@ -10,17 +12,32 @@ import (
 )
 
 type RefreshToken struct {
-	Id        string `gorm:"type:uuid;primary_key;"`
-	Token     string
-	UserId    string
+	Id          string `gorm:"type:uuid;primary_key;"`
+	Token       string
+	UserId      string
+	ExpiresAt   time.Time
+	MfaVerified bool
+}
+
+// RotatedRefreshToken remembers a refresh token replaced by rotation until it
+// would have expired, so presenting it again can be told apart from an
+// unknown token.
+type RotatedRefreshToken struct {
+	TokenHash string `gorm:"primaryKey"`
+	SessionId string `gorm:"type:uuid"`
 	ExpiresAt time.Time
 }
 
 type RefreshTokenRepository interface {
 	Save(ctx context.Context, token *RefreshToken) error
+	Rotate(ctx context.Context, token *RefreshToken, previousToken string) error
 	FindByToken(ctx context.Context, token string) (*RefreshToken, error)
+	FindRotated(ctx context.Context, token string) (*RotatedRefreshToken, error)
+	DeleteById(ctx context.Context, id string) error
 	DeleteByToken(ctx context.Context, token string) error
 	DeleteByUserId(ctx context.Context, userId string) error
+	DeleteByUserIdExcept(ctx context.Context, userId, keepToken string) error
+	FindByUserId(ctx context.Context, userId string) ([]*RefreshToken, error)
 }
 
 func (s *RefreshToken) BeforeCreate(tx *gorm.DB) (err error) {
@@ -36,8 +53,28 @@ type refreshTokenRepositoryImpl struct {
 	db *gorm.DB
 }
 
+func (r *refreshTokenRepositoryImpl) FindByUserId(ctx context.Context, userId string) ([]*RefreshToken, error) {
+	var tokens []*RefreshToken
+	result := conn(ctx, r.db).Order("expires_at").Find(&tokens, "user_id = ?", userId)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return tokens, nil
+}
+
+func (r *refreshTokenRepositoryImpl) DeleteById(ctx context.Context, id string) error {
+	result := conn(ctx, r.db).Delete(&RefreshToken{}, "id = ?", id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrRefreshTokenNotFound
+	}
+	return nil
+}
+
 func (r *refreshTokenRepositoryImpl) DeleteByToken(ctx context.Context, token string) error {
-	result := r.db.WithContext(ctx).Delete(&RefreshToken{}, "token = ?", token)
+	result := conn(ctx, r.db).Delete(&RefreshToken{}, "token = ?", token)
 	if result.Error != nil {
 		return result.Error
 	}
@@ -48,7 +85,7 @@ func (r *refreshTokenRepositoryImpl) DeleteByToken(ctx context.Context, token st
 }
 
 func (r *refreshTokenRepositoryImpl) DeleteByUserId(ctx context.Context, userId string) error {
-	result := r.db.WithContext(ctx).Delete(&RefreshToken{}, "user_id = ?", userId)
+	result := conn(ctx, r.db).Delete(&RefreshToken{}, "user_id = ?", userId)
 	if result.Error != nil {
 		return result.Error
 	}
@@ -58,9 +95,13 @@ func (r *refreshTokenRepositoryImpl) DeleteByUserId(ctx context.Context, userId
 	return nil
 }
 
+func (r *refreshTokenRepositoryImpl) DeleteByUserIdExcept(ctx context.Context, userId, keepToken string) error {
+	return conn(ctx, r.db).Delete(&RefreshToken{}, "user_id = ? AND token <> ?", userId, keepToken).Error
+}
+
 func (r *refreshTokenRepositoryImpl) FindByToken(ctx context.Context, token string) (*RefreshToken, error) {
 	var refreshToken RefreshToken
-	result := r.db.WithContext(ctx).First(&refreshToken, "token = ?", token)
+	result := conn(ctx, r.db).First(&refreshToken, "token = ?", token)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			return nil, ErrRefreshTokenNotFound
@@ -71,7 +112,46 @@ func (r *refreshTokenRepositoryImpl) FindByToken(ctx context.Context, token stri
 }
 
 func (r *refreshTokenRepositoryImpl) Save(ctx context.Context, token *RefreshToken) error {
-	return r.db.WithContext(ctx).Save(token).Error
+	return conn(ctx, r.db).Save(token).Error
+}
+
+// Rotate replaces previousToken of the session token.Id with token.Token and
+// remembers previousToken as rotated. It returns ErrRefreshTokenNotFound when
+// the session no longer holds previousToken, e.g. because a concurrent
+// refresh rotated it first.
+func (r *refreshTokenRepositoryImpl) Rotate(ctx context.Context, token *RefreshToken, previousToken string) error {
+	return conn(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&RefreshToken{}).Where("id = ? AND token = ?", token.Id, previousToken).
+			Updates(map[string]any{"token": token.Token, "expires_at": token.ExpiresAt})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRefreshTokenNotFound
+		}
+		rotated := &RotatedRefreshToken{TokenHash: hashRefreshToken(previousToken), SessionId: token.Id, ExpiresAt: token.ExpiresAt}
+		if err := tx.Create(rotated).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&RotatedRefreshToken{}, "expires_at < ?", time.Now()).Error
+	})
+}
+
+func (r *refreshTokenRepositoryImpl) FindRotated(ctx context.Context, token string) (*RotatedRefreshToken, error) {
+	var rotated RotatedRefreshToken
+	result := conn(ctx, r.db).First(&rotated, "token_hash = ? AND expires_at > ?", hashRefreshToken(token), time.Now())
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrRefreshTokenNotFound
+		}
+		return nil, result.Error
+	}
+	return &rotated, nil
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
 
 func NewRefreshTokenRepositoryImpl(db *gorm.DB) RefreshTokenRepository {
@@ -11,6 +11,11 @@ import (
 type RoleRepository interface {
 	Save(ctx context.Context, role *domain.Role) error
 	FindByName(ctx context.Context, name string) (*domain.Role, error)
+	FindAllWithPermissions(ctx context.Context) ([]*domain.Role, error)
+	AddPermission(ctx context.Context, role *domain.Role, permission *domain.Permission) error
+	UpdateWithPermissions(ctx context.Context, role *domain.Role) error
+	CountUsers(ctx context.Context, roleId string) (int64, error)
+	Delete(ctx context.Context, role *domain.Role, reassignTo *domain.Role) error
 }
 
 var ErrRoleNotFound = errors.New("role not found")
@@ -20,12 +25,12 @@ type roleRepositoryImpl struct {
 }
 
 func (r *roleRepositoryImpl) Save(ctx context.Context, role *domain.Role) error {
-	return r.db.WithContext(ctx).Save(role).Error
+	return conn(ctx, r.db).Save(role).Error
 }
 
 func (r *roleRepositoryImpl) FindByName(ctx context.Context, name string) (*domain.Role, error) {
 	var role domain.Role
-	result := r.db.WithContext(ctx).First(&role, "LOWER(name) = LOWER(?)", name)
+	result := conn(ctx, r.db).Preload("Permissions").First(&role, "LOWER(name) = LOWER(?)", name)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			return nil, ErrRoleNotFound
@@ -38,6 +43,64 @@ func (r *roleRepositoryImpl) FindByName(ctx context.Context, name string) (*doma
 	return &role, nil
 }
 
+func (r *roleRepositoryImpl) FindAllWithPermissions(ctx context.Context) ([]*domain.Role, error) {
+	var roles []*domain.Role
+	result := conn(ctx, r.db).Preload("Permissions").Order("name").Find(&roles)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return roles, nil
+}
+
+func (r *roleRepositoryImpl) AddPermission(ctx context.Context, role *domain.Role, permission *domain.Permission) error {
+	return conn(ctx, r.db).Model(role).Association("Permissions").Append(permission)
+}
+
+func (r *roleRepositoryImpl) UpdateWithPermissions(ctx context.Context, role *domain.Role) error {
+	return conn(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Permissions").Save(role).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(role).Association("Permissions").Replace(role.Permissions); err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
+
+func (r *roleRepositoryImpl) CountUsers(ctx context.Context, roleId string) (int64, error) {
+	var count int64
+	result := conn(ctx, r.db).Table("user_roles").Where("role_id = ?", roleId).Count(&count)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return count, nil
+}
+
+// Delete removes role in one transaction. Users holding it are moved to
+// reassignTo when given, otherwise they just lose the role.
+func (r *roleRepositoryImpl) Delete(ctx context.Context, role *domain.Role, reassignTo *domain.Role) error {
+	return conn(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		if reassignTo != nil {
+			err := tx.Exec(`INSERT INTO user_roles (user_id, role_id)
+				SELECT user_id, ? FROM user_roles WHERE role_id = ?
+				ON CONFLICT DO NOTHING`, reassignTo.Id, role.Id).Error
+			if err != nil {
+				return err
+			}
+		}
+		if err := tx.Exec("DELETE FROM user_roles WHERE role_id = ?", role.Id).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(role).Association("Permissions").Clear(); err != nil {
+			return err
+		}
+		return tx.Delete(role).Error
+	})
+}
+
 func NewRoleRepositoryImpl(db *gorm.DB) RoleRepository {
 	return &roleRepositoryImpl{db: db}
 }
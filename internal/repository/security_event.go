@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type SecurityEvent struct {
+	Id        string  `gorm:"type:uuid;primary_key;"`
+	Type      string  `gorm:"index"`
+	UserId    *string `gorm:"type:uuid;index"`
+	Login     string
+	Ip        string
+	Details   string
+	CreatedAt time.Time
+}
+
+type SecurityEventRepository interface {
+	Save(ctx context.Context, event *SecurityEvent) error
+	FindByUserId(ctx context.Context, userId string) ([]*SecurityEvent, error)
+	AnonymizeUser(ctx context.Context, userId string) error
+}
+
+func (s *SecurityEvent) BeforeCreate(tx *gorm.DB) (err error) {
+	if s.Id == "" {
+		s.Id = uuid.NewString()
+	}
+	return
+}
+
+type securityEventRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func (s *securityEventRepositoryImpl) Save(ctx context.Context, event *SecurityEvent) error {
+	return conn(ctx, s.db).Create(event).Error
+}
+
+func (s *securityEventRepositoryImpl) FindByUserId(ctx context.Context, userId string) ([]*SecurityEvent, error) {
+	var events []*SecurityEvent
+	result := conn(ctx, s.db).Order("created_at").Find(&events, "user_id = ?", userId)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return events, nil
+}
+
+// AnonymizeUser blanks the login and IP address of the user's events but
+// keeps the events themselves.
+func (s *securityEventRepositoryImpl) AnonymizeUser(ctx context.Context, userId string) error {
+	return conn(ctx, s.db).Model(&SecurityEvent{}).Where("user_id = ?", userId).
+		Updates(map[string]interface{}{"login": "", "ip": "", "details": ""}).Error
+}
+
+func NewSecurityEventRepositoryImpl(db *gorm.DB) SecurityEventRepository {
+	return &securityEventRepositoryImpl{db: db}
+}
@@ -4,8 +4,11 @@ import (
 	"api/catshelter/internal/domain"
 	"context"
 	"errors"
+	"strings"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type UserRepository interface {
@@ -16,33 +19,171 @@ type UserRepository interface {
 	FindByIdWithCats(ctx context.Context, id string) (*domain.User, error)
 	FindByLogin(ctx context.Context, login string) (*domain.User, error)
 	FindByLoginWithRoles(ctx context.Context, login string) (*domain.User, error)
+	FindByEmail(ctx context.Context, email string) (*domain.User, error)
+	FindByPhone(ctx context.Context, phone string) (*domain.User, error)
 	FindAll(ctx context.Context) ([]*domain.User, error)
-	UpdateWithRoles(ctx context.Context, user *domain.User) error
+	Update(ctx context.Context, user *domain.User, columns ...string) error
+	LiftEndedSuspension(ctx context.Context, id string, now time.Time) (bool, error)
+	ReplaceRoles(ctx context.Context, user *domain.User) error
+	Search(ctx context.Context, search *UserSearch, page, pageSize int) ([]*domain.User, int64, error)
+	FindByIdsWithRoles(ctx context.Context, ids []string) ([]*domain.User, error)
+	UpdateProfile(ctx context.Context, user *domain.User, expectedVersion int64) error
 }
 
-var ErrUserNotFound = errors.New("user not found")
+var (
+	ErrUserNotFound    = errors.New("user not found")
+	ErrVersionConflict = errors.New("the record was changed by someone else")
+	// ErrUserConflict means another user already has the login, email or
+	// phone that was to be stored.
+	ErrUserConflict = errors.New("another user has the same login, email or phone")
+)
+
+// UserSortColumns maps the sort keys accepted by Search to columns.
+var UserSortColumns = map[string]string{
+	"login":      "login",
+	"name":       "name",
+	"email":      "email",
+	"created_at": "created_at",
+}
+
+// UserSearch filters the user directory. Query matches login, name or email
+// case-insensitively; Role matches roles assigned directly to the user.
+type UserSearch struct {
+	Query          string
+	Role           string
+	Status         string
+	RegisteredFrom *time.Time
+	RegisteredTo   *time.Time
+	Sort           string
+	Desc           bool
+}
 
 type userRepositoryImpl struct {
 	db *gorm.DB
 }
 
-func (u *userRepositoryImpl) UpdateWithRoles(ctx context.Context, user *domain.User) error {
-	return u.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		if err := tx.Save(user).Error; err != nil {
-			return err
-		}
+// Update stores only the given columns of user. Writes other than profile
+// edits go through it, so they cannot overwrite a concurrent UpdateProfile
+// with the values they read before it.
+func (u *userRepositoryImpl) Update(ctx context.Context, user *domain.User, columns ...string) error {
+	result := conn(ctx, u.db).Model(user).Select(columns).Updates(user)
+	if result.Error != nil {
+		return userWriteError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
 
-		if err := tx.Model(user).Association("Roles").Replace(user.Roles); err != nil {
-			return err
-		}
+// LiftEndedSuspension reactivates the user if they are still suspended until
+// now or earlier, and reports whether it did. Checking the status in the same
+// statement keeps a ban or a new suspension written since the user was read.
+func (u *userRepositoryImpl) LiftEndedSuspension(ctx context.Context, id string, now time.Time) (bool, error) {
+	result := conn(ctx, u.db).Model(&domain.User{}).
+		Where("id = ? AND status = ? AND suspended_until <= ?", id, domain.UserStatusSuspended, now).
+		Updates(map[string]any{"status": domain.UserStatusActive, "suspended_reason": "", "suspended_until": nil})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
 
-		return nil
+// ReplaceRoles makes user.Roles the user's roles, leaving the user's own
+// columns alone.
+func (u *userRepositoryImpl) ReplaceRoles(ctx context.Context, user *domain.User) error {
+	return conn(ctx, u.db).Transaction(func(tx *gorm.DB) error {
+		return tx.Model(user).Association("Roles").Replace(user.Roles)
 	})
 }
 
+func (u *userRepositoryImpl) Search(ctx context.Context, search *UserSearch, page, pageSize int) ([]*domain.User, int64, error) {
+	var users []*domain.User
+	var count int64
+
+	baseQuery := conn(ctx, u.db).Model(&domain.User{})
+	if search.Query != "" {
+		like := "%" + escapeLike(search.Query) + "%"
+		baseQuery = baseQuery.Where("login ILIKE ? OR name ILIKE ? OR email ILIKE ?", like, like, like)
+	}
+	if search.Role != "" {
+		baseQuery = baseQuery.Where(`EXISTS (SELECT 1 FROM user_roles JOIN roles ON roles.id = user_roles.role_id
+			WHERE user_roles.user_id = users.id AND LOWER(roles.name) = LOWER(?))`, search.Role)
+	}
+	// Suspensions that have run out count as lifted even before the user
+	// signs in again and the change is stored.
+	switch search.Status {
+	case "":
+	case domain.UserStatusActive:
+		baseQuery = baseQuery.Where("status = ? OR (status = ? AND suspended_until <= ?)", domain.UserStatusActive, domain.UserStatusSuspended, time.Now())
+	case domain.UserStatusSuspended:
+		baseQuery = baseQuery.Where("status = ? AND (suspended_until IS NULL OR suspended_until > ?)", domain.UserStatusSuspended, time.Now())
+	default:
+		baseQuery = baseQuery.Where("status = ?", search.Status)
+	}
+	if search.RegisteredFrom != nil {
+		baseQuery = baseQuery.Where("created_at >= ?", *search.RegisteredFrom)
+	}
+	if search.RegisteredTo != nil {
+		baseQuery = baseQuery.Where("created_at < ?", *search.RegisteredTo)
+	}
+
+	if err := baseQuery.Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+
+	column, ok := UserSortColumns[search.Sort]
+	if !ok {
+		column = "created_at"
+	}
+	order := clause.OrderByColumn{Column: clause.Column{Name: column}, Desc: search.Desc}
+	err := baseQuery.Preload("Roles").Order(order).Order("id").Scopes(PaginationWithParams(page, pageSize)).Find(&users).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return users, count, nil
+}
+
+// UpdateProfile stores the profile fields of user only if its version is
+// still expectedVersion, and bumps the version.
+func (u *userRepositoryImpl) UpdateProfile(ctx context.Context, user *domain.User, expectedVersion int64) error {
+	result := conn(ctx, u.db).Model(&domain.User{}).
+		Where("id = ? AND version = ?", user.Id, expectedVersion).
+		Updates(map[string]interface{}{
+			"login":             user.Login,
+			"name":              user.Name,
+			"email":             user.Email,
+			"email_verified_at": user.EmailVerifiedAt,
+			"phone":             user.Phone,
+			"version":           gorm.Expr("version + 1"),
+		})
+	if result.Error != nil {
+		return userWriteError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrVersionConflict
+	}
+	user.Version = expectedVersion + 1
+	return nil
+}
+
+func (u *userRepositoryImpl) FindByIdsWithRoles(ctx context.Context, ids []string) ([]*domain.User, error) {
+	var users []*domain.User
+	result := conn(ctx, u.db).Preload("Roles.Permissions").Where("id IN ?", ids).Find(&users)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return users, nil
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
 func (u *userRepositoryImpl) FindByIdWithAll(ctx context.Context, id string) (*domain.User, error) {
 	var user domain.User
-	result := u.db.WithContext(ctx).Preload("Roles").Preload("Cats").First(&user, "id = ?", id)
+	result := conn(ctx, u.db).Preload("Roles.Permissions").Preload("Cats").First(&user, "id = ?", id)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			return nil, ErrUserNotFound
@@ -54,7 +195,7 @@ func (u *userRepositoryImpl) FindByIdWithAll(ctx context.Context, id string) (*d
 
 func (u *userRepositoryImpl) FindByIdWithRoles(ctx context.Context, id string) (*domain.User, error) {
 	var user domain.User
-	result := u.db.WithContext(ctx).Preload("Roles").First(&user, "id = ?", id)
+	result := conn(ctx, u.db).Preload("Roles.Permissions").First(&user, "id = ?", id)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			return nil, ErrUserNotFound
@@ -66,7 +207,7 @@ func (u *userRepositoryImpl) FindByIdWithRoles(ctx context.Context, id string) (
 
 func (u *userRepositoryImpl) FindByLoginWithRoles(ctx context.Context, login string) (*domain.User, error) {
 	var user domain.User
-	result := u.db.WithContext(ctx).Preload("Roles").First(&user, "login = ?", login)
+	result := conn(ctx, u.db).Preload("Roles.Permissions").First(&user, "login = ?", login)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			return nil, ErrUserNotFound
@@ -78,7 +219,7 @@ func (u *userRepositoryImpl) FindByLoginWithRoles(ctx context.Context, login str
 
 func (u *userRepositoryImpl) FindByIdWithCats(ctx context.Context, id string) (*domain.User, error) {
 	var user domain.User
-	result := u.db.WithContext(ctx).Preload("Cats").First(&user, "id = ?", id)
+	result := conn(ctx, u.db).Preload("Cats").First(&user, "id = ?", id)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			return nil, ErrUserNotFound
@@ -90,7 +231,7 @@ func (u *userRepositoryImpl) FindByIdWithCats(ctx context.Context, id string) (*
 
 func (u *userRepositoryImpl) FindAll(ctx context.Context) ([]*domain.User, error) {
 	var users []*domain.User
-	result := u.db.WithContext(ctx).Find(&users)
+	result := conn(ctx, u.db).Find(&users)
 	if result.Error != nil {
 		return nil, result.Error
 	}
@@ -100,7 +241,7 @@ func (u *userRepositoryImpl) FindAll(ctx context.Context) ([]*domain.User, error
 
 func (u *userRepositoryImpl) FindById(ctx context.Context, id string) (*domain.User, error) {
 	var user domain.User
-	result := u.db.WithContext(ctx).First(&user, "id = ?", id)
+	result := conn(ctx, u.db).First(&user, "id = ?", id)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			return nil, ErrUserNotFound
@@ -113,7 +254,31 @@ func (u *userRepositoryImpl) FindById(ctx context.Context, id string) (*domain.U
 
 func (u *userRepositoryImpl) FindByLogin(ctx context.Context, login string) (*domain.User, error) {
 	var user domain.User
-	result := u.db.WithContext(ctx).First(&user, "login = ?", login)
+	result := conn(ctx, u.db).First(&user, "login = ?", login)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, result.Error
+	}
+	return &user, nil
+}
+
+func (u *userRepositoryImpl) FindByEmail(ctx context.Context, email string) (*domain.User, error) {
+	var user domain.User
+	result := conn(ctx, u.db).First(&user, "email = ?", email)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, result.Error
+	}
+	return &user, nil
+}
+
+func (u *userRepositoryImpl) FindByPhone(ctx context.Context, phone string) (*domain.User, error) {
+	var user domain.User
+	result := conn(ctx, u.db).First(&user, "phone = ?", phone)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			return nil, ErrUserNotFound
@@ -124,7 +289,16 @@ func (u *userRepositoryImpl) FindByLogin(ctx context.Context, login string) (*do
 }
 
 func (u *userRepositoryImpl) Save(ctx context.Context, user *domain.User) error {
-	return u.db.WithContext(ctx).Save(user).Error
+	return userWriteError(conn(ctx, u.db).Save(user).Error)
+}
+
+// userWriteError reports a unique index violation as ErrUserConflict. The
+// database needs gorm's TranslateError for it to be recognised.
+func userWriteError(err error) error {
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrUserConflict
+	}
+	return err
 }
 
 func NewUserReposioryImpl(db *gorm.DB) UserRepository {
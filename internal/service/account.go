@@ -0,0 +1,305 @@
+package service
+
+import (
+	"api/catshelter/internal/domain"
+	"api/catshelter/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// statusColumns are the columns a status change writes.
+	statusColumns = []string{"status", "suspended_reason", "suspended_until"}
+	// anonymizedColumns are the columns domain.User.Anonymize clears.
+	anonymizedColumns = []string{"login", "password", "name", "email", "email_verified_at", "phone",
+		"totp_secret", "totp_enabled", "totp_last_step", "status", "suspended_reason", "suspended_until",
+		"deleted_at", "version"}
+)
+
+// AccountData is everything stored about a user, for data export requests.
+type AccountData struct {
+	User               *domain.User
+	Avatar             *repository.Avatar
+	ExternalIdentities []*repository.ExternalIdentity
+	ApiKeys            []*domain.ApiKey
+	Sessions           []*repository.RefreshToken
+	SecurityEvents     []*repository.SecurityEvent
+	AuditEntries       []*repository.AuditEntry
+}
+
+type AccountService interface {
+	Suspend(ctx context.Context, actorId, userId, reason string, until *time.Time) error
+	Ban(ctx context.Context, actorId, userId, reason string) error
+	Reactivate(ctx context.Context, userId string) error
+	Delete(ctx context.Context, userId, password string) error
+	Export(ctx context.Context, userId string) (*AccountData, error)
+}
+
+type accountServiceImpl struct {
+	userRepository               repository.UserRepository
+	refreshTokenRepository       repository.RefreshTokenRepository
+	apiKeyRepository             repository.ApiKeyRepository
+	externalIdentityRepository   repository.ExternalIdentityRepository
+	mfaRecoveryCodeRepository    repository.MfaRecoveryCodeRepository
+	passwordResetTokenRepository repository.PasswordResetTokenRepository
+	avatarRepository             repository.AvatarRepository
+	securityEventRepository      repository.SecurityEventRepository
+	auditLogRepository           repository.AuditLogRepository
+	transactor                   repository.Transactor
+}
+
+func (a *accountServiceImpl) Suspend(ctx context.Context, actorId, userId, reason string, until *time.Time) (err error) {
+	ctx, span := startSpan(ctx, "AccountService.Suspend")
+	defer func() { endSpan(span, err) }()
+
+	return a.changeStatus(ctx, actorId, userId, AuditUserSuspended, func(user *domain.User) error {
+		return user.Suspend(reason, until)
+	})
+}
+
+func (a *accountServiceImpl) Ban(ctx context.Context, actorId, userId, reason string) (err error) {
+	ctx, span := startSpan(ctx, "AccountService.Ban")
+	defer func() { endSpan(span, err) }()
+
+	return a.changeStatus(ctx, actorId, userId, AuditUserBanned, func(user *domain.User) error {
+		return user.Ban(reason)
+	})
+}
+
+func (a *accountServiceImpl) Reactivate(ctx context.Context, userId string) (err error) {
+	ctx, span := startSpan(ctx, "AccountService.Reactivate")
+	defer func() { endSpan(span, err) }()
+
+	return a.changeStatus(ctx, "", userId, AuditUserReactivated, func(user *domain.User) error {
+		return user.Reactivate()
+	})
+}
+
+// changeStatus applies change and, for anything but a reactivation, ends the
+// user's sessions in the same transaction. API keys are kept: they stop
+// working while the account is not active and work again once reactivated.
+func (a *accountServiceImpl) changeStatus(ctx context.Context, actorId, userId, action string, change func(user *domain.User) error) error {
+	user, err := a.findUser(ctx, userId)
+	if err != nil {
+		return err
+	}
+	if actorId != "" && user.Id == actorId {
+		return fmt.Errorf("%w: you cannot change your own account status", domain.ErrValidation)
+	}
+
+	before := map[string]any{"status": user.Status}
+	if err := change(user); err != nil {
+		return err
+	}
+
+	return withAudit(ctx, a.transactor, a.auditLogRepository, func(ctx context.Context) (*AuditChange, error) {
+		if err := a.userRepository.Update(ctx, user, statusColumns...); err != nil {
+			return nil, err
+		}
+		if user.Status != domain.UserStatusActive {
+			if err := a.endSessions(ctx, user.Id); err != nil {
+				return nil, err
+			}
+		}
+		return &AuditChange{
+			Action:     action,
+			TargetType: "user",
+			TargetId:   user.Id,
+			Before:     before,
+			After:      map[string]any{"status": user.Status, "reason": user.SuspendedReason, "until": user.SuspendedUntil},
+		}, nil
+	})
+}
+
+// Delete honors a user's request to delete their account. Personal data is
+// erased and credentials are removed, but the anonymized row stays so cats
+// they adopted keep their adoption record. Users who only sign in with an
+// identity provider have no password to confirm the deletion with.
+func (a *accountServiceImpl) Delete(ctx context.Context, userId, password string) (err error) {
+	ctx, span := startSpan(ctx, "AccountService.Delete")
+	defer func() { endSpan(span, err) }()
+
+	user, err := a.findUser(ctx, userId)
+	if err != nil {
+		return err
+	}
+	if user.HasPassword() && !user.CheckPassword(password) {
+		return ErrIncorrectPassword
+	}
+
+	before := map[string]any{"status": user.Status}
+	if err := user.Anonymize(); err != nil {
+		return err
+	}
+
+	return withAudit(ctx, a.transactor, a.auditLogRepository, func(ctx context.Context) (*AuditChange, error) {
+		if err := a.userRepository.Update(ctx, user, anonymizedColumns...); err != nil {
+			return nil, err
+		}
+		if err := a.endSessions(ctx, user.Id); err != nil {
+			return nil, err
+		}
+		if err := a.apiKeyRepository.RevokeByUserId(ctx, user.Id, time.Now()); err != nil {
+			return nil, err
+		}
+		if err := a.externalIdentityRepository.DeleteByUserId(ctx, user.Id); err != nil {
+			return nil, err
+		}
+		if err := a.mfaRecoveryCodeRepository.DeleteByUserId(ctx, user.Id); err != nil {
+			return nil, err
+		}
+		if err := a.passwordResetTokenRepository.DeleteByUserId(ctx, user.Id); err != nil {
+			return nil, err
+		}
+		if err := a.avatarRepository.DeleteByUserId(ctx, user.Id); err != nil {
+			return nil, err
+		}
+		if err := a.securityEventRepository.AnonymizeUser(ctx, user.Id); err != nil {
+			return nil, err
+		}
+		// The audit log is immutable, so the entry carries no personal data.
+		return &AuditChange{
+			Action:     AuditUserDeleted,
+			TargetType: "user",
+			TargetId:   user.Id,
+			Before:     before,
+			After:      map[string]any{"status": user.Status},
+		}, nil
+	})
+}
+
+func (a *accountServiceImpl) Export(ctx context.Context, userId string) (_ *AccountData, err error) {
+	ctx, span := startSpan(ctx, "AccountService.Export")
+	defer func() { endSpan(span, err) }()
+
+	user, err := a.userRepository.FindByIdWithAll(ctx, userId)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, fmt.Errorf("%w: user with id '%s' not found", repository.ErrUserNotFound, userId)
+		}
+		return nil, err
+	}
+
+	data := &AccountData{User: user}
+	data.Avatar, err = a.avatarRepository.FindByUserId(ctx, userId)
+	if err != nil && !errors.Is(err, repository.ErrAvatarNotFound) {
+		return nil, fmt.Errorf("db error: %w", err)
+	}
+	if data.ExternalIdentities, err = a.externalIdentityRepository.FindByUserId(ctx, userId); err != nil {
+		return nil, fmt.Errorf("db error: %w", err)
+	}
+	if data.ApiKeys, err = a.apiKeyRepository.FindByUserId(ctx, userId); err != nil {
+		return nil, fmt.Errorf("db error: %w", err)
+	}
+	if data.Sessions, err = a.refreshTokenRepository.FindByUserId(ctx, userId); err != nil {
+		return nil, fmt.Errorf("db error: %w", err)
+	}
+	if data.SecurityEvents, err = a.securityEventRepository.FindByUserId(ctx, userId); err != nil {
+		return nil, fmt.Errorf("db error: %w", err)
+	}
+
+	byActor, err := a.auditLogRepository.FindAll(ctx, &repository.AuditFilter{ActorId: userId})
+	if err != nil {
+		return nil, fmt.Errorf("db error: %w", err)
+	}
+	aboutUser, err := a.auditLogRepository.FindAll(ctx, &repository.AuditFilter{TargetType: "user", TargetId: userId})
+	if err != nil {
+		return nil, fmt.Errorf("db error: %w", err)
+	}
+	data.AuditEntries = mergeAuditEntries(byActor, aboutUser)
+
+	return data, nil
+}
+
+func (a *accountServiceImpl) endSessions(ctx context.Context, userId string) error {
+	err := a.refreshTokenRepository.DeleteByUserId(ctx, userId)
+	if err != nil && !errors.Is(err, repository.ErrUserNotFound) {
+		return err
+	}
+	return nil
+}
+
+func (a *accountServiceImpl) findUser(ctx context.Context, userId string) (*domain.User, error) {
+	user, err := a.userRepository.FindById(ctx, userId)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, fmt.Errorf("%w: user with id '%s' not found", repository.ErrUserNotFound, userId)
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+// mergeAuditEntries merges two lists sorted by sequence number, dropping
+// entries present in both.
+func mergeAuditEntries(a, b []*repository.AuditEntry) []*repository.AuditEntry {
+	merged := make([]*repository.AuditEntry, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case j == len(b) || (i < len(a) && a[i].Seq < b[j].Seq):
+			merged = append(merged, a[i])
+			i++
+		case i == len(a) || b[j].Seq < a[i].Seq:
+			merged = append(merged, b[j])
+			j++
+		default:
+			merged = append(merged, a[i])
+			i++
+			j++
+		}
+	}
+	return merged
+}
+
+// checkActive is domain.User.CheckActive that also stores the lifting of a
+// suspension whose end has passed, so the account shows as active again.
+// The lifting only applies if the status did not change since user was read.
+func checkActive(ctx context.Context, userRepository repository.UserRepository, user *domain.User) error {
+	now := time.Now()
+	ended := user.Status == domain.UserStatusSuspended && user.SuspendedUntil != nil && !user.SuspendedUntil.After(now)
+	if !ended {
+		return user.CheckActive()
+	}
+
+	lifted, err := userRepository.LiftEndedSuspension(ctx, user.Id, now)
+	if err != nil {
+		return fmt.Errorf("db error: %w", err)
+	}
+	if !lifted {
+		current, err := userRepository.FindById(ctx, user.Id)
+		if err != nil {
+			return fmt.Errorf("db error: %w", err)
+		}
+		user.Status, user.SuspendedReason, user.SuspendedUntil = current.Status, current.SuspendedReason, current.SuspendedUntil
+	}
+	return user.CheckActive()
+}
+
+func NewAccountService(
+	userRepository repository.UserRepository,
+	refreshTokenRepository repository.RefreshTokenRepository,
+	apiKeyRepository repository.ApiKeyRepository,
+	externalIdentityRepository repository.ExternalIdentityRepository,
+	mfaRecoveryCodeRepository repository.MfaRecoveryCodeRepository,
+	passwordResetTokenRepository repository.PasswordResetTokenRepository,
+	avatarRepository repository.AvatarRepository,
+	securityEventRepository repository.SecurityEventRepository,
+	auditLogRepository repository.AuditLogRepository,
+	transactor repository.Transactor,
+) AccountService {
+	return &accountServiceImpl{
+		userRepository:               userRepository,
+		refreshTokenRepository:       refreshTokenRepository,
+		apiKeyRepository:             apiKeyRepository,
+		externalIdentityRepository:   externalIdentityRepository,
+		mfaRecoveryCodeRepository:    mfaRecoveryCodeRepository,
+		passwordResetTokenRepository: passwordResetTokenRepository,
+		avatarRepository:             avatarRepository,
+		securityEventRepository:      securityEventRepository,
+		auditLogRepository:           auditLogRepository,
+		transactor:                   transactor,
+	}
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"api/catshelter/internal/domain"
+	"api/catshelter/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+var ErrNotServiceAccount = errors.New("user is not a service account")
+
+type ApiKeyService interface {
+	Create(ctx context.Context, userId, name string, scopes []string, expiresAt *time.Time, mfaVerified bool) (*domain.ApiKey, string, error)
+	List(ctx context.Context, userId string) ([]*domain.ApiKey, error)
+	Revoke(ctx context.Context, userId, keyId string) error
+	Authenticate(ctx context.Context, rawKey string) (*domain.User, *domain.ApiKey, error)
+	CreateServiceAccount(ctx context.Context, login, name string) (*domain.User, error)
+	FindServiceAccount(ctx context.Context, userId string) (*domain.User, error)
+}
+
+type apiKeyServiceImpl struct {
+	apiKeyRepository        repository.ApiKeyRepository
+	userRepository          repository.UserRepository
+	roleRepository          repository.RoleRepository
+	securityEventRepository repository.SecurityEventRepository
+}
+
+func (a *apiKeyServiceImpl) Create(ctx context.Context, userId, name string, scopes []string, expiresAt *time.Time, mfaVerified bool) (_ *domain.ApiKey, _ string, err error) {
+	ctx, span := startSpan(ctx, "ApiKeyService.Create")
+	defer func() { endSpan(span, err) }()
+
+	user, err := a.userRepository.FindById(ctx, userId)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, "", fmt.Errorf("%w: user with id '%s' not found", repository.ErrUserNotFound, userId)
+		}
+		return nil, "", err
+	}
+
+	key, plain, err := domain.NewApiKey(user.Id, name, scopes, expiresAt, mfaVerified)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := a.apiKeyRepository.Save(ctx, key); err != nil {
+		return nil, "", fmt.Errorf("db error: %w", err)
+	}
+
+	recordSecurityEvent(ctx, a.securityEventRepository, &repository.SecurityEvent{Type: SecurityEventApiKeyCreated, UserId: &user.Id, Login: user.Login, Details: key.Prefix})
+	return key, plain, nil
+}
+
+func (a *apiKeyServiceImpl) List(ctx context.Context, userId string) (_ []*domain.ApiKey, err error) {
+	ctx, span := startSpan(ctx, "ApiKeyService.List")
+	defer func() { endSpan(span, err) }()
+
+	keys, err := a.apiKeyRepository.FindByUserId(ctx, userId)
+	if err != nil {
+		return nil, fmt.Errorf("db error: %w", err)
+	}
+	return keys, nil
+}
+
+// Revoke only touches keys owned by userId; keys of other users look like
+// they do not exist.
+func (a *apiKeyServiceImpl) Revoke(ctx context.Context, userId, keyId string) (err error) {
+	ctx, span := startSpan(ctx, "ApiKeyService.Revoke")
+	defer func() { endSpan(span, err) }()
+
+	key, err := a.apiKeyRepository.FindById(ctx, keyId)
+	if err != nil {
+		if errors.Is(err, repository.ErrApiKeyNotFound) {
+			return fmt.Errorf("%w: api key with id '%s' not found", repository.ErrApiKeyNotFound, keyId)
+		}
+		return err
+	}
+	if key.UserId != userId {
+		return fmt.Errorf("%w: api key with id '%s' not found", repository.ErrApiKeyNotFound, keyId)
+	}
+
+	key.Revoke()
+	if err := a.apiKeyRepository.Save(ctx, key); err != nil {
+		return fmt.Errorf("db error: %w", err)
+	}
+
+	recordSecurityEvent(ctx, a.securityEventRepository, &repository.SecurityEvent{Type: SecurityEventApiKeyRevoked, UserId: &userId, Details: key.Prefix})
+	return nil
+}
+
+func (a *apiKeyServiceImpl) Authenticate(ctx context.Context, rawKey string) (_ *domain.User, _ *domain.ApiKey, err error) {
+	ctx, span := startSpan(ctx, "ApiKeyService.Authenticate")
+	defer func() { endSpan(span, err) }()
+
+	prefix, secret, err := domain.ParseApiKey(rawKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, err := a.apiKeyRepository.FindByPrefix(ctx, prefix)
+	if err != nil {
+		if errors.Is(err, repository.ErrApiKeyNotFound) {
+			return nil, nil, domain.ErrInvalidApiKey
+		}
+		return nil, nil, err
+	}
+	now := time.Now()
+	if err := key.Check(secret, now); err != nil {
+		return nil, nil, err
+	}
+
+	user, err := a.userRepository.FindByIdWithRoles(ctx, key.UserId)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, nil, domain.ErrInvalidApiKey
+		}
+		return nil, nil, err
+	}
+	if err := checkActive(ctx, a.userRepository, user); err != nil {
+		return nil, nil, err
+	}
+
+	if err := a.apiKeyRepository.TouchLastUsed(ctx, key.Id, now); err != nil {
+		slog.WarnContext(ctx, "failed to update last use of api key", "api_key_prefix", key.Prefix, "error", err)
+	}
+	return user, key, nil
+}
+
+func (a *apiKeyServiceImpl) CreateServiceAccount(ctx context.Context, login, name string) (_ *domain.User, err error) {
+	ctx, span := startSpan(ctx, "ApiKeyService.CreateServiceAccount")
+	defer func() { endSpan(span, err) }()
+
+	existing, err := a.userRepository.FindByLogin(ctx, login)
+	if err != nil && !errors.Is(err, repository.ErrUserNotFound) {
+		return nil, fmt.Errorf("db error: %w", err)
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("%w: '%s'", ErrLoginAlreadyUsed, login)
+	}
+
+	user, err := domain.NewServiceAccount(login, name)
+	if err != nil {
+		return nil, err
+	}
+	role, err := a.roleRepository.FindByName(ctx, "user")
+	if err != nil {
+		if errors.Is(err, repository.ErrRoleNotFound) {
+			return nil, errors.New("role 'user' not found")
+		}
+		return nil, fmt.Errorf("db error: %w", err)
+	}
+	if err := user.AddRole(role); err != nil {
+		return nil, err
+	}
+	if err := a.userRepository.Save(ctx, user); err != nil {
+		if errors.Is(err, repository.ErrUserConflict) {
+			return nil, takenField(ctx, a.userRepository, user)
+		}
+		return nil, fmt.Errorf("db error: %w", err)
+	}
+	return user, nil
+}
+
+func (a *apiKeyServiceImpl) FindServiceAccount(ctx context.Context, userId string) (_ *domain.User, err error) {
+	ctx, span := startSpan(ctx, "ApiKeyService.FindServiceAccount")
+	defer func() { endSpan(span, err) }()
+
+	user, err := a.userRepository.FindById(ctx, userId)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, fmt.Errorf("%w: user with id '%s' not found", repository.ErrUserNotFound, userId)
+		}
+		return nil, err
+	}
+	if !user.ServiceAccount {
+		return nil, ErrNotServiceAccount
+	}
+	return user, nil
+}
+
+func NewApiKeyService(apiKeyRepository repository.ApiKeyRepository, userRepository repository.UserRepository, roleRepository repository.RoleRepository, securityEventRepository repository.SecurityEventRepository) ApiKeyService {
+	return &apiKeyServiceImpl{
+		apiKeyRepository:        apiKeyRepository,
+		userRepository:          userRepository,
+		roleRepository:          roleRepository,
+		securityEventRepository: securityEventRepository,
+	}
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"api/catshelter/internal/handler/dto"
+	"api/catshelter/internal/repository"
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	AuditRoleGranted = "role_granted"
+	AuditRoleRevoked = "role_revoked"
+	AuditCatCreated  = "cat_created"
+	AuditCatAdopted  = "cat_adopted"
+
+	AuditUserSuspended   = "user_suspended"
+	AuditUserBanned      = "user_banned"
+	AuditUserReactivated = "user_reactivated"
+	AuditUserDeleted     = "user_deleted"
+)
+
+// AuditActor is who made a request, attached to the context by the
+// AuditContext middleware.
+type AuditActor struct {
+	UserId    string
+	Ip        string
+	RequestId string
+}
+
+type auditActorContextKey struct{}
+
+func ContextWithAuditActor(ctx context.Context, actor AuditActor) context.Context {
+	return context.WithValue(ctx, auditActorContextKey{}, actor)
+}
+
+func auditActorFromContext(ctx context.Context) AuditActor {
+	actor, _ := ctx.Value(auditActorContextKey{}).(AuditActor)
+	return actor
+}
+
+// AuditChange describes a change for the audit log. Before and After are
+// stored as JSON; nil means the target did not exist.
+type AuditChange struct {
+	Action     string
+	TargetType string
+	TargetId   string
+	Before     any
+	After      any
+}
+
+// withAudit runs change in a transaction and appends the audit entry it
+// returns in the same transaction, so a change is never stored without its
+// entry and vice versa.
+func withAudit(ctx context.Context, transactor repository.Transactor, auditRepository repository.AuditLogRepository, change func(ctx context.Context) (*AuditChange, error)) error {
+	return transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		audit, err := change(ctx)
+		if err != nil {
+			return err
+		}
+
+		before, err := auditSnapshot(audit.Before)
+		if err != nil {
+			return err
+		}
+		after, err := auditSnapshot(audit.After)
+		if err != nil {
+			return err
+		}
+
+		actor := auditActorFromContext(ctx)
+		entry := &repository.AuditEntry{
+			Action:     audit.Action,
+			TargetType: audit.TargetType,
+			TargetId:   audit.TargetId,
+			Before:     before,
+			After:      after,
+			Ip:         actor.Ip,
+			RequestId:  actor.RequestId,
+		}
+		if actor.UserId != "" {
+			entry.ActorId = &actor.UserId
+		}
+		if err := auditRepository.Append(ctx, entry); err != nil {
+			return fmt.Errorf("writing audit log: %w", err)
+		}
+		return nil
+	})
+}
+
+func auditSnapshot(v any) (string, error) {
+	if v == nil {
+		return "", nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("encoding audit snapshot: %w", err)
+	}
+	return string(data), nil
+}
+
+// AuditVerification is the result of walking the hash chain. Entries counts
+// the entries checked, which stops at the first one whose hash does not
+// match; BrokenAtSeq is that entry, zero when the chain is intact.
+type AuditVerification struct {
+	Entries     int
+	Valid       bool
+	BrokenAtSeq int64
+}
+
+type AuditService interface {
+	Find(ctx context.Context, filter *repository.AuditFilter, page, pageSize int) ([]*repository.AuditEntry, *dto.PaginationResult, error)
+	FindAll(ctx context.Context, filter *repository.AuditFilter) ([]*repository.AuditEntry, error)
+	Verify(ctx context.Context) (*AuditVerification, error)
+}
+
+// auditVerifyPageSize is how many entries Verify reads at a time.
+var auditVerifyPageSize = 1000
+
+type auditServiceImpl struct {
+	auditLogRepository repository.AuditLogRepository
+	key                []byte
+}
+
+func (a *auditServiceImpl) Find(ctx context.Context, filter *repository.AuditFilter, page, pageSize int) (_ []*repository.AuditEntry, _ *dto.PaginationResult, err error) {
+	ctx, span := startSpan(ctx, "AuditService.Find")
+	defer func() { endSpan(span, err) }()
+
+	entries, count, err := a.auditLogRepository.Find(ctx, filter, page, pageSize)
+	if err != nil {
+		return nil, nil, fmt.Errorf("DB error: %w", err)
+	}
+
+	paginationResult := repository.CalculatePaginationResult(page, pageSize, count)
+	return entries, &paginationResult, nil
+}
+
+func (a *auditServiceImpl) FindAll(ctx context.Context, filter *repository.AuditFilter) (_ []*repository.AuditEntry, err error) {
+	ctx, span := startSpan(ctx, "AuditService.FindAll")
+	defer func() { endSpan(span, err) }()
+
+	entries, err := a.auditLogRepository.FindAll(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("DB error: %w", err)
+	}
+	return entries, nil
+}
+
+// Verify recomputes every hash from the first entry on, reading the log in
+// pages. Any edited, removed or reordered entry shows up as the first
+// mismatch. Entries from before the log was keyed are checked against their
+// bare SHA-256, but may only precede the keyed ones.
+func (a *auditServiceImpl) Verify(ctx context.Context) (_ *AuditVerification, err error) {
+	ctx, span := startSpan(ctx, "AuditService.Verify")
+	defer func() { endSpan(span, err) }()
+
+	var seq int64
+	prevHash := ""
+	keyed := false
+	for {
+		entries, err := a.auditLogRepository.FindAfter(ctx, seq, auditVerifyPageSize)
+		if err != nil {
+			return nil, fmt.Errorf("DB error: %w", err)
+		}
+
+		for _, entry := range entries {
+			seq++
+			var key []byte
+			if entry.Keyed() {
+				key = a.key
+				keyed = true
+			} else if keyed {
+				return &AuditVerification{Entries: int(seq), BrokenAtSeq: entry.Seq}, nil
+			}
+			if entry.Seq != seq || entry.PrevHash != prevHash || !hmac.Equal([]byte(entry.ComputeHash(key)), []byte(entry.Hash)) {
+				return &AuditVerification{Entries: int(seq), BrokenAtSeq: entry.Seq}, nil
+			}
+			prevHash = entry.Hash
+		}
+		if len(entries) < auditVerifyPageSize {
+			return &AuditVerification{Entries: int(seq), Valid: true}, nil
+		}
+	}
+}
+
+func NewAuditService(auditLogRepository repository.AuditLogRepository, key []byte) AuditService {
+	return &auditServiceImpl{auditLogRepository: auditLogRepository, key: key}
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"api/catshelter/internal/repository"
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestVerifyAuditLog(t *testing.T) {
+	ctx := context.Background()
+	key := []byte("audit test key")
+	pageSize := auditVerifyPageSize
+	auditVerifyPageSize = 2
+	t.Cleanup(func() { auditVerifyPageSize = pageSize })
+
+	// newLog appends five entries, the first legacy ones hashed without a
+	// key as before the log was keyed.
+	newLog := func(legacy int) *fakeAuditLogRepository {
+		repo := &fakeAuditLogRepository{}
+		for i := range 5 {
+			if i == legacy {
+				repo.key = key
+			}
+			if err := repo.Append(ctx, &repository.AuditEntry{Action: AuditCatCreated, TargetType: "cat", TargetId: fmt.Sprint(i)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return repo
+	}
+
+	tests := []struct {
+		name   string
+		legacy int
+		tamper func(entries []*repository.AuditEntry)
+		want   AuditVerification
+	}{
+		{"intact", 0, nil, AuditVerification{Entries: 5, Valid: true}},
+		{"legacy entries before keyed ones", 2, nil, AuditVerification{Entries: 5, Valid: true}},
+		{"edited entry", 0, func(entries []*repository.AuditEntry) {
+			entries[2].After = `{"name":"Forged"}`
+		}, AuditVerification{Entries: 3, BrokenAtSeq: 3}},
+		{"chain recomputed without the key", 0, func(entries []*repository.AuditEntry) {
+			entries[1].After = `{"name":"Forged"}`
+			for i, entry := range entries {
+				if i > 0 {
+					entry.PrevHash = entries[i-1].Hash
+				}
+				entry.Hash = entry.ComputeHash([]byte("guessed key"))
+			}
+		}, AuditVerification{Entries: 1, BrokenAtSeq: 1}},
+		{"chain recomputed as legacy", 0, func(entries []*repository.AuditEntry) {
+			entries[3].After = `{"name":"Forged"}`
+			for i := 3; i < len(entries); i++ {
+				entries[i].PrevHash = entries[i-1].Hash
+				entries[i].Hash = entries[i].ComputeHash(nil)
+			}
+		}, AuditVerification{Entries: 4, BrokenAtSeq: 4}},
+		{"missing entry", 0, func(entries []*repository.AuditEntry) {
+			entries[1] = entries[2]
+		}, AuditVerification{Entries: 2, BrokenAtSeq: 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newLog(tt.legacy)
+			if tt.tamper != nil {
+				tt.tamper(repo.entries)
+			}
+
+			verification, err := NewAuditService(repo, key).Verify(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *verification != tt.want {
+				t.Errorf("got %+v, want %+v", *verification, tt.want)
+			}
+		})
+	}
+
+	t.Run("reads in pages", func(t *testing.T) {
+		repo := newLog(0)
+		if _, err := NewAuditService(repo, key).Verify(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if repo.pages != 3 {
+			t.Errorf("read %d pages, want 3", repo.pages)
+		}
+	})
+}
@@ -2,59 +2,127 @@ package service
 
 import (
 	"api/catshelter/internal/domain"
+	"api/catshelter/internal/metrics"
 	"api/catshelter/internal/repository"
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
 type AuthService interface {
-	Register(ctx context.Context, login, password, name string) (*domain.User, error)
-	Login(ctx context.Context, login, password string) (*domain.User, error)
+	Register(ctx context.Context, login, password, name, email, phone string) (*domain.User, error)
+	Login(ctx context.Context, login, password, ip string) (*domain.User, error)
+	UnlockUser(ctx context.Context, userId string) error
 }
 
+var ErrInvalidCredentials = errors.New("incorrect login or password")
+
 type authServiceImpl struct {
-	userRepository repository.UserRepository
-	roleRepository repository.RoleRepository
+	userRepository          repository.UserRepository
+	roleRepository          repository.RoleRepository
+	securityEventRepository repository.SecurityEventRepository
+	contactService          ContactService
+	throttle                *loginThrottle
 }
 
-func (s *authServiceImpl) Login(ctx context.Context, login, password string) (*domain.User, error) {
+func (s *authServiceImpl) Login(ctx context.Context, login, password, ip string) (_ *domain.User, err error) {
+	ctx, span := startSpan(ctx, "AuthService.Login")
+	defer func() { endSpan(span, err) }()
+
+	if err := s.throttle.check(ctx, login, ip); err != nil {
+		if errors.Is(err, ErrTooManyLoginAttempts) {
+			recordSecurityEvent(ctx, s.securityEventRepository, &repository.SecurityEvent{Type: SecurityEventLoginThrottled, Login: login, Ip: ip})
+			metrics.Logins.WithLabelValues(metrics.LoginThrottled).Inc()
+			return nil, err
+		}
+		return nil, fmt.Errorf("db error: %w", err)
+	}
+
 	user, err := s.userRepository.FindByLoginWithRoles(ctx, login)
 	if err != nil {
 		if errors.Is(err, repository.ErrUserNotFound) {
-			return nil, fmt.Errorf("user with login: '%s' not found", login)
+			return nil, s.loginFailed(ctx, nil, login, ip, "unknown login")
 		}
-		return nil, fmt.Errorf("db error: %s", err.Error())
+		return nil, fmt.Errorf("db error: %w", err)
+	}
+	if user.ServiceAccount {
+		return nil, s.loginFailed(ctx, &user.Id, login, ip, "service account")
 	}
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
 	if err != nil {
-		return nil, fmt.Errorf("incorrect password")
+		return nil, s.loginFailed(ctx, &user.Id, login, ip, "incorrect password")
+	}
+	if err := checkActive(ctx, s.userRepository, user); err != nil {
+		recordSecurityEvent(ctx, s.securityEventRepository, &repository.SecurityEvent{Type: SecurityEventLoginFailed, UserId: &user.Id, Login: login, Ip: ip, Details: "account " + user.Status})
+		metrics.Logins.WithLabelValues(metrics.LoginInactive).Inc()
+		return nil, err
+	}
+
+	if err := s.throttle.reset(ctx, login); err != nil {
+		return nil, fmt.Errorf("db error: %w", err)
 	}
+	recordSecurityEvent(ctx, s.securityEventRepository, &repository.SecurityEvent{Type: SecurityEventLoginSucceeded, UserId: &user.Id, Login: login, Ip: ip})
+	metrics.Logins.WithLabelValues(metrics.LoginSucceeded).Inc()
 
 	return user, nil
 }
 
-func (s *authServiceImpl) Register(ctx context.Context, login, password, name string) (*domain.User, error) {
+func (s *authServiceImpl) loginFailed(ctx context.Context, userId *string, login, ip, reason string) error {
+	recordSecurityEvent(ctx, s.securityEventRepository, &repository.SecurityEvent{Type: SecurityEventLoginFailed, UserId: userId, Login: login, Ip: ip, Details: reason})
+	metrics.Logins.WithLabelValues(metrics.LoginFailed).Inc()
+
+	locked, err := s.throttle.registerFailure(ctx, login, ip)
+	if err != nil {
+		return fmt.Errorf("db error: %w", err)
+	}
+	if locked {
+		recordSecurityEvent(ctx, s.securityEventRepository, &repository.SecurityEvent{Type: SecurityEventAccountLocked, UserId: userId, Login: login, Ip: ip})
+	}
+	return ErrInvalidCredentials
+}
+
+func (s *authServiceImpl) UnlockUser(ctx context.Context, userId string) (err error) {
+	ctx, span := startSpan(ctx, "AuthService.UnlockUser")
+	defer func() { endSpan(span, err) }()
+
+	user, err := s.userRepository.FindById(ctx, userId)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return fmt.Errorf("%w: user with id '%s' not found", repository.ErrUserNotFound, userId)
+		}
+		return err
+	}
+
+	if err := s.throttle.reset(ctx, user.Login); err != nil {
+		return err
+	}
+	recordSecurityEvent(ctx, s.securityEventRepository, &repository.SecurityEvent{Type: SecurityEventAccountUnlocked, UserId: &user.Id, Login: user.Login})
+	return nil
+}
+
+func (s *authServiceImpl) Register(ctx context.Context, login, password, name, email, phone string) (_ *domain.User, err error) {
+	ctx, span := startSpan(ctx, "AuthService.Register")
+	defer func() { endSpan(span, err) }()
+
 	user, err := s.userRepository.FindByLoginWithRoles(ctx, login)
 	if err != nil {
 		if !errors.Is(err, repository.ErrUserNotFound) {
-			return nil, fmt.Errorf("db error: %s", err.Error())
+			return nil, fmt.Errorf("db error: %w", err)
 		}
 	}
 	if user != nil {
-		return user, fmt.Errorf("user with login '%s' already exists", login)
+		return nil, fmt.Errorf("%w: '%s'", ErrLoginAlreadyUsed, login)
 	}
 
 	user, err = domain.NewUser(login, password, name)
 	if err != nil {
 		return nil, err
 	}
-
-	err = s.userRepository.Save(ctx, user)
-	if err != nil {
-		return nil, fmt.Errorf("db error: %s", err.Error())
+	if err := applyContacts(ctx, s.userRepository, user, email, phone); err != nil {
+		return nil, err
 	}
 
 	role, err := s.roleRepository.FindByName(ctx, "user")
@@ -62,7 +130,7 @@ func (s *authServiceImpl) Register(ctx context.Context, login, password, name st
 		if errors.Is(err, repository.ErrRoleNotFound) {
 			return nil, errors.New("role 'user' not found")
 		}
-		return nil, fmt.Errorf("db error: %s", err.Error())
+		return nil, fmt.Errorf("db error: %w", err)
 	}
 
 	err = user.AddRole(role)
@@ -72,11 +140,31 @@ func (s *authServiceImpl) Register(ctx context.Context, login, password, name st
 
 	err = s.userRepository.Save(ctx, user)
 	if err != nil {
-		return nil, fmt.Errorf("db error: %s", err.Error())
+		if errors.Is(err, repository.ErrUserConflict) {
+			return nil, takenField(ctx, s.userRepository, user)
+		}
+		return nil, fmt.Errorf("db error: %w", err)
+	}
+	metrics.Registrations.WithLabelValues(metrics.RegistrationPassword).Inc()
+
+	if user.Email != nil {
+		if err := s.contactService.SendVerification(ctx, user.Id); err != nil {
+			slog.ErrorContext(ctx, "failed to send verification mail", "target_user_id", user.Id, "error", err)
+		}
 	}
 	return user, nil
 }
 
-func NewAuthService(userRepository repository.UserRepository, roleRepository repository.RoleRepository) AuthService {
-	return &authServiceImpl{userRepository: userRepository, roleRepository: roleRepository}
+func NewAuthService(userRepository repository.UserRepository, roleRepository repository.RoleRepository, loginAttemptRepository repository.LoginAttemptRepository, securityEventRepository repository.SecurityEventRepository, contactService ContactService) AuthService {
+	return &authServiceImpl{
+		userRepository:          userRepository,
+		roleRepository:          roleRepository,
+		securityEventRepository: securityEventRepository,
+		contactService:          contactService,
+		throttle: &loginThrottle{
+			loginAttemptRepository: loginAttemptRepository,
+			accountPolicy:          DefaultAccountLockoutPolicy,
+			ipPolicy:               DefaultIpLockoutPolicy,
+		},
+	}
 }
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"api/catshelter/internal/domain"
+	"api/catshelter/internal/repository"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// racingUserRepository misses every lookup until a write conflicts, like the
+// checks of a request racing another one that takes the same fields.
+type racingUserRepository struct {
+	*fakeUserRepository
+	conflicted bool
+}
+
+func (r *racingUserRepository) Save(ctx context.Context, user *domain.User) error {
+	err := r.fakeUserRepository.Save(ctx, user)
+	if errors.Is(err, repository.ErrUserConflict) {
+		r.conflicted = true
+	}
+	return err
+}
+
+func (r *racingUserRepository) lookup(find func() (*domain.User, error)) (*domain.User, error) {
+	if !r.conflicted {
+		return nil, repository.ErrUserNotFound
+	}
+	return find()
+}
+
+func (r *racingUserRepository) FindByLogin(ctx context.Context, login string) (*domain.User, error) {
+	return r.lookup(func() (*domain.User, error) { return r.fakeUserRepository.FindByLogin(ctx, login) })
+}
+
+func (r *racingUserRepository) FindByLoginWithRoles(ctx context.Context, login string) (*domain.User, error) {
+	return r.FindByLogin(ctx, login)
+}
+
+func (r *racingUserRepository) FindByEmail(ctx context.Context, email string) (*domain.User, error) {
+	return r.lookup(func() (*domain.User, error) { return r.fakeUserRepository.FindByEmail(ctx, email) })
+}
+
+func (r *racingUserRepository) FindByPhone(ctx context.Context, phone string) (*domain.User, error) {
+	return r.lookup(func() (*domain.User, error) { return r.fakeUserRepository.FindByPhone(ctx, phone) })
+}
+
+func TestRegisterReportsFieldsTakenConcurrently(t *testing.T) {
+	email, phone := "murka@example.com", "+14155552671"
+	existing := &domain.User{BaseModel: domain.BaseModel{Id: "user-1"}, Login: "murka_cat", Email: &email, Phone: &phone}
+	roles := &fakeRoleRepository{roles: map[string]*domain.Role{"user": {BaseModel: domain.BaseModel{Id: "role-user"}, Name: "user"}}}
+
+	tests := []struct {
+		name         string
+		login, email string
+		phone        string
+		want         error
+	}{
+		{"login", "murka_cat", "", "", ErrLoginAlreadyUsed},
+		{"email", "barsik_cat", "Murka@example.com", "", ErrEmailAlreadyUsed},
+		{"phone", "barsik_cat", "", "+1 415 555 2671", ErrPhoneAlreadyUsed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := &racingUserRepository{fakeUserRepository: newFakeUserRepository(existing)}
+			service := NewAuthService(users, roles, repository.NewInMemoryLoginAttemptRepository(), &fakeSecurityEventRepository{}, nil)
+
+			_, err := service.Register(context.Background(), tt.login, "password", "Barsik", tt.email, tt.phone)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Register = %v, want %v", err, tt.want)
+			}
+			if len(users.users) != 1 {
+				t.Errorf("%d users stored, want only the existing one", len(users.users))
+			}
+		})
+	}
+}
+
+func TestLoginStoresLiftedSuspension(t *testing.T) {
+	user, err := domain.NewUser("murka_cat", "password", "Murka")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ended := time.Now().Add(-time.Minute)
+	user.Status, user.SuspendedReason, user.SuspendedUntil = domain.UserStatusSuspended, "cooling off", &ended
+	users := newFakeUserRepository(user)
+	service := NewAuthService(users, &fakeRoleRepository{}, repository.NewInMemoryLoginAttemptRepository(), &fakeSecurityEventRepository{}, nil)
+
+	if _, err := service.Login(context.Background(), "murka_cat", "password", "127.0.0.1"); err != nil {
+		t.Fatalf("Login = %v, want the run-out suspension lifted", err)
+	}
+	if stored := users.users[user.Id]; stored.Status != domain.UserStatusActive || stored.SuspendedUntil != nil {
+		t.Errorf("stored status %s until %v, want the account active", stored.Status, stored.SuspendedUntil)
+	}
+}
+
+// staleUserRepository hands out the user as they were before a write that
+// other requests made in the meantime.
+type staleUserRepository struct {
+	*fakeUserRepository
+	stale *domain.User
+}
+
+func (r *staleUserRepository) FindByLoginWithRoles(ctx context.Context, login string) (*domain.User, error) {
+	copied := *r.stale
+	return &copied, nil
+}
+
+func TestLoginKeepsBanWrittenAfterRead(t *testing.T) {
+	user, err := domain.NewUser("murka_cat", "password", "Murka")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ended := time.Now().Add(-time.Minute)
+	stale := *user
+	stale.Status, stale.SuspendedReason, stale.SuspendedUntil = domain.UserStatusSuspended, "cooling off", &ended
+	if err := user.Ban("spam"); err != nil {
+		t.Fatal(err)
+	}
+	users := &staleUserRepository{fakeUserRepository: newFakeUserRepository(user), stale: &stale}
+	service := NewAuthService(users, &fakeRoleRepository{}, repository.NewInMemoryLoginAttemptRepository(), &fakeSecurityEventRepository{}, nil)
+
+	if _, err := service.Login(context.Background(), "murka_cat", "password", "127.0.0.1"); !errors.Is(err, domain.ErrAccountDisabled) {
+		t.Fatalf("Login = %v, want the ban to hold", err)
+	}
+	if stored := users.users[user.Id]; stored.Status != domain.UserStatusBanned {
+		t.Errorf("stored status %s, want banned", stored.Status)
+	}
+}
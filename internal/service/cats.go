@@ -3,43 +3,79 @@ package service
 import (
 	"api/catshelter/internal/domain"
 	"api/catshelter/internal/handler/dto"
+	"api/catshelter/internal/metrics"
 	"api/catshelter/internal/repository"
 	"context"
+	"errors"
 	"fmt"
 )
 
 type CatService interface {
 	FindLonelyCats(ctx context.Context, page, pageSize int) ([]*domain.Cat, *dto.PaginationResult, error)
 	AddCat(ctx context.Context, name string, age int) error
+	FindById(ctx context.Context, id string) (*domain.Cat, error)
 }
 
 type catServiceImpl struct {
-	catRepository repository.CatRepository
+	catRepository      repository.CatRepository
+	transactor         repository.Transactor
+	auditLogRepository repository.AuditLogRepository
 }
 
-func (c *catServiceImpl) AddCat(ctx context.Context, name string, age int) error {
+func (c *catServiceImpl) AddCat(ctx context.Context, name string, age int) (err error) {
+	ctx, span := startSpan(ctx, "CatService.AddCat")
+	defer func() { endSpan(span, err) }()
+
 	newCat, err := domain.NewCat(name, age)
 	if err != nil {
 		return err
 	}
-	err = c.catRepository.Save(ctx, newCat)
+	err = withAudit(ctx, c.transactor, c.auditLogRepository, func(ctx context.Context) (*AuditChange, error) {
+		if err := c.catRepository.Save(ctx, newCat); err != nil {
+			return nil, err
+		}
+		return &AuditChange{
+			Action:     AuditCatCreated,
+			TargetType: "cat",
+			TargetId:   newCat.Id,
+			After:      map[string]any{"name": newCat.Name, "age": newCat.Age},
+		}, nil
+	})
 	if err != nil {
-		return fmt.Errorf("DB error: %s", err.Error())
+		return fmt.Errorf("DB error: %w", err)
 	}
+	metrics.CatsAdded.Inc()
 
 	return nil
 }
 
-func (c *catServiceImpl) FindLonelyCats(ctx context.Context, page, pageSize int) ([]*domain.Cat, *dto.PaginationResult, error) {
+func (c *catServiceImpl) FindLonelyCats(ctx context.Context, page, pageSize int) (_ []*domain.Cat, _ *dto.PaginationResult, err error) {
+	ctx, span := startSpan(ctx, "CatService.FindLonelyCats")
+	defer func() { endSpan(span, err) }()
+
 	lonelyCats, count, err := c.catRepository.FindWithoutUserId(ctx, page, pageSize)
 	if err != nil {
-		return nil, nil, fmt.Errorf("DB error: %s", err.Error())
+		return nil, nil, fmt.Errorf("DB error: %w", err)
 	}
 
 	paginationResult := repository.CalculatePaginationResult(page, pageSize, count)
 	return lonelyCats, &paginationResult, nil
 }
 
-func NewCatService(catRepository repository.CatRepository) CatService {
-	return &catServiceImpl{catRepository: catRepository}
+func (c *catServiceImpl) FindById(ctx context.Context, id string) (_ *domain.Cat, err error) {
+	ctx, span := startSpan(ctx, "CatService.FindById")
+	defer func() { endSpan(span, err) }()
+
+	cat, err := c.catRepository.FindById(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrCatNotFound) {
+			return nil, fmt.Errorf("%w: cat with id '%s' not found", repository.ErrCatNotFound, id)
+		}
+		return nil, fmt.Errorf("DB error: %w", err)
+	}
+	return cat, nil
+}
+
+func NewCatService(catRepository repository.CatRepository, transactor repository.Transactor, auditLogRepository repository.AuditLogRepository) CatService {
+	return &catServiceImpl{catRepository: catRepository, transactor: transactor, auditLogRepository: auditLogRepository}
 }
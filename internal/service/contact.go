@@ -0,0 +1,170 @@
+package service
+
+import (
+	"api/catshelter/internal/domain"
+	"api/catshelter/internal/mail"
+	"api/catshelter/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/go-chi/jwtauth/v5"
+)
+
+const emailVerificationTTL = 48 * time.Hour
+
+var (
+	ErrEmailAlreadyUsed             = errors.New("email address is already used by another account")
+	ErrPhoneAlreadyUsed             = errors.New("phone number is already used by another account")
+	ErrInvalidEmailVerificationLink = errors.New("invalid or expired email verification link")
+	ErrNoEmail                      = errors.New("user has no email address")
+)
+
+type ContactService interface {
+	SendVerification(ctx context.Context, userId string) error
+	VerifyEmail(ctx context.Context, token string) error
+}
+
+type contactServiceImpl struct {
+	auth           *jwtauth.JWTAuth
+	userRepository repository.UserRepository
+	mailer         mail.Mailer
+	verifyUrl      string
+}
+
+func (c *contactServiceImpl) SendVerification(ctx context.Context, userId string) (err error) {
+	ctx, span := startSpan(ctx, "ContactService.SendVerification")
+	defer func() { endSpan(span, err) }()
+
+	user, err := c.userRepository.FindById(ctx, userId)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return fmt.Errorf("%w: user with id '%s' not found", repository.ErrUserNotFound, userId)
+		}
+		return err
+	}
+	if user.Email == nil {
+		return ErrNoEmail
+	}
+	if user.IsEmailVerified() {
+		return nil
+	}
+	return c.sendVerification(ctx, user)
+}
+
+func (c *contactServiceImpl) VerifyEmail(ctx context.Context, token string) (err error) {
+	ctx, span := startSpan(ctx, "ContactService.VerifyEmail")
+	defer func() { endSpan(span, err) }()
+
+	parsed, err := jwtauth.VerifyToken(c.auth, token)
+	if err != nil {
+		return ErrInvalidEmailVerificationLink
+	}
+	userId, _ := parsed.PrivateClaims()["user_id"].(string)
+	email, _ := parsed.PrivateClaims()["email"].(string)
+	if userId == "" || email == "" {
+		return ErrInvalidEmailVerificationLink
+	}
+
+	user, err := c.userRepository.FindById(ctx, userId)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return ErrInvalidEmailVerificationLink
+		}
+		return err
+	}
+	if err := user.VerifyEmail(email); err != nil {
+		return ErrInvalidEmailVerificationLink
+	}
+	// The address is part of the profile, so this must not race an edit
+	// that changes it.
+	if err := c.userRepository.UpdateProfile(ctx, user, user.Version); err != nil {
+		if errors.Is(err, repository.ErrVersionConflict) {
+			return err
+		}
+		return fmt.Errorf("db error: %w", err)
+	}
+	return nil
+}
+
+// sendVerification mails a signed link bound to the current address. The
+// link is stateless, so nothing has to be stored until it is used.
+func (c *contactServiceImpl) sendVerification(ctx context.Context, user *domain.User) error {
+	_, token, err := c.auth.Encode(map[string]interface{}{
+		"user_id": user.Id,
+		"email":   *user.Email,
+		"exp":     time.Now().Add(emailVerificationTTL).Unix(),
+	})
+	if err != nil {
+		return err
+	}
+
+	link := c.verifyUrl + "?token=" + url.QueryEscape(token)
+	err = c.mailer.Send(ctx, &mail.Message{
+		To:      *user.Email,
+		Subject: "Confirm your CatShelter email address",
+		Body: fmt.Sprintf("Hello %s,\n\nPlease confirm your email address by opening the link below. It expires in %d hours.\n\n%s\n",
+			user.Name, int(emailVerificationTTL.Hours()), link),
+	})
+	if err != nil {
+		return fmt.Errorf("sending verification mail: %w", err)
+	}
+	return nil
+}
+
+// applyContacts sets email and phone on user after checking that no other
+// account already uses them.
+func applyContacts(ctx context.Context, userRepository repository.UserRepository, user *domain.User, email, phone string) error {
+	if err := user.SetEmail(email); err != nil {
+		return err
+	}
+	if err := user.SetPhone(phone); err != nil {
+		return err
+	}
+
+	if user.Email != nil {
+		other, err := userRepository.FindByEmail(ctx, *user.Email)
+		if err != nil && !errors.Is(err, repository.ErrUserNotFound) {
+			return fmt.Errorf("db error: %w", err)
+		}
+		if other != nil && other.Id != user.Id {
+			return ErrEmailAlreadyUsed
+		}
+	}
+	if user.Phone != nil {
+		other, err := userRepository.FindByPhone(ctx, *user.Phone)
+		if err != nil && !errors.Is(err, repository.ErrUserNotFound) {
+			return fmt.Errorf("db error: %w", err)
+		}
+		if other != nil && other.Id != user.Id {
+			return ErrPhoneAlreadyUsed
+		}
+	}
+	return nil
+}
+
+// takenField tells which unique field of user another account has, after
+// storing user failed with repository.ErrUserConflict. The lookups before a
+// write only give early errors; the unique indexes settle concurrent writes.
+func takenField(ctx context.Context, userRepository repository.UserRepository, user *domain.User) error {
+	if other, err := userRepository.FindByLogin(ctx, user.Login); err == nil && other.Id != user.Id {
+		return fmt.Errorf("%w: '%s'", ErrLoginAlreadyUsed, user.Login)
+	}
+	if user.Email != nil {
+		if other, err := userRepository.FindByEmail(ctx, *user.Email); err == nil && other.Id != user.Id {
+			return ErrEmailAlreadyUsed
+		}
+	}
+	if user.Phone != nil {
+		if other, err := userRepository.FindByPhone(ctx, *user.Phone); err == nil && other.Id != user.Id {
+			return ErrPhoneAlreadyUsed
+		}
+	}
+	return fmt.Errorf("db error: %w", repository.ErrUserConflict)
+}
+
+func NewContactService(auth *jwtauth.JWTAuth, userRepository repository.UserRepository, mailer mail.Mailer, verifyUrl string) ContactService {
+	return &contactServiceImpl{auth: auth, userRepository: userRepository, mailer: mailer, verifyUrl: verifyUrl}
+}
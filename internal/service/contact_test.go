@@ -0,0 +1,36 @@
+package service
+
+import (
+	"api/catshelter/internal/domain"
+	"api/catshelter/internal/mail"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/jwtauth/v5"
+)
+
+func TestSendVerificationKeepsTokenOutOfLog(t *testing.T) {
+	log := captureLog(t)
+	user, err := domain.NewUser("murka_cat", "password", "Murka")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := user.SetEmail("murka@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	mailer := &recordingMailer{next: mail.NewLogMailer("no-reply@example.com")}
+	service := NewContactService(jwtauth.New("HS256", []byte("contact test secret"), nil), newFakeUserRepository(user),
+		mailer, "https://catshelter.example/api/user/verify-email")
+
+	if err := service.SendVerification(context.Background(), user.Id); err != nil {
+		t.Fatal(err)
+	}
+	token := mailer.linkToken(t)
+	if !strings.Contains(log.String(), "mail sent to log") {
+		t.Errorf("the mail was not logged: %s", log)
+	}
+	if strings.Contains(log.String(), token) {
+		t.Errorf("the verification token reached the log: %s", log)
+	}
+}
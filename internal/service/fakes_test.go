@@ -0,0 +1,383 @@
+package service
+
+import (
+	"api/catshelter/internal/domain"
+	"api/catshelter/internal/logging"
+	"api/catshelter/internal/mail"
+	"api/catshelter/internal/repository"
+	"bytes"
+	"context"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// The fakes keep their records in memory. Methods a test does not need are
+// left to the embedded nil interface and panic when called.
+
+type fakeUserRepository struct {
+	repository.UserRepository
+	mu    sync.Mutex
+	users map[string]*domain.User
+}
+
+func newFakeUserRepository(users ...*domain.User) *fakeUserRepository {
+	r := &fakeUserRepository{users: make(map[string]*domain.User)}
+	for _, user := range users {
+		r.users[user.Id] = user
+	}
+	return r
+}
+
+// Save enforces the unique indexes of the users table.
+func (r *fakeUserRepository) Save(ctx context.Context, user *domain.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, other := range r.users {
+		if other.Id != user.Id && (other.Login == user.Login ||
+			other.Email != nil && user.Email != nil && *other.Email == *user.Email ||
+			other.Phone != nil && user.Phone != nil && *other.Phone == *user.Phone) {
+			return repository.ErrUserConflict
+		}
+	}
+	copied := *user
+	r.users[user.Id] = &copied
+	return nil
+}
+
+// Update stores the whole user; the tests do not write to a user concurrently.
+func (r *fakeUserRepository) Update(ctx context.Context, user *domain.User, columns ...string) error {
+	return r.Save(ctx, user)
+}
+
+func (r *fakeUserRepository) LiftEndedSuspension(ctx context.Context, id string, now time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.users[id]
+	if !ok || user.Status != domain.UserStatusSuspended || user.SuspendedUntil == nil || user.SuspendedUntil.After(now) {
+		return false, nil
+	}
+	user.Status, user.SuspendedReason, user.SuspendedUntil = domain.UserStatusActive, "", nil
+	return true, nil
+}
+
+func (r *fakeUserRepository) find(match func(*domain.User) bool) (*domain.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, user := range r.users {
+		if match(user) {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, repository.ErrUserNotFound
+}
+
+func (r *fakeUserRepository) FindById(ctx context.Context, id string) (*domain.User, error) {
+	return r.find(func(u *domain.User) bool { return u.Id == id })
+}
+
+func (r *fakeUserRepository) FindByIdWithRoles(ctx context.Context, id string) (*domain.User, error) {
+	return r.FindById(ctx, id)
+}
+
+func (r *fakeUserRepository) FindByLogin(ctx context.Context, login string) (*domain.User, error) {
+	return r.find(func(u *domain.User) bool { return strings.EqualFold(u.Login, login) })
+}
+
+func (r *fakeUserRepository) FindByEmail(ctx context.Context, email string) (*domain.User, error) {
+	return r.find(func(u *domain.User) bool { return u.Email != nil && strings.EqualFold(*u.Email, email) })
+}
+
+func (r *fakeUserRepository) FindByPhone(ctx context.Context, phone string) (*domain.User, error) {
+	return r.find(func(u *domain.User) bool { return u.Phone != nil && *u.Phone == phone })
+}
+
+func (r *fakeUserRepository) FindByLoginWithRoles(ctx context.Context, login string) (*domain.User, error) {
+	return r.FindByLogin(ctx, login)
+}
+
+type fakeSecurityEventRepository struct {
+	repository.SecurityEventRepository
+	mu     sync.Mutex
+	events []*repository.SecurityEvent
+}
+
+func (r *fakeSecurityEventRepository) Save(ctx context.Context, event *repository.SecurityEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+	return nil
+}
+
+type fakeRecoveryCodeRepository struct {
+	repository.MfaRecoveryCodeRepository
+	unused map[string]bool
+}
+
+func (r *fakeRecoveryCodeRepository) Use(ctx context.Context, userId, codeHash string) error {
+	if !r.unused[codeHash] {
+		return repository.ErrRecoveryCodeNotFound
+	}
+	delete(r.unused, codeHash)
+	return nil
+}
+
+func (r *fakeRecoveryCodeRepository) DeleteByUserId(ctx context.Context, userId string) error {
+	clear(r.unused)
+	return nil
+}
+
+type fakeApiKeyRepository struct {
+	repository.ApiKeyRepository
+	keys []*domain.ApiKey
+}
+
+func (r *fakeApiKeyRepository) ClearMfaVerified(ctx context.Context, userId string) error {
+	for _, key := range r.keys {
+		if key.UserId == userId {
+			key.MfaVerified = false
+		}
+	}
+	return nil
+}
+
+type fakeRoleRepository struct {
+	repository.RoleRepository
+	roles map[string]*domain.Role
+}
+
+func (r *fakeRoleRepository) FindByName(ctx context.Context, name string) (*domain.Role, error) {
+	role, ok := r.roles[name]
+	if !ok {
+		return nil, repository.ErrRoleNotFound
+	}
+	return role, nil
+}
+
+type fakeExternalIdentityRepository struct {
+	repository.ExternalIdentityRepository
+	mu         sync.Mutex
+	identities []*repository.ExternalIdentity
+}
+
+func (r *fakeExternalIdentityRepository) Save(ctx context.Context, identity *repository.ExternalIdentity) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.identities = append(r.identities, identity)
+	return nil
+}
+
+func (r *fakeExternalIdentityRepository) FindByProviderSubject(ctx context.Context, provider, subject string) (*repository.ExternalIdentity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, identity := range r.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return identity, nil
+		}
+	}
+	return nil, repository.ErrExternalIdentityNotFound
+}
+
+type fakePasswordResetTokenRepository struct {
+	repository.PasswordResetTokenRepository
+	mu     sync.Mutex
+	tokens map[string]*repository.PasswordResetToken
+}
+
+func (r *fakePasswordResetTokenRepository) Save(ctx context.Context, token *repository.PasswordResetToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tokens[token.TokenHash] = token
+	return nil
+}
+
+func (r *fakePasswordResetTokenRepository) DeleteByUserId(ctx context.Context, userId string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for hash, token := range r.tokens {
+		if token.UserId == userId {
+			delete(r.tokens, hash)
+		}
+	}
+	return nil
+}
+
+func (r *fakePasswordResetTokenRepository) Consume(ctx context.Context, tokenHash string) (*repository.PasswordResetToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	token, ok := r.tokens[tokenHash]
+	if !ok || token.UsedAt != nil || !token.ExpiresAt.After(time.Now()) {
+		return nil, repository.ErrPasswordResetTokenNotFound
+	}
+	now := time.Now()
+	token.UsedAt = &now
+	return token, nil
+}
+
+// fakeRefreshTokenRepository keeps sessions by id and rotated tokens with
+// the session they belonged to.
+type fakeRefreshTokenRepository struct {
+	repository.RefreshTokenRepository
+	mu       sync.Mutex
+	sessions map[string]*repository.RefreshToken
+	rotated  map[string]string
+}
+
+func (r *fakeRefreshTokenRepository) Save(ctx context.Context, token *repository.RefreshToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.sessions == nil {
+		r.sessions, r.rotated = make(map[string]*repository.RefreshToken), make(map[string]string)
+	}
+	if token.Id == "" {
+		token.Id = uuid.NewString()
+	}
+	copied := *token
+	r.sessions[token.Id] = &copied
+	return nil
+}
+
+func (r *fakeRefreshTokenRepository) Rotate(ctx context.Context, token *repository.RefreshToken, previousToken string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	session, ok := r.sessions[token.Id]
+	if !ok || session.Token != previousToken {
+		return repository.ErrRefreshTokenNotFound
+	}
+	session.Token, session.ExpiresAt = token.Token, token.ExpiresAt
+	r.rotated[previousToken] = token.Id
+	return nil
+}
+
+func (r *fakeRefreshTokenRepository) FindByToken(ctx context.Context, token string) (*repository.RefreshToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, session := range r.sessions {
+		if session.Token == token {
+			copied := *session
+			return &copied, nil
+		}
+	}
+	return nil, repository.ErrRefreshTokenNotFound
+}
+
+func (r *fakeRefreshTokenRepository) FindRotated(ctx context.Context, token string) (*repository.RotatedRefreshToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sessionId, ok := r.rotated[token]
+	if !ok {
+		return nil, repository.ErrRefreshTokenNotFound
+	}
+	return &repository.RotatedRefreshToken{SessionId: sessionId}, nil
+}
+
+func (r *fakeRefreshTokenRepository) DeleteById(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.sessions[id]; !ok {
+		return repository.ErrRefreshTokenNotFound
+	}
+	delete(r.sessions, id)
+	return nil
+}
+
+func (r *fakeRefreshTokenRepository) DeleteByUserId(ctx context.Context, userId string) error {
+	return nil
+}
+
+func (r *fakeRefreshTokenRepository) DeleteByUserIdExcept(ctx context.Context, userId, token string) error {
+	return nil
+}
+
+// fakeAuditLogRepository chains entries like the real one and counts the
+// pages read.
+type fakeAuditLogRepository struct {
+	repository.AuditLogRepository
+	key     []byte
+	entries []*repository.AuditEntry
+	pages   int
+}
+
+func (r *fakeAuditLogRepository) Append(ctx context.Context, entry *repository.AuditEntry) error {
+	entry.Id = uuid.NewString()
+	entry.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	entry.Seq = int64(len(r.entries) + 1)
+	if len(r.entries) > 0 {
+		entry.PrevHash = r.entries[len(r.entries)-1].Hash
+	}
+	entry.Hash = entry.ComputeHash(r.key)
+	r.entries = append(r.entries, entry)
+	return nil
+}
+
+func (r *fakeAuditLogRepository) FindAfter(ctx context.Context, afterSeq int64, limit int) ([]*repository.AuditEntry, error) {
+	r.pages++
+	var entries []*repository.AuditEntry
+	for _, entry := range r.entries {
+		if entry.Seq > afterSeq && len(entries) < limit {
+			copied := *entry
+			entries = append(entries, &copied)
+		}
+	}
+	return entries, nil
+}
+
+// fakeTransactor runs fn without a transaction; the fakes cannot roll back.
+type fakeTransactor struct{}
+
+func (fakeTransactor) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+// recordingMailer keeps the messages it passes on to next.
+type recordingMailer struct {
+	next     mail.Mailer
+	mu       sync.Mutex
+	messages []*mail.Message
+}
+
+func (m *recordingMailer) Send(ctx context.Context, message *mail.Message) error {
+	m.mu.Lock()
+	m.messages = append(m.messages, message)
+	m.mu.Unlock()
+	return m.next.Send(ctx, message)
+}
+
+// linkToken returns the token of the link in the only message sent.
+func (m *recordingMailer) linkToken(t *testing.T) string {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.messages) != 1 {
+		t.Fatalf("%d messages sent, want 1", len(m.messages))
+	}
+	_, query, ok := strings.Cut(m.messages[0].Body, "?token=")
+	if !ok {
+		t.Fatalf("no link in the message: %s", m.messages[0].Body)
+	}
+	token, err := url.QueryUnescape(strings.Fields(query)[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// captureLog sends the default logger to a buffer for the rest of the test.
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, logging.Config{Level: "debug"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := slog.Default()
+	slog.SetDefault(logger)
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
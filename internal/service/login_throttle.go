@@ -0,0 +1,159 @@
+package service
+
+import (
+	"api/catshelter/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var ErrTooManyLoginAttempts = errors.New("too many login attempts")
+
+// LoginLockedError is returned while an account or IP address is locked out.
+type LoginLockedError struct {
+	Until time.Time
+}
+
+func (e *LoginLockedError) Error() string {
+	return fmt.Sprintf("%s: try again after %s", ErrTooManyLoginAttempts, e.Until.Format(time.RFC3339))
+}
+
+func (e *LoginLockedError) Unwrap() error {
+	return ErrTooManyLoginAttempts
+}
+
+// LockoutPolicy describes how failures for one kind of key are punished.
+// After BackoffAfter failures every further failure blocks the key for
+// BaseDelay doubled per failure, capped at MaxDelay. After MaxFailures the key
+// is locked for LockoutDuration. Failures older than Window are forgotten.
+type LockoutPolicy struct {
+	BackoffAfter    int
+	MaxFailures     int
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	LockoutDuration time.Duration
+	Window          time.Duration
+}
+
+var (
+	DefaultAccountLockoutPolicy = LockoutPolicy{
+		BackoffAfter:    3,
+		MaxFailures:     10,
+		BaseDelay:       time.Second,
+		MaxDelay:        5 * time.Minute,
+		LockoutDuration: 30 * time.Minute,
+		Window:          time.Hour,
+	}
+	// DefaultMfaLockoutPolicy throttles second factor guesses per user, on
+	// top of the failures allowed per pending token, so a six-digit code
+	// cannot be guessed by logging in again and again.
+	DefaultMfaLockoutPolicy = LockoutPolicy{
+		BackoffAfter:    3,
+		MaxFailures:     10,
+		BaseDelay:       time.Second,
+		MaxDelay:        5 * time.Minute,
+		LockoutDuration: 30 * time.Minute,
+		Window:          time.Hour,
+	}
+	DefaultIpLockoutPolicy = LockoutPolicy{
+		BackoffAfter:    10,
+		MaxFailures:     50,
+		BaseDelay:       time.Second,
+		MaxDelay:        5 * time.Minute,
+		LockoutDuration: time.Hour,
+		Window:          time.Hour,
+	}
+)
+
+func (p LockoutPolicy) lockDuration(failures int) (time.Duration, bool) {
+	if failures >= p.MaxFailures {
+		return p.LockoutDuration, true
+	}
+	if failures < p.BackoffAfter {
+		return 0, false
+	}
+	delay := p.BaseDelay
+	for i := p.BackoffAfter; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, p.MaxDelay), false
+}
+
+type loginThrottle struct {
+	loginAttemptRepository repository.LoginAttemptRepository
+	accountPolicy          LockoutPolicy
+	ipPolicy               LockoutPolicy
+}
+
+func accountAttemptKey(login string) string {
+	return "account:" + strings.ToLower(login)
+}
+
+func ipAttemptKey(ip string) string {
+	return "ip:" + ip
+}
+
+func mfaAttemptKey(userId string) string {
+	return "mfa:" + userId
+}
+
+func mfaTokenAttemptKey(tokenId string) string {
+	return "mfa-token:" + tokenId
+}
+
+func (t *loginThrottle) check(ctx context.Context, login, ip string) error {
+	for _, key := range []string{accountAttemptKey(login), ipAttemptKey(ip)} {
+		if err := t.checkKey(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *loginThrottle) checkKey(ctx context.Context, key string) error {
+	attempt, err := t.loginAttemptRepository.FindByKey(ctx, key)
+	if err != nil {
+		if errors.Is(err, repository.ErrLoginAttemptNotFound) {
+			return nil
+		}
+		return err
+	}
+	if attempt.LockedUntil != nil && attempt.LockedUntil.After(time.Now()) {
+		return &LoginLockedError{Until: *attempt.LockedUntil}
+	}
+	return nil
+}
+
+// registerFailure counts a failed attempt for both the account and the IP and
+// reports whether the account has just been locked out.
+func (t *loginThrottle) registerFailure(ctx context.Context, login, ip string) (bool, error) {
+	accountLocked, err := t.registerKeyFailure(ctx, accountAttemptKey(login), t.accountPolicy)
+	if err != nil {
+		return false, err
+	}
+	if _, err := t.registerKeyFailure(ctx, ipAttemptKey(ip), t.ipPolicy); err != nil {
+		return false, err
+	}
+	return accountLocked, nil
+}
+
+func (t *loginThrottle) registerKeyFailure(ctx context.Context, key string, policy LockoutPolicy) (bool, error) {
+	attempt, err := t.loginAttemptRepository.RegisterFailure(ctx, key, policy.Window)
+	if err != nil {
+		return false, err
+	}
+	delay, locked := policy.lockDuration(attempt.Failures)
+	if delay == 0 {
+		return false, nil
+	}
+	if err := t.loginAttemptRepository.LockUntil(ctx, key, time.Now().Add(delay)); err != nil {
+		return false, err
+	}
+	return locked, nil
+}
+
+func (t *loginThrottle) reset(ctx context.Context, login string) error {
+	return t.loginAttemptRepository.DeleteByKey(ctx, accountAttemptKey(login))
+}
@@ -0,0 +1,413 @@
+package service
+
+import (
+	"api/catshelter/internal/domain"
+	"api/catshelter/internal/repository"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/google/uuid"
+	"github.com/skip2/go-qrcode"
+)
+
+// MfaMandatoryRoles lists roles whose members may not turn two-factor
+// authentication off and must pass it to use role protected endpoints.
+var MfaMandatoryRoles = []string{"admin"}
+
+// totpColumns are the columns enrolling, enabling and disabling TOTP write.
+var totpColumns = []string{"totp_secret", "totp_enabled", "totp_last_step"}
+
+const (
+	mfaIssuer            = "CatShelter"
+	mfaPendingTokenTTL   = 5 * time.Minute
+	mfaRecoveryCodeCount = 10
+	// mfaPendingTokenMaxFailures wrong codes invalidate a pending token; the
+	// user has to enter the password again.
+	mfaPendingTokenMaxFailures = 5
+)
+
+var (
+	ErrInvalidMfaCode      = errors.New("invalid two-factor authentication code")
+	ErrInvalidMfaToken     = errors.New("invalid or expired mfa token")
+	ErrMfaMandatory        = errors.New("two-factor authentication is mandatory for this account")
+	ErrIncorrectPassword   = errors.New("incorrect password")
+	ErrMfaCodeNotSpecified = errors.New("either code or recovery code must be specified")
+)
+
+type MfaService interface {
+	Enroll(ctx context.Context, userId string) (*MfaEnrollment, error)
+	Activate(ctx context.Context, userId, code string) ([]string, error)
+	Disable(ctx context.Context, userId, password, code string) error
+	Reset(ctx context.Context, userId string) error
+	RegenerateRecoveryCodes(ctx context.Context, userId, code string) ([]string, error)
+	IssuePendingToken(ctx context.Context, user *domain.User) (*TokenDetails, error)
+	VerifyPending(ctx context.Context, pendingToken, code, recoveryCode string) (*domain.User, error)
+}
+
+type MfaEnrollment struct {
+	Secret          string
+	ProvisioningUri string
+	QrCodePng       []byte
+}
+
+type mfaServiceImpl struct {
+	auth                    *jwtauth.JWTAuth
+	userRepository          repository.UserRepository
+	recoveryCodeRepository  repository.MfaRecoveryCodeRepository
+	refreshTokenRepository  repository.RefreshTokenRepository
+	apiKeyRepository        repository.ApiKeyRepository
+	securityEventRepository repository.SecurityEventRepository
+	throttle                *loginThrottle
+}
+
+func (m *mfaServiceImpl) Enroll(ctx context.Context, userId string) (_ *MfaEnrollment, err error) {
+	ctx, span := startSpan(ctx, "MfaService.Enroll")
+	defer func() { endSpan(span, err) }()
+
+	user, err := m.findUser(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := generateTotpSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := user.EnrollTotp(secret); err != nil {
+		return nil, err
+	}
+	if err := m.userRepository.Update(ctx, user, totpColumns...); err != nil {
+		return nil, fmt.Errorf("db error: %w", err)
+	}
+
+	uri := totpProvisioningUri(mfaIssuer, user.Login, secret)
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		return nil, fmt.Errorf("generating qr code: %w", err)
+	}
+
+	return &MfaEnrollment{Secret: secret, ProvisioningUri: uri, QrCodePng: png}, nil
+}
+
+func (m *mfaServiceImpl) Activate(ctx context.Context, userId, code string) (_ []string, err error) {
+	ctx, span := startSpan(ctx, "MfaService.Activate")
+	defer func() { endSpan(span, err) }()
+
+	user, err := m.findUser(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if user.TotpEnabled {
+		return nil, domain.ErrTotpAlreadyEnabled
+	}
+	if user.TotpSecret == "" {
+		return nil, domain.ErrTotpNotEnrolled
+	}
+
+	step, ok := validateTotp(user.TotpSecret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidMfaCode
+	}
+	if err := user.EnableTotp(step); err != nil {
+		return nil, err
+	}
+	if err := m.userRepository.Update(ctx, user, totpColumns...); err != nil {
+		return nil, fmt.Errorf("db error: %w", err)
+	}
+
+	recordSecurityEvent(ctx, m.securityEventRepository, &repository.SecurityEvent{Type: SecurityEventMfaEnabled, UserId: &user.Id, Login: user.Login})
+	return m.replaceRecoveryCodes(ctx, user.Id)
+}
+
+func (m *mfaServiceImpl) Disable(ctx context.Context, userId, password, code string) (err error) {
+	ctx, span := startSpan(ctx, "MfaService.Disable")
+	defer func() { endSpan(span, err) }()
+
+	user, err := m.userRepository.FindByIdWithRoles(ctx, userId)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return fmt.Errorf("%w: user with id '%s' not found", repository.ErrUserNotFound, userId)
+		}
+		return err
+	}
+	if !user.TotpEnabled {
+		return domain.ErrTotpNotEnrolled
+	}
+	if isMfaMandatory(user) {
+		return ErrMfaMandatory
+	}
+	if !user.CheckPassword(password) {
+		return ErrIncorrectPassword
+	}
+	if err := m.checkCode(ctx, user, code); err != nil {
+		return err
+	}
+
+	return m.disable(ctx, user)
+}
+
+func (m *mfaServiceImpl) Reset(ctx context.Context, userId string) (err error) {
+	ctx, span := startSpan(ctx, "MfaService.Reset")
+	defer func() { endSpan(span, err) }()
+
+	user, err := m.findUser(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	if err := m.disable(ctx, user); err != nil {
+		return err
+	}
+	err = m.refreshTokenRepository.DeleteByUserId(ctx, user.Id)
+	if err != nil && !errors.Is(err, repository.ErrUserNotFound) {
+		return err
+	}
+	// Keys created while the reset factor was in use must not pass as
+	// two-factor authenticated any more.
+	if err := m.apiKeyRepository.ClearMfaVerified(ctx, user.Id); err != nil {
+		return fmt.Errorf("db error: %w", err)
+	}
+	return nil
+}
+
+func (m *mfaServiceImpl) RegenerateRecoveryCodes(ctx context.Context, userId, code string) (_ []string, err error) {
+	ctx, span := startSpan(ctx, "MfaService.RegenerateRecoveryCodes")
+	defer func() { endSpan(span, err) }()
+
+	user, err := m.findUser(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if !user.TotpEnabled {
+		return nil, domain.ErrTotpNotEnrolled
+	}
+	if err := m.checkCode(ctx, user, code); err != nil {
+		return nil, err
+	}
+
+	return m.replaceRecoveryCodes(ctx, user.Id)
+}
+
+func (m *mfaServiceImpl) IssuePendingToken(ctx context.Context, user *domain.User) (_ *TokenDetails, err error) {
+	ctx, span := startSpan(ctx, "MfaService.IssuePendingToken")
+	defer func() { endSpan(span, err) }()
+
+	exp := time.Now().Add(mfaPendingTokenTTL)
+	_, tokenString, err := m.auth.Encode(map[string]interface{}{
+		"jti":     uuid.NewString(),
+		"user_id": user.Id,
+		"exp":     exp.Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenDetails{Token: tokenString, ExpiresAt: exp, UserId: user.Id}, nil
+}
+
+func (m *mfaServiceImpl) VerifyPending(ctx context.Context, pendingToken, code, recoveryCode string) (_ *domain.User, err error) {
+	ctx, span := startSpan(ctx, "MfaService.VerifyPending")
+	defer func() { endSpan(span, err) }()
+
+	token, err := jwtauth.VerifyToken(m.auth, pendingToken)
+	if err != nil {
+		return nil, ErrInvalidMfaToken
+	}
+	userId, ok := token.PrivateClaims()["user_id"].(string)
+	if !ok || token.JwtID() == "" {
+		return nil, ErrInvalidMfaToken
+	}
+	tokenKey := mfaTokenAttemptKey(token.JwtID())
+	spent, err := m.pendingTokenSpent(ctx, tokenKey)
+	if err != nil {
+		return nil, err
+	}
+	if spent {
+		return nil, ErrInvalidMfaToken
+	}
+
+	user, err := m.userRepository.FindByIdWithRoles(ctx, userId)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, ErrInvalidMfaToken
+		}
+		return nil, err
+	}
+	if !user.TotpEnabled {
+		return nil, ErrInvalidMfaToken
+	}
+	if err := m.throttle.checkKey(ctx, mfaAttemptKey(user.Id)); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case code != "":
+		err = m.checkCode(ctx, user, code)
+	case recoveryCode != "":
+		err = m.useRecoveryCode(ctx, user, recoveryCode)
+	default:
+		err = ErrMfaCodeNotSpecified
+	}
+	if errors.Is(err, ErrInvalidMfaCode) {
+		if _, err := m.throttle.loginAttemptRepository.RegisterFailure(ctx, tokenKey, mfaPendingTokenTTL); err != nil {
+			return nil, err
+		}
+		if _, err := m.throttle.registerKeyFailure(ctx, mfaAttemptKey(user.Id), m.throttle.accountPolicy); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidMfaCode
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.spendPendingToken(ctx, tokenKey, token.Expiration()); err != nil {
+		return nil, err
+	}
+	if err := m.throttle.loginAttemptRepository.DeleteByKey(ctx, mfaAttemptKey(user.Id)); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// pendingTokenSpent reports whether a pending token has completed a sign-in
+// or run out of attempts.
+func (m *mfaServiceImpl) pendingTokenSpent(ctx context.Context, tokenKey string) (bool, error) {
+	attempt, err := m.throttle.loginAttemptRepository.FindByKey(ctx, tokenKey)
+	if err != nil {
+		if errors.Is(err, repository.ErrLoginAttemptNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return attempt.LockedUntil != nil || attempt.Failures >= mfaPendingTokenMaxFailures, nil
+}
+
+// spendPendingToken locks a pending token that completed a sign-in until it
+// expires, so it cannot be replayed with a later code. RegisterFailure creates
+// the record LockUntil needs; it holds no failure of the user.
+func (m *mfaServiceImpl) spendPendingToken(ctx context.Context, tokenKey string, expiresAt time.Time) error {
+	if _, err := m.throttle.loginAttemptRepository.RegisterFailure(ctx, tokenKey, mfaPendingTokenTTL); err != nil {
+		return err
+	}
+	return m.throttle.loginAttemptRepository.LockUntil(ctx, tokenKey, expiresAt)
+}
+
+// checkCode accepts every TOTP code at most once by remembering the last
+// matched time step.
+func (m *mfaServiceImpl) checkCode(ctx context.Context, user *domain.User, code string) error {
+	step, ok := validateTotp(user.TotpSecret, code, time.Now())
+	if !ok || step <= user.TotpLastStep {
+		recordSecurityEvent(ctx, m.securityEventRepository, &repository.SecurityEvent{Type: SecurityEventMfaFailed, UserId: &user.Id, Login: user.Login})
+		return ErrInvalidMfaCode
+	}
+
+	user.TotpLastStep = step
+	if err := m.userRepository.Update(ctx, user, "totp_last_step"); err != nil {
+		return fmt.Errorf("db error: %w", err)
+	}
+	return nil
+}
+
+func (m *mfaServiceImpl) useRecoveryCode(ctx context.Context, user *domain.User, recoveryCode string) error {
+	err := m.recoveryCodeRepository.Use(ctx, user.Id, hashRecoveryCode(recoveryCode))
+	if err != nil {
+		if errors.Is(err, repository.ErrRecoveryCodeNotFound) {
+			recordSecurityEvent(ctx, m.securityEventRepository, &repository.SecurityEvent{Type: SecurityEventMfaFailed, UserId: &user.Id, Login: user.Login, Details: "recovery code"})
+			return ErrInvalidMfaCode
+		}
+		return err
+	}
+	recordSecurityEvent(ctx, m.securityEventRepository, &repository.SecurityEvent{Type: SecurityEventMfaRecoveryCodeUsed, UserId: &user.Id, Login: user.Login})
+	return nil
+}
+
+func (m *mfaServiceImpl) disable(ctx context.Context, user *domain.User) error {
+	user.DisableTotp()
+	if err := m.userRepository.Update(ctx, user, totpColumns...); err != nil {
+		return fmt.Errorf("db error: %w", err)
+	}
+	if err := m.recoveryCodeRepository.DeleteByUserId(ctx, user.Id); err != nil {
+		return fmt.Errorf("db error: %w", err)
+	}
+
+	recordSecurityEvent(ctx, m.securityEventRepository, &repository.SecurityEvent{Type: SecurityEventMfaDisabled, UserId: &user.Id, Login: user.Login})
+	return nil
+}
+
+func (m *mfaServiceImpl) replaceRecoveryCodes(ctx context.Context, userId string) ([]string, error) {
+	codes := make([]string, 0, mfaRecoveryCodeCount)
+	records := make([]*repository.MfaRecoveryCode, 0, mfaRecoveryCodeCount)
+	for range mfaRecoveryCodeCount {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		records = append(records, &repository.MfaRecoveryCode{UserId: userId, CodeHash: hashRecoveryCode(code)})
+	}
+
+	if err := m.recoveryCodeRepository.ReplaceForUser(ctx, userId, records); err != nil {
+		return nil, fmt.Errorf("db error: %w", err)
+	}
+	return codes, nil
+}
+
+func (m *mfaServiceImpl) findUser(ctx context.Context, userId string) (*domain.User, error) {
+	user, err := m.userRepository.FindById(ctx, userId)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, fmt.Errorf("%w: user with id '%s' not found", repository.ErrUserNotFound, userId)
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+func isMfaMandatory(user *domain.User) bool {
+	for _, role := range MfaMandatoryRoles {
+		if user.HasRoleName(role) {
+			return true
+		}
+	}
+	return false
+}
+
+func generateRecoveryCode() (string, error) {
+	raw := make([]byte, 10)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	code := strings.ToLower(totpEncoding.EncodeToString(raw))
+	return code[:8] + "-" + code[8:], nil
+}
+
+// Recovery codes carry 80 bits of entropy, so a plain SHA-256 is enough to
+// keep them useless if the table leaks.
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+func NewMfaService(auth *jwtauth.JWTAuth, userRepository repository.UserRepository, recoveryCodeRepository repository.MfaRecoveryCodeRepository, refreshTokenRepository repository.RefreshTokenRepository, apiKeyRepository repository.ApiKeyRepository, securityEventRepository repository.SecurityEventRepository, loginAttemptRepository repository.LoginAttemptRepository) MfaService {
+	return &mfaServiceImpl{
+		auth:                    auth,
+		userRepository:          userRepository,
+		recoveryCodeRepository:  recoveryCodeRepository,
+		refreshTokenRepository:  refreshTokenRepository,
+		apiKeyRepository:        apiKeyRepository,
+		securityEventRepository: securityEventRepository,
+		throttle: &loginThrottle{
+			loginAttemptRepository: loginAttemptRepository,
+			accountPolicy:          DefaultMfaLockoutPolicy,
+		},
+	}
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"api/catshelter/internal/domain"
+	"api/catshelter/internal/repository"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-chi/jwtauth/v5"
+)
+
+func newTestMfaService(t *testing.T) (*mfaServiceImpl, *domain.User, repository.LoginAttemptRepository) {
+	t.Helper()
+	secret, err := generateTotpSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &domain.User{BaseModel: domain.BaseModel{Id: "user-1"}, Login: "barsik", TotpSecret: secret, TotpEnabled: true}
+	attempts := repository.NewInMemoryLoginAttemptRepository()
+	service := &mfaServiceImpl{
+		auth:                    jwtauth.New("HS256", []byte("test secret"), nil),
+		userRepository:          newFakeUserRepository(user),
+		recoveryCodeRepository:  &fakeRecoveryCodeRepository{unused: map[string]bool{hashRecoveryCode("good-recovery"): true}},
+		refreshTokenRepository:  &fakeRefreshTokenRepository{},
+		apiKeyRepository:        &fakeApiKeyRepository{},
+		securityEventRepository: &fakeSecurityEventRepository{},
+		throttle: &loginThrottle{
+			loginAttemptRepository: attempts,
+			// Without backoff, so only the limits are exercised.
+			accountPolicy: LockoutPolicy{BackoffAfter: 100, MaxFailures: 8, LockoutDuration: time.Hour, Window: time.Hour},
+		},
+	}
+	return service, user, attempts
+}
+
+func pendingToken(t *testing.T, m *mfaServiceImpl, user *domain.User) string {
+	t.Helper()
+	token, err := m.IssuePendingToken(context.Background(), user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token.Token
+}
+
+func currentCode(t *testing.T, secret string) string {
+	t.Helper()
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return totpCode(key, time.Now().Unix()/totpPeriod)
+}
+
+// wrongCode returns a code that matches none of the accepted time steps.
+func wrongCode(secret string) string {
+	for n := 0; ; n++ {
+		code := totpCode([]byte("other"), int64(n))
+		if _, ok := validateTotp(secret, code, time.Now()); !ok {
+			return code
+		}
+	}
+}
+
+func TestVerifyPendingInvalidatesTokenAfterFailures(t *testing.T) {
+	ctx := context.Background()
+	m, user, _ := newTestMfaService(t)
+	token := pendingToken(t, m, user)
+
+	for i := 0; i < mfaPendingTokenMaxFailures; i++ {
+		if _, err := m.VerifyPending(ctx, token, wrongCode(user.TotpSecret), ""); !errors.Is(err, ErrInvalidMfaCode) {
+			t.Fatalf("attempt %d: got %v, want %v", i+1, err, ErrInvalidMfaCode)
+		}
+	}
+	if _, err := m.VerifyPending(ctx, token, currentCode(t, user.TotpSecret), ""); !errors.Is(err, ErrInvalidMfaToken) {
+		t.Fatalf("right code on a spent token: got %v, want %v", err, ErrInvalidMfaToken)
+	}
+	if _, err := m.VerifyPending(ctx, token, "", "good-recovery"); !errors.Is(err, ErrInvalidMfaToken) {
+		t.Fatalf("recovery code on a spent token: got %v, want %v", err, ErrInvalidMfaToken)
+	}
+
+	// A fresh token still works: the user is below the lockout.
+	if _, err := m.VerifyPending(ctx, pendingToken(t, m, user), currentCode(t, user.TotpSecret), ""); err != nil {
+		t.Fatalf("fresh token: %v", err)
+	}
+}
+
+func TestVerifyPendingLocksUserAcrossTokens(t *testing.T) {
+	ctx := context.Background()
+	m, user, _ := newTestMfaService(t)
+
+	failures := 0
+	for failures < m.throttle.accountPolicy.MaxFailures {
+		token := pendingToken(t, m, user)
+		for i := 0; i < mfaPendingTokenMaxFailures && failures < m.throttle.accountPolicy.MaxFailures; i++ {
+			if _, err := m.VerifyPending(ctx, token, "", "bad-recovery"); !errors.Is(err, ErrInvalidMfaCode) {
+				t.Fatalf("failure %d: got %v, want %v", failures+1, err, ErrInvalidMfaCode)
+			}
+			failures++
+		}
+	}
+
+	_, err := m.VerifyPending(ctx, pendingToken(t, m, user), currentCode(t, user.TotpSecret), "")
+	var locked *LoginLockedError
+	if !errors.As(err, &locked) {
+		t.Fatalf("got %v, want a lockout", err)
+	}
+}
+
+func TestVerifyPendingResetsUserFailuresOnSuccess(t *testing.T) {
+	ctx := context.Background()
+	m, user, attempts := newTestMfaService(t)
+	token := pendingToken(t, m, user)
+
+	if _, err := m.VerifyPending(ctx, token, wrongCode(user.TotpSecret), ""); !errors.Is(err, ErrInvalidMfaCode) {
+		t.Fatalf("got %v, want %v", err, ErrInvalidMfaCode)
+	}
+	if _, err := m.VerifyPending(ctx, token, currentCode(t, user.TotpSecret), ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := attempts.FindByKey(ctx, mfaAttemptKey(user.Id)); !errors.Is(err, repository.ErrLoginAttemptNotFound) {
+		t.Errorf("user failures kept after a successful verification: %v", err)
+	}
+}
+
+func TestVerifyPendingRejectsReplayedTokens(t *testing.T) {
+	ctx := context.Background()
+	m, user, _ := newTestMfaService(t)
+	m.recoveryCodeRepository.(*fakeRecoveryCodeRepository).unused[hashRecoveryCode("other-recovery")] = true
+	token := pendingToken(t, m, user)
+
+	if _, err := m.VerifyPending(ctx, token, currentCode(t, user.TotpSecret), ""); err != nil {
+		t.Fatal(err)
+	}
+	// Even with a second factor that is still good, the token has been used.
+	if _, err := m.VerifyPending(ctx, token, "", "good-recovery"); !errors.Is(err, ErrInvalidMfaToken) {
+		t.Fatalf("replayed token: got %v, want %v", err, ErrInvalidMfaToken)
+	}
+
+	token = pendingToken(t, m, user)
+	if _, err := m.VerifyPending(ctx, token, "", "good-recovery"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.VerifyPending(ctx, token, "", "other-recovery"); !errors.Is(err, ErrInvalidMfaToken) {
+		t.Fatalf("token replayed after a recovery code: got %v, want %v", err, ErrInvalidMfaToken)
+	}
+}
+
+func TestVerifyPendingRejectsTokensWithoutId(t *testing.T) {
+	m, user, _ := newTestMfaService(t)
+	_, token, err := m.auth.Encode(map[string]interface{}{"user_id": user.Id, "exp": time.Now().Add(time.Minute).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.VerifyPending(context.Background(), token, currentCode(t, user.TotpSecret), ""); !errors.Is(err, ErrInvalidMfaToken) {
+		t.Fatalf("got %v, want %v", err, ErrInvalidMfaToken)
+	}
+}
+
+func TestResetClearsMfaOfApiKeys(t *testing.T) {
+	m, user, _ := newTestMfaService(t)
+	key := &domain.ApiKey{UserId: user.Id, MfaVerified: true}
+	m.apiKeyRepository = &fakeApiKeyRepository{keys: []*domain.ApiKey{key}}
+
+	if err := m.Reset(context.Background(), user.Id); err != nil {
+		t.Fatal(err)
+	}
+	if key.MfaVerified {
+		t.Error("after an MFA reset the API key still counts as two-factor authenticated")
+	}
+}
@@ -0,0 +1,364 @@
+package service
+
+import (
+	"api/catshelter/internal/domain"
+	"api/catshelter/internal/metrics"
+	"api/catshelter/internal/repository"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/go-chi/jwtauth/v5"
+	"golang.org/x/oauth2"
+	"golang.org/x/sync/singleflight"
+)
+
+const oidcFlowTTL = 10 * time.Minute
+
+// oidcDiscoveryTimeout bounds fetching a provider's discovery document.
+var oidcDiscoveryTimeout = 10 * time.Second
+
+var (
+	ErrUnknownOidcProvider = errors.New("unknown identity provider")
+	ErrInvalidOidcFlow     = errors.New("invalid or expired sign-in attempt")
+	ErrOidcAuthFailed      = errors.New("identity provider sign-in failed")
+)
+
+type OidcProviderConfig struct {
+	Name         string
+	Issuer       string
+	ClientId     string
+	ClientSecret string
+	Scopes       []string
+}
+
+type OidcService interface {
+	Providers() []string
+	Begin(ctx context.Context, provider string) (authUrl, flowToken string, err error)
+	Complete(ctx context.Context, provider, flowToken, state, code string) (*domain.User, error)
+}
+
+type oidcProvider struct {
+	config   OidcProviderConfig
+	oauth2   *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+type oidcServiceImpl struct {
+	auth                       *jwtauth.JWTAuth
+	userRepository             repository.UserRepository
+	roleRepository             repository.RoleRepository
+	externalIdentityRepository repository.ExternalIdentityRepository
+	securityEventRepository    repository.SecurityEventRepository
+	configs                    map[string]OidcProviderConfig
+	callbackUrl                func(provider string) string
+
+	mu        sync.Mutex
+	providers map[string]*oidcProvider
+	discovery singleflight.Group
+}
+
+func (o *oidcServiceImpl) Providers() []string {
+	names := make([]string, 0, len(o.configs))
+	for name := range o.configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Begin starts an authorization code flow with PKCE. State, nonce and the
+// code verifier travel in flowToken, a signed short-lived token the caller
+// keeps on the client (in a cookie) until the callback.
+func (o *oidcServiceImpl) Begin(ctx context.Context, provider string) (_ string, _ string, err error) {
+	ctx, span := startSpan(ctx, "OidcService.Begin")
+	defer func() { endSpan(span, err) }()
+
+	p, err := o.provider(ctx, provider)
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err := randomOidcValue()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomOidcValue()
+	if err != nil {
+		return "", "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	_, flowToken, err := o.auth.Encode(map[string]interface{}{
+		"provider": provider,
+		"state":    state,
+		"nonce":    nonce,
+		"verifier": verifier,
+		"exp":      time.Now().Add(oidcFlowTTL).Unix(),
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	authUrl := p.oauth2.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+	return authUrl, flowToken, nil
+}
+
+func (o *oidcServiceImpl) Complete(ctx context.Context, provider, flowToken, state, code string) (_ *domain.User, err error) {
+	ctx, span := startSpan(ctx, "OidcService.Complete")
+	defer func() { endSpan(span, err) }()
+
+	flow, err := jwtauth.VerifyToken(o.auth, flowToken)
+	if err != nil {
+		return nil, ErrInvalidOidcFlow
+	}
+	claims := flow.PrivateClaims()
+	flowProvider, _ := claims["provider"].(string)
+	flowState, _ := claims["state"].(string)
+	nonce, _ := claims["nonce"].(string)
+	verifier, _ := claims["verifier"].(string)
+	if flowProvider != provider || flowState == "" || subtle.ConstantTimeCompare([]byte(flowState), []byte(state)) != 1 {
+		return nil, ErrInvalidOidcFlow
+	}
+
+	p, err := o.provider(ctx, provider)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := p.oauth2.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("%w: exchanging code: %s", ErrOidcAuthFailed, err.Error())
+	}
+	rawIdToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: no id_token in token response", ErrOidcAuthFailed)
+	}
+	idToken, err := p.verifier.Verify(ctx, rawIdToken)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrOidcAuthFailed, err.Error())
+	}
+	if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrOidcAuthFailed)
+	}
+
+	var identity struct {
+		Email         string      `json:"email"`
+		EmailVerified interface{} `json:"email_verified"`
+		Name          string      `json:"name"`
+	}
+	if err := idToken.Claims(&identity); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrOidcAuthFailed, err.Error())
+	}
+	emailVerified := identity.EmailVerified == true || identity.EmailVerified == "true"
+
+	return o.resolveUser(ctx, provider, idToken.Subject, identity.Email, emailVerified, identity.Name)
+}
+
+// resolveUser finds the user behind an external identity. Unknown identities
+// are linked to an existing account only when both sides have verified the
+// same email; otherwise a new account is created.
+func (o *oidcServiceImpl) resolveUser(ctx context.Context, provider, subject, email string, emailVerified bool, name string) (*domain.User, error) {
+	existing, err := o.externalIdentityRepository.FindByProviderSubject(ctx, provider, subject)
+	if err == nil {
+		return o.findUserWithRoles(ctx, existing.UserId)
+	}
+	if !errors.Is(err, repository.ErrExternalIdentityNotFound) {
+		return nil, fmt.Errorf("db error: %w", err)
+	}
+
+	var user *domain.User
+	normalizedEmail, emailErr := domain.NormalizeEmail(email)
+	if emailVerified && emailErr == nil {
+		candidate, err := o.userRepository.FindByEmail(ctx, normalizedEmail)
+		if err != nil && !errors.Is(err, repository.ErrUserNotFound) {
+			return nil, fmt.Errorf("db error: %w", err)
+		}
+		if candidate != nil && candidate.IsEmailVerified() {
+			user = candidate
+		}
+		if candidate != nil && !candidate.IsEmailVerified() {
+			// The address belongs to an account that never proved it owns it,
+			// so it cannot be reused for a new account either.
+			normalizedEmail = ""
+		}
+	} else {
+		normalizedEmail = ""
+	}
+
+	if user == nil {
+		user, err = o.createUser(ctx, provider, subject, normalizedEmail, name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = o.externalIdentityRepository.Save(ctx, &repository.ExternalIdentity{
+		UserId:   user.Id,
+		Provider: provider,
+		Subject:  subject,
+		Email:    email,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("db error: %w", err)
+	}
+	recordSecurityEvent(ctx, o.securityEventRepository, &repository.SecurityEvent{Type: SecurityEventExternalIdentityLinked, UserId: &user.Id, Login: user.Login, Details: provider})
+
+	return o.findUserWithRoles(ctx, user.Id)
+}
+
+func (o *oidcServiceImpl) createUser(ctx context.Context, provider, subject, email, name string) (*domain.User, error) {
+	subjectHash := sha256.Sum256([]byte(subject))
+	login := fmt.Sprintf("%s_%s", provider, hex.EncodeToString(subjectHash[:])[:12])
+
+	user, err := domain.NewUserWithoutPassword(login, name)
+	if err != nil {
+		return nil, err
+	}
+	if email != "" {
+		if err := user.SetEmail(email); err != nil {
+			return nil, err
+		}
+		if err := user.VerifyEmail(email); err != nil {
+			return nil, err
+		}
+	}
+
+	role, err := o.roleRepository.FindByName(ctx, "user")
+	if err != nil {
+		if errors.Is(err, repository.ErrRoleNotFound) {
+			return nil, errors.New("role 'user' not found")
+		}
+		return nil, fmt.Errorf("db error: %w", err)
+	}
+	if err := user.AddRole(role); err != nil {
+		return nil, err
+	}
+
+	if err := o.userRepository.Save(ctx, user); err != nil {
+		if errors.Is(err, repository.ErrUserConflict) {
+			return nil, takenField(ctx, o.userRepository, user)
+		}
+		return nil, fmt.Errorf("db error: %w", err)
+	}
+	metrics.Registrations.WithLabelValues(metrics.RegistrationOidc).Inc()
+	return user, nil
+}
+
+func (o *oidcServiceImpl) findUserWithRoles(ctx context.Context, userId string) (*domain.User, error) {
+	user, err := o.userRepository.FindByIdWithRoles(ctx, userId)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, fmt.Errorf("%w: user with id '%s' not found", repository.ErrUserNotFound, userId)
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+// provider runs discovery on first use so an unreachable identity provider
+// does not prevent the API from starting.
+func (o *oidcServiceImpl) provider(ctx context.Context, name string) (*oidcProvider, error) {
+	config, ok := o.configs[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: '%s'", ErrUnknownOidcProvider, name)
+	}
+
+	o.mu.Lock()
+	p, ok := o.providers[name]
+	o.mu.Unlock()
+	if ok {
+		return p, nil
+	}
+
+	// Sign-ins waiting for the same provider share one discovery, which
+	// outlives the request that started it so the others are not failed by
+	// its cancellation.
+	result := o.discovery.DoChan(name, func() (any, error) {
+		return o.discover(context.WithoutCancel(ctx), config)
+	})
+	select {
+	case r := <-result:
+		if r.Err != nil {
+			return nil, r.Err
+		}
+		return r.Val.(*oidcProvider), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// discover fetches the discovery document of a provider and keeps the
+// result. Other providers are served meanwhile.
+func (o *oidcServiceImpl) discover(ctx context.Context, config OidcProviderConfig) (*oidcProvider, error) {
+	o.mu.Lock()
+	p, ok := o.providers[config.Name]
+	o.mu.Unlock()
+	if ok {
+		return p, nil
+	}
+
+	discoveryCtx, cancel := context.WithTimeout(ctx, oidcDiscoveryTimeout)
+	defer cancel()
+	discovered, err := oidc.NewProvider(discoveryCtx, config.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("%w: discovery for '%s': %s", ErrOidcAuthFailed, config.Name, err.Error())
+	}
+
+	scopes := config.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{oidc.ScopeOpenID, "profile", "email"}
+	}
+	p = &oidcProvider{
+		config: config,
+		oauth2: &oauth2.Config{
+			ClientID:     config.ClientId,
+			ClientSecret: config.ClientSecret,
+			Endpoint:     discovered.Endpoint(),
+			RedirectURL:  o.callbackUrl(config.Name),
+			Scopes:       scopes,
+		},
+		// The key set is fetched and refreshed with a background context,
+		// not the one of the discovery.
+		verifier: discovered.Verifier(&oidc.Config{ClientID: config.ClientId}),
+	}
+
+	o.mu.Lock()
+	o.providers[config.Name] = p
+	o.mu.Unlock()
+	return p, nil
+}
+
+func randomOidcValue() (string, error) {
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func NewOidcService(auth *jwtauth.JWTAuth, userRepository repository.UserRepository, roleRepository repository.RoleRepository, externalIdentityRepository repository.ExternalIdentityRepository, securityEventRepository repository.SecurityEventRepository, providers []OidcProviderConfig, callbackUrl func(provider string) string) OidcService {
+	configs := make(map[string]OidcProviderConfig, len(providers))
+	for _, p := range providers {
+		configs[p.Name] = p
+	}
+	return &oidcServiceImpl{
+		auth:                       auth,
+		userRepository:             userRepository,
+		roleRepository:             roleRepository,
+		externalIdentityRepository: externalIdentityRepository,
+		securityEventRepository:    securityEventRepository,
+		configs:                    configs,
+		callbackUrl:                callbackUrl,
+		providers:                  make(map[string]*oidcProvider),
+	}
+}
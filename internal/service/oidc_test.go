@@ -0,0 +1,489 @@
+package service
+
+import (
+	"api/catshelter/internal/domain"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+const testOidcClientId = "catshelter"
+
+// fakeOidcProvider serves discovery, a key set and a token endpoint. Codes
+// are issued by the test with the ID token claims the exchange returns, and
+// are only exchanged with the PKCE verifier of the challenge they were
+// issued for.
+type fakeOidcProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu     sync.Mutex
+	grants map[string]fakeOidcGrant
+}
+
+type fakeOidcGrant struct {
+	challenge string
+	idToken   string
+}
+
+func newFakeOidcProvider(t *testing.T) *fakeOidcProvider {
+	t.Helper()
+	p := &fakeOidcProvider{key: newRsaKey(t), grants: make(map[string]fakeOidcGrant)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                p.server.URL,
+			"authorization_endpoint":                p.server.URL + "/authorize",
+			"token_endpoint":                        p.server.URL + "/token",
+			"jwks_uri":                              p.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		key, err := jwk.FromRaw(&p.key.PublicKey)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		key.Set(jwk.KeyIDKey, "test")
+		key.Set(jwk.AlgorithmKey, jwa.RS256)
+		set := jwk.NewSet()
+		set.AddKey(key)
+		json.NewEncoder(w).Encode(set)
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		grant, ok := p.grants[r.FormValue("code")]
+		delete(p.grants, r.FormValue("code"))
+		p.mu.Unlock()
+		if !ok || pkceChallenge(r.FormValue("code_verifier")) != grant.challenge {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     grant.idToken,
+		})
+	})
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+// issue returns a code that exchanges for an ID token with claims, signed
+// with key.
+func (p *fakeOidcProvider) issue(t *testing.T, challenge string, claims map[string]any, key *rsa.PrivateKey) string {
+	t.Helper()
+	token := jwt.New()
+	for name, value := range claims {
+		if err := token.Set(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	signingKey, err := jwk.FromRaw(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingKey.Set(jwk.KeyIDKey, "test")
+	signed, err := jwt.Sign(token, jwt.WithKey(jwa.RS256, signingKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code := randomTestValue(t)
+	p.mu.Lock()
+	p.grants[code] = fakeOidcGrant{challenge: challenge, idToken: string(signed)}
+	p.mu.Unlock()
+	return code
+}
+
+// oidcFlow is what a sign-in carries from Begin to Complete.
+type oidcFlow struct {
+	provider  string
+	flowToken string
+	state     string
+	challenge string
+	claims    map[string]any
+	key       *rsa.PrivateKey
+}
+
+type oidcTest struct {
+	service    *oidcServiceImpl
+	provider   *fakeOidcProvider
+	users      *fakeUserRepository
+	identities *fakeExternalIdentityRepository
+}
+
+func newOidcTest(t *testing.T, users ...*domain.User) *oidcTest {
+	t.Helper()
+	provider := newFakeOidcProvider(t)
+	test := &oidcTest{
+		provider:   provider,
+		users:      newFakeUserRepository(users...),
+		identities: &fakeExternalIdentityRepository{},
+	}
+	test.service = NewOidcService(
+		jwtauth.New("HS256", []byte("test secret"), nil),
+		test.users,
+		&fakeRoleRepository{roles: map[string]*domain.Role{"user": {BaseModel: domain.BaseModel{Id: "role-user"}, Name: "user"}}},
+		test.identities,
+		&fakeSecurityEventRepository{},
+		[]OidcProviderConfig{{Name: "acme", Issuer: provider.server.URL, ClientId: testOidcClientId, ClientSecret: "secret"}},
+		func(provider string) string {
+			return "https://catshelter.example/api/auth/oidc/" + provider + "/callback"
+		},
+	).(*oidcServiceImpl)
+	return test
+}
+
+// begin starts a sign-in and prepares the claims of a valid ID token for
+// subject.
+func (o *oidcTest) begin(t *testing.T, subject string) *oidcFlow {
+	t.Helper()
+	authUrl, flowToken, err := o.service.Begin(context.Background(), "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := url.Parse(authUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+	return &oidcFlow{
+		provider:  "acme",
+		flowToken: flowToken,
+		state:     query.Get("state"),
+		challenge: query.Get("code_challenge"),
+		claims: map[string]any{
+			"iss":   o.provider.server.URL,
+			"aud":   testOidcClientId,
+			"sub":   subject,
+			"iat":   time.Now().Unix(),
+			"exp":   time.Now().Add(time.Minute).Unix(),
+			"nonce": query.Get("nonce"),
+		},
+		key: o.provider.key,
+	}
+}
+
+func (o *oidcTest) complete(t *testing.T, flow *oidcFlow) (*domain.User, error) {
+	t.Helper()
+	code := o.provider.issue(t, flow.challenge, flow.claims, flow.key)
+	return o.service.Complete(context.Background(), flow.provider, flow.flowToken, flow.state, code)
+}
+
+func TestOidcCompleteRejectsInvalidSignIns(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(t *testing.T, o *oidcTest, flow *oidcFlow)
+		want   error
+	}{
+		{"state mismatch", func(t *testing.T, o *oidcTest, flow *oidcFlow) {
+			flow.state = "forged"
+		}, ErrInvalidOidcFlow},
+		{"another provider", func(t *testing.T, o *oidcTest, flow *oidcFlow) {
+			flow.provider = "other"
+		}, ErrInvalidOidcFlow},
+		{"forged flow token", func(t *testing.T, o *oidcTest, flow *oidcFlow) {
+			flow.flowToken = flow.flowToken[:len(flow.flowToken)-4] + "AAAA"
+		}, ErrInvalidOidcFlow},
+		{"code issued to another sign-in", func(t *testing.T, o *oidcTest, flow *oidcFlow) {
+			flow.challenge = o.begin(t, "intruder").challenge
+		}, ErrOidcAuthFailed},
+		{"nonce mismatch", func(t *testing.T, o *oidcTest, flow *oidcFlow) {
+			flow.claims["nonce"] = "replayed"
+		}, ErrOidcAuthFailed},
+		{"signed with another key", func(t *testing.T, o *oidcTest, flow *oidcFlow) {
+			flow.key = newRsaKey(t)
+		}, ErrOidcAuthFailed},
+		{"issued to another client", func(t *testing.T, o *oidcTest, flow *oidcFlow) {
+			flow.claims["aud"] = "another-client"
+		}, ErrOidcAuthFailed},
+		{"issued by another issuer", func(t *testing.T, o *oidcTest, flow *oidcFlow) {
+			flow.claims["iss"] = "https://evil.example"
+		}, ErrOidcAuthFailed},
+		{"expired", func(t *testing.T, o *oidcTest, flow *oidcFlow) {
+			flow.claims["exp"] = time.Now().Add(-time.Minute).Unix()
+		}, ErrOidcAuthFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newOidcTest(t)
+			flow := o.begin(t, "subject-1")
+			tt.tamper(t, o, flow)
+
+			user, err := o.complete(t, flow)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Complete = %v, %v, want %v", user, err, tt.want)
+			}
+			if len(o.users.users) != 0 || len(o.identities.identities) != 0 {
+				t.Errorf("a failed sign-in left %d users and %d identities", len(o.users.users), len(o.identities.identities))
+			}
+		})
+	}
+}
+
+func TestOidcCompleteCreatesUser(t *testing.T) {
+	o := newOidcTest(t)
+	flow := o.begin(t, "subject-1")
+	flow.claims["email"] = "Murka@Example.com"
+	flow.claims["email_verified"] = true
+	flow.claims["name"] = "Murka"
+
+	user, err := o.complete(t, flow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(user.Login, "acme_") || user.Name != "Murka" {
+		t.Errorf("created user %q named %q", user.Login, user.Name)
+	}
+	if !user.IsEmailVerified() || *user.Email != "murka@example.com" {
+		t.Errorf("created user has email %v, verified %v", user.Email, user.IsEmailVerified())
+	}
+	if len(user.Roles) != 1 || user.Roles[0].Name != "user" {
+		t.Errorf("created user has roles %v", user.Roles)
+	}
+	if user.HasPassword() {
+		t.Error("created user has a password, want none to confirm account deletion with")
+	}
+	assertLinked(t, o, user.Id, "subject-1")
+
+	// The next sign-in finds the account through the identity.
+	again, err := o.complete(t, o.begin(t, "subject-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Id != user.Id || len(o.users.users) != 1 {
+		t.Errorf("second sign-in returned %s, %d users exist", again.Id, len(o.users.users))
+	}
+}
+
+func TestOidcCompleteLinksByVerifiedEmail(t *testing.T) {
+	verifiedAt := time.Now()
+	email := "murka@example.com"
+	verified := &domain.User{BaseModel: domain.BaseModel{Id: "user-1"}, Login: "murka", Email: &email, EmailVerifiedAt: &verifiedAt}
+	unverified := &domain.User{BaseModel: domain.BaseModel{Id: "user-1"}, Login: "murka", Email: &email}
+
+	tests := []struct {
+		name          string
+		existing      *domain.User
+		emailVerified any
+		linked        bool
+	}{
+		{"both sides verified", verified, true, true},
+		{"verified as a string", verified, "true", true},
+		{"provider did not verify", verified, false, false},
+		{"provider does not say", verified, nil, false},
+		{"account did not verify", unverified, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newOidcTest(t, tt.existing)
+			flow := o.begin(t, "subject-1")
+			flow.claims["email"] = "Murka@example.com"
+			if tt.emailVerified != nil {
+				flow.claims["email_verified"] = tt.emailVerified
+			}
+
+			user, err := o.complete(t, flow)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.linked {
+				if user.Id != tt.existing.Id || len(o.users.users) != 1 {
+					t.Errorf("signed in as %s with %d users, want the existing account", user.Id, len(o.users.users))
+				}
+			} else {
+				if user.Id == tt.existing.Id || len(o.users.users) != 2 {
+					t.Errorf("signed in as %s with %d users, want a new account", user.Id, len(o.users.users))
+				}
+				// The address stays with the account that has it.
+				if user.Email != nil {
+					t.Errorf("new account got email %q", *user.Email)
+				}
+			}
+			assertLinked(t, o, user.Id, "subject-1")
+		})
+	}
+}
+
+// slowDiscovery serves a discovery document once released and counts the
+// requests it gets.
+type slowDiscovery struct {
+	server   *httptest.Server
+	release  chan struct{}
+	requests atomic.Int32
+}
+
+func newSlowDiscovery(t *testing.T) *slowDiscovery {
+	t.Helper()
+	d := &slowDiscovery{release: make(chan struct{})}
+	d.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d.requests.Add(1)
+		select {
+		case <-d.release:
+		case <-r.Context().Done():
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                 d.server.URL,
+			"authorization_endpoint": d.server.URL + "/authorize",
+			"token_endpoint":         d.server.URL + "/token",
+			"jwks_uri":               d.server.URL + "/jwks",
+		})
+	}))
+	t.Cleanup(d.server.Close)
+	return d
+}
+
+// started waits for the first discovery request.
+func (d *slowDiscovery) started(t *testing.T) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); d.requests.Load() == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("discovery was not requested")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func newDiscoveryTestService(providers ...OidcProviderConfig) *oidcServiceImpl {
+	return NewOidcService(jwtauth.New("HS256", []byte("test secret"), nil), nil, nil, nil, nil, providers, func(provider string) string {
+		return "https://catshelter.example/api/auth/oidc/" + provider + "/callback"
+	}).(*oidcServiceImpl)
+}
+
+func TestOidcDiscovery(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("sign-ins share one discovery", func(t *testing.T) {
+		d := newSlowDiscovery(t)
+		service := newDiscoveryTestService(OidcProviderConfig{Name: "slow", Issuer: d.server.URL, ClientId: testOidcClientId})
+
+		errs := make(chan error, 5)
+		for range cap(errs) {
+			go func() {
+				_, _, err := service.Begin(ctx, "slow")
+				errs <- err
+			}()
+		}
+		d.started(t)
+		close(d.release)
+		for range cap(errs) {
+			if err := <-errs; err != nil {
+				t.Error(err)
+			}
+		}
+		if requests := d.requests.Load(); requests != 1 {
+			t.Errorf("discovery was requested %d times, want once", requests)
+		}
+	})
+
+	t.Run("a canceled sign-in leaves discovery running", func(t *testing.T) {
+		d := newSlowDiscovery(t)
+		service := newDiscoveryTestService(OidcProviderConfig{Name: "slow", Issuer: d.server.URL, ClientId: testOidcClientId})
+
+		canceled, cancel := context.WithCancel(ctx)
+		errs := make(chan error, 1)
+		go func() {
+			_, _, err := service.Begin(canceled, "slow")
+			errs <- err
+		}()
+		d.started(t)
+		cancel()
+		if err := <-errs; !errors.Is(err, context.Canceled) {
+			t.Errorf("canceled Begin = %v, want context.Canceled", err)
+		}
+
+		close(d.release)
+		if _, _, err := service.Begin(ctx, "slow"); err != nil {
+			t.Fatal(err)
+		}
+		if requests := d.requests.Load(); requests != 1 {
+			t.Errorf("discovery was requested %d times, want once", requests)
+		}
+	})
+
+	t.Run("an unresponsive provider does not hold up others", func(t *testing.T) {
+		timeout := oidcDiscoveryTimeout
+		oidcDiscoveryTimeout = 100 * time.Millisecond
+		t.Cleanup(func() { oidcDiscoveryTimeout = timeout })
+
+		d := newSlowDiscovery(t)
+		acme := newFakeOidcProvider(t)
+		service := newDiscoveryTestService(
+			OidcProviderConfig{Name: "slow", Issuer: d.server.URL, ClientId: testOidcClientId},
+			OidcProviderConfig{Name: "acme", Issuer: acme.server.URL, ClientId: testOidcClientId},
+		)
+
+		errs := make(chan error, 1)
+		go func() {
+			_, _, err := service.Begin(ctx, "slow")
+			errs <- err
+		}()
+		d.started(t)
+		if _, _, err := service.Begin(ctx, "acme"); err != nil {
+			t.Fatal(err)
+		}
+		if err := <-errs; !errors.Is(err, ErrOidcAuthFailed) {
+			t.Errorf("Begin with an unresponsive provider = %v, want %v", err, ErrOidcAuthFailed)
+		}
+	})
+}
+
+func assertLinked(t *testing.T, o *oidcTest, userId, subject string) {
+	t.Helper()
+	identity, err := o.identities.FindByProviderSubject(context.Background(), "acme", subject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.UserId != userId {
+		t.Errorf("%s is linked to %s, want %s", subject, identity.UserId, userId)
+	}
+}
+
+func newRsaKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func randomTestValue(t *testing.T) string {
+	t.Helper()
+	value, err := randomOidcValue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
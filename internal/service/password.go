@@ -0,0 +1,232 @@
+package service
+
+import (
+	"api/catshelter/internal/domain"
+	"api/catshelter/internal/mail"
+	"api/catshelter/internal/repository"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	netmail "net/mail"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const passwordResetTokenTTL = time.Hour
+
+var ErrInvalidPasswordResetToken = errors.New("invalid or expired password reset token")
+
+type PasswordService interface {
+	ChangePassword(ctx context.Context, userId, currentPassword, newPassword, currentRefreshToken string) error
+	RequestReset(ctx context.Context, login string) error
+	ResetPassword(ctx context.Context, token, newPassword string) error
+}
+
+type passwordServiceImpl struct {
+	userRepository               repository.UserRepository
+	refreshTokenRepository       repository.RefreshTokenRepository
+	apiKeyRepository             repository.ApiKeyRepository
+	passwordResetTokenRepository repository.PasswordResetTokenRepository
+	securityEventRepository      repository.SecurityEventRepository
+	transactor                   repository.Transactor
+	mailer                       mail.Mailer
+	resetUrl                     string
+
+	// pending counts reset requests still being handled in the background.
+	pending sync.WaitGroup
+}
+
+// ChangePassword keeps the session identified by currentRefreshToken alive and
+// revokes every other session of the user.
+func (p *passwordServiceImpl) ChangePassword(ctx context.Context, userId, currentPassword, newPassword, currentRefreshToken string) (err error) {
+	ctx, span := startSpan(ctx, "PasswordService.ChangePassword")
+	defer func() { endSpan(span, err) }()
+
+	user, err := p.userRepository.FindById(ctx, userId)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return fmt.Errorf("%w: user with id '%s' not found", repository.ErrUserNotFound, userId)
+		}
+		return err
+	}
+	if !user.CheckPassword(currentPassword) {
+		return ErrIncorrectPassword
+	}
+	if err := user.ChangePassword(newPassword); err != nil {
+		return err
+	}
+
+	if err := p.userRepository.Update(ctx, user, "password"); err != nil {
+		return fmt.Errorf("db error: %w", err)
+	}
+	if err := p.refreshTokenRepository.DeleteByUserIdExcept(ctx, user.Id, currentRefreshToken); err != nil {
+		return fmt.Errorf("db error: %w", err)
+	}
+	if err := p.apiKeyRepository.ClearMfaVerified(ctx, user.Id); err != nil {
+		return fmt.Errorf("db error: %w", err)
+	}
+
+	recordSecurityEvent(ctx, p.securityEventRepository, &repository.SecurityEvent{Type: SecurityEventPasswordChanged, UserId: &user.Id, Login: user.Login})
+	return nil
+}
+
+// RequestReset never reveals whether the login exists: unknown logins and
+// users without a deliverable address are silently ignored. The user is
+// looked up and mailed in the background, so the response takes as long
+// whether or not there is someone to mail.
+func (p *passwordServiceImpl) RequestReset(ctx context.Context, login string) error {
+	ctx = detachContext(ctx)
+	p.pending.Add(1)
+	go func() {
+		defer p.pending.Done()
+		if err := p.requestReset(ctx, login); err != nil {
+			slog.ErrorContext(ctx, "password reset request failed", "error", err)
+		}
+	}()
+	return nil
+}
+
+func (p *passwordServiceImpl) requestReset(ctx context.Context, login string) (err error) {
+	ctx, span := startSpan(ctx, "PasswordService.RequestReset")
+	defer func() { endSpan(span, err) }()
+
+	user, err := p.userRepository.FindByLogin(ctx, login)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil
+		}
+		return fmt.Errorf("db error: %w", err)
+	}
+
+	address, ok := resetAddress(user)
+	if !ok {
+		slog.InfoContext(ctx, "password reset skipped: no mail address", "target_user_id", user.Id)
+		return nil
+	}
+
+	token, err := generateResetToken()
+	if err != nil {
+		return err
+	}
+	if err := p.passwordResetTokenRepository.DeleteByUserId(ctx, user.Id); err != nil {
+		return fmt.Errorf("db error: %w", err)
+	}
+	err = p.passwordResetTokenRepository.Save(ctx, &repository.PasswordResetToken{
+		UserId:    user.Id,
+		TokenHash: hashResetToken(token),
+		ExpiresAt: time.Now().Add(passwordResetTokenTTL),
+	})
+	if err != nil {
+		return fmt.Errorf("db error: %w", err)
+	}
+
+	link := p.resetUrl + "?token=" + url.QueryEscape(token)
+	err = p.mailer.Send(ctx, &mail.Message{
+		To:      address,
+		Subject: "Reset your CatShelter password",
+		Body: fmt.Sprintf("Hello %s,\n\nTo choose a new password open the link below. It expires in %d minutes.\n\n%s\n\nIf you did not ask for a password reset you can ignore this message.\n",
+			user.Name, int(passwordResetTokenTTL.Minutes()), link),
+	})
+	if err != nil {
+		return fmt.Errorf("sending password reset mail: %w", err)
+	}
+
+	recordSecurityEvent(ctx, p.securityEventRepository, &repository.SecurityEvent{Type: SecurityEventPasswordResetRequested, UserId: &user.Id, Login: user.Login})
+	return nil
+}
+
+func (p *passwordServiceImpl) ResetPassword(ctx context.Context, token, newPassword string) (err error) {
+	ctx, span := startSpan(ctx, "PasswordService.ResetPassword")
+	defer func() { endSpan(span, err) }()
+
+	// A password that cannot be set must not use up the token.
+	hash, err := domain.NewPasswordHash(newPassword)
+	if err != nil {
+		return err
+	}
+
+	// The token is used up only together with setting the password.
+	var user *domain.User
+	err = p.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		resetToken, err := p.passwordResetTokenRepository.Consume(ctx, hashResetToken(token))
+		if err != nil {
+			if errors.Is(err, repository.ErrPasswordResetTokenNotFound) {
+				return ErrInvalidPasswordResetToken
+			}
+			return fmt.Errorf("db error: %w", err)
+		}
+
+		user, err = p.userRepository.FindById(ctx, resetToken.UserId)
+		if err != nil {
+			if errors.Is(err, repository.ErrUserNotFound) {
+				return ErrInvalidPasswordResetToken
+			}
+			return err
+		}
+		user.SetPassword(hash)
+
+		if err := p.userRepository.Update(ctx, user, "password"); err != nil {
+			return fmt.Errorf("db error: %w", err)
+		}
+		err = p.refreshTokenRepository.DeleteByUserId(ctx, user.Id)
+		if err != nil && !errors.Is(err, repository.ErrUserNotFound) {
+			return fmt.Errorf("db error: %w", err)
+		}
+		if err := p.apiKeyRepository.ClearMfaVerified(ctx, user.Id); err != nil {
+			return fmt.Errorf("db error: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	recordSecurityEvent(ctx, p.securityEventRepository, &repository.SecurityEvent{Type: SecurityEventPasswordReset, UserId: &user.Id, Login: user.Login})
+	return nil
+}
+
+// resetAddress returns where reset links are delivered: the verified email
+// if there is one, otherwise the login of accounts that signed up with an
+// address as their login.
+func resetAddress(user *domain.User) (string, bool) {
+	if user.IsEmailVerified() {
+		return *user.Email, true
+	}
+	address, err := netmail.ParseAddress(user.Login)
+	if err != nil {
+		return "", false
+	}
+	return address.Address, true
+}
+
+func generateResetToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func NewPasswordService(userRepository repository.UserRepository, refreshTokenRepository repository.RefreshTokenRepository, apiKeyRepository repository.ApiKeyRepository, passwordResetTokenRepository repository.PasswordResetTokenRepository, securityEventRepository repository.SecurityEventRepository, transactor repository.Transactor, mailer mail.Mailer, resetUrl string) PasswordService {
+	return &passwordServiceImpl{
+		userRepository:               userRepository,
+		refreshTokenRepository:       refreshTokenRepository,
+		apiKeyRepository:             apiKeyRepository,
+		passwordResetTokenRepository: passwordResetTokenRepository,
+		securityEventRepository:      securityEventRepository,
+		transactor:                   transactor,
+		mailer:                       mailer,
+		resetUrl:                     resetUrl,
+	}
+}
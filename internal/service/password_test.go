@@ -0,0 +1,132 @@
+package service
+
+import (
+	"api/catshelter/internal/domain"
+	"api/catshelter/internal/mail"
+	"api/catshelter/internal/repository"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResetPasswordKeepsTokenForRejectedPassword(t *testing.T) {
+	user, err := domain.NewUser("barsik", "old password", "Barsik")
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := newFakeUserRepository(user)
+	service := &passwordServiceImpl{
+		userRepository:         users,
+		refreshTokenRepository: &fakeRefreshTokenRepository{},
+		apiKeyRepository:       &fakeApiKeyRepository{},
+		passwordResetTokenRepository: &fakePasswordResetTokenRepository{tokens: map[string]*repository.PasswordResetToken{
+			hashResetToken("reset-token"): {UserId: user.Id, ExpiresAt: time.Now().Add(time.Hour)},
+		}},
+		securityEventRepository: &fakeSecurityEventRepository{},
+		transactor:              fakeTransactor{},
+	}
+	ctx := context.Background()
+
+	for _, password := range []string{"short", strings.Repeat("ж", 37)} {
+		err := service.ResetPassword(ctx, "reset-token", password)
+		if !errors.Is(err, domain.ErrValidation) {
+			t.Fatalf("ResetPassword(%q) = %v, want a validation error", password, err)
+		}
+	}
+
+	if err := service.ResetPassword(ctx, "reset-token", "new password"); err != nil {
+		t.Fatalf("the token did not survive rejected passwords: %v", err)
+	}
+	stored, err := users.FindById(ctx, user.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stored.CheckPassword("new password") {
+		t.Error("the new password was not stored")
+	}
+	if err := service.ResetPassword(ctx, "reset-token", "another password"); !errors.Is(err, ErrInvalidPasswordResetToken) {
+		t.Errorf("reusing the token = %v, want %v", err, ErrInvalidPasswordResetToken)
+	}
+}
+
+func TestRequestResetKeepsTokenOutOfLog(t *testing.T) {
+	log := captureLog(t)
+	user, err := domain.NewUser("barsik", "old password", "Barsik")
+	if err != nil {
+		t.Fatal(err)
+	}
+	email := "barsik@example.com"
+	user.Email = &email
+	if err := user.VerifyEmail(email); err != nil {
+		t.Fatal(err)
+	}
+	mailer := &recordingMailer{next: mail.NewLogMailer("no-reply@example.com")}
+	service := NewPasswordService(newFakeUserRepository(user), &fakeRefreshTokenRepository{}, &fakeApiKeyRepository{},
+		&fakePasswordResetTokenRepository{tokens: map[string]*repository.PasswordResetToken{}},
+		&fakeSecurityEventRepository{}, fakeTransactor{}, mailer, "https://catshelter.example/reset-password")
+
+	if err := service.RequestReset(context.Background(), user.Login); err != nil {
+		t.Fatal(err)
+	}
+	service.(*passwordServiceImpl).pending.Wait()
+	token := mailer.linkToken(t)
+	if !strings.Contains(log.String(), "mail sent to log") {
+		t.Errorf("the mail was not logged: %s", log)
+	}
+	if strings.Contains(log.String(), token) {
+		t.Errorf("the reset token reached the log: %s", log)
+	}
+}
+
+func TestRequestResetForUnknownLoginSendsNothing(t *testing.T) {
+	mailer := &recordingMailer{next: mail.NewLogMailer("no-reply@example.com")}
+	service := NewPasswordService(newFakeUserRepository(), &fakeRefreshTokenRepository{}, &fakeApiKeyRepository{},
+		&fakePasswordResetTokenRepository{tokens: map[string]*repository.PasswordResetToken{}},
+		&fakeSecurityEventRepository{}, fakeTransactor{}, mailer, "https://catshelter.example/reset-password")
+
+	if err := service.RequestReset(context.Background(), "nobody"); err != nil {
+		t.Fatalf("RequestReset = %v, want the same answer as for a known login", err)
+	}
+	service.(*passwordServiceImpl).pending.Wait()
+	if len(mailer.messages) != 0 {
+		t.Errorf("%d messages sent for an unknown login", len(mailer.messages))
+	}
+}
+
+func TestPasswordChangesClearMfaOfApiKeys(t *testing.T) {
+	ctx := context.Background()
+	user, err := domain.NewUser("barsik", "old password", "Barsik")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := &fakeApiKeyRepository{}
+	service := &passwordServiceImpl{
+		userRepository:         newFakeUserRepository(user),
+		refreshTokenRepository: &fakeRefreshTokenRepository{},
+		apiKeyRepository:       keys,
+		passwordResetTokenRepository: &fakePasswordResetTokenRepository{tokens: map[string]*repository.PasswordResetToken{
+			hashResetToken("reset-token"): {UserId: user.Id, ExpiresAt: time.Now().Add(time.Hour)},
+		}},
+		securityEventRepository: &fakeSecurityEventRepository{},
+		transactor:              fakeTransactor{},
+	}
+
+	for _, change := range []struct {
+		name string
+		run  func() error
+	}{
+		{"change", func() error { return service.ChangePassword(ctx, user.Id, "old password", "new password", "") }},
+		{"reset", func() error { return service.ResetPassword(ctx, "reset-token", "newer password") }},
+	} {
+		key := &domain.ApiKey{UserId: user.Id, MfaVerified: true}
+		keys.keys = []*domain.ApiKey{key}
+		if err := change.run(); err != nil {
+			t.Fatalf("%s: %v", change.name, err)
+		}
+		if key.MfaVerified {
+			t.Errorf("after a password %s the API key still counts as two-factor authenticated", change.name)
+		}
+	}
+}
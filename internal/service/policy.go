@@ -0,0 +1,159 @@
+package service
+
+import (
+	"api/catshelter/internal/domain"
+	"errors"
+	"slices"
+)
+
+var (
+	// ErrForbidden means the subject may see the resource but not perform
+	// the action on it.
+	ErrForbidden = errors.New("forbidden")
+	// ErrResourceHidden means the subject may not even see the resource and
+	// should be answered as if it did not exist.
+	ErrResourceHidden = errors.New("resource not found")
+)
+
+type Action string
+
+const (
+	ActionRead   Action = "read"
+	ActionUpdate Action = "update"
+	ActionAdopt  Action = "adopt"
+)
+
+// Subject is whoever makes a request. The zero value is an anonymous user.
+type Subject struct {
+	UserId      string
+	Roles       []string
+	Permissions []string
+}
+
+func (s *Subject) HasPermission(permission string) bool {
+	return slices.Contains(s.Permissions, permission)
+}
+
+// Condition decides a rule for a subject and a resource. Conditions receive
+// the resource type the rule was declared for.
+type Condition func(subject *Subject, resource any) bool
+
+// PolicyRule grants Action on resources of Resource's type to subjects for
+// which Allow holds.
+type PolicyRule struct {
+	Resource string
+	Action   Action
+	Allow    Condition
+}
+
+// DefaultPolicyRules describe who may do what with each resource. Anything
+// not granted here is denied.
+var DefaultPolicyRules = []PolicyRule{
+	{"cat", ActionRead, AnyOf(catIsAvailable, isCatOwner, HasPermission(domain.PermissionCatsWrite))},
+	{"cat", ActionUpdate, HasPermission(domain.PermissionCatsWrite)},
+	{"cat", ActionAdopt, AllOf(HasPermission(domain.PermissionAdoptionsWrite), catIsAvailable)},
+
+	{"user", ActionRead, AnyOf(isSelf, HasPermission(domain.PermissionUsersRead))},
+	{"user", ActionUpdate, AnyOf(AllOf(isSelf, HasPermission(domain.PermissionProfileWrite)), HasPermission(domain.PermissionUsersManage))},
+}
+
+// Policy answers resource-based authorization questions.
+//
+// Authorize tells two denials apart: a subject who may read a resource but
+// not act on it gets ErrForbidden (403), one who may not read it at all gets
+// ErrResourceHidden (404) so responses do not reveal that it exists.
+type Policy interface {
+	Can(subject *Subject, action Action, resource any) bool
+	Authorize(subject *Subject, action Action, resource any) error
+}
+
+type policyImpl struct {
+	rules map[string]map[Action][]Condition
+}
+
+func (p *policyImpl) Can(subject *Subject, action Action, resource any) bool {
+	if subject == nil {
+		subject = &Subject{}
+	}
+	for _, allow := range p.rules[resourceType(resource)][action] {
+		if allow(subject, resource) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *policyImpl) Authorize(subject *Subject, action Action, resource any) error {
+	if p.Can(subject, action, resource) {
+		return nil
+	}
+	if action != ActionRead && p.Can(subject, ActionRead, resource) {
+		return ErrForbidden
+	}
+	return ErrResourceHidden
+}
+
+func NewPolicy(rules []PolicyRule) Policy {
+	p := &policyImpl{rules: make(map[string]map[Action][]Condition)}
+	for _, rule := range rules {
+		if p.rules[rule.Resource] == nil {
+			p.rules[rule.Resource] = make(map[Action][]Condition)
+		}
+		p.rules[rule.Resource][rule.Action] = append(p.rules[rule.Resource][rule.Action], rule.Allow)
+	}
+	return p
+}
+
+func resourceType(resource any) string {
+	switch resource.(type) {
+	case *domain.Cat:
+		return "cat"
+	case *domain.User:
+		return "user"
+	default:
+		return ""
+	}
+}
+
+func HasPermission(permission string) Condition {
+	return func(subject *Subject, _ any) bool {
+		return subject.HasPermission(permission)
+	}
+}
+
+func AnyOf(conditions ...Condition) Condition {
+	return func(subject *Subject, resource any) bool {
+		for _, condition := range conditions {
+			if condition(subject, resource) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func AllOf(conditions ...Condition) Condition {
+	return func(subject *Subject, resource any) bool {
+		for _, condition := range conditions {
+			if !condition(subject, resource) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func isSelf(subject *Subject, resource any) bool {
+	user, ok := resource.(*domain.User)
+	return ok && subject.UserId != "" && user.Id == subject.UserId
+}
+
+func isCatOwner(subject *Subject, resource any) bool {
+	cat, ok := resource.(*domain.Cat)
+	return ok && subject.UserId != "" && cat.UserId != nil && *cat.UserId == subject.UserId
+}
+
+func catIsAvailable(_ *Subject, resource any) bool {
+	cat, ok := resource.(*domain.Cat)
+	return ok && cat.UserId == nil
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"api/catshelter/internal/domain"
+	"errors"
+	"testing"
+)
+
+func TestDefaultPolicy(t *testing.T) {
+	policy := NewPolicy(DefaultPolicyRules)
+
+	owner := "owner"
+	available := &domain.Cat{BaseModel: domain.BaseModel{Id: "cat-1"}, Name: "Murka"}
+	adopted := &domain.Cat{BaseModel: domain.BaseModel{Id: "cat-2"}, Name: "Barsik", UserId: &owner}
+	self := &domain.User{BaseModel: domain.BaseModel{Id: owner}, Login: "owner"}
+	other := &domain.User{BaseModel: domain.BaseModel{Id: "other"}, Login: "other"}
+
+	anonymous := &Subject{}
+	user := &Subject{UserId: owner, Roles: []string{"user"},
+		Permissions: []string{domain.PermissionCatsRead, domain.PermissionAdoptionsWrite, domain.PermissionProfileWrite}}
+	stranger := &Subject{UserId: "stranger", Roles: []string{"user"},
+		Permissions: []string{domain.PermissionCatsRead, domain.PermissionAdoptionsWrite, domain.PermissionProfileWrite}}
+	readOnly := &Subject{UserId: owner}
+	catKeeper := &Subject{UserId: "keeper", Permissions: []string{domain.PermissionCatsWrite}}
+	userReader := &Subject{UserId: "reader", Permissions: []string{domain.PermissionUsersRead}}
+	userManager := &Subject{UserId: "manager", Permissions: []string{domain.PermissionUsersManage}}
+
+	tests := []struct {
+		name     string
+		subject  *Subject
+		action   Action
+		resource any
+		want     error
+	}{
+		{"anonymous reads an available cat", anonymous, ActionRead, available, nil},
+		{"nil subject reads an available cat", nil, ActionRead, available, nil},
+		{"anonymous reads an adopted cat", anonymous, ActionRead, adopted, ErrResourceHidden},
+		{"owner reads their adopted cat", user, ActionRead, adopted, nil},
+		{"non-owner reads an adopted cat", stranger, ActionRead, adopted, ErrResourceHidden},
+		{"cat keeper reads an adopted cat", catKeeper, ActionRead, adopted, nil},
+
+		{"user adopts an available cat", user, ActionAdopt, available, nil},
+		{"user adopts an adopted cat of their own", user, ActionAdopt, adopted, ErrForbidden},
+		{"non-owner adopts an adopted cat", stranger, ActionAdopt, adopted, ErrResourceHidden},
+		{"user without the permission adopts", readOnly, ActionAdopt, available, ErrForbidden},
+		{"anonymous adopts", anonymous, ActionAdopt, available, ErrForbidden},
+
+		{"cat keeper updates a cat", catKeeper, ActionUpdate, adopted, nil},
+		{"owner updates their cat", user, ActionUpdate, adopted, ErrForbidden},
+		{"non-owner updates an adopted cat", stranger, ActionUpdate, adopted, ErrResourceHidden},
+		{"user updates an available cat", user, ActionUpdate, available, ErrForbidden},
+
+		{"user reads themselves", user, ActionRead, self, nil},
+		{"user reads another user", user, ActionRead, other, ErrResourceHidden},
+		{"anonymous reads a user", anonymous, ActionRead, other, ErrResourceHidden},
+		{"user reader reads another user", userReader, ActionRead, other, nil},
+
+		{"user updates themselves", user, ActionUpdate, self, nil},
+		{"user without the permission updates themselves", readOnly, ActionUpdate, self, ErrForbidden},
+		{"user updates another user", user, ActionUpdate, other, ErrResourceHidden},
+		{"user reader updates another user", userReader, ActionUpdate, other, ErrForbidden},
+		{"user manager updates another user", userManager, ActionUpdate, other, nil},
+
+		{"action without a rule", user, ActionAdopt, self, ErrForbidden},
+		{"resource without rules", userManager, ActionRead, &domain.Role{Name: "admin"}, ErrResourceHidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Authorize(tt.subject, tt.action, tt.resource)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Authorize = %v, want %v", err, tt.want)
+			}
+			if can := policy.Can(tt.subject, tt.action, tt.resource); can != (tt.want == nil) {
+				t.Errorf("Can = %v, want %v", can, tt.want == nil)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"api/catshelter/internal/domain"
+	"api/catshelter/internal/repository"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"log/slog"
+	"time"
+)
+
+const (
+	MaxAvatarSize      = 2 << 20
+	maxAvatarDimension = 4096
+)
+
+var (
+	ErrLoginAlreadyUsed = errors.New("login is already used by another account")
+	ErrInvalidAvatar    = fmt.Errorf("%w: avatar must be a PNG, JPEG or GIF image of at most 2 MiB and %dx%d pixels", domain.ErrValidation, maxAvatarDimension, maxAvatarDimension)
+)
+
+// ProfileUpdate holds the fields to change; nil fields are left alone and an
+// empty email or phone removes it.
+type ProfileUpdate struct {
+	Name  *string
+	Login *string
+	Email *string
+	Phone *string
+}
+
+type ProfileService interface {
+	Update(ctx context.Context, userId string, expectedVersion int64, update *ProfileUpdate) (*domain.User, bool, error)
+	SetAvatar(ctx context.Context, userId string, data []byte) error
+	Avatar(ctx context.Context, userId string) (*repository.Avatar, error)
+	DeleteAvatar(ctx context.Context, userId string) error
+}
+
+type profileServiceImpl struct {
+	userRepository   repository.UserRepository
+	avatarRepository repository.AvatarRepository
+	contactService   ContactService
+}
+
+// Update applies update if the profile is still at expectedVersion, so two
+// clients editing at once cannot silently overwrite each other. It reports
+// whether the login changed, in which case sessions have to be re-issued.
+func (p *profileServiceImpl) Update(ctx context.Context, userId string, expectedVersion int64, update *ProfileUpdate) (_ *domain.User, _ bool, err error) {
+	ctx, span := startSpan(ctx, "ProfileService.Update")
+	defer func() { endSpan(span, err) }()
+
+	user, err := p.userRepository.FindByIdWithRoles(ctx, userId)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, false, fmt.Errorf("%w: user with id '%s' not found", repository.ErrUserNotFound, userId)
+		}
+		return nil, false, err
+	}
+	if user.Version != expectedVersion {
+		return nil, false, repository.ErrVersionConflict
+	}
+
+	if update.Name != nil {
+		if err := user.Rename(*update.Name); err != nil {
+			return nil, false, err
+		}
+	}
+
+	loginChanged := false
+	if update.Login != nil && *update.Login != user.Login {
+		other, err := p.userRepository.FindByLogin(ctx, *update.Login)
+		if err != nil && !errors.Is(err, repository.ErrUserNotFound) {
+			return nil, false, fmt.Errorf("db error: %w", err)
+		}
+		if other != nil {
+			return nil, false, ErrLoginAlreadyUsed
+		}
+		if err := user.ChangeLogin(*update.Login); err != nil {
+			return nil, false, err
+		}
+		loginChanged = true
+	}
+
+	previousEmail := user.Email
+	if update.Email != nil || update.Phone != nil {
+		email, phone := deref(user.Email), deref(user.Phone)
+		if update.Email != nil {
+			email = *update.Email
+		}
+		if update.Phone != nil {
+			phone = *update.Phone
+		}
+		if err := applyContacts(ctx, p.userRepository, user, email, phone); err != nil {
+			return nil, false, err
+		}
+	}
+
+	if err := p.userRepository.UpdateProfile(ctx, user, expectedVersion); err != nil {
+		if errors.Is(err, repository.ErrVersionConflict) {
+			return nil, false, err
+		}
+		if errors.Is(err, repository.ErrUserConflict) {
+			return nil, false, takenField(ctx, p.userRepository, user)
+		}
+		return nil, false, fmt.Errorf("db error: %w", err)
+	}
+
+	if user.Email != nil && (previousEmail == nil || *previousEmail != *user.Email) {
+		if err := p.contactService.SendVerification(ctx, user.Id); err != nil {
+			slog.ErrorContext(ctx, "failed to send verification mail", "target_user_id", user.Id, "error", err)
+		}
+	}
+	return user, loginChanged, nil
+}
+
+func (p *profileServiceImpl) SetAvatar(ctx context.Context, userId string, data []byte) (err error) {
+	ctx, span := startSpan(ctx, "ProfileService.SetAvatar")
+	defer func() { endSpan(span, err) }()
+
+	if len(data) == 0 || len(data) > MaxAvatarSize {
+		return ErrInvalidAvatar
+	}
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || config.Width > maxAvatarDimension || config.Height > maxAvatarDimension {
+		return ErrInvalidAvatar
+	}
+
+	avatar := &repository.Avatar{
+		UserId:      userId,
+		ContentType: "image/" + format,
+		Data:        data,
+		UpdatedAt:   time.Now(),
+	}
+	if err := p.avatarRepository.Save(ctx, avatar); err != nil {
+		return fmt.Errorf("db error: %w", err)
+	}
+	return nil
+}
+
+func (p *profileServiceImpl) Avatar(ctx context.Context, userId string) (_ *repository.Avatar, err error) {
+	ctx, span := startSpan(ctx, "ProfileService.Avatar")
+	defer func() { endSpan(span, err) }()
+
+	avatar, err := p.avatarRepository.FindByUserId(ctx, userId)
+	if err != nil {
+		if errors.Is(err, repository.ErrAvatarNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("db error: %w", err)
+	}
+	return avatar, nil
+}
+
+func (p *profileServiceImpl) DeleteAvatar(ctx context.Context, userId string) (err error) {
+	ctx, span := startSpan(ctx, "ProfileService.DeleteAvatar")
+	defer func() { endSpan(span, err) }()
+
+	if err := p.avatarRepository.DeleteByUserId(ctx, userId); err != nil {
+		return fmt.Errorf("db error: %w", err)
+	}
+	return nil
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func NewProfileService(userRepository repository.UserRepository, avatarRepository repository.AvatarRepository, contactService ContactService) ProfileService {
+	return &profileServiceImpl{userRepository: userRepository, avatarRepository: avatarRepository, contactService: contactService}
+}
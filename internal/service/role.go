@@ -0,0 +1,279 @@
+package service
+
+import (
+	"api/catshelter/internal/domain"
+	"api/catshelter/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrRoleAlreadyExists = errors.New("role already exists")
+	ErrRoleInUse         = errors.New("role is in use")
+)
+
+// Access is what a user may do: their roles including inherited ones and the
+// permissions those roles grant.
+type Access struct {
+	Roles       []string
+	Permissions []string
+}
+
+type RoleSummary struct {
+	Role         *domain.Role
+	InheritsFrom string
+	UserCount    int64
+}
+
+type RoleUpdate struct {
+	Name         *string
+	Description  *string
+	InheritsFrom *string
+	Permissions  *[]string
+}
+
+type RoleService interface {
+	ResolveAccess(ctx context.Context, user *domain.User) (*Access, error)
+	List(ctx context.Context) ([]*RoleSummary, error)
+	Create(ctx context.Context, name, description, inheritsFrom string, permissions []string) (*RoleSummary, error)
+	Update(ctx context.Context, name string, update *RoleUpdate) (*RoleSummary, error)
+	Delete(ctx context.Context, name, reassignTo string) error
+}
+
+type roleServiceImpl struct {
+	roleRepository       repository.RoleRepository
+	permissionRepository repository.PermissionRepository
+}
+
+func (s *roleServiceImpl) ResolveAccess(ctx context.Context, user *domain.User) (_ *Access, err error) {
+	ctx, span := startSpan(ctx, "RoleService.ResolveAccess")
+	defer func() { endSpan(span, err) }()
+
+	all, err := s.roleRepository.FindAllWithPermissions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("db error: %w", err)
+	}
+
+	effective := domain.EffectiveRoles(user.Roles, all)
+	return &Access{
+		Roles:       domain.RoleNames(effective),
+		Permissions: domain.PermissionNames(effective),
+	}, nil
+}
+
+func (s *roleServiceImpl) List(ctx context.Context) (_ []*RoleSummary, err error) {
+	ctx, span := startSpan(ctx, "RoleService.List")
+	defer func() { endSpan(span, err) }()
+
+	all, err := s.roleRepository.FindAllWithPermissions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("db error: %w", err)
+	}
+
+	names := make(map[string]string, len(all))
+	for _, role := range all {
+		names[role.Id] = role.Name
+	}
+
+	summaries := make([]*RoleSummary, 0, len(all))
+	for _, role := range all {
+		count, err := s.roleRepository.CountUsers(ctx, role.Id)
+		if err != nil {
+			return nil, fmt.Errorf("db error: %w", err)
+		}
+		summary := &RoleSummary{Role: role, UserCount: count}
+		if role.InheritsFromId != nil {
+			summary.InheritsFrom = names[*role.InheritsFromId]
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, nil
+}
+
+func (s *roleServiceImpl) Create(ctx context.Context, name, description, inheritsFrom string, permissions []string) (_ *RoleSummary, err error) {
+	ctx, span := startSpan(ctx, "RoleService.Create")
+	defer func() { endSpan(span, err) }()
+
+	name = strings.ToLower(strings.TrimSpace(name))
+	if err := domain.ValidateRoleName(name); err != nil {
+		return nil, err
+	}
+	if _, err := s.roleRepository.FindByName(ctx, name); err == nil {
+		return nil, fmt.Errorf("%w: '%s'", ErrRoleAlreadyExists, name)
+	} else if !errors.Is(err, repository.ErrRoleNotFound) {
+		return nil, fmt.Errorf("db error: %w", err)
+	}
+
+	role, err := domain.NewRole(name)
+	if err != nil {
+		return nil, err
+	}
+	role.Description = description
+	err = s.applyUpdate(ctx, role, &RoleUpdate{InheritsFrom: &inheritsFrom, Permissions: &permissions})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.roleRepository.UpdateWithPermissions(ctx, role); err != nil {
+		return nil, fmt.Errorf("db error: %w", err)
+	}
+	return s.summarize(ctx, role)
+}
+
+func (s *roleServiceImpl) Update(ctx context.Context, name string, update *RoleUpdate) (_ *RoleSummary, err error) {
+	ctx, span := startSpan(ctx, "RoleService.Update")
+	defer func() { endSpan(span, err) }()
+
+	role, err := s.findRole(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.Name != nil {
+		newName := strings.ToLower(strings.TrimSpace(*update.Name))
+		if !strings.EqualFold(newName, role.Name) {
+			if _, err := s.roleRepository.FindByName(ctx, newName); err == nil {
+				return nil, fmt.Errorf("%w: '%s'", ErrRoleAlreadyExists, newName)
+			} else if !errors.Is(err, repository.ErrRoleNotFound) {
+				return nil, fmt.Errorf("db error: %w", err)
+			}
+		}
+		if err := role.Rename(newName); err != nil {
+			return nil, err
+		}
+	}
+	if update.Description != nil {
+		role.Description = *update.Description
+	}
+	if err := s.applyUpdate(ctx, role, update); err != nil {
+		return nil, err
+	}
+
+	if err := s.roleRepository.UpdateWithPermissions(ctx, role); err != nil {
+		return nil, fmt.Errorf("db error: %w", err)
+	}
+	return s.summarize(ctx, role)
+}
+
+// Delete refuses to remove built-in roles and roles others inherit from.
+// Roles still assigned to users are only deleted when reassignTo names the
+// role those users should get instead.
+func (s *roleServiceImpl) Delete(ctx context.Context, name, reassignTo string) (err error) {
+	ctx, span := startSpan(ctx, "RoleService.Delete")
+	defer func() { endSpan(span, err) }()
+
+	role, err := s.findRole(ctx, name)
+	if err != nil {
+		return err
+	}
+	if role.IsBuiltin() {
+		return domain.ErrBuiltinRole
+	}
+
+	all, err := s.roleRepository.FindAllWithPermissions(ctx)
+	if err != nil {
+		return fmt.Errorf("db error: %w", err)
+	}
+	for _, other := range all {
+		if other.InheritsFromId != nil && *other.InheritsFromId == role.Id {
+			return fmt.Errorf("%w: role '%s' inherits from it", ErrRoleInUse, other.Name)
+		}
+	}
+
+	var target *domain.Role
+	if reassignTo != "" {
+		target, err = s.findRole(ctx, reassignTo)
+		if err != nil {
+			return err
+		}
+		if target.Id == role.Id {
+			return fmt.Errorf("%w: cannot reassign users to the role being deleted", domain.ErrValidation)
+		}
+	} else {
+		count, err := s.roleRepository.CountUsers(ctx, role.Id)
+		if err != nil {
+			return fmt.Errorf("db error: %w", err)
+		}
+		if count > 0 {
+			return fmt.Errorf("%w: assigned to %d users, pass a role to reassign them to", ErrRoleInUse, count)
+		}
+	}
+
+	if err := s.roleRepository.Delete(ctx, role, target); err != nil {
+		return fmt.Errorf("db error: %w", err)
+	}
+	return nil
+}
+
+func (s *roleServiceImpl) summarize(ctx context.Context, role *domain.Role) (*RoleSummary, error) {
+	count, err := s.roleRepository.CountUsers(ctx, role.Id)
+	if err != nil {
+		return nil, fmt.Errorf("db error: %w", err)
+	}
+	summary := &RoleSummary{Role: role, UserCount: count}
+	if role.InheritsFromId != nil {
+		all, err := s.roleRepository.FindAllWithPermissions(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("db error: %w", err)
+		}
+		for _, other := range all {
+			if other.Id == *role.InheritsFromId {
+				summary.InheritsFrom = other.Name
+			}
+		}
+	}
+	return summary, nil
+}
+
+func (s *roleServiceImpl) applyUpdate(ctx context.Context, role *domain.Role, update *RoleUpdate) error {
+	if update.InheritsFrom != nil {
+		var parent *domain.Role
+		if *update.InheritsFrom != "" {
+			var err error
+			parent, err = s.findRole(ctx, *update.InheritsFrom)
+			if err != nil {
+				return err
+			}
+		}
+		all, err := s.roleRepository.FindAllWithPermissions(ctx)
+		if err != nil {
+			return fmt.Errorf("db error: %w", err)
+		}
+		if err := role.InheritFrom(parent, all); err != nil {
+			return err
+		}
+	}
+
+	if update.Permissions != nil {
+		permissions := make([]*domain.Permission, 0, len(*update.Permissions))
+		for _, name := range *update.Permissions {
+			permission, err := s.permissionRepository.FindByName(ctx, name)
+			if err != nil {
+				if errors.Is(err, repository.ErrPermissionNotFound) {
+					return fmt.Errorf("%w: permission '%s' not found", repository.ErrPermissionNotFound, name)
+				}
+				return fmt.Errorf("db error: %w", err)
+			}
+			permissions = append(permissions, permission)
+		}
+		role.Permissions = permissions
+	}
+	return nil
+}
+
+func (s *roleServiceImpl) findRole(ctx context.Context, name string) (*domain.Role, error) {
+	role, err := s.roleRepository.FindByName(ctx, name)
+	if err != nil {
+		if errors.Is(err, repository.ErrRoleNotFound) {
+			return nil, fmt.Errorf("%w: role with name '%s' not found", repository.ErrRoleNotFound, name)
+		}
+		return nil, err
+	}
+	return role, nil
+}
+
+func NewRoleService(roleRepository repository.RoleRepository, permissionRepository repository.PermissionRepository) RoleService {
+	return &roleServiceImpl{roleRepository: roleRepository, permissionRepository: permissionRepository}
+}
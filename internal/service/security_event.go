@@ -0,0 +1,37 @@
+package service
+
+import (
+	"api/catshelter/internal/repository"
+	"context"
+	"log/slog"
+)
+
+const (
+	SecurityEventLoginSucceeded         = "login_succeeded"
+	SecurityEventLoginFailed            = "login_failed"
+	SecurityEventLoginThrottled         = "login_throttled"
+	SecurityEventAccountLocked          = "account_locked"
+	SecurityEventAccountUnlocked        = "account_unlocked"
+	SecurityEventMfaEnabled             = "mfa_enabled"
+	SecurityEventMfaDisabled            = "mfa_disabled"
+	SecurityEventMfaFailed              = "mfa_failed"
+	SecurityEventMfaRecoveryCodeUsed    = "mfa_recovery_code_used"
+	SecurityEventPasswordChanged        = "password_changed"
+	SecurityEventPasswordResetRequested = "password_reset_requested"
+	SecurityEventPasswordReset          = "password_reset"
+	SecurityEventExternalIdentityLinked = "external_identity_linked"
+	SecurityEventApiKeyCreated          = "api_key_created"
+	SecurityEventApiKeyRevoked          = "api_key_revoked"
+)
+
+// recordSecurityEvent never fails the caller: losing an event must not block a
+// login, so storage errors are only logged.
+func recordSecurityEvent(ctx context.Context, r repository.SecurityEventRepository, event *repository.SecurityEvent) {
+	slog.InfoContext(ctx, "security event", "event", event.Type, "login", event.Login, "ip", event.Ip, "details", event.Details)
+	if r == nil {
+		return
+	}
+	if err := r.Save(ctx, event); err != nil {
+		slog.ErrorContext(ctx, "failed to save security event", "event", event.Type, "error", err)
+	}
+}
@@ -2,10 +2,12 @@ package service
 
 import (
 	"api/catshelter/internal/domain"
+	"api/catshelter/internal/metrics"
 	"api/catshelter/internal/repository"
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
 	"time"
 
 	"github.com/go-chi/jwtauth/v5"
@@ -13,32 +15,43 @@ import (
 )
 
 type TokenService interface {
-	CreateSession(ctx context.Context, user *domain.User) (*SessionTokens, error)
+	CreateSession(ctx context.Context, user *domain.User, mfaVerified bool) (*SessionTokens, error)
 	UpdateSession(ctx context.Context, refreshToken string) (*SessionTokens, error)
 	DeleteRefreshToken(ctx context.Context, token string) error
 	DeleteAllRefreshTokens(ctx context.Context, userId string) error
 }
 
+// ErrRefreshTokenExpired is returned for a refresh token that exists but is
+// past its expiry.
+var ErrRefreshTokenExpired = errors.New("refresh token is expired")
+
 type SessionTokens struct {
 	AccessToken  *TokenDetails
 	RefreshToken *TokenDetails
 }
 
 type TokenDetails struct {
-	Id        string
-	Token     string
-	ExpiresAt time.Time
-	UserId    string
+	Id          string
+	Token       string
+	ExpiresAt   time.Time
+	UserId      string
+	MfaVerified bool
 }
 
 type tokenServiceImpl struct {
 	auth                   *jwtauth.JWTAuth
 	refreshTokenRepository repository.RefreshTokenRepository
 	userRepository         repository.UserRepository
+	roleService            RoleService
+	accessTokenTTL         time.Duration
+	refreshTokenTTL        time.Duration
 }
 
-func (s *tokenServiceImpl) DeleteAllRefreshTokens(ctx context.Context, userId string) error {
-	err := s.refreshTokenRepository.DeleteByUserId(ctx, userId)
+func (s *tokenServiceImpl) DeleteAllRefreshTokens(ctx context.Context, userId string) (err error) {
+	ctx, span := startSpan(ctx, "TokenService.DeleteAllRefreshTokens")
+	defer func() { endSpan(span, err) }()
+
+	err = s.refreshTokenRepository.DeleteByUserId(ctx, userId)
 	if err != nil {
 		if errors.Is(err, repository.ErrUserNotFound) {
 			return fmt.Errorf("%w: user with id '%s' not found", repository.ErrUserNotFound, userId)
@@ -48,48 +61,99 @@ func (s *tokenServiceImpl) DeleteAllRefreshTokens(ctx context.Context, userId st
 	return nil
 }
 
-func (s *tokenServiceImpl) DeleteRefreshToken(ctx context.Context, token string) error {
-	err := s.refreshTokenRepository.DeleteByToken(ctx, token)
+func (s *tokenServiceImpl) DeleteRefreshToken(ctx context.Context, token string) (err error) {
+	ctx, span := startSpan(ctx, "TokenService.DeleteRefreshToken")
+	defer func() { endSpan(span, err) }()
+
+	err = s.refreshTokenRepository.DeleteByToken(ctx, token)
 	if err != nil {
 		if errors.Is(err, repository.ErrRefreshTokenNotFound) {
-			return fmt.Errorf("%w: refresh token '%s' not found", repository.ErrRefreshTokenNotFound, token)
+			return repository.ErrRefreshTokenNotFound
 		}
 		return err
 	}
 	return nil
 }
 
-func (s *tokenServiceImpl) UpdateSession(ctx context.Context, refreshToken string) (*SessionTokens, error) {
+func (s *tokenServiceImpl) UpdateSession(ctx context.Context, refreshToken string) (_ *SessionTokens, err error) {
+	ctx, span := startSpan(ctx, "TokenService.UpdateSession")
+	defer func() { endSpan(span, err) }()
+
 	token, err := s.findRefreshTokenByToken(ctx, refreshToken)
 	if err != nil {
+		if errors.Is(err, repository.ErrRefreshTokenNotFound) {
+			return nil, s.refreshTokenNotFound(ctx, refreshToken)
+		}
 		return nil, err
 	}
 
 	if token.ExpiresAt.Before(time.Now()) {
-		return nil, errors.New("refresh token is expired")
+		metrics.TokenRefreshes.WithLabelValues(metrics.RefreshExpired).Inc()
+		return nil, ErrRefreshTokenExpired
 	}
 
 	user, err := s.userRepository.FindByIdWithRoles(ctx, token.UserId)
 	if err != nil {
-		return nil, fmt.Errorf("db error: %s", err.Error())
+		return nil, fmt.Errorf("db error: %w", err)
+	}
+	if err := checkActive(ctx, s.userRepository, user); err != nil {
+		if delErr := s.refreshTokenRepository.DeleteByToken(ctx, refreshToken); delErr != nil {
+			return nil, delErr
+		}
+		return nil, err
 	}
 
-	sessionTokens, err := s.generateSessionTokens(ctx, user)
+	sessionTokens, err := s.generateSessionTokens(ctx, user, token.MfaVerified)
 	if err != nil {
 		return nil, err
 	}
 
 	token.Token = sessionTokens.RefreshToken.Token
-	err = s.saveRefreshToken(ctx, &TokenDetails{Id: token.Id, Token: token.Token, UserId: token.UserId, ExpiresAt: sessionTokens.RefreshToken.ExpiresAt})
-	if err != nil {
-		return nil, err
+	token.ExpiresAt = sessionTokens.RefreshToken.ExpiresAt
+	if err := s.refreshTokenRepository.Rotate(ctx, token, refreshToken); err != nil {
+		if errors.Is(err, repository.ErrRefreshTokenNotFound) {
+			return nil, s.refreshTokenNotFound(ctx, refreshToken)
+		}
+		return nil, fmt.Errorf("DB error: %w", err)
 	}
+	metrics.TokenRefreshes.WithLabelValues(metrics.RefreshSucceeded).Inc()
 
 	return sessionTokens, nil
 }
 
-func (s *tokenServiceImpl) CreateSession(ctx context.Context, user *domain.User) (*SessionTokens, error) {
-	sessionTokens, err := s.generateSessionTokens(ctx, user)
+// refreshTokenNotFound tells a token that was already rotated away from an
+// unknown one. Presenting a rotated token means it leaked, or a client
+// refreshed twice with it; either way the session it belonged to is ended.
+func (s *tokenServiceImpl) refreshTokenNotFound(ctx context.Context, refreshToken string) error {
+	rotated, err := s.refreshTokenRepository.FindRotated(ctx, refreshToken)
+	if err != nil {
+		if errors.Is(err, repository.ErrRefreshTokenNotFound) {
+			metrics.TokenRefreshes.WithLabelValues(metrics.RefreshInvalid).Inc()
+			return repository.ErrRefreshTokenNotFound
+		}
+		return fmt.Errorf("DB error: %w", err)
+	}
+
+	metrics.TokenRefreshes.WithLabelValues(metrics.RefreshReused).Inc()
+	slog.WarnContext(ctx, "rotated refresh token reused, ending its session", "session_id", rotated.SessionId)
+	err = s.refreshTokenRepository.DeleteById(ctx, rotated.SessionId)
+	if err != nil && !errors.Is(err, repository.ErrRefreshTokenNotFound) {
+		return fmt.Errorf("DB error: %w", err)
+	}
+	return repository.ErrRefreshTokenNotFound
+}
+
+// CreateSession and UpdateSession refuse users who are not active, so every
+// sign-in method and every refresh honors suspensions, bans and deletions.
+func (s *tokenServiceImpl) CreateSession(ctx context.Context, user *domain.User, mfaVerified bool) (_ *SessionTokens, err error) {
+	ctx, span := startSpan(ctx, "TokenService.CreateSession")
+	defer func() { endSpan(span, err) }()
+
+	if err := checkActive(ctx, s.userRepository, user); err != nil {
+		return nil, err
+	}
+
+	sessionTokens, err := s.generateSessionTokens(ctx, user, mfaVerified)
 	if err != nil {
 		return nil, err
 	}
@@ -106,7 +170,7 @@ func (s *tokenServiceImpl) findRefreshTokenByToken(ctx context.Context, token st
 	refToken, err := s.refreshTokenRepository.FindByToken(ctx, token)
 	if err != nil {
 		if errors.Is(err, repository.ErrRefreshTokenNotFound) {
-			return nil, fmt.Errorf("%w: refresh token '%s' not found", repository.ErrRefreshTokenNotFound, token)
+			return nil, repository.ErrRefreshTokenNotFound
 		}
 		return nil, err
 	}
@@ -115,10 +179,11 @@ func (s *tokenServiceImpl) findRefreshTokenByToken(ctx context.Context, token st
 
 func (s *tokenServiceImpl) saveRefreshToken(ctx context.Context, token *TokenDetails) error {
 	refreshToken := &repository.RefreshToken{
-		Id:        token.Id,
-		Token:     token.Token,
-		UserId:    token.UserId,
-		ExpiresAt: token.ExpiresAt,
+		Id:          token.Id,
+		Token:       token.Token,
+		UserId:      token.UserId,
+		ExpiresAt:   token.ExpiresAt,
+		MfaVerified: token.MfaVerified,
 	}
 
 	err := s.refreshTokenRepository.Save(ctx, refreshToken)
@@ -129,16 +194,16 @@ func (s *tokenServiceImpl) saveRefreshToken(ctx context.Context, token *TokenDet
 	return nil
 }
 
-func NewTokenService(auth *jwtauth.JWTAuth, refreshTokenRepository repository.RefreshTokenRepository, userRepository repository.UserRepository) TokenService {
-	return &tokenServiceImpl{auth: auth, refreshTokenRepository: refreshTokenRepository, userRepository: userRepository}
+func NewTokenService(auth *jwtauth.JWTAuth, refreshTokenRepository repository.RefreshTokenRepository, userRepository repository.UserRepository, roleService RoleService, accessTokenTTL, refreshTokenTTL time.Duration) TokenService {
+	return &tokenServiceImpl{auth: auth, refreshTokenRepository: refreshTokenRepository, userRepository: userRepository, roleService: roleService, accessTokenTTL: accessTokenTTL, refreshTokenTTL: refreshTokenTTL}
 }
 
-func (s *tokenServiceImpl) generateSessionTokens(ctx context.Context, user *domain.User) (*SessionTokens, error) {
-	accessToken, err := s.generateAccessToken(ctx, user)
+func (s *tokenServiceImpl) generateSessionTokens(ctx context.Context, user *domain.User, mfaVerified bool) (*SessionTokens, error) {
+	accessToken, err := s.generateAccessToken(ctx, user, mfaVerified)
 	if err != nil {
 		return nil, fmt.Errorf("generating access token: %w", err)
 	}
-	refreshTolen, err := s.generateRefreshToken(ctx, user)
+	refreshTolen, err := s.generateRefreshToken(ctx, user, mfaVerified)
 	if err != nil {
 		return nil, fmt.Errorf("generating refresh token: %w", err)
 	}
@@ -149,20 +214,23 @@ func (s *tokenServiceImpl) generateSessionTokens(ctx context.Context, user *doma
 	}, nil
 }
 
-func (s *tokenServiceImpl) generateAccessToken(ctx context.Context, user *domain.User) (*TokenDetails, error) {
+func (s *tokenServiceImpl) generateAccessToken(ctx context.Context, user *domain.User, mfaVerified bool) (*TokenDetails, error) {
 	select {
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	default:
-		exp := time.Now().Add(15 * time.Minute)
-		roles := make([]string, 0, len(user.Roles))
-		for _, role := range user.Roles {
-			roles = append(roles, role.Name)
+		access, err := s.roleService.ResolveAccess(ctx, user)
+		if err != nil {
+			return nil, err
 		}
+
+		exp := time.Now().Add(s.accessTokenTTL)
 		claims := map[string]interface{}{
-			"user_id": user.Id,
-			"roles":   roles,
-			"exp":     exp.Unix(),
+			"user_id":     user.Id,
+			"roles":       access.Roles,
+			"permissions": access.Permissions,
+			"mfa":         mfaVerified,
+			"exp":         exp.Unix(),
 		}
 
 		_, tokenString, err := s.auth.Encode(claims)
@@ -177,15 +245,16 @@ func (s *tokenServiceImpl) generateAccessToken(ctx context.Context, user *domain
 	}
 }
 
-func (s *tokenServiceImpl) generateRefreshToken(ctx context.Context, user *domain.User) (*TokenDetails, error) {
+func (s *tokenServiceImpl) generateRefreshToken(ctx context.Context, user *domain.User, mfaVerified bool) (*TokenDetails, error) {
 	select {
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	default:
 		return &TokenDetails{
-			Token:     uuid.NewString(),
-			UserId:    user.Id,
-			ExpiresAt: time.Now().Add(24 * time.Hour * 30),
+			Token:       uuid.NewString(),
+			UserId:      user.Id,
+			ExpiresAt:   time.Now().Add(s.refreshTokenTTL),
+			MfaVerified: mfaVerified,
 		}, nil
 	}
 }
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"api/catshelter/internal/domain"
+	"api/catshelter/internal/metrics"
+	"api/catshelter/internal/repository"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type fakeRoleService struct {
+	RoleService
+}
+
+func (fakeRoleService) ResolveAccess(ctx context.Context, user *domain.User) (*Access, error) {
+	return &Access{Roles: []string{"user"}}, nil
+}
+
+func TestUpdateSessionDetectsReusedRefreshToken(t *testing.T) {
+	ctx := context.Background()
+	user, err := domain.NewUser("murka_cat", "password", "Murka")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions := &fakeRefreshTokenRepository{}
+	service := NewTokenService(jwtauth.New("HS256", []byte("token test secret"), nil), sessions, newFakeUserRepository(user),
+		fakeRoleService{}, time.Minute, time.Hour)
+	refreshes := func(result string) float64 {
+		return testutil.ToFloat64(metrics.TokenRefreshes.WithLabelValues(result))
+	}
+	reused, invalid := refreshes(metrics.RefreshReused), refreshes(metrics.RefreshInvalid)
+
+	created, err := service.CreateSession(ctx, user, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := service.UpdateSession(ctx, created.RefreshToken.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := service.UpdateSession(ctx, created.RefreshToken.Token); !errors.Is(err, repository.ErrRefreshTokenNotFound) {
+		t.Fatalf("reusing a rotated token = %v, want %v", err, repository.ErrRefreshTokenNotFound)
+	}
+	if got := refreshes(metrics.RefreshReused) - reused; got != 1 {
+		t.Errorf("%v refreshes counted as reused, want 1", got)
+	}
+	if _, err := service.UpdateSession(ctx, rotated.RefreshToken.Token); !errors.Is(err, repository.ErrRefreshTokenNotFound) {
+		t.Errorf("refreshing the session after reuse = %v, want it ended", err)
+	}
+
+	if _, err := service.UpdateSession(ctx, "never issued"); !errors.Is(err, repository.ErrRefreshTokenNotFound) {
+		t.Fatalf("unknown token = %v, want %v", err, repository.ErrRefreshTokenNotFound)
+	}
+	if got := refreshes(metrics.RefreshInvalid) - invalid; got != 2 {
+		t.Errorf("%v refreshes counted as invalid, want 2", got)
+	}
+	if got := refreshes(metrics.RefreshReused) - reused; got != 1 {
+		t.Errorf("%v refreshes counted as reused, want still 1", got)
+	}
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"context"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("api/catshelter/internal/service")
+
+// startSpan starts the span of a service method, named like
+// "CatService.AddCat". End it with endSpan.
+func startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name)
+}
+
+// endSpan records the error the method returned, if any, and ends span.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// detachContext returns a context for work that outlives the request of ctx.
+// It keeps the request id and the trace, so logs and spans still lead back to
+// the request, but drops its cancellation and other values, which the router
+// recycles once the response is written.
+func detachContext(ctx context.Context) context.Context {
+	detached := trace.ContextWithSpanContext(context.Background(), trace.SpanContextFromContext(ctx))
+	if requestId := middleware.GetReqID(ctx); requestId != "" {
+		detached = context.WithValue(detached, middleware.RequestIDKey, requestId)
+	}
+	return detached
+}
@@ -2,10 +2,13 @@ package service
 
 import (
 	"api/catshelter/internal/domain"
+	"api/catshelter/internal/handler/dto"
+	"api/catshelter/internal/metrics"
 	"api/catshelter/internal/repository"
 	"context"
 	"errors"
 	"fmt"
+	"time"
 )
 
 type UserService interface {
@@ -15,15 +18,163 @@ type UserService interface {
 	AdoptCat(ctx context.Context, catId, userId string) error
 	AddRole(ctx context.Context, userId, roleName string) error
 	RemoveRole(ctx context.Context, userId, roleName string) error
+	Search(ctx context.Context, search *repository.UserSearch, page, pageSize int) ([]*domain.User, *dto.PaginationResult, error)
+	BulkAssignRole(ctx context.Context, userIds []string, roleName string) (int, error)
+	BulkSuspend(ctx context.Context, actorId string, userIds []string, reason string, until *time.Time) error
 }
 
+const maxBulkUsers = 500
+
 type userServiceImpl struct {
-	userRepository repository.UserRepository
-	catRepository  repository.CatRepository
-	roleRepository repository.RoleRepository
+	userRepository         repository.UserRepository
+	refreshTokenRepository repository.RefreshTokenRepository
+	catRepository          repository.CatRepository
+	roleRepository         repository.RoleRepository
+	transactor             repository.Transactor
+	auditLogRepository     repository.AuditLogRepository
+}
+
+func (u *userServiceImpl) Search(ctx context.Context, search *repository.UserSearch, page, pageSize int) (_ []*domain.User, _ *dto.PaginationResult, err error) {
+	ctx, span := startSpan(ctx, "UserService.Search")
+	defer func() { endSpan(span, err) }()
+
+	users, count, err := u.userRepository.Search(ctx, search, page, pageSize)
+	if err != nil {
+		return nil, nil, fmt.Errorf("DB error: %w", err)
+	}
+	// Show run-out suspensions as lifted, as the status filter treats them.
+	for _, user := range users {
+		user.CheckActive()
+	}
+
+	paginationResult := repository.CalculatePaginationResult(page, pageSize, count)
+	return users, &paginationResult, nil
+}
+
+// BulkAssignRole grants roleName to every user in one transaction: either all
+// of them get it or, if any user is missing, none do. Users who already hold
+// the role are skipped; the number of users that got it is returned.
+func (u *userServiceImpl) BulkAssignRole(ctx context.Context, userIds []string, roleName string) (_ int, err error) {
+	ctx, span := startSpan(ctx, "UserService.BulkAssignRole")
+	defer func() { endSpan(span, err) }()
+
+	role, err := u.roleRepository.FindByName(ctx, roleName)
+	if err != nil {
+		if errors.Is(err, repository.ErrRoleNotFound) {
+			return 0, fmt.Errorf("%w: role with name '%s' not found", repository.ErrRoleNotFound, roleName)
+		}
+		return 0, err
+	}
+
+	assigned := 0
+	err = u.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		users, err := u.findUsersForBulk(ctx, userIds)
+		if err != nil {
+			return err
+		}
+
+		for _, user := range users {
+			before := domain.RoleNames(user.Roles)
+			if err := user.AddRole(role); err != nil {
+				continue
+			}
+			err := withAudit(ctx, u.transactor, u.auditLogRepository, func(ctx context.Context) (*AuditChange, error) {
+				if err := u.userRepository.ReplaceRoles(ctx, user); err != nil {
+					return nil, err
+				}
+				return &AuditChange{
+					Action:     AuditRoleGranted,
+					TargetType: "user",
+					TargetId:   user.Id,
+					Before:     map[string]any{"roles": before},
+					After:      map[string]any{"roles": domain.RoleNames(user.Roles)},
+				}, nil
+			})
+			if err != nil {
+				return err
+			}
+			assigned++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return assigned, nil
+}
+
+// BulkSuspend suspends every user and ends their sessions in one
+// transaction. Admins cannot suspend themselves.
+func (u *userServiceImpl) BulkSuspend(ctx context.Context, actorId string, userIds []string, reason string, until *time.Time) (err error) {
+	ctx, span := startSpan(ctx, "UserService.BulkSuspend")
+	defer func() { endSpan(span, err) }()
+
+	return u.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		users, err := u.findUsersForBulk(ctx, userIds)
+		if err != nil {
+			return err
+		}
+
+		for _, user := range users {
+			if user.Id == actorId {
+				return fmt.Errorf("%w: you cannot suspend yourself", domain.ErrValidation)
+			}
+			before := map[string]any{"status": user.Status}
+			if err := user.Suspend(reason, until); err != nil {
+				return err
+			}
+			err := withAudit(ctx, u.transactor, u.auditLogRepository, func(ctx context.Context) (*AuditChange, error) {
+				if err := u.userRepository.Update(ctx, user, statusColumns...); err != nil {
+					return nil, err
+				}
+				err := u.refreshTokenRepository.DeleteByUserId(ctx, user.Id)
+				if err != nil && !errors.Is(err, repository.ErrUserNotFound) {
+					return nil, err
+				}
+				return &AuditChange{
+					Action:     AuditUserSuspended,
+					TargetType: "user",
+					TargetId:   user.Id,
+					Before:     before,
+					After:      map[string]any{"status": user.Status, "reason": reason, "until": until},
+				}, nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (u *userServiceImpl) findUsersForBulk(ctx context.Context, userIds []string) ([]*domain.User, error) {
+	if len(userIds) == 0 {
+		return nil, fmt.Errorf("%w: no users given", domain.ErrValidation)
+	}
+	if len(userIds) > maxBulkUsers {
+		return nil, fmt.Errorf("%w: at most %d users can be changed at once", domain.ErrValidation, maxBulkUsers)
+	}
+
+	users, err := u.userRepository.FindByIdsWithRoles(ctx, userIds)
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[string]bool, len(users))
+	for _, user := range users {
+		found[user.Id] = true
+	}
+	for _, id := range userIds {
+		if !found[id] {
+			return nil, fmt.Errorf("%w: user with id '%s' not found", repository.ErrUserNotFound, id)
+		}
+	}
+	return users, nil
 }
 
-func (u *userServiceImpl) RemoveRole(ctx context.Context, userId string, roleName string) error {
+func (u *userServiceImpl) RemoveRole(ctx context.Context, userId string, roleName string) (err error) {
+	ctx, span := startSpan(ctx, "UserService.RemoveRole")
+	defer func() { endSpan(span, err) }()
+
 	user, err := u.userRepository.FindByIdWithRoles(ctx, userId)
 	if err != nil {
 		if errors.Is(err, repository.ErrUserNotFound) {
@@ -39,6 +190,7 @@ func (u *userServiceImpl) RemoveRole(ctx context.Context, userId string, roleNam
 		return err
 	}
 
+	before := domain.RoleNames(user.Roles)
 	err = user.RemoveRole(newRole)
 	if err != nil {
 		if errors.Is(err, domain.ErrValidation) {
@@ -50,14 +202,24 @@ func (u *userServiceImpl) RemoveRole(ctx context.Context, userId string, roleNam
 		return err
 	}
 
-	if err := u.userRepository.UpdateWithRoles(ctx, user); err != nil {
-		return err
-	}
-
-	return nil
+	return withAudit(ctx, u.transactor, u.auditLogRepository, func(ctx context.Context) (*AuditChange, error) {
+		if err := u.userRepository.ReplaceRoles(ctx, user); err != nil {
+			return nil, err
+		}
+		return &AuditChange{
+			Action:     AuditRoleRevoked,
+			TargetType: "user",
+			TargetId:   user.Id,
+			Before:     map[string]any{"roles": before},
+			After:      map[string]any{"roles": domain.RoleNames(user.Roles)},
+		}, nil
+	})
 }
 
-func (u *userServiceImpl) AddRole(ctx context.Context, userId, roleName string) error {
+func (u *userServiceImpl) AddRole(ctx context.Context, userId, roleName string) (err error) {
+	ctx, span := startSpan(ctx, "UserService.AddRole")
+	defer func() { endSpan(span, err) }()
+
 	user, err := u.userRepository.FindByIdWithRoles(ctx, userId)
 	if err != nil {
 		if errors.Is(err, repository.ErrUserNotFound) {
@@ -74,17 +236,29 @@ func (u *userServiceImpl) AddRole(ctx context.Context, userId, roleName string)
 		return err
 	}
 
+	before := domain.RoleNames(user.Roles)
 	if err := user.AddRole(newRole); err != nil {
 		return fmt.Errorf("%w: user already have role '%s'", err, roleName)
 	}
-	if err := u.userRepository.UpdateWithRoles(ctx, user); err != nil {
-		return err
-	}
 
-	return nil
+	return withAudit(ctx, u.transactor, u.auditLogRepository, func(ctx context.Context) (*AuditChange, error) {
+		if err := u.userRepository.ReplaceRoles(ctx, user); err != nil {
+			return nil, err
+		}
+		return &AuditChange{
+			Action:     AuditRoleGranted,
+			TargetType: "user",
+			TargetId:   user.Id,
+			Before:     map[string]any{"roles": before},
+			After:      map[string]any{"roles": domain.RoleNames(user.Roles)},
+		}, nil
+	})
 }
 
-func (u *userServiceImpl) FindByIdWithAll(ctx context.Context, userId string) (*domain.User, error) {
+func (u *userServiceImpl) FindByIdWithAll(ctx context.Context, userId string) (_ *domain.User, err error) {
+	ctx, span := startSpan(ctx, "UserService.FindByIdWithAll")
+	defer func() { endSpan(span, err) }()
+
 	user, err := u.userRepository.FindByIdWithAll(ctx, userId)
 	if err != nil {
 		if errors.Is(err, repository.ErrUserNotFound) {
@@ -96,7 +270,10 @@ func (u *userServiceImpl) FindByIdWithAll(ctx context.Context, userId string) (*
 	return user, nil
 }
 
-func (u *userServiceImpl) AdoptCat(ctx context.Context, catId, userId string) error {
+func (u *userServiceImpl) AdoptCat(ctx context.Context, catId, userId string) (err error) {
+	ctx, span := startSpan(ctx, "UserService.AdoptCat")
+	defer func() { endSpan(span, err) }()
+
 	cat, err := u.catRepository.FindById(ctx, catId)
 	if err != nil {
 		if errors.Is(err, repository.ErrCatNotFound) {
@@ -104,22 +281,41 @@ func (u *userServiceImpl) AdoptCat(ctx context.Context, catId, userId string) er
 		}
 		return err
 	}
-	_, err = u.FindById(ctx, userId)
+	user, err := u.FindById(ctx, userId)
 	if err != nil {
 		return err
 	}
+	if !user.IsEmailVerified() {
+		return domain.ErrEmailNotVerified
+	}
 	err = cat.AddUser(userId)
 	if err != nil {
 		return err
 	}
-	err = u.catRepository.Save(ctx, cat)
+
+	err = withAudit(ctx, u.transactor, u.auditLogRepository, func(ctx context.Context) (*AuditChange, error) {
+		if err := u.catRepository.Save(ctx, cat); err != nil {
+			return nil, err
+		}
+		return &AuditChange{
+			Action:     AuditCatAdopted,
+			TargetType: "cat",
+			TargetId:   cat.Id,
+			Before:     map[string]any{"owner_id": nil},
+			After:      map[string]any{"owner_id": userId},
+		}, nil
+	})
 	if err != nil {
 		return err
 	}
+	metrics.Adoptions.Inc()
 	return nil
 }
 
-func (u *userServiceImpl) FindById(ctx context.Context, id string) (*domain.User, error) {
+func (u *userServiceImpl) FindById(ctx context.Context, id string) (_ *domain.User, err error) {
+	ctx, span := startSpan(ctx, "UserService.FindById")
+	defer func() { endSpan(span, err) }()
+
 	user, err := u.userRepository.FindById(ctx, id)
 	if err != nil {
 		if err == repository.ErrUserNotFound {
@@ -130,7 +326,10 @@ func (u *userServiceImpl) FindById(ctx context.Context, id string) (*domain.User
 	return user, nil
 }
 
-func (u *userServiceImpl) FindByIdWithCats(ctx context.Context, id string) (*domain.User, error) {
+func (u *userServiceImpl) FindByIdWithCats(ctx context.Context, id string) (_ *domain.User, err error) {
+	ctx, span := startSpan(ctx, "UserService.FindByIdWithCats")
+	defer func() { endSpan(span, err) }()
+
 	userWithCats, err := u.userRepository.FindByIdWithCats(ctx, id)
 	if err != nil {
 		if err == repository.ErrUserNotFound {
@@ -141,6 +340,13 @@ func (u *userServiceImpl) FindByIdWithCats(ctx context.Context, id string) (*dom
 	return userWithCats, nil
 }
 
-func NewUserService(userRepository repository.UserRepository, catRepository repository.CatRepository, roleRepository repository.RoleRepository) UserService {
-	return &userServiceImpl{userRepository: userRepository, catRepository: catRepository, roleRepository: roleRepository}
+func NewUserService(userRepository repository.UserRepository, refreshTokenRepository repository.RefreshTokenRepository, catRepository repository.CatRepository, roleRepository repository.RoleRepository, transactor repository.Transactor, auditLogRepository repository.AuditLogRepository) UserService {
+	return &userServiceImpl{
+		userRepository:         userRepository,
+		refreshTokenRepository: refreshTokenRepository,
+		catRepository:          catRepository,
+		roleRepository:         roleRepository,
+		transactor:             transactor,
+		auditLogRepository:     auditLogRepository,
+	}
 }
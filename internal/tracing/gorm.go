@@ -0,0 +1,105 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const (
+	spanKey      = "tracing:span"
+	parentCtxKey = "tracing:parent_ctx"
+)
+
+var tracer = otel.Tracer("api/catshelter/internal/tracing")
+
+// registerer is implemented by the callback positions of GORM processors,
+// whose type is not exported.
+type registerer interface {
+	Register(name string, fn func(*gorm.DB)) error
+}
+
+// InstrumentDB adds a client span for every GORM statement. Preloads run as
+// statements of their own inside the span of the query that preloads them, so
+// a slow Preload shows up as a slow child span.
+func InstrumentDB(db *gorm.DB) error {
+	callbacks := db.Callback()
+	processors := []struct {
+		operation     string
+		before, after registerer
+	}{
+		{"create", callbacks.Create().Before("*"), callbacks.Create().After("*")},
+		{"query", callbacks.Query().Before("*"), callbacks.Query().After("*")},
+		{"update", callbacks.Update().Before("*"), callbacks.Update().After("*")},
+		{"delete", callbacks.Delete().Before("*"), callbacks.Delete().After("*")},
+		{"row", callbacks.Row().Before("*"), callbacks.Row().After("*")},
+		{"raw", callbacks.Raw().Before("*"), callbacks.Raw().After("*")},
+	}
+	for _, p := range processors {
+		operation := p.operation
+		err := p.before.Register("tracing:before_"+operation, func(tx *gorm.DB) {
+			before(tx, operation)
+		})
+		if err != nil {
+			return err
+		}
+		if err := p.after.Register("tracing:after_"+operation, after); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func before(tx *gorm.DB, operation string) {
+	parent := tx.Statement.Context
+	if parent == nil {
+		parent = context.Background()
+	}
+	name := "gorm." + operation
+	if tx.Statement.Table != "" {
+		name += " " + tx.Statement.Table
+	}
+
+	ctx, span := tracer.Start(parent, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBOperationName(operation),
+			semconv.DBCollectionName(tx.Statement.Table),
+		),
+	)
+	tx.InstanceSet(spanKey, span)
+	tx.InstanceSet(parentCtxKey, parent)
+	tx.Statement.Context = ctx
+}
+
+func after(tx *gorm.DB) {
+	value, ok := tx.InstanceGet(spanKey)
+	if !ok {
+		return
+	}
+	span, ok := value.(trace.Span)
+	if !ok {
+		return
+	}
+	if parent, ok := tx.InstanceGet(parentCtxKey); ok {
+		tx.Statement.Context = parent.(context.Context)
+	}
+
+	// The statement keeps its placeholders, so no values end up in traces.
+	span.SetAttributes(
+		semconv.DBQueryText(tx.Statement.SQL.String()),
+		attribute.Int64("db.rows_affected", tx.Statement.RowsAffected),
+	)
+	if tx.Error != nil && !errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		span.RecordError(tx.Error)
+		span.SetStatus(codes.Error, tx.Error.Error())
+	}
+	span.End()
+}